@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"go.uber.org/zap"
+
+	"roombooker/internal/config"
+	"roombooker/internal/http/handlers"
+	"roombooker/internal/repository"
+)
+
+const importUsage = `usage: server import-bookings -room <id> -as <email> [-commit] [-override] <file.ics>
+
+Books the events of an iCalendar export in a room. Without -commit it only
+reports what it would book and what it would skip, and why.`
+
+// runImportBookings implements the import-bookings subcommand
+func runImportBookings(ctx context.Context, out io.Writer, store repository.Store, cfg *config.Config, logger *zap.Logger, args []string) error {
+	fs := flag.NewFlagSet("import-bookings", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	roomID := fs.String("room", "", "id of the room to book")
+	as := fs.String("as", "", "email of the admin importing, who organises events whose organizer is not a user")
+	commit := fs.Bool("commit", false, "book the events rather than report what would be booked")
+	override := fs.Bool("override", false, "book events breaking the office's booking rules")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%v\n%s", err, importUsage)
+	}
+	if *roomID == "" || *as == "" || fs.NArg() != 1 {
+		return errors.New(importUsage)
+	}
+
+	user, err := store.GetUserByEmail(ctx, *as)
+	if err != nil {
+		return fmt.Errorf("import-bookings: user %s: %w", *as, err)
+	}
+	if user.Role != "admin" {
+		return fmt.Errorf("import-bookings: %s is not an admin", *as)
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := handlers.NewHandler(store, nil, nil, cfg, logger)
+	report, err := h.ImportBookings(ctx, f, handlers.BookingImportOptions{
+		RoomID:     *roomID,
+		ImportedBy: user.ID,
+		Commit:     *commit,
+		Override:   *override,
+	})
+	if report != nil {
+		if printErr := printImport(out, report); printErr != nil && err == nil {
+			err = printErr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("import-bookings: %w", err)
+	}
+	return nil
+}
+
+// printImport lists each event of an import with what became of it, then the
+// conflicts, rule violations and warnings behind it
+func printImport(out io.Writer, report *handlers.BookingImport) error {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tSTART\tOCCURRENCES\tTITLE\tUID")
+	for _, e := range report.Events {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", e.Status, e.Start, e.Occurrences, e.Title, e.UID)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, e := range report.Events {
+		var notes []string
+		if e.Reason != "" {
+			notes = append(notes, e.Reason)
+		}
+		for _, c := range e.Conflicts {
+			titles := make([]string, 0, len(c.Conflicts))
+			for _, b := range c.Conflicts {
+				titles = append(titles, fmt.Sprintf("%q", b.Title))
+			}
+			notes = append(notes, fmt.Sprintf("%s clashes with %s", c.Start, strings.Join(titles, ", ")))
+		}
+		for _, v := range e.Violations {
+			notes = append(notes, fmt.Sprintf("%s: %s", v.Occurrence, v.Message))
+		}
+		notes = append(notes, e.Warnings...)
+		if len(notes) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "\n%s (%s)\n", e.Title, e.UID)
+		for _, n := range notes {
+			fmt.Fprintf(out, "  %s\n", n)
+		}
+	}
+
+	booked, skipped := report.Counts()
+	if report.Committed {
+		fmt.Fprintf(out, "\nbooked %d, skipped %d\n", booked, skipped)
+	} else {
+		fmt.Fprintf(out, "\ndry run: would book %d, skip %d; run again with -commit to book them\n", booked, skipped)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	// Office timezones must resolve even in the alpine image, which ships no zone database
+	_ "time/tzdata"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"go.uber.org/zap"
+
+	"roombooker/internal/auth"
+	"roombooker/internal/config"
+	"roombooker/internal/http/handlers"
+	"roombooker/internal/msgraph"
+	"roombooker/internal/notify"
+	"roombooker/internal/repository"
+	"roombooker/internal/repository/memory"
+)
+
+func main() {
+	logger, err := zap.NewProduction()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to create logger:", err)
+		os.Exit(1)
+	}
+	defer logger.Sync()
+
+	if err := run(logger, os.Args[1:]); err != nil {
+		logger.Fatal("server exited with error", zap.Error(err))
+	}
+}
+
+// memoryDriver selects the in-process store instead of a SQL database
+const memoryDriver = "memory"
+
+func run(logger *zap.Logger, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	cmd := "serve"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+	if cmd != "serve" && cmd != "migrate" && cmd != "import-bookings" {
+		return fmt.Errorf("unknown command %q (expected serve, migrate or import-bookings)", cmd)
+	}
+
+	var store repository.Store
+	if cfg.Database.Driver == memoryDriver {
+		if cmd == "migrate" {
+			return errors.New("migrate: the memory driver has no schema to migrate")
+		}
+		if cmd == "import-bookings" {
+			return errors.New("import-bookings: the memory driver keeps nothing it imports")
+		}
+		mem := memory.New()
+		mem.SeedDemoData()
+		store = mem
+		logger.Warn("using the in-memory store with demo data; nothing is persisted")
+	} else {
+		db, err := openDB(cfg.Database)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		if cmd == "migrate" {
+			return runMigrate(context.Background(), os.Stdout, db, cfg.Database.Driver, args[1:])
+		}
+		if cfg.Database.AutoMigrate {
+			m, err := newMigrator(db, cfg.Database.Driver)
+			if err != nil {
+				return err
+			}
+			applied, err := m.Up(context.Background())
+			if err != nil {
+				return fmt.Errorf("auto-migrate: %w", err)
+			}
+			logger.Info("database schema up to date", zap.Ints("applied", applied), zap.Int("version", m.Latest()))
+		}
+		repo := repository.New(db, cfg.Database.Driver)
+		repo.SetQueryTimeout(cfg.Database.QueryTimeout)
+		store = repo
+
+		if cmd == "import-bookings" {
+			return runImportBookings(context.Background(), os.Stdout, store, cfg, logger, args[1:])
+		}
+	}
+
+	authService := auth.NewService(store, cfg)
+	graphClient, err := msgraph.NewClient(cfg)
+	if err != nil {
+		return fmt.Errorf("create graph client: %w", err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(middleware.RealIP)
+	r.Use(middleware.Logger)
+	r.Use(middleware.Recoverer)
+	r.Use(cors.Handler(cors.Options{
+		AllowedOrigins:   []string{cfg.App.BaseURL},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
+		AllowCredentials: true,
+	}))
+	h := handlers.SetupRoutes(r, store, authService, graphClient, cfg, logger)
+	if cfg.SMTP.Host != "" {
+		mailer, err := notify.NewSMTPNotifier(cfg.SMTP)
+		if err != nil {
+			return err
+		}
+		h.SetNotifier(mailer)
+		logger.Info("sending booking emails", zap.String("smtp_host", cfg.SMTP.Host))
+	}
+
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The scheduler runs until the signal, apart from the background work
+	// requests start, which shutdown waits for
+	reminders := make(chan struct{})
+	if cfg.App.ReminderInterval > 0 {
+		go func() {
+			defer close(reminders)
+			h.RunReminders(ctx, cfg.App.ReminderInterval)
+		}()
+	} else {
+		close(reminders)
+		logger.Info("not sending booking reminders; REMINDER_INTERVAL is 0")
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		logger.Info("server listening", zap.String("addr", srv.Addr), zap.String("driver", cfg.Database.Driver))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("listen: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+	}
+	stop()
+
+	logger.Info("shutting down", zap.Duration("timeout", cfg.Server.ShutdownTimeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	// Stop accepting requests and drain in-flight ones before waiting on background work,
+	// since requests may still be starting it
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("http shutdown incomplete", zap.Error(err))
+	}
+	if err := h.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("background work cancelled", zap.Error(err))
+	}
+	select {
+	case <-reminders:
+	case <-shutdownCtx.Done():
+		logger.Warn("booking reminders still sending at shutdown")
+	}
+	logger.Info("server stopped")
+	return nil
+}
+
+func openDB(cfg config.DatabaseConfig) (*sql.DB, error) {
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("open %s database: %w", cfg.Driver, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping %s database: %w", cfg.Driver, err)
+	}
+	return db, nil
+}
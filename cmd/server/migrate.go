@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"roombooker/internal/migrate"
+	"roombooker/migrations"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  up           apply all pending migrations
+  down [n]     revert the last n applied migrations (default 1)
+  status       list migrations and whether they are applied
+  goto <v>     migrate up or down to version v (0 reverts everything)`
+
+// newMigrator picks the migration set written for the configured driver
+func newMigrator(db *sql.DB, driver string) (*migrate.Migrator, error) {
+	fsys, err := migrations.ForDriver(driver)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, driver, fsys)
+}
+
+// runMigrate implements the migrate subcommand
+func runMigrate(ctx context.Context, out io.Writer, db *sql.DB, driver string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", migrateUsage)
+	}
+	m, err := newMigrator(db, driver)
+	if err != nil {
+		return err
+	}
+
+	var done []int
+	switch args[0] {
+	case "up":
+		done, err = m.Up(ctx)
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				return fmt.Errorf("down: invalid count %q", args[1])
+			}
+		}
+		done, err = m.Down(ctx, n)
+	case "goto":
+		if len(args) < 2 {
+			return fmt.Errorf("goto: version required")
+		}
+		v, convErr := strconv.Atoi(args[1])
+		if convErr != nil || v < 0 {
+			return fmt.Errorf("goto: invalid version %q", args[1])
+		}
+		done, err = m.Goto(ctx, v)
+	case "status":
+		return printStatus(ctx, out, m)
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], migrateUsage)
+	}
+
+	for _, v := range done {
+		fmt.Fprintf(out, "migrated %06d\n", v)
+	}
+	if err != nil {
+		return err
+	}
+	if len(done) == 0 {
+		fmt.Fprintln(out, "no change")
+	}
+	return nil
+}
+
+func printStatus(ctx context.Context, out io.Writer, m *migrate.Migrator) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.Applied {
+			applied = s.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(tw, "%06d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return tw.Flush()
+}
@@ -13,12 +13,12 @@ import (
 )
 
 type Service struct {
-	repo    *repository.Repository
+	repo    repository.UserStore
 	config  *config.Config
 	jwtAuth *jwtauth.JWTAuth
 }
 
-func NewService(repo *repository.Repository, cfg *config.Config) *Service {
+func NewService(repo repository.UserStore, cfg *config.Config) *Service {
 	return &Service{
 		repo:    repo,
 		config:  cfg,
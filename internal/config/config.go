@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
 )
@@ -10,16 +12,23 @@ type Config struct {
 	Database DatabaseConfig
 	Auth     AuthConfig
 	Graph    GraphConfig
+	SMTP     SMTPConfig
 	App      AppConfig
 }
 
 type ServerConfig struct {
 	Port int
+	// ShutdownTimeout bounds how long the server drains requests and background work
+	ShutdownTimeout time.Duration
 }
 
 type DatabaseConfig struct {
 	Driver string
 	DSN    string
+	// AutoMigrate applies pending embedded migrations when the server boots
+	AutoMigrate bool
+	// QueryTimeout bounds each repository call; zero disables it
+	QueryTimeout time.Duration
 }
 
 type AuthConfig struct {
@@ -36,30 +45,57 @@ type GraphConfig struct {
 	TenantID     string
 }
 
+// SMTPConfig is the mail server booking emails are sent through. Mail is
+// only logged while Host is empty.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// From is the sender address, optionally with a display name
+	From string
+	// TLS is "starttls" (upgrade the connection, required), "tls" (connect
+	// over TLS, as on port 465) or "none" for local mail sinks
+	TLS string
+}
+
 type AppConfig struct {
 	BaseURL  string
 	OfficeTZ string
+	// ReminderInterval is how often the server looks for booking reminders
+	// to send; zero leaves sending them to other instances
+	ReminderInterval time.Duration
 }
 
 func Load() (*Config, error) {
 	godotenv.Load(".env")
 
 	viper.SetDefault("SERVER_PORT", 8080)
+	viper.SetDefault("SERVER_SHUTDOWN_TIMEOUT", "30s")
 	viper.SetDefault("DATABASE_DRIVER", "sqlite3")
-	viper.SetDefault("DATABASE_DSN", "file:roombooker.db?cache=shared&_fk=1")
+	viper.SetDefault("DATABASE_DSN", "file:roombooker.db?cache=shared&_fk=1&_busy_timeout=5000")
+	viper.SetDefault("DATABASE_AUTO_MIGRATE", false)
+	viper.SetDefault("DATABASE_QUERY_TIMEOUT", "5s")
 	viper.SetDefault("JWT_SECRET", "your-secret-key")
+	viper.SetDefault("SMTP_PORT", 587)
+	viper.SetDefault("SMTP_FROM", "Room Booker <roombooker@localhost>")
+	viper.SetDefault("SMTP_TLS", "starttls")
 	viper.SetDefault("APP_BASE_URL", "http://localhost:8080")
 	viper.SetDefault("OFFICE_TZ", "America/New_York")
+	viper.SetDefault("REMINDER_INTERVAL", "1m")
 
 	viper.AutomaticEnv()
 
 	cfg := &Config{
 		Server: ServerConfig{
-			Port: viper.GetInt("SERVER_PORT"),
+			Port:            viper.GetInt("SERVER_PORT"),
+			ShutdownTimeout: viper.GetDuration("SERVER_SHUTDOWN_TIMEOUT"),
 		},
 		Database: DatabaseConfig{
-			Driver: viper.GetString("DATABASE_DRIVER"),
-			DSN:    viper.GetString("DATABASE_DSN"),
+			Driver:       viper.GetString("DATABASE_DRIVER"),
+			DSN:          viper.GetString("DATABASE_DSN"),
+			AutoMigrate:  viper.GetBool("DATABASE_AUTO_MIGRATE"),
+			QueryTimeout: viper.GetDuration("DATABASE_QUERY_TIMEOUT"),
 		},
 		Auth: AuthConfig{
 			JWTSecret:        viper.GetString("JWT_SECRET"),
@@ -73,9 +109,18 @@ func Load() (*Config, error) {
 			ClientSecret: viper.GetString("GRAPH_CLIENT_SECRET"),
 			TenantID:     viper.GetString("GRAPH_TENANT_ID"),
 		},
+		SMTP: SMTPConfig{
+			Host:     viper.GetString("SMTP_HOST"),
+			Port:     viper.GetInt("SMTP_PORT"),
+			Username: viper.GetString("SMTP_USERNAME"),
+			Password: viper.GetString("SMTP_PASSWORD"),
+			From:     viper.GetString("SMTP_FROM"),
+			TLS:      viper.GetString("SMTP_TLS"),
+		},
 		App: AppConfig{
-			BaseURL:  viper.GetString("APP_BASE_URL"),
-			OfficeTZ: viper.GetString("OFFICE_TZ"),
+			BaseURL:          viper.GetString("APP_BASE_URL"),
+			OfficeTZ:         viper.GetString("OFFICE_TZ"),
+			ReminderInterval: viper.GetDuration("REMINDER_INTERVAL"),
 		},
 	}
 
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"roombooker/internal/repository"
+)
+
+// Attendee is someone invited to a booking and their answer
+type Attendee struct {
+	Email    string `json:"email"`
+	Required bool   `json:"required"`
+	Response string `json:"response"`
+}
+
+func attendeesFromRepo(participants []repository.Participant) []Attendee {
+	out := make([]Attendee, 0, len(participants))
+	for _, p := range participants {
+		out = append(out, Attendee{Email: p.Email, Required: p.Required, Response: p.ResponseStatus})
+	}
+	return out
+}
+
+// AttendeeRequest names an attendee, either as a plain email for a required
+// attendee or as {"email": ..., "required": false}
+type AttendeeRequest struct {
+	Email    string
+	Required bool
+}
+
+func (a *AttendeeRequest) UnmarshalJSON(data []byte) error {
+	var email string
+	if err := json.Unmarshal(data, &email); err == nil {
+		a.Email, a.Required = email, true
+		return nil
+	}
+	var obj struct {
+		Email    string `json:"email"`
+		Required *bool  `json:"required"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	a.Email = obj.Email
+	a.Required = obj.Required == nil || *obj.Required
+	return nil
+}
+
+// attendeeParticipants validates requested attendees. Emails are compared
+// case-insensitively; one listed twice is invited once, as required if either
+// entry says so. Blank entries are skipped. It writes 400 on an invalid email.
+func attendeeParticipants(w http.ResponseWriter, attendees []AttendeeRequest) ([]repository.Participant, bool) {
+	out := make([]repository.Participant, 0, len(attendees))
+	index := map[string]int{}
+	for _, a := range attendees {
+		email := strings.ToLower(strings.TrimSpace(a.Email))
+		if email == "" {
+			continue
+		}
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+			http.Error(w, fmt.Sprintf("invalid attendee email %q", a.Email), http.StatusBadRequest)
+			return nil, false
+		}
+		if i, ok := index[email]; ok {
+			out[i].Required = out[i].Required || a.Required
+			continue
+		}
+		index[email] = len(out)
+		out = append(out, repository.Participant{Email: email, Required: a.Required})
+	}
+	return out, true
+}
+
+// checkCapacity writes 422 and returns false if the people expected at a
+// booking do not fit the room: every attendee who has not declined, and the
+// organiser unless they are listed. Rooms without a capacity take anyone.
+func (h *Handler) checkCapacity(w http.ResponseWriter, r *http.Request, roomID, organiserID string, participants []repository.Participant) bool {
+	room, err := h.repo.GetRoom(r.Context(), roomID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Unknown room_id", http.StatusBadRequest)
+			return false
+		}
+		storeError(w, "Failed to load room", err)
+		return false
+	}
+	if room.Capacity <= 0 {
+		return true
+	}
+	organiser := ""
+	if organiserID != "" {
+		user, err := h.repo.GetUserByID(r.Context(), organiserID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			storeError(w, "Failed to load user", err)
+			return false
+		}
+		if user != nil {
+			organiser = strings.ToLower(user.Email)
+		}
+	}
+	if err := overCapacity(room, organiser, participants); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return false
+	}
+	return true
+}
+
+// overCapacity returns an error if the people expected at a booking do not
+// fit room: every attendee who has not declined, and the organiser, by
+// email, unless they are listed
+func overCapacity(room *repository.Room, organiser string, participants []repository.Participant) error {
+	if room.Capacity <= 0 {
+		return nil
+	}
+	headcount := 1
+	for _, p := range participants {
+		if p.Email == organiser {
+			headcount--
+		}
+		if p.ResponseStatus != repository.ResponseDeclined {
+			headcount++
+		}
+	}
+	if headcount > room.Capacity {
+		return fmt.Errorf("%d people are expected but %s seats %d", headcount, room.Name, room.Capacity)
+	}
+	return nil
+}
+
+// withResponses copies the answers already given by attendees who stay onto
+// a new attendee list, so a capacity check sees who has declined
+func withResponses(participants, existing []repository.Participant) []repository.Participant {
+	responses := map[string]string{}
+	for _, p := range existing {
+		responses[p.Email] = p.ResponseStatus
+	}
+	out := make([]repository.Participant, 0, len(participants))
+	for _, p := range participants {
+		p.ResponseStatus = responses[p.Email]
+		out = append(out, p)
+	}
+	return out
+}
+
+// removedAttendees returns the emails of existing attendees not in participants
+func removedAttendees(existing, participants []repository.Participant) []string {
+	staying := map[string]bool{}
+	for _, p := range participants {
+		staying[p.Email] = true
+	}
+	var out []string
+	for _, p := range existing {
+		if !staying[p.Email] {
+			out = append(out, p.Email)
+		}
+	}
+	return out
+}
+
+// attendeesAudit is the audit entry for replacing a booking's attendees
+func (h *Handler) attendeesAudit(r *http.Request, bookingID string, before, after []repository.Participant) repository.AuditLog {
+	after = withResponses(after, before)
+	for i := range after {
+		if after[i].ResponseStatus == "" {
+			after[i].ResponseStatus = repository.ResponseNeedsAction
+		}
+	}
+	return h.auditEntry(r, "booking.attendees", "booking", bookingID, map[string]interface{}{
+		"before": attendeesFromRepo(before),
+		"after":  attendeesFromRepo(after),
+	})
+}
+
+// bookingWithAttendees returns the booking as sent to the frontend, with its attendees
+func (h *Handler) bookingWithAttendees(ctx context.Context, b *repository.Booking) (Booking, error) {
+	out := bookingFromRepo(b)
+	participants, err := h.repo.ListParticipants(ctx, b.ID)
+	if err != nil {
+		return out, err
+	}
+	out.Attendees = attendeesFromRepo(participants)
+	return out, nil
+}
+
+// RSVPRequest answers an invitation. Email defaults to the signed-in user's;
+// the organiser and admins may answer for another attendee.
+type RSVPRequest struct {
+	Response string `json:"response"`
+	Email    string `json:"email"`
+}
+
+// RSVPBooking records whether an attendee is coming to a booking
+func (h *Handler) RSVPBooking(w http.ResponseWriter, r *http.Request) {
+	var req RSVPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	renderIn, ok := responseLocation(w, r)
+	if !ok {
+		return
+	}
+	switch req.Response {
+	case repository.ResponseAccepted, repository.ResponseDeclined, repository.ResponseTentative:
+	default:
+		http.Error(w, "response must be accepted, declined or tentative", http.StatusBadRequest)
+		return
+	}
+	v := r.Context().Value("user_id")
+	if v == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := fmt.Sprintf("%v", v)
+	user, err := h.repo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		storeError(w, "Failed to load user", err)
+		return
+	}
+	b, err := h.repo.GetBooking(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Booking not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to load booking", err)
+		return
+	}
+	if b.Status != repository.BookingStatusActive {
+		http.Error(w, "Booking has been cancelled", http.StatusConflict)
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email == "" {
+		email = strings.ToLower(user.Email)
+	}
+	if email != strings.ToLower(user.Email) && b.CreatedBy != userID {
+		admin, err := h.isAdmin(r)
+		if err != nil {
+			storeError(w, "Failed to load user", err)
+			return
+		}
+		if !admin {
+			http.Error(w, "Only the organiser or an admin may answer for another attendee", http.StatusForbidden)
+			return
+		}
+	}
+	participants, err := h.repo.ListParticipants(r.Context(), b.ID)
+	if err != nil {
+		storeError(w, "Failed to load attendees", err)
+		return
+	}
+	found := false
+	for i := range participants {
+		if participants[i].Email == email {
+			participants[i].ResponseStatus = req.Response
+			found = true
+		}
+	}
+	if !found {
+		http.Error(w, "Not an attendee of this booking", http.StatusNotFound)
+		return
+	}
+	if req.Response != repository.ResponseDeclined && !h.checkCapacity(w, r, b.RoomID, b.CreatedBy, participants) {
+		return
+	}
+
+	ctx := audited(r, h.auditEntry(r, "booking.rsvp", "booking", b.ID, map[string]interface{}{
+		"email":    email,
+		"response": req.Response,
+	}))
+	if err := h.repo.SetParticipantResponse(ctx, b.ID, email, req.Response); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Not an attendee of this booking", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to record response", err)
+		return
+	}
+
+	out, err := h.bookingWithAttendees(r.Context(), b)
+	if err != nil {
+		storeError(w, "Failed to load attendees", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out.In(renderIn))
+}
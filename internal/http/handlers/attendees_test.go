@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/repository"
+)
+
+func createBookingWithAttendees(t *testing.T, h *Handler, attendees string) Booking {
+	body := `{"title":"Planning","start_time":"2099-03-02T14:00:00Z","end_time":"2099-03-02T15:00:00Z","room_id":"room-101","attendees":` + attendees + `}`
+	w := httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-regular"))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	return created
+}
+
+func TestHandler_CreateBooking_Attendees(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	created := createBookingWithAttendees(t, h, `["Ann@Example.com",{"email":"bob@example.com","required":false},"ann@example.com",""]`)
+	assert.Equal(t, []Attendee{
+		{Email: "ann@example.com", Required: true, Response: repository.ResponseNeedsAction},
+		{Email: "bob@example.com", Required: false, Response: repository.ResponseNeedsAction},
+	}, created.Attendees)
+
+	w := httptest.NewRecorder()
+	h.GetBooking(w, bookingRequest("GET", created.ID, "user-admin", ""))
+	require.Equal(t, http.StatusOK, w.Code)
+	var got Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, created.Attendees, got.Attendees)
+
+	// Saved with the booking, so audited with it too
+	logs, err := h.repo.ListAuditLogs(context.Background(), repository.AuditFilter{EntityID: created.ID})
+	require.NoError(t, err)
+	actions := []string{}
+	for _, l := range logs {
+		actions = append(actions, l.Action)
+	}
+	assert.ElementsMatch(t, []string{"booking.create", "booking.attendees"}, actions)
+
+	for _, bad := range []string{`["not an email"]`, `["Ann <ann@example.com>"]`, `[42]`} {
+		body := `{"start_time":"2099-03-02T16:00:00Z","end_time":"2099-03-02T17:00:00Z","room_id":"room-101","attendees":` + bad + `}`
+		w := httptest.NewRecorder()
+		h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-regular"))
+		assert.Equal(t, http.StatusBadRequest, w.Code, bad)
+	}
+}
+
+func TestHandler_Attendees_Capacity(t *testing.T) {
+	h := newBookingsTestHandler(t)
+
+	// Room 101 seats 4: the organiser and four guests do not fit
+	body := `{"start_time":"2099-03-02T14:00:00Z","end_time":"2099-03-02T15:00:00Z","room_id":"room-101","attendees":["a@example.com","b@example.com","c@example.com","d@example.com"]}`
+	w := httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-regular"))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// The organiser is counted once when listed
+	created := createBookingWithAttendees(t, h, `["user@example.com","a@example.com","b@example.com","c@example.com"]`)
+	require.Len(t, created.Attendees, 4)
+
+	w = httptest.NewRecorder()
+	h.UpdateBooking(w, bookingRequest("PATCH", created.ID, "user-regular", `{"attendees":["user@example.com","a@example.com","b@example.com","c@example.com","d@example.com"]}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// Those who declined free their seat
+	w = httptest.NewRecorder()
+	h.RSVPBooking(w, bookingRequest("POST", created.ID, "user-regular", `{"response":"declined","email":"c@example.com"}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = httptest.NewRecorder()
+	h.UpdateBooking(w, bookingRequest("PATCH", created.ID, "user-regular", `{"attendees":["user@example.com","a@example.com","b@example.com","c@example.com","d@example.com"]}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	require.Len(t, updated.Attendees, 5)
+	assert.Equal(t, repository.ResponseDeclined, updated.Attendees[2].Response, "a kept attendee keeps their response")
+
+	// ...until they change their mind
+	w = httptest.NewRecorder()
+	h.RSVPBooking(w, bookingRequest("POST", created.ID, "user-regular", `{"response":"accepted","email":"c@example.com"}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// Moving to a smaller room is checked too; room 102 seats 6
+	w = httptest.NewRecorder()
+	h.UpdateBooking(w, bookingRequest("PATCH", created.ID, "user-regular", `{"room_id":"room-102","attendees":["a@example.com","b@example.com","c@example.com","d@example.com","e@example.com"]}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = httptest.NewRecorder()
+	h.UpdateBooking(w, bookingRequest("PATCH", created.ID, "user-regular", `{"room_id":"room-103"}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestHandler_RSVPBooking(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	created := createBookingWithAttendees(t, h, `["admin@example.com","bob@example.com"]`)
+
+	// Attendees answer for themselves
+	w := httptest.NewRecorder()
+	h.RSVPBooking(w, bookingRequest("POST", created.ID, "user-admin", `{"response":"tentative"}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var got Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, []Attendee{
+		{Email: "admin@example.com", Required: true, Response: repository.ResponseTentative},
+		{Email: "bob@example.com", Required: true, Response: repository.ResponseNeedsAction},
+	}, got.Attendees)
+
+	// The organiser is not invited to their own booking
+	w = httptest.NewRecorder()
+	h.RSVPBooking(w, bookingRequest("POST", created.ID, "user-regular", `{"response":"accepted"}`))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	h.RSVPBooking(w, bookingRequest("POST", created.ID, "user-admin", `{"response":"maybe"}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Other attendees and outsiders may not answer for someone else
+	created2 := createTestBooking(t, h, "room-102", "user-admin", "2099-03-02T14:00:00Z", "2099-03-02T15:00:00Z")
+	require.NoError(t, h.repo.SetParticipants(context.Background(), created2.ID, []repository.Participant{{Email: "bob@example.com", Required: true}}))
+	w = httptest.NewRecorder()
+	h.RSVPBooking(w, bookingRequest("POST", created2.ID, "user-regular", `{"response":"declined","email":"bob@example.com"}`))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	entries, err := h.repo.ListAuditLogs(context.Background(), repository.AuditFilter{Action: "booking.rsvp", EntityID: created.ID})
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// Cancelled bookings take no answers
+	w = httptest.NewRecorder()
+	h.DeleteBooking(w, bookingRequest("DELETE", created.ID, "user-regular", ""))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	w = httptest.NewRecorder()
+	h.RSVPBooking(w, bookingRequest("POST", created.ID, "user-admin", `{"response":"accepted"}`))
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestHandler_Attendees_Series(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	series := createTestSeries(t, h, `,"attendees":["bob@example.com"]`)
+	require.Len(t, series.Occurrences, 4)
+	for _, o := range series.Occurrences {
+		assert.Equal(t, []Attendee{{Email: "bob@example.com", Required: true, Response: repository.ResponseNeedsAction}}, o.Attendees)
+	}
+
+	w := httptest.NewRecorder()
+	h.UpdateBooking(w, scopedRequest("PATCH", series.Occurrences[2].ID, ScopeFollowing, `{"attendees":["bob@example.com","ann@example.com"]}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	for i, o := range series.Occurrences {
+		participants, err := h.repo.ListParticipants(context.Background(), o.ID)
+		require.NoError(t, err)
+		if i < 2 {
+			assert.Len(t, participants, 1)
+		} else {
+			assert.Len(t, participants, 2)
+		}
+	}
+}
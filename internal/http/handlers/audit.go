@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"roombooker/internal/repository"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditEntry is one recorded change as returned to admins
+type AuditEntry struct {
+	ID          string          `json:"id"`
+	ActorUserID string          `json:"actor_user_id"`
+	Action      string          `json:"action"`
+	EntityType  string          `json:"entity_type"`
+	EntityID    string          `json:"entity_id"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	CreatedAt   string          `json:"created_at"`
+}
+
+func auditEntryFromRepo(e repository.AuditLog) AuditEntry {
+	out := AuditEntry{
+		ID:          e.ID,
+		ActorUserID: e.ActorUserID,
+		Action:      e.Action,
+		EntityType:  e.EntityType,
+		EntityID:    e.EntityID,
+		CreatedAt:   e.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if e.Payload != "" && json.Valid([]byte(e.Payload)) {
+		out.Payload = json.RawMessage(e.Payload)
+	}
+	return out
+}
+
+// ListAuditLogs returns recorded changes, newest first. It filters by actor,
+// action, entity_type, entity_id and a from/to time range, and pages with
+// limit and offset; X-Next-Offset is set when more entries match.
+// format=csv downloads the matches instead, all of them unless limit is given.
+func (h *Handler) ListAuditLogs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := repository.AuditFilter{
+		ActorUserID: q.Get("actor"),
+		Action:      q.Get("action"),
+		EntityType:  q.Get("entity_type"),
+		EntityID:    q.Get("entity_id"),
+	}
+	loc, ok := h.queryLocation(w, r, nil)
+	if !ok {
+		return
+	}
+	if v := q.Get("from"); v != "" {
+		if filter.From, ok = parseTimeField(w, "from", v, loc); !ok {
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if filter.To, ok = parseTimeField(w, "to", v, loc); !ok {
+			return
+		}
+	}
+	var err error
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.To.After(filter.From) {
+		http.Error(w, "to must be after from", http.StatusBadRequest)
+		return
+	}
+	csvExport := q.Get("format") == "csv"
+	if q.Get("format") != "" && !csvExport && q.Get("format") != "json" {
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+	limit := defaultAuditLimit
+	if csvExport {
+		limit = 0
+	}
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxAuditLimit {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if filter.Offset, err = strconv.Atoi(v); err != nil || filter.Offset < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+	if limit > 0 {
+		// One extra row tells us whether there is another page
+		filter.Limit = limit + 1
+	}
+
+	entries, err := h.repo.ListAuditLogs(r.Context(), filter)
+	if err != nil {
+		storeError(w, "Failed to load audit log", err)
+		return
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+		w.Header().Set("X-Next-Offset", strconv.Itoa(filter.Offset+limit))
+	}
+
+	if csvExport {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"id", "created_at", "actor_user_id", "action", "entity_type", "entity_id", "payload"})
+		for _, e := range entries {
+			cw.Write([]string{e.ID, e.CreatedAt.UTC().Format(time.RFC3339), e.ActorUserID, e.Action, e.EntityType, e.EntityID, e.Payload})
+		}
+		cw.Flush()
+		return
+	}
+
+	out := make([]AuditEntry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, auditEntryFromRepo(e))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listAudit(t *testing.T, h *Handler, query string) ([]AuditEntry, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	h.ListAuditLogs(w, withUser(httptest.NewRequest("GET", "/api/admin/audit?"+query, nil), "user-admin"))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var entries []AuditEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	return entries, w
+}
+
+func TestHandler_Audit_BookingLifecycle(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	created := createTestBooking(t, h, "room-101", "user-regular", "2099-03-02T14:00:00Z", "2099-03-02T15:00:00Z")
+
+	w := httptest.NewRecorder()
+	h.UpdateBooking(w, bookingRequest("PATCH", created.ID, "user-regular", `{"title":"Renamed"}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = httptest.NewRecorder()
+	h.DeleteBooking(w, bookingRequest("DELETE", created.ID, "user-regular", ""))
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	entries, _ := listAudit(t, h, "entity_type=booking&entity_id="+created.ID)
+	require.Len(t, entries, 3)
+	actions := map[string]AuditEntry{}
+	for _, e := range entries {
+		assert.Equal(t, "user-regular", e.ActorUserID)
+		actions[e.Action] = e
+	}
+	require.Contains(t, actions, "booking.create")
+	require.Contains(t, actions, "booking.update")
+	require.Contains(t, actions, "booking.cancel")
+
+	var update struct {
+		Before Booking `json:"before"`
+		After  Booking `json:"after"`
+	}
+	require.NoError(t, json.Unmarshal(actions["booking.update"].Payload, &update))
+	assert.Equal(t, "Renamed", update.After.Title)
+	assert.NotEqual(t, update.Before.Title, update.After.Title)
+
+	// A rejected write records nothing
+	w = httptest.NewRecorder()
+	h.UpdateBooking(w, bookingRequest("PATCH", created.ID, "user-admin", `{"end_time":"2099-03-02T13:00:00Z"}`))
+	require.NotEqual(t, http.StatusOK, w.Code)
+	entries, _ = listAudit(t, h, "entity_id="+created.ID)
+	assert.Len(t, entries, 3)
+}
+
+func TestHandler_Audit_UpdateUserRole(t *testing.T) {
+	h := newBookingsTestHandler(t)
+
+	req := withURLParam(withUser(httptest.NewRequest("PATCH", "/api/admin/users/user-regular/role", strings.NewReader(`{"role":"admin"}`)), "user-admin"), "id", "user-regular")
+	w := httptest.NewRecorder()
+	h.UpdateUserRole(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	entries, _ := listAudit(t, h, "action=user.role&actor=user-admin")
+	require.Len(t, entries, 1)
+	assert.Equal(t, "user-regular", entries[0].EntityID)
+	assert.JSONEq(t, `{"before":{"role":"user"},"after":{"role":"admin"}}`, string(entries[0].Payload))
+
+	req = withURLParam(withUser(httptest.NewRequest("PATCH", "/api/admin/users/missing/role", strings.NewReader(`{"role":"admin"}`)), "user-admin"), "id", "missing")
+	w = httptest.NewRecorder()
+	h.UpdateUserRole(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_ListAuditLogs_Pagination(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	for _, hour := range []string{"14", "15", "16"} {
+		createTestBooking(t, h, "room-101", "user-regular", "2099-03-02T"+hour+":00:00Z", "2099-03-02T"+hour+":30:00Z")
+	}
+
+	page, w := listAudit(t, h, "action=booking.create&limit=2")
+	assert.Len(t, page, 2)
+	assert.Equal(t, "2", w.Header().Get("X-Next-Offset"))
+	rest, w := listAudit(t, h, "action=booking.create&limit=2&offset=2")
+	assert.Len(t, rest, 1)
+	assert.Empty(t, w.Header().Get("X-Next-Offset"))
+	assert.NotContains(t, []string{page[0].ID, page[1].ID}, rest[0].ID)
+
+	none, _ := listAudit(t, h, "action=booking.create&to=2000-01-01T00:00:00Z")
+	assert.Empty(t, none)
+	none, _ = listAudit(t, h, "action=booking.create&to=2000-01-01T00:00&tz=Asia/Tokyo")
+	assert.Empty(t, none)
+
+	for _, bad := range []string{"limit=0", "limit=5000", "offset=-1", "from=yesterday", "format=xml", "from=2099-03-08T02:30&tz=America/New_York", "tz=Mars/Olympus"} {
+		w := httptest.NewRecorder()
+		h.ListAuditLogs(w, httptest.NewRequest("GET", "/api/admin/audit?"+bad, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, bad)
+	}
+}
+
+func TestHandler_ListAuditLogs_CSV(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	created := createTestBooking(t, h, "room-101", "user-regular", "2099-03-02T14:00:00Z", "2099-03-02T15:00:00Z")
+
+	w := httptest.NewRecorder()
+	h.ListAuditLogs(w, httptest.NewRequest("GET", "/api/admin/audit?format=csv&entity_id="+created.ID, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "audit.csv")
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, []string{"id", "created_at", "actor_user_id", "action", "entity_type", "entity_id", "payload"}, records[0])
+	assert.Equal(t, []string{"user-regular", "booking.create", "booking", created.ID}, records[1][2:6])
+	assert.True(t, json.Valid([]byte(records[1][6])))
+}
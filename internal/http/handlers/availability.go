@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"roombooker/internal/policy"
+	"roombooker/internal/repository"
+)
+
+// maxAvailabilityWindow bounds a search so one request cannot scan months of bookings
+const maxAvailabilityWindow = 31 * 24 * time.Hour
+
+// Slot is a free period in a room
+type Slot struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Availability is one room's free time within the searched window. Available
+// means the whole window can be booked in one go. ClosedDays are the office's
+// holidays within the window.
+type Availability struct {
+	RoomID     string    `json:"room_id"`
+	Room       Room      `json:"room"`
+	Start      string    `json:"start"`
+	End        string    `json:"end"`
+	Available  bool      `json:"available"`
+	FreeSlots  []Slot    `json:"free_slots"`
+	ClosedDays []Holiday `json:"closed_days"`
+}
+
+type interval struct {
+	start, end time.Time
+}
+
+// GetAvailability finds rooms with free time in [from, to). A room is free
+// when it is within its office's working hours, not on a holiday, at least the
+// minimum lead time ahead, and clear of other bookings and their buffers.
+// Rooms free for the whole window come first; rooms with no free time are left out.
+func (h *Handler) GetAvailability(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var office *repository.Office
+	var err error
+	if officeID := q.Get("office_id"); officeID != "" {
+		if office, err = h.repo.GetOffice(r.Context(), officeID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Office not found", http.StatusNotFound)
+				return
+			}
+			storeError(w, "Failed to load office", err)
+			return
+		}
+	}
+	// Zone-less times are read in the office's zone, or the default one when
+	// searching every office
+	loc, ok := h.queryLocation(w, r, office)
+	if !ok {
+		return
+	}
+	from, ok := parseTimeField(w, "from", q.Get("from"), loc)
+	if !ok {
+		return
+	}
+	to, ok := parseTimeField(w, "to", q.Get("to"), loc)
+	if !ok {
+		return
+	}
+	if !to.After(from) {
+		http.Error(w, "to must be after from", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from) > maxAvailabilityWindow {
+		http.Error(w, "the search window may span at most 31 days", http.StatusBadRequest)
+		return
+	}
+	minCapacity := 0
+	if v := q.Get("capacity"); v != "" {
+		if minCapacity, err = strconv.Atoi(v); err != nil || minCapacity < 0 {
+			http.Error(w, "invalid capacity", http.StatusBadRequest)
+			return
+		}
+	}
+	var equipment []string
+	for _, item := range strings.Split(q.Get("equipment"), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			equipment = append(equipment, item)
+		}
+	}
+	floor := q.Get("floor")
+
+	var offices []repository.Office
+	if office != nil {
+		offices = []repository.Office{*office}
+	} else if offices, err = h.repo.ListOffices(r.Context()); err != nil {
+		storeError(w, "Failed to load offices", err)
+		return
+	}
+
+	now := time.Now()
+	out := []Availability{}
+	for _, office := range offices {
+		loc := h.officeLocation(&office)
+		rooms, err := h.repo.ListRoomsByOffice(r.Context(), office.ID)
+		if err != nil {
+			storeError(w, "Failed to load rooms", err)
+			return
+		}
+		var matching []repository.Room
+		for _, room := range rooms {
+			if room.Capacity >= minCapacity && hasEquipment(room.Equipment, equipment) && onFloor(&room, floor) {
+				matching = append(matching, room)
+			}
+		}
+		if len(matching) == 0 {
+			continue
+		}
+
+		rules, err := h.repo.ListBookingRules(r.Context(), office.ID)
+		if err != nil {
+			storeError(w, "Failed to load booking rules", err)
+			return
+		}
+		holidays, err := h.repo.ListHolidays(r.Context(), office.ID)
+		if err != nil {
+			storeError(w, "Failed to load holidays", err)
+			return
+		}
+		closedDays := holidaysBetween(holidays, from, to, loc)
+		ev := policy.Evaluator{Rules: rules, Location: loc, Holidays: policy.HolidayMap(holidays)}
+		// Bookings just outside the window can still reach into it with their buffers
+		bookings, err := h.repo.ListBookingsByOffice(r.Context(), office.ID, from.Add(-ev.Reach()), to.Add(ev.Reach()))
+		if err != nil {
+			storeError(w, "Failed to load bookings", err)
+			return
+		}
+		busy := map[string][]interval{}
+		for _, b := range bookings {
+			before, after := ev.Blocked(b.StartsAt)
+			busy[b.RoomID] = append(busy[b.RoomID], interval{b.StartsAt.Add(-before), b.EndsAt.Add(after)})
+		}
+
+		open := openHours(from, to, now, ev)
+		wholeWindow := true
+		if rule := ev.RuleAt(from); rule != nil && rule.MaxDuration > 0 && to.Sub(from) > rule.MaxDuration {
+			wholeWindow = false
+		}
+		for i := range matching {
+			free := subtractIntervals(open, busy[matching[i].ID])
+			if len(free) == 0 {
+				continue
+			}
+			a := Availability{
+				RoomID:     matching[i].ID,
+				Room:       roomFromRepo(&matching[i]),
+				Start:      from.UTC().Format(time.RFC3339),
+				End:        to.UTC().Format(time.RFC3339),
+				Available:  wholeWindow && len(free) == 1 && free[0].start.Equal(from) && free[0].end.Equal(to),
+				FreeSlots:  make([]Slot, 0, len(free)),
+				ClosedDays: closedDays,
+			}
+			for _, f := range free {
+				a.FreeSlots = append(a.FreeSlots, Slot{Start: f.start.UTC().Format(time.RFC3339), End: f.end.UTC().Format(time.RFC3339)})
+			}
+			out = append(out, a)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Available && !out[j].Available })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// openHours returns the parts of [from, to) an office is open for booking:
+// its working hours on each local day that is not a holiday, from the minimum
+// lead time after now onwards. Each day uses the newest rule in effect by the
+// end of that day; days before any rule are open around the clock.
+func openHours(from, to, now time.Time, ev policy.Evaluator) []interval {
+	loc := ev.Location
+	var out []interval
+	y, m, d := from.In(loc).Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	for day.Before(to) {
+		y, m, d := day.Date()
+		next := time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+		if _, closed := ev.Closed(day.Format(repository.DateLayout)); !closed {
+			span := interval{day, next}
+			earliest := from
+			if open, closing, rule := ev.OpenOn(y, m, d); rule != nil {
+				span = interval{open, closing}
+				if lead := now.Add(rule.MinLeadTime); lead.After(earliest) {
+					earliest = lead
+				}
+			}
+			if earliest.After(span.start) {
+				span.start = earliest
+			}
+			if to.Before(span.end) {
+				span.end = to
+			}
+			if span.end.After(span.start) {
+				out = append(out, span)
+			}
+		}
+		day = next
+	}
+	return out
+}
+
+// subtractIntervals removes busy from the ordered, disjoint intervals in open
+func subtractIntervals(open, busy []interval) []interval {
+	sort.Slice(busy, func(i, j int) bool { return busy[i].start.Before(busy[j].start) })
+	var out []interval
+	for _, o := range open {
+		cursor := o.start
+		for _, b := range busy {
+			if !b.end.After(cursor) || !b.start.Before(o.end) {
+				continue
+			}
+			if b.start.After(cursor) {
+				out = append(out, interval{cursor, b.start})
+			}
+			cursor = b.end
+		}
+		if o.end.After(cursor) {
+			out = append(out, interval{cursor, o.end})
+		}
+	}
+	return out
+}
+
+// hasEquipment reports whether the room's equipment JSON has every wanted item
+// set to true, a non-zero number or a non-empty string
+func hasEquipment(equipmentJSON string, wanted []string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+	var items map[string]interface{}
+	if err := json.Unmarshal([]byte(equipmentJSON), &items); err != nil {
+		return false
+	}
+	for _, name := range wanted {
+		switch v := items[name].(type) {
+		case bool:
+			if !v {
+				return false
+			}
+		case float64:
+			if v == 0 {
+				return false
+			}
+		case string:
+			if v == "" {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// onFloor matches a room against a floor given by id or number; empty matches any floor
+func onFloor(room *repository.Room, floor string) bool {
+	return floor == "" || floor == room.FloorID || floor == strconv.Itoa(room.FloorNumber)
+}
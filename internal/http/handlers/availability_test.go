@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/policy"
+	"roombooker/internal/repository"
+)
+
+func getAvailability(t *testing.T, h *Handler, query string) []Availability {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.GetAvailability(w, httptest.NewRequest("GET", "/api/availability?"+query, nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var out []Availability
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+	return out
+}
+
+func availabilityByRoom(list []Availability) map[string]Availability {
+	out := map[string]Availability{}
+	for _, a := range list {
+		out[a.RoomID] = a
+	}
+	return out
+}
+
+// The seeded office works 09:00-18:00 New York time with 15 minute buffers;
+// 2099-03-02 14:00Z is 09:00 there
+func TestHandler_GetAvailability(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	createTestBooking(t, h, "room-101", "user-regular", "2099-03-02T14:30:00Z", "2099-03-02T15:00:00Z")
+
+	list := getAvailability(t, h, "from=2099-03-02T14:00:00Z&to=2099-03-02T15:00:00Z")
+	require.Len(t, list, 6)
+	byRoom := availabilityByRoom(list)
+
+	busy := byRoom["room-101"]
+	assert.False(t, busy.Available)
+	assert.Equal(t, []Slot{{Start: "2099-03-02T14:00:00Z", End: "2099-03-02T14:15:00Z"}}, busy.FreeSlots, "the buffer before the booking is not free")
+	assert.Equal(t, "room-101", list[len(list)-1].RoomID, "fully free rooms come first")
+
+	free := byRoom["room-102"]
+	assert.True(t, free.Available)
+	assert.Equal(t, "Room 102", free.Room.Name)
+	assert.Equal(t, []Slot{{Start: "2099-03-02T14:00:00Z", End: "2099-03-02T15:00:00Z"}}, free.FreeSlots)
+
+	// Zone-less times are read in the office's zone, or in ?tz=
+	for _, query := range []string{
+		"office_id=office-1&from=2099-03-02T09:00&to=2099-03-02T10:00",
+		"from=2099-03-02T15:00&to=2099-03-02T16:00&tz=Europe/Berlin",
+	} {
+		local := availabilityByRoom(getAvailability(t, h, query))["room-102"]
+		assert.Equal(t, "2099-03-02T14:00:00Z", local.Start, query)
+		assert.Equal(t, "2099-03-02T15:00:00Z", local.End, query)
+	}
+}
+
+func TestHandler_GetAvailability_WorkingHoursAndHolidays(t *testing.T) {
+	h := newBookingsTestHandler(t)
+
+	// 12:00-15:00Z is 07:00-10:00 in New York, so only the last hour is open
+	list := getAvailability(t, h, "from=2099-03-02T12:00:00Z&to=2099-03-02T15:00:00Z&capacity=8")
+	require.Len(t, list, 1)
+	assert.Equal(t, "room-104", list[0].RoomID)
+	assert.False(t, list[0].Available)
+	assert.Equal(t, []Slot{{Start: "2099-03-02T14:00:00Z", End: "2099-03-02T15:00:00Z"}}, list[0].FreeSlots)
+
+	// Longer than the four hour maximum: free, but not bookable in one go
+	list = getAvailability(t, h, "from=2099-03-02T14:00:00Z&to=2099-03-02T20:00:00Z&capacity=8")
+	require.Len(t, list, 1)
+	assert.False(t, list[0].Available)
+	assert.Len(t, list[0].FreeSlots, 1)
+
+	// Two days give one slot per working day
+	list = getAvailability(t, h, "from=2099-03-02T00:00:00Z&to=2099-03-04T00:00:00Z&capacity=8")
+	require.Len(t, list, 1)
+	assert.Equal(t, []Slot{
+		{Start: "2099-03-02T14:00:00Z", End: "2099-03-02T23:00:00Z"},
+		{Start: "2099-03-03T14:00:00Z", End: "2099-03-03T23:00:00Z"},
+	}, list[0].FreeSlots)
+
+	_, err := h.repo.CreateHoliday(context.Background(), &repository.Holiday{OfficeID: "office-1", Date: "2099-03-02", Description: "Founders' Day"})
+	require.NoError(t, err)
+	list = getAvailability(t, h, "from=2099-03-02T00:00:00Z&to=2099-03-04T00:00:00Z&capacity=8")
+	require.Len(t, list, 1)
+	assert.Equal(t, []Slot{{Start: "2099-03-03T14:00:00Z", End: "2099-03-03T23:00:00Z"}}, list[0].FreeSlots)
+	require.Len(t, list[0].ClosedDays, 1)
+	assert.Equal(t, "2099-03-02", list[0].ClosedDays[0].Date)
+	assert.Equal(t, "Founders' Day", list[0].ClosedDays[0].Description)
+
+	assert.Empty(t, getAvailability(t, h, "from=2099-03-02T14:00:00Z&to=2099-03-02T15:00:00Z"), "nothing is free on a holiday")
+}
+
+func TestHandler_GetAvailability_Filters(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	window := "from=2099-03-02T14:00:00Z&to=2099-03-02T15:00:00Z"
+
+	ids := func(list []Availability) []string {
+		var out []string
+		for _, a := range list {
+			out = append(out, a.RoomID)
+		}
+		return out
+	}
+	assert.ElementsMatch(t, []string{"room-102", "room-104", "room-105"}, ids(getAvailability(t, h, window+"&capacity=6")))
+	assert.ElementsMatch(t, []string{"room-101", "room-104"}, ids(getAvailability(t, h, window+"&equipment=screen,vc")))
+	assert.Len(t, getAvailability(t, h, window+"&floor=1"), 6)
+	assert.Len(t, getAvailability(t, h, window+"&floor=floor-1-1&office_id=office-1"), 6)
+	assert.Empty(t, getAvailability(t, h, window+"&floor=2"))
+
+	w := httptest.NewRecorder()
+	h.GetAvailability(w, httptest.NewRequest("GET", "/api/availability?"+window+"&office_id=nope", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_GetAvailability_InvalidQuery(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	for _, query := range []string{
+		"to=2099-03-02T15:00:00Z",
+		"from=2099-03-02T15:00:00Z&to=2099-03-02T14:00:00Z",
+		"from=2099-03-01T00:00:00Z&to=2099-04-15T00:00:00Z",
+		"from=2099-03-02T14:00:00Z&to=2099-03-02T15:00:00Z&capacity=lots",
+	} {
+		w := httptest.NewRecorder()
+		h.GetAvailability(w, httptest.NewRequest("GET", "/api/availability?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestOpenHours_DaylightSavingDay(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	ev := policy.Evaluator{Rules: []repository.BookingRule{{WorkdayStart: 9 * time.Hour, WorkdayEnd: 18 * time.Hour}}, Location: loc}
+	// Clocks go forward on 2099-03-08, so 09:00 local is 13:00Z instead of 14:00Z
+	from := time.Date(2099, 3, 8, 0, 0, 0, 0, loc)
+	open := openHours(from, from.Add(24*time.Hour), time.Time{}, ev)
+	require.Len(t, open, 1)
+	assert.Equal(t, time.Date(2099, 3, 8, 13, 0, 0, 0, time.UTC), open[0].start.UTC())
+	assert.Equal(t, time.Date(2099, 3, 8, 22, 0, 0, 0, time.UTC), open[0].end.UTC())
+}
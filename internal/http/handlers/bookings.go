@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"roombooker/internal/policy"
+	"roombooker/internal/repository"
+)
+
+// bookingSlot is the room and time a booking is created in or moved to
+type bookingSlot struct {
+	roomID    string
+	start     time.Time
+	end       time.Time
+	recurring bool
+	// excludeID is the booking being moved, which cannot crowd itself
+	excludeID string
+}
+
+// slotPolicy is what checkBookingSlot found: the violations an admin overrode,
+// and the buffers the store keeps free as it saves, against bookings made in
+// the meantime
+type slotPolicy struct {
+	overridden   []policy.Violation
+	bufferBefore time.Duration
+	bufferAfter  time.Duration
+}
+
+// apply has b's write keep the buffers free
+func (p slotPolicy) apply(b *repository.Booking) {
+	b.BufferBefore, b.BufferAfter = p.bufferBefore, p.bufferAfter
+}
+
+// checkBookingSlot writes an error and returns false unless the slot may be
+// booked: a valid range in an in-service room that keeps to the rules and
+// holidays of the room's office, read in the office timezone. Rule violations answer 422 with
+// the violations, unless an admin passes ?override=true; the overridden
+// violations are then returned for the caller to audit once the booking is saved.
+func (h *Handler) checkBookingSlot(w http.ResponseWriter, r *http.Request, slot bookingSlot) (slotPolicy, bool) {
+	if !slot.end.After(slot.start) {
+		http.Error(w, "end_time must be after start_time", http.StatusBadRequest)
+		return slotPolicy{}, false
+	}
+	ev, ok := h.bookingPolicy(w, r, slot.roomID)
+	if !ok {
+		return slotPolicy{}, false
+	}
+	nearby, err := h.repo.ListBookingsByRoom(r.Context(), slot.roomID, slot.start.Add(-ev.Reach()), slot.end.Add(ev.Reach()))
+	if err != nil {
+		storeError(w, "Failed to load bookings", err)
+		return slotPolicy{}, false
+	}
+	others := nearby[:0]
+	for _, b := range nearby {
+		if b.ID != slot.excludeID {
+			others = append(others, b)
+		}
+	}
+
+	violations := ev.Check(policy.Booking{Start: slot.start, End: slot.end, Recurring: slot.recurring}, others, time.Now())
+	if len(violations) == 0 {
+		var p slotPolicy
+		if rule := ev.RuleAt(slot.start); rule != nil {
+			p.bufferBefore, p.bufferAfter = rule.BufferBefore, rule.BufferAfter
+		}
+		return p, true
+	}
+	if !h.overrideRules(w, r, violations) {
+		return slotPolicy{}, false
+	}
+	return slotPolicy{overridden: violations}, true
+}
+
+// bufferTaken answers a write that failed with repository.ErrBufferTaken,
+// because a booking was made within the slot's buffers after it was checked:
+// 422 with the violations, as if the booking had been there all along
+func (h *Handler) bufferTaken(w http.ResponseWriter, r *http.Request, slot bookingSlot) {
+	if _, ok := h.checkBookingSlot(w, r, slot); ok {
+		// ...unless it has gone again already
+		http.Error(w, "Another booking was made close to this one; try again", http.StatusConflict)
+	}
+}
+
+// bookingPolicy returns the evaluator for bookings in a room, built from the
+// rules and holidays of its office. It writes an error and returns false
+// unless the room exists and is in service.
+func (h *Handler) bookingPolicy(w http.ResponseWriter, r *http.Request, roomID string) (policy.Evaluator, bool) {
+	room, ok := h.bookableRoom(w, r, roomID)
+	if !ok {
+		return policy.Evaluator{}, false
+	}
+	ev, err := h.officePolicy(r.Context(), room)
+	if err != nil {
+		storeError(w, "Failed to load booking rules", err)
+		return policy.Evaluator{}, false
+	}
+	return ev, true
+}
+
+// officePolicy builds the evaluator for bookings in room from the rules and
+// holidays of its office
+func (h *Handler) officePolicy(ctx context.Context, room *repository.Room) (policy.Evaluator, error) {
+	office, err := h.repo.GetOffice(ctx, room.OfficeID)
+	if err != nil {
+		return policy.Evaluator{}, err
+	}
+	rules, err := h.repo.ListBookingRules(ctx, office.ID)
+	if err != nil {
+		return policy.Evaluator{}, err
+	}
+	holidays, err := h.repo.ListHolidays(ctx, office.ID)
+	if err != nil {
+		return policy.Evaluator{}, err
+	}
+	return policy.Evaluator{Rules: rules, Location: h.officeLocation(office), Holidays: policy.HolidayMap(holidays)}, nil
+}
+
+// overrideRules decides whether a write breaking booking rules goes ahead. It
+// answers 422 with the violations unless the request passes ?override=true,
+// and 403 if the user passing it is not an admin.
+func (h *Handler) overrideRules(w http.ResponseWriter, r *http.Request, violations interface{}) bool {
+	if r.URL.Query().Get("override") != "true" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":    "Booking breaks the office's booking rules",
+			"violations": violations,
+		})
+		return false
+	}
+	admin, err := h.isAdmin(r)
+	if err != nil {
+		storeError(w, "Failed to load user", err)
+		return false
+	}
+	if !admin {
+		http.Error(w, "Only admins may override booking rules", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// overrideAudit returns the entry recording the rules an admin overrode to
+// save a booking, if any
+func (h *Handler) overrideAudit(r *http.Request, bookingID string, violations []policy.Violation) []repository.AuditLog {
+	if len(violations) == 0 {
+		return nil
+	}
+	return []repository.AuditLog{h.auditEntry(r, "booking.policy_override", "booking", bookingID, map[string]interface{}{
+		"violations": violations,
+	})}
+}
+
+// isAdmin reports whether the request's user has the admin role
+func (h *Handler) isAdmin(r *http.Request) (bool, error) {
+	v := r.Context().Value("user_id")
+	if v == nil {
+		return false, nil
+	}
+	user, err := h.repo.GetUserByID(r.Context(), fmt.Sprintf("%v", v))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return user.Role == "admin", nil
+}
+
+// GetBooking returns a single booking, cancelled ones included. Any signed-in
+// user may read it, as room calendars already show every booking.
+func (h *Handler) GetBooking(w http.ResponseWriter, r *http.Request) {
+	renderIn, ok := responseLocation(w, r)
+	if !ok {
+		return
+	}
+	b, err := h.repo.GetBooking(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Booking not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to load booking", err)
+		return
+	}
+	out, err := h.bookingWithAttendees(r.Context(), b)
+	if err != nil {
+		storeError(w, "Failed to load attendees", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out.In(renderIn))
+}
+
+// loadOwnBooking fetches the booking named in the URL for a change. Only its
+// owner and admins may change it; anyone else gets 403.
+func (h *Handler) loadOwnBooking(w http.ResponseWriter, r *http.Request) (*repository.Booking, bool) {
+	v := r.Context().Value("user_id")
+	if v == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	userID := fmt.Sprintf("%v", v)
+
+	b, err := h.repo.GetBooking(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Booking not found", http.StatusNotFound)
+			return nil, false
+		}
+		storeError(w, "Failed to load booking", err)
+		return nil, false
+	}
+	if b.CreatedBy == userID {
+		return b, true
+	}
+	admin, err := h.isAdmin(r)
+	if err != nil {
+		storeError(w, "Failed to load user", err)
+		return nil, false
+	}
+	if !admin {
+		http.Error(w, "Only the booking's owner or an admin may change it", http.StatusForbidden)
+		return nil, false
+	}
+	return b, true
+}
+
+// UpdateBookingRequest holds the booking fields to change; omitted fields are
+// kept. Times accept the same formats as CreateBookingRequest.
+type UpdateBookingRequest struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	StartTime   *string `json:"start_time"`
+	EndTime     *string `json:"end_time"`
+	RoomID      *string `json:"room_id"`
+	// Attendees replaces the attendee list; those who stay keep their response
+	Attendees *[]AttendeeRequest `json:"attendees"`
+	TZ        string             `json:"tz"`
+}
+
+// UpdateBooking edits, reschedules or moves an active booking. A new time or
+// room is checked like a new booking, so a clash answers 409 with the conflicts.
+// For an occurrence of a recurring booking ?scope= picks what changes: the
+// occurrence alone (the default), it and the following ones, or the series.
+func (h *Handler) UpdateBooking(w http.ResponseWriter, r *http.Request) {
+	var req UpdateBookingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	scope, ok := bookingScope(w, r)
+	if !ok {
+		return
+	}
+	b, ok := h.loadOwnBooking(w, r)
+	if !ok {
+		return
+	}
+	if b.Status != repository.BookingStatusActive {
+		http.Error(w, "Booking has been cancelled", http.StatusConflict)
+		return
+	}
+	renderIn, ok := responseLocation(w, r)
+	if !ok {
+		return
+	}
+	loc := time.UTC
+	if req.StartTime != nil || req.EndTime != nil {
+		roomID := b.RoomID
+		if req.RoomID != nil && *req.RoomID != "" {
+			roomID = *req.RoomID
+		}
+		if loc, ok = h.inputLocation(w, r, req.TZ, roomID); !ok {
+			return
+		}
+	}
+	before := *b
+	if !applyBookingUpdate(w, b, &req, loc) {
+		return
+	}
+	var participants, existing []repository.Participant
+	if req.Attendees != nil {
+		if participants, ok = attendeeParticipants(w, *req.Attendees); !ok {
+			return
+		}
+	}
+	if req.Attendees != nil || b.RoomID != before.RoomID {
+		var err error
+		if existing, err = h.repo.ListParticipants(r.Context(), b.ID); err != nil {
+			storeError(w, "Failed to load attendees", err)
+			return
+		}
+		expected := existing
+		if req.Attendees != nil {
+			expected = withResponses(participants, existing)
+		}
+		if !h.checkCapacity(w, r, b.RoomID, b.CreatedBy, expected) {
+			return
+		}
+	}
+	if scope != ScopeOccurrence && b.SeriesID != "" {
+		h.updateSeries(w, r, &before, b, &req, participants, scope, renderIn)
+		return
+	}
+
+	var checked slotPolicy
+	slot := bookingSlot{roomID: b.RoomID, start: b.StartsAt, end: b.EndsAt, recurring: b.RRule != "", excludeID: b.ID}
+	if b.RoomID != before.RoomID || !b.StartsAt.Equal(before.StartsAt) || !b.EndsAt.Equal(before.EndsAt) {
+		if checked, ok = h.checkBookingSlot(w, r, slot); !ok {
+			return
+		}
+		checked.apply(b)
+	}
+
+	entries := append([]repository.AuditLog{h.auditEntry(r, "booking.update", "booking", b.ID, map[string]interface{}{
+		"before": bookingFromRepo(&before),
+		"after":  bookingFromRepo(b),
+	})}, h.overrideAudit(r, b.ID, checked.overridden)...)
+	if req.Attendees != nil {
+		b.Participants = participants
+		entries = append(entries, h.attendeesAudit(r, b.ID, existing, participants))
+	}
+	if err := h.repo.UpdateBooking(audited(r, entries...), b); err != nil {
+		var conflict *repository.ConflictError
+		switch {
+		case errors.As(err, &conflict):
+			writeConflict(w, conflict)
+		case errors.Is(err, repository.ErrBufferTaken):
+			h.bufferTaken(w, r, slot)
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Booking not found", http.StatusNotFound)
+		default:
+			storeError(w, "Failed to update booking", err)
+		}
+		return
+	}
+	var dropped []string
+	if req.Attendees != nil {
+		dropped = removedAttendees(existing, participants)
+	}
+	h.notifyBookingChange(bookingUpdated, []repository.Booking{*b}, dropped)
+
+	out, err := h.bookingWithAttendees(r.Context(), b)
+	if err != nil {
+		storeError(w, "Failed to load attendees", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out.In(renderIn))
+}
+
+// applyBookingUpdate copies the fields given in req onto b, reading zone-less
+// times in loc. It writes 400 and returns false if one is invalid.
+func applyBookingUpdate(w http.ResponseWriter, b *repository.Booking, req *UpdateBookingRequest, loc *time.Location) bool {
+	if req.Title != nil {
+		b.Title = *req.Title
+	}
+	if req.Description != nil {
+		b.Description = *req.Description
+	}
+	if req.StartTime != nil {
+		start, ok := parseTimeField(w, "start_time", *req.StartTime, loc)
+		if !ok {
+			return false
+		}
+		b.StartsAt = start
+	}
+	if req.EndTime != nil {
+		end, ok := parseTimeField(w, "end_time", *req.EndTime, loc)
+		if !ok {
+			return false
+		}
+		b.EndsAt = end
+	}
+	if req.RoomID != nil {
+		if *req.RoomID == "" {
+			http.Error(w, "room_id must not be empty", http.StatusBadRequest)
+			return false
+		}
+		b.RoomID = *req.RoomID
+	}
+	return true
+}
+
+// DeleteBooking cancels a booking. The row is kept with status "cancelled" so
+// it stays in the history; cancelling twice is not an error. ?scope= works as
+// for UpdateBooking.
+func (h *Handler) DeleteBooking(w http.ResponseWriter, r *http.Request) {
+	scope, ok := bookingScope(w, r)
+	if !ok {
+		return
+	}
+	b, ok := h.loadOwnBooking(w, r)
+	if !ok {
+		return
+	}
+	if scope != ScopeOccurrence && b.SeriesID != "" {
+		h.cancelSeries(w, r, b, scope)
+		return
+	}
+	if b.Status == repository.BookingStatusCancelled {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	ctx := audited(r, h.auditEntry(r, "booking.cancel", "booking", b.ID, map[string]interface{}{
+		"before": bookingFromRepo(b),
+	}))
+	if err := h.repo.CancelBooking(ctx, b.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Booking not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to cancel booking", err)
+		return
+	}
+	h.notifyBookingChange(bookingCancelled, []repository.Booking{*b}, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
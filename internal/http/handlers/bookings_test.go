@@ -0,0 +1,415 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/config"
+	"roombooker/internal/policy"
+	"roombooker/internal/repository"
+	"roombooker/internal/repository/memory"
+)
+
+// newBookingsTestHandler returns a handler over an in-memory store holding the demo rooms and users
+func newBookingsTestHandler(t *testing.T) *Handler {
+	store := memory.New()
+	store.SeedDemoData()
+	return NewHandler(store, nil, nil, &config.Config{}, nil)
+}
+
+func withUser(r *http.Request, userID string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), "user_id", userID))
+}
+
+func withURLParam(r *http.Request, key, value string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(key, value)
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestHandler_CreateBooking_Persists(t *testing.T) {
+	h := newBookingsTestHandler(t)
+
+	body := `{"title":"Planning","start_time":"2024-01-15T10:00","end_time":"2024-01-15T11:00","room_id":"room-101"}`
+	req := withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-regular")
+	w := httptest.NewRecorder()
+	h.CreateBooking(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var created Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.ID)
+	// Zone-less times are read in the office's timezone, New York
+	assert.Equal(t, "2024-01-15T15:00:00Z", created.Start)
+	assert.Equal(t, "user-regular", created.UserID)
+
+	req = httptest.NewRequest("GET", "/api/rooms/room-101/bookings?from=2024-01-15T00:00:00Z&to=2024-01-16T00:00:00Z", nil)
+	req = withURLParam(req, "id", "room-101")
+	w = httptest.NewRecorder()
+	h.GetRoomBookings(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var listed []Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed, 1)
+	assert.Equal(t, created.ID, listed[0].ID)
+	assert.Equal(t, "Planning", listed[0].Title)
+}
+
+func TestHandler_GetRoomBookings_Empty(t *testing.T) {
+	h := newBookingsTestHandler(t)
+
+	req := withURLParam(httptest.NewRequest("GET", "/api/rooms/room-102/bookings", nil), "id", "room-102")
+	w := httptest.NewRecorder()
+	h.GetRoomBookings(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+}
+
+func TestHandler_GetRoomBookings_ZonelessTimes(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	// 10:00-11:00 New York
+	createTestBooking(t, h, "room-101", "user-regular", "2024-01-15T15:00:00Z", "2024-01-15T16:00:00Z")
+	list := func(query string) *httptest.ResponseRecorder {
+		req := withURLParam(httptest.NewRequest("GET", "/api/rooms/room-101/bookings?"+query, nil), "id", "room-101")
+		w := httptest.NewRecorder()
+		h.GetRoomBookings(w, req)
+		return w
+	}
+
+	// Zone-less times are read in the office's zone, so 11:00 is after the booking
+	w := list("from=2024-01-15T11:00")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `[]`, w.Body.String())
+	w = list("from=2024-01-15T10:30")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var listed []Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	assert.Len(t, listed, 1)
+
+	// ...or in ?tz=
+	w = list("from=2024-01-15T16:30&tz=Europe/Berlin")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	assert.Len(t, listed, 1)
+
+	for _, query := range []string{"from=yesterday", "to=2024-01-15", "from=2024-03-10T02:30"} {
+		assert.Equal(t, http.StatusBadRequest, list(query).Code, query)
+	}
+}
+
+func TestHandler_CreateBooking_InvalidRange(t *testing.T) {
+	h := newBookingsTestHandler(t)
+
+	body := `{"title":"Backwards","start_time":"2024-01-15T11:00","end_time":"2024-01-15T10:00","room_id":"room-101"}`
+	req := withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-regular")
+	w := httptest.NewRecorder()
+	h.CreateBooking(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandler_CreateBooking_Conflict(t *testing.T) {
+	h := newBookingsTestHandler(t)
+
+	body := `{"title":"First","start_time":"2024-01-15T10:00","end_time":"2024-01-15T11:00","room_id":"room-101"}`
+	w := httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-regular"))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var first Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+
+	body = `{"title":"Second","start_time":"2024-01-15T10:30","end_time":"2024-01-15T11:30","room_id":"room-101"}`
+	w = httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-admin"))
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	var resp struct {
+		Message   string    `json:"message"`
+		Conflicts []Booking `json:"conflicts"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.NotEmpty(t, resp.Message)
+	require.Len(t, resp.Conflicts, 1)
+	assert.Equal(t, first.ID, resp.Conflicts[0].ID)
+	assert.Equal(t, "First", resp.Conflicts[0].Title)
+}
+
+func TestHandler_CreateBooking_ConcurrentRequests(t *testing.T) {
+	h := newBookingsTestHandler(t)
+
+	const requests = 20
+	codes := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := `{"title":"Race","start_time":"2024-01-15T10:00","end_time":"2024-01-15T11:00","room_id":"room-101"}`
+			w := httptest.NewRecorder()
+			h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-regular"))
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for c := range codes {
+		counts[c]++
+	}
+	assert.Equal(t, 1, counts[http.StatusCreated])
+	assert.Equal(t, requests-1, counts[http.StatusConflict])
+}
+
+// timeoutStore fails booking reads the way the SQL store does when the query timeout expires
+type timeoutStore struct {
+	*memory.Store
+}
+
+func (timeoutStore) ListBookingsByRoom(ctx context.Context, roomID string, from, to time.Time) ([]repository.Booking, error) {
+	return nil, fmt.Errorf("list bookings: %w", context.DeadlineExceeded)
+}
+
+func TestHandler_GetRoomBookings_TimeoutIs503(t *testing.T) {
+	h := NewHandler(timeoutStore{memory.New()}, nil, nil, &config.Config{}, nil)
+
+	req := withURLParam(httptest.NewRequest("GET", "/api/rooms/room-101/bookings", nil), "id", "room-101")
+	w := httptest.NewRecorder()
+	h.GetRoomBookings(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+func bookingRequest(method, id, userID, body string) *http.Request {
+	req := httptest.NewRequest(method, "/api/bookings/"+id, strings.NewReader(body))
+	return withURLParam(withUser(req, userID), "id", id)
+}
+
+func TestHandler_GetBooking(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	created := createTestBooking(t, h, "room-101", "user-regular", "2099-03-02T14:00:00Z", "2099-03-02T15:00:00Z")
+
+	w := httptest.NewRecorder()
+	h.GetBooking(w, bookingRequest("GET", created.ID, "user-admin", ""))
+	require.Equal(t, http.StatusOK, w.Code)
+	var got Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, created, got)
+
+	w = httptest.NewRecorder()
+	h.GetBooking(w, bookingRequest("GET", "missing", "user-regular", ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_UpdateBooking_Reschedule(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	created := createTestBooking(t, h, "room-101", "user-regular", "2099-03-02T14:00:00Z", "2099-03-02T15:00:00Z")
+
+	body := `{"title":"Retro","description":"Sprint 12","start_time":"2099-03-02T16:00:00Z","end_time":"2099-03-02T17:30:00Z","room_id":"room-102"}`
+	w := httptest.NewRecorder()
+	h.UpdateBooking(w, bookingRequest("PATCH", created.ID, "user-regular", body))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, "Retro", updated.Title)
+	assert.Equal(t, "Sprint 12", updated.Description)
+	assert.Equal(t, "2099-03-02T16:00:00Z", updated.Start)
+	assert.Equal(t, "2099-03-02T17:30:00Z", updated.End)
+	assert.Equal(t, "room-102", updated.RoomID)
+
+	// Omitted fields are kept
+	w = httptest.NewRecorder()
+	h.UpdateBooking(w, bookingRequest("PATCH", created.ID, "user-regular", `{"title":"Retro 2"}`))
+	require.Equal(t, http.StatusOK, w.Code)
+	stored, err := h.repo.GetBooking(context.Background(), created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Retro 2", stored.Title)
+	assert.Equal(t, "room-102", stored.RoomID)
+
+	entries, err := h.repo.ListAuditLogs(context.Background(), repository.AuditFilter{Action: "booking.update", EntityID: created.ID})
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestHandler_UpdateBooking_ChecksMoves(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	other := createTestBooking(t, h, "room-102", "user-admin", "2099-03-02T16:00:00Z", "2099-03-02T17:00:00Z")
+	created := createTestBooking(t, h, "room-101", "user-regular", "2099-03-02T14:00:00Z", "2099-03-02T15:00:00Z")
+
+	w := httptest.NewRecorder()
+	h.UpdateBooking(w, bookingRequest("PATCH", created.ID, "user-regular", `{"room_id":"room-102","start_time":"2099-03-02T16:30:00Z","end_time":"2099-03-02T17:30:00Z"}`))
+	require.Equal(t, http.StatusConflict, w.Code)
+	var resp struct {
+		Conflicts []Booking `json:"conflicts"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Conflicts, 1)
+	assert.Equal(t, other.ID, resp.Conflicts[0].ID)
+
+	for body, code := range map[string]int{
+		`{"end_time":"2099-03-02T13:00:00Z"}`: http.StatusBadRequest,
+		`{"start_time":"tomorrow"}`:           http.StatusBadRequest,
+		`{"room_id":"nope"}`:                  http.StatusBadRequest,
+	} {
+		w = httptest.NewRecorder()
+		h.UpdateBooking(w, bookingRequest("PATCH", created.ID, "user-regular", body))
+		assert.Equal(t, code, w.Code, body)
+	}
+
+	stored, err := h.repo.GetBooking(context.Background(), created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "room-101", stored.RoomID, "refused moves change nothing")
+}
+
+func TestHandler_UpdateBooking_OwnerOrAdmin(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	created := createTestBooking(t, h, "room-101", "user-regular", "2099-03-02T14:00:00Z", "2099-03-02T15:00:00Z")
+	strangerID, err := h.repo.CreateUser(context.Background(), "stranger@example.com", "Stranger", "user", "")
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	h.UpdateBooking(w, bookingRequest("PATCH", created.ID, strangerID, `{"title":"Mine now"}`))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = httptest.NewRecorder()
+	h.DeleteBooking(w, bookingRequest("DELETE", created.ID, strangerID, ""))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	h.UpdateBooking(w, bookingRequest("PATCH", created.ID, "user-admin", `{"title":"Moved by admin"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	h.UpdateBooking(w, bookingRequest("PATCH", "missing", "user-admin", `{}`))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_DeleteBooking_Cancels(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	created := createTestBooking(t, h, "room-101", "user-regular", "2099-03-02T14:00:00Z", "2099-03-02T15:00:00Z")
+
+	w := httptest.NewRecorder()
+	h.DeleteBooking(w, bookingRequest("DELETE", created.ID, "user-regular", ""))
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	stored, err := h.repo.GetBooking(context.Background(), created.ID)
+	require.NoError(t, err, "cancelled bookings are kept")
+	assert.Equal(t, "cancelled", stored.Status)
+
+	w = httptest.NewRecorder()
+	h.DeleteBooking(w, bookingRequest("DELETE", created.ID, "user-regular", ""))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = httptest.NewRecorder()
+	h.UpdateBooking(w, bookingRequest("PATCH", created.ID, "user-regular", `{"title":"Back"}`))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// The slot is free again
+	createTestBooking(t, h, "room-101", "user-admin", "2099-03-02T14:00:00Z", "2099-03-02T15:00:00Z")
+}
+
+func TestHandler_CreateBooking_PolicyViolations(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	// 12:00-17:00Z is 07:00-12:00 in New York: too early and over the 4h limit
+	body := `{"title":"Offsite","start_time":"2099-03-02T12:00:00Z","end_time":"2099-03-02T17:00:00Z","room_id":"room-101"}`
+
+	w := httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-regular"))
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+	var resp struct {
+		Violations []policy.Violation `json:"violations"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Violations, 2)
+	assert.Equal(t, policy.Violation{
+		Rule:    policy.RuleWorkdayStart,
+		Limit:   "09:00",
+		Actual:  "07:00",
+		Message: "Bookings may not start before 09:00 America/New_York",
+	}, resp.Violations[0])
+	assert.Equal(t, policy.RuleMaxDuration, resp.Violations[1].Rule)
+	assert.Equal(t, "5h", resp.Violations[1].Actual)
+
+	w = httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings?override=true", strings.NewReader(body)), "user-regular"))
+	assert.Equal(t, http.StatusForbidden, w.Code, "only admins may override")
+
+	w = httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings?override=true", strings.NewReader(body)), "user-admin"))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	entries, err := h.repo.ListAuditLogs(context.Background(), repository.AuditFilter{Action: "booking.policy_override"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, created.ID, entries[0].EntityID)
+	assert.Equal(t, "user-admin", entries[0].ActorUserID)
+	assert.Contains(t, entries[0].Payload, policy.RuleMaxDuration)
+}
+
+func TestHandler_UpdateBooking_PolicyViolations(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	createTestBooking(t, h, "room-101", "user-admin", "2099-03-02T16:00:00Z", "2099-03-02T17:00:00Z")
+	created := createTestBooking(t, h, "room-101", "user-regular", "2099-03-02T14:00:00Z", "2099-03-02T15:00:00Z")
+
+	// Ending 5 minutes before the next booking leaves no room for the buffers
+	w := httptest.NewRecorder()
+	h.UpdateBooking(w, bookingRequest("PATCH", created.ID, "user-regular", `{"end_time":"2099-03-02T15:55:00Z"}`))
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), policy.RuleBufferAfter)
+
+	// A booking does not crowd itself when it is moved
+	w = httptest.NewRecorder()
+	h.UpdateBooking(w, bookingRequest("PATCH", created.ID, "user-regular", `{"start_time":"2099-03-02T14:30:00Z","end_time":"2099-03-02T15:30:00Z"}`))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+// staleListStore misses the room's bookings on its first listing, as a
+// booking made just after the handler looked would be
+type staleListStore struct {
+	repository.Store
+	listed bool
+}
+
+func (s *staleListStore) ListBookingsByRoom(ctx context.Context, roomID string, from, to time.Time) ([]repository.Booking, error) {
+	if !s.listed {
+		s.listed = true
+		return nil, nil
+	}
+	return s.Store.ListBookingsByRoom(ctx, roomID, from, to)
+}
+
+func TestHandler_CreateBooking_BuffersCheckedAsSaved(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	createTestBooking(t, h, "room-101", "user-admin", "2099-03-02T14:00:00Z", "2099-03-02T15:00:00Z")
+	h.bgWG.Wait()
+	h.repo = &staleListStore{Store: h.repo}
+
+	body := `{"title":"Squeezed","start_time":"2099-03-02T15:05:00Z","end_time":"2099-03-02T15:30:00Z","room_id":"room-101"}`
+	w := httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-regular"))
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+	var resp struct {
+		Violations []policy.Violation `json:"violations"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Violations, 1)
+	assert.Equal(t, policy.RuleBufferBefore, resp.Violations[0].Rule)
+
+	bookings, err := h.repo.ListBookingsByRoom(context.Background(), "room-101", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, bookings, 1, "nothing is saved")
+}
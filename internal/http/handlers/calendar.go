@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"roombooker/internal/ical"
+	"roombooker/internal/repository"
+)
+
+// feedHistory is how far back calendar feeds go, so clients keep recent
+// meetings without the feed growing forever
+const feedHistory = 90 * 24 * time.Hour
+
+const calendarProdID = "-//Roombooker//Room Calendar//EN"
+
+// uidDomain names this deployment in event UIDs, so they stay unique
+// among the calendars a client subscribes to
+func (h *Handler) uidDomain() string {
+	if h.config != nil {
+		if u, err := url.Parse(h.config.App.BaseURL); err == nil && u.Hostname() != "" {
+			return u.Hostname()
+		}
+	}
+	return "roombooker"
+}
+
+// bookingEvent is a booking as a calendar event. Feeds anyone can subscribe
+// to give only the title, not the description.
+func (h *Handler) bookingEvent(b *repository.Booking, where string, now time.Time) ical.Event {
+	summary := b.Title
+	if summary == "" {
+		summary = "Booked"
+	}
+	status := "CONFIRMED"
+	if b.Status == repository.BookingStatusCancelled {
+		status = "CANCELLED"
+	}
+	return ical.Event{
+		UID:      b.ID + "@" + h.uidDomain(),
+		Summary:  summary,
+		Start:    b.StartsAt,
+		End:      b.EndsAt,
+		Location: where,
+		Status:   status,
+		Stamp:    now,
+	}
+}
+
+// seriesEvents writes the occurrences of a series a feed shows as a
+// recurring event in loc, the zone of the series' office: the rule from the
+// first occurrence, EXDATEs for those cancelled or left out by keep, and an
+// override for each one moved or renamed. A series with nothing left to show
+// is one cancelled event. event turns a booking into the feed's event.
+func (h *Handler) seriesEvents(occurrences []repository.Booking, keep func(*repository.Booking) bool, event func(*repository.Booking) ical.Event, loc *time.Location) ([]ical.Event, error) {
+	first := occurrences[0]
+	rule, err := ical.ParseRRule(first.RRule, loc)
+	if err != nil {
+		return nil, err
+	}
+	dtstart := first.RecurrenceID
+	if dtstart.IsZero() {
+		dtstart = first.StartsAt
+	}
+	length := first.EndsAt.Sub(first.StartsAt)
+	master := event(&first)
+	master.UID = first.SeriesID + "@" + h.uidDomain()
+	master.Start, master.End = dtstart, dtstart.Add(length)
+	master.RRule = rule.String()
+	master.Zone = loc
+
+	byStart := map[int64]*repository.Booking{}
+	active := false
+	for i := range occurrences {
+		o := &occurrences[i]
+		byStart[o.RecurrenceID.Unix()] = o
+		if keep(o) && o.Status == repository.BookingStatusActive {
+			active = true
+		}
+	}
+	if !active {
+		master.Status = "CANCELLED"
+		return []ical.Event{master}, nil
+	}
+
+	events := []ical.Event{master}
+	for _, s := range rule.Occurrences(dtstart.In(loc), dtstart.AddDate(maxSeriesYears+1, 0, 0)) {
+		o, ok := byStart[s.Unix()]
+		if !ok || !keep(o) || o.Status != repository.BookingStatusActive {
+			events[0].ExDates = append(events[0].ExDates, s)
+			continue
+		}
+		if o.StartsAt.Equal(s) && o.EndsAt.Sub(o.StartsAt) == length && o.Title == first.Title {
+			continue
+		}
+		override := event(o)
+		override.UID = master.UID
+		override.Zone = loc
+		override.RecurrenceID = s
+		events = append(events, override)
+	}
+	return events, nil
+}
+
+// GetRoomCalendarFeed serves a room's bookings as an iCalendar feed that
+// Outlook, Apple Calendar and Thunderbird can subscribe to. It covers the
+// last 90 days onward, with times in the office timezone. Calendar clients
+// cannot sign in, so the feed is public and gives only titles and times.
+func (h *Handler) GetRoomCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	room, err := h.repo.GetRoom(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to load room", err)
+		return
+	}
+	loc := h.defaultLocation()
+	office, err := h.repo.GetOffice(r.Context(), room.OfficeID)
+	switch {
+	case err == nil:
+		loc = h.officeLocation(office)
+	case !errors.Is(err, sql.ErrNoRows):
+		storeError(w, "Failed to load office", err)
+		return
+	}
+	now := time.Now().UTC()
+	bookings, err := h.repo.ListRoomCalendar(r.Context(), room.ID, now.Add(-feedHistory))
+	if err != nil {
+		storeError(w, "Failed to load bookings", err)
+		return
+	}
+
+	inRoom := func(b *repository.Booking) bool { return b.RoomID == room.ID }
+	event := func(b *repository.Booking) ical.Event { return h.bookingEvent(b, room.Name, now) }
+	cal := ical.Calendar{ProdID: calendarProdID, Name: room.Name, Location: loc}
+	seen := map[string]bool{}
+	for i := range bookings {
+		b := &bookings[i]
+		if b.SeriesID == "" {
+			cal.Events = append(cal.Events, event(b))
+			continue
+		}
+		if seen[b.SeriesID] {
+			continue
+		}
+		seen[b.SeriesID] = true
+		occurrences, err := h.repo.ListBookingSeries(r.Context(), b.SeriesID)
+		if err != nil {
+			storeError(w, "Failed to load series", err)
+			return
+		}
+		if len(occurrences) == 0 {
+			// Deleted since the bookings were listed
+			continue
+		}
+		events, err := h.seriesEvents(occurrences, inRoom, event, loc)
+		if err != nil {
+			storeError(w, "Failed to read series rule", err)
+			return
+		}
+		cal.Events = append(cal.Events, events...)
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="room.ics"`)
+	ical.Write(w, cal)
+}
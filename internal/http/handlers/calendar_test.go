@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/ical"
+)
+
+func TestHandler_GetRoomCalendarFeed(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	single := createTestBooking(t, h, "room-101", "user-regular", "2099-03-04T15:00:00Z", "2099-03-04T16:00:00Z")
+	cancelled := createTestBooking(t, h, "room-101", "user-regular", "2099-03-05T15:00:00Z", "2099-03-05T16:00:00Z")
+	w := httptest.NewRecorder()
+	h.DeleteBooking(w, bookingRequest("DELETE", cancelled.ID, "user-regular", ""))
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	// Weekly at 10:00 New York time: cancel the second, rename the third
+	series := createTestSeries(t, h, "")
+	w = httptest.NewRecorder()
+	h.DeleteBooking(w, scopedRequest("DELETE", series.Occurrences[1].ID, ScopeOccurrence, ""))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	w = httptest.NewRecorder()
+	h.UpdateBooking(w, scopedRequest("PATCH", series.Occurrences[2].ID, ScopeOccurrence, `{"title":"Planning"}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	createTestBooking(t, h, "room-102", "user-regular", "2099-03-04T15:00:00Z", "2099-03-04T16:00:00Z")
+
+	w = httptest.NewRecorder()
+	h.GetRoomCalendarFeed(w, withURLParam(httptest.NewRequest("GET", "/rooms/room-101/calendar.ics", nil), "id", "room-101"))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+	out := w.Body.String()
+
+	assert.Contains(t, out, "BEGIN:VTIMEZONE\r\nTZID:America/New_York\r\n")
+	assert.Contains(t, out, "UID:"+single.ID+"@roombooker\r\n")
+	assert.Contains(t, out, "DTSTART;TZID=America/New_York:20990304T100000\r\n")
+	assert.Contains(t, out, "UID:"+series.ID+"@roombooker\r\n")
+	assert.Contains(t, out, "RRULE:FREQ=WEEKLY;COUNT=4\r\n")
+	assert.Contains(t, out, "EXDATE;TZID=America/New_York:20990309T100000\r\n")
+	assert.Contains(t, out, "RECURRENCE-ID;TZID=America/New_York:20990316T100000\r\nSUMMARY:Planning\r\n")
+
+	events, err := ical.Parse(strings.NewReader(out), time.UTC)
+	require.NoError(t, err)
+	require.Len(t, events, 4, "two bookings, the series and its renamed occurrence")
+	statuses := map[string]int{}
+	for _, e := range events {
+		assert.Equal(t, "Room 101", e.Location)
+		statuses[e.Status]++
+	}
+	assert.Equal(t, map[string]int{"CONFIRMED": 3, "CANCELLED": 1}, statuses)
+
+	w = httptest.NewRecorder()
+	h.GetRoomCalendarFeed(w, withURLParam(httptest.NewRequest("GET", "/rooms/missing/calendar.ics", nil), "id", "missing"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_GetRoomCalendarFeed_CancelledSeries(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	series := createTestSeries(t, h, "")
+	w := httptest.NewRecorder()
+	h.DeleteBooking(w, scopedRequest("DELETE", series.Occurrences[0].ID, ScopeSeries, ""))
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	h.GetRoomCalendarFeed(w, withURLParam(httptest.NewRequest("GET", "/rooms/room-101/calendar.ics", nil), "id", "room-101"))
+	require.Equal(t, http.StatusOK, w.Code)
+	events, err := ical.Parse(strings.NewReader(w.Body.String()), time.UTC)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "CANCELLED", events[0].Status)
+}
+
+func TestHandler_GetRoomCalendarFeed_VanishedSeries(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	createTestSeries(t, h, "")
+	h.bgWG.Wait()
+	h.repo = vanishedSeriesStore{Store: h.repo}
+
+	w := httptest.NewRecorder()
+	h.GetRoomCalendarFeed(w, withURLParam(httptest.NewRequest("GET", "/rooms/room-101/calendar.ics", nil), "id", "room-101"))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	events, err := ical.Parse(strings.NewReader(w.Body.String()), time.UTC)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"roombooker/internal/ical"
+	"roombooker/internal/repository"
+)
+
+const personalProdID = "-//Roombooker//My Bookings//EN"
+
+// CalendarFeed tells a user whether their personal feed is on, and where it
+// is just after it was turned on or rotated
+type CalendarFeed struct {
+	Enabled bool   `json:"enabled"`
+	URL     string `json:"url,omitempty"`
+}
+
+// newFeedToken returns a random token for a feed URL and the hash stored in
+// its place, so a leaked database does not leak working feed URLs
+func newFeedToken() (token, hash string, err error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b[:])
+	return token, hashFeedToken(token), nil
+}
+
+func hashFeedToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// feedURL is where a token's feed is served: under APP_BASE_URL when set,
+// otherwise under the host the request came in on
+func (h *Handler) feedURL(r *http.Request, token string) string {
+	base := ""
+	if h.config != nil {
+		base = strings.TrimSuffix(h.config.App.BaseURL, "/")
+	}
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	return base + "/feeds/" + token + ".ics"
+}
+
+// GetCalendarFeed reports whether the signed-in user's personal feed is on.
+// The URL itself is only shown when it is made.
+func (h *Handler) GetCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	userID := fmt.Sprintf("%v", r.Context().Value("user_id"))
+	enabled, err := h.repo.HasFeedToken(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to load feed", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CalendarFeed{Enabled: enabled})
+}
+
+// RotateCalendarFeed turns the signed-in user's personal feed on, or gives it
+// a new URL if it already was, so the old URL stops working
+func (h *Handler) RotateCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	userID := fmt.Sprintf("%v", r.Context().Value("user_id"))
+	token, hash, err := newFeedToken()
+	if err != nil {
+		h.logger.Error("cannot generate feed token", zap.Error(err))
+		http.Error(w, "Failed to create feed", http.StatusInternalServerError)
+		return
+	}
+	ctx := audited(r, h.auditEntry(r, "calendar_feed.rotate", "user", userID, nil))
+	if err := h.repo.SetFeedToken(ctx, userID, hash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to create feed", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CalendarFeed{Enabled: true, URL: h.feedURL(r, token)})
+}
+
+// RevokeCalendarFeed turns the signed-in user's personal feed off
+func (h *Handler) RevokeCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	userID := fmt.Sprintf("%v", r.Context().Value("user_id"))
+	ctx := audited(r, h.auditEntry(r, "calendar_feed.revoke", "user", userID, nil))
+	if err := h.repo.SetFeedToken(ctx, userID, ""); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to revoke feed", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// feedRoom is what the personal feed needs to know about a booking's room
+type feedRoom struct {
+	name string
+	loc  *time.Location
+}
+
+// feedRooms looks up rooms and the zones of their offices, once each.
+// Bookings of rooms since deleted are written without a location in fallback.
+func (h *Handler) feedRooms(ctx context.Context, fallback *time.Location) func(roomID string) (feedRoom, error) {
+	rooms := map[string]feedRoom{}
+	zones := map[string]*time.Location{}
+	return func(roomID string) (feedRoom, error) {
+		if fr, ok := rooms[roomID]; ok {
+			return fr, nil
+		}
+		fr := feedRoom{loc: fallback}
+		room, err := h.repo.GetRoom(ctx, roomID)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return fr, err
+		default:
+			fr.name = room.Name
+			loc, ok := zones[room.OfficeID]
+			if !ok {
+				office, err := h.repo.GetOffice(ctx, room.OfficeID)
+				switch {
+				case err == nil:
+					loc = h.officeLocation(office)
+				case errors.Is(err, sql.ErrNoRows):
+					loc = h.defaultLocation()
+				default:
+					return fr, err
+				}
+				zones[room.OfficeID] = loc
+			}
+			fr.loc = loc
+		}
+		rooms[roomID] = fr
+		return fr, nil
+	}
+}
+
+// GetPersonalCalendarFeed serves everything a user booked or is invited to,
+// across all rooms, as an iCalendar feed. Calendar clients cannot sign in, so
+// the secret token in the URL stands in for the session; the feed is private
+// and so gives descriptions as well as titles. Each booking is written in its
+// office's timezone, the calendar in the user's.
+func (h *Handler) GetPersonalCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	if token == "" {
+		http.Error(w, "Feed not found", http.StatusNotFound)
+		return
+	}
+	user, err := h.repo.GetUserByFeedToken(r.Context(), hashFeedToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Feed not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to load feed", err)
+		return
+	}
+	loc, err := loadTimezone(user.Timezone)
+	if err != nil {
+		loc = h.defaultLocation()
+	}
+	now := time.Now().UTC()
+	since := now.Add(-feedHistory)
+	bookings, err := h.repo.ListUserCalendar(r.Context(), user.ID, user.Email, since)
+	if err != nil {
+		storeError(w, "Failed to load bookings", err)
+		return
+	}
+
+	mine := map[string]bool{}
+	for _, b := range bookings {
+		mine[b.ID] = true
+	}
+	// Occurrences from before the feed's window are kept when the user made
+	// them; invitations to them are not looked up
+	keep := func(b *repository.Booking) bool { return mine[b.ID] || b.CreatedBy == user.ID }
+	rooms := h.feedRooms(r.Context(), loc)
+	var roomErr error
+	event := func(b *repository.Booking) ical.Event {
+		room, err := rooms(b.RoomID)
+		if err != nil {
+			roomErr = err
+		}
+		e := h.bookingEvent(b, room.name, now)
+		e.Description = b.Description
+		e.Zone = room.loc
+		return e
+	}
+
+	cal := ical.Calendar{ProdID: personalProdID, Name: "My bookings", Location: loc}
+	seen := map[string]bool{}
+	for i := range bookings {
+		b := &bookings[i]
+		if b.SeriesID == "" {
+			cal.Events = append(cal.Events, event(b))
+			continue
+		}
+		if seen[b.SeriesID] {
+			continue
+		}
+		seen[b.SeriesID] = true
+		occurrences, err := h.repo.ListBookingSeries(r.Context(), b.SeriesID)
+		if err != nil {
+			storeError(w, "Failed to load series", err)
+			return
+		}
+		if len(occurrences) == 0 {
+			// Deleted since the bookings were listed
+			continue
+		}
+		room, err := rooms(occurrences[0].RoomID)
+		if err != nil {
+			storeError(w, "Failed to load room", err)
+			return
+		}
+		events, err := h.seriesEvents(occurrences, keep, event, room.loc)
+		if err != nil {
+			storeError(w, "Failed to read series rule", err)
+			return
+		}
+		cal.Events = append(cal.Events, events...)
+	}
+	if roomErr != nil {
+		storeError(w, "Failed to load room", roomErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="bookings.ics"`)
+	w.Header().Set("Cache-Control", "private")
+	ical.Write(w, cal)
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/ical"
+	"roombooker/internal/repository"
+)
+
+// feedRouter serves the personal feed the way SetupRoutes does, so the
+// token is read from the URL
+func feedRouter(h *Handler) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/feeds/{token}.ics", h.GetPersonalCalendarFeed)
+	return r
+}
+
+func rotateFeed(t *testing.T, h *Handler, userID string) string {
+	w := httptest.NewRecorder()
+	h.RotateCalendarFeed(w, withUser(httptest.NewRequest("POST", "/me/calendar-feed", nil), userID))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var feed CalendarFeed
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &feed))
+	assert.True(t, feed.Enabled)
+	require.True(t, strings.HasPrefix(feed.URL, "http://example.com/feeds/"), feed.URL)
+	return strings.TrimPrefix(feed.URL, "http://example.com")
+}
+
+func TestHandler_CalendarFeedToken(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	enabled := func() bool {
+		w := httptest.NewRecorder()
+		h.GetCalendarFeed(w, withUser(httptest.NewRequest("GET", "/me/calendar-feed", nil), "user-regular"))
+		require.Equal(t, http.StatusOK, w.Code)
+		var feed CalendarFeed
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &feed))
+		assert.Empty(t, feed.URL, "the URL is only shown when made")
+		return feed.Enabled
+	}
+	fetch := func(path string) int {
+		w := httptest.NewRecorder()
+		feedRouter(h).ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+
+	assert.False(t, enabled())
+	first := rotateFeed(t, h, "user-regular")
+	assert.True(t, enabled())
+	assert.Equal(t, http.StatusOK, fetch(first))
+
+	second := rotateFeed(t, h, "user-regular")
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, http.StatusNotFound, fetch(first), "rotating retires the old URL")
+	assert.Equal(t, http.StatusOK, fetch(second))
+
+	w := httptest.NewRecorder()
+	h.RevokeCalendarFeed(w, withUser(httptest.NewRequest("DELETE", "/me/calendar-feed", nil), "user-regular"))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	assert.False(t, enabled())
+	assert.Equal(t, http.StatusNotFound, fetch(second))
+	assert.Equal(t, http.StatusNotFound, fetch("/feeds/guess.ics"))
+
+	logs, err := h.repo.ListAuditLogs(context.Background(), repository.AuditFilter{EntityID: "user-regular"})
+	require.NoError(t, err)
+	var actions []string
+	for _, l := range logs {
+		actions = append(actions, l.Action)
+	}
+	assert.ElementsMatch(t, []string{"calendar_feed.rotate", "calendar_feed.rotate", "calendar_feed.revoke"}, actions)
+}
+
+func TestHandler_GetPersonalCalendarFeed(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	own := createTestBooking(t, h, "room-101", "user-regular", "2099-03-04T15:00:00Z", "2099-03-04T16:00:00Z")
+	series := createTestSeries(t, h, "")
+	createTestBooking(t, h, "room-102", "user-admin", "2099-03-05T15:00:00Z", "2099-03-05T16:00:00Z")
+
+	body := `{"title":"Review","description":"Bring the numbers","start_time":"2099-03-06T15:00:00Z","end_time":"2099-03-06T16:00:00Z","room_id":"room-103","attendees":["user@example.com"]}`
+	w := httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-admin"))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var invited Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &invited))
+
+	path := rotateFeed(t, h, "user-regular")
+	w = httptest.NewRecorder()
+	feedRouter(h).ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+	out := w.Body.String()
+
+	assert.Contains(t, out, "X-WR-TIMEZONE:America/New_York\r\n")
+	assert.Contains(t, out, "UID:"+own.ID+"@roombooker\r\n")
+	assert.Contains(t, out, "UID:"+series.ID+"@roombooker\r\n")
+	assert.Contains(t, out, "RRULE:FREQ=WEEKLY;COUNT=4\r\n")
+	assert.Contains(t, out, "UID:"+invited.ID+"@roombooker\r\n")
+	assert.Contains(t, out, "DESCRIPTION:Bring the numbers\r\n", "the feed is private")
+
+	events, err := ical.Parse(strings.NewReader(out), time.UTC)
+	require.NoError(t, err)
+	require.Len(t, events, 3, "the user's booking, series and invitation, not other people's bookings")
+	rooms := map[string]bool{}
+	for _, e := range events {
+		rooms[e.Location] = true
+	}
+	assert.Equal(t, map[string]bool{"Room 101": true, "Room 103": true}, rooms)
+}
+
+// vanishedSeriesStore finds no occurrences of any series, as when an office
+// is deleted between listing bookings and loading their series
+type vanishedSeriesStore struct {
+	repository.Store
+}
+
+func (vanishedSeriesStore) ListBookingSeries(ctx context.Context, seriesID string) ([]repository.Booking, error) {
+	return nil, nil
+}
+
+func TestHandler_GetPersonalCalendarFeed_VanishedSeries(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	own := createTestBooking(t, h, "room-101", "user-regular", "2099-03-04T15:00:00Z", "2099-03-04T16:00:00Z")
+	createTestSeries(t, h, "")
+	path := rotateFeed(t, h, "user-regular")
+	h.bgWG.Wait()
+	h.repo = vanishedSeriesStore{Store: h.repo}
+
+	w := httptest.NewRecorder()
+	feedRouter(h).ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	events, err := ical.Parse(strings.NewReader(w.Body.String()), time.UTC)
+	require.NoError(t, err)
+	require.Len(t, events, 1, "the series is left out")
+	assert.Equal(t, own.ID+"@roombooker", events[0].UID)
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"roombooker/internal/repository"
+)
+
+// Floor is a floor of an office as exposed to the admin panel
+type Floor struct {
+	ID       string `json:"id"`
+	OfficeID string `json:"office_id"`
+	Number   int    `json:"number"`
+	Label    string `json:"label"`
+}
+
+func floorFromRepo(f *repository.Floor) Floor {
+	return Floor{ID: f.ID, OfficeID: f.OfficeID, Number: f.Number, Label: f.Label}
+}
+
+// ListFloors returns the floors of the office given by ?office_id=
+func (h *Handler) ListFloors(w http.ResponseWriter, r *http.Request) {
+	officeID := r.URL.Query().Get("office_id")
+	if officeID == "" {
+		http.Error(w, "office_id required", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.repo.GetOffice(r.Context(), officeID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Office not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to load office", err)
+		return
+	}
+	floors, err := h.repo.ListFloors(r.Context(), officeID)
+	if err != nil {
+		storeError(w, "Failed to load floors", err)
+		return
+	}
+	out := make([]Floor, 0, len(floors))
+	for i := range floors {
+		out = append(out, floorFromRepo(&floors[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (h *Handler) CreateFloor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		OfficeID string `json:"office_id"`
+		Number   int    `json:"number"`
+		Label    string `json:"label"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.OfficeID == "" {
+		http.Error(w, "office_id required", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.repo.GetOffice(r.Context(), req.OfficeID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Unknown office_id", http.StatusBadRequest)
+			return
+		}
+		storeError(w, "Failed to load office", err)
+		return
+	}
+
+	ctx := h.auditedCreate(r, "floor.create", "floor", func(id string) interface{} {
+		return map[string]interface{}{"after": Floor{ID: id, OfficeID: req.OfficeID, Number: req.Number, Label: req.Label}}
+	})
+	id, err := h.repo.CreateFloor(ctx, req.OfficeID, req.Number, req.Label)
+	if err != nil {
+		if errors.Is(err, repository.ErrFloorNumberTaken) {
+			http.Error(w, "Floor number already used in this office", http.StatusConflict)
+			return
+		}
+		storeError(w, "Failed to create floor", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Floor{ID: id, OfficeID: req.OfficeID, Number: req.Number, Label: req.Label})
+}
+
+// UpdateFloor renames and/or renumbers a floor; omitted fields are kept
+func (h *Handler) UpdateFloor(w http.ResponseWriter, r *http.Request) {
+	floorID := chi.URLParam(r, "id")
+
+	var req struct {
+		Number *int    `json:"number"`
+		Label  *string `json:"label"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	floor, err := h.repo.GetFloor(r.Context(), floorID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Floor not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to load floor", err)
+		return
+	}
+	before := *floor
+	if req.Number != nil {
+		floor.Number = *req.Number
+	}
+	if req.Label != nil {
+		floor.Label = *req.Label
+	}
+
+	ctx := audited(r, h.auditEntry(r, "floor.update", "floor", floor.ID, map[string]interface{}{
+		"before": floorFromRepo(&before),
+		"after":  floorFromRepo(floor),
+	}))
+	if err := h.repo.UpdateFloor(ctx, floor); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Floor not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrFloorNumberTaken):
+			http.Error(w, "Floor number already used in this office", http.StatusConflict)
+		default:
+			storeError(w, "Failed to update floor", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(floorFromRepo(floor))
+}
+
+// DeleteFloor removes a floor once all its rooms are gone
+func (h *Handler) DeleteFloor(w http.ResponseWriter, r *http.Request) {
+	floorID := chi.URLParam(r, "id")
+
+	floor, err := h.repo.GetFloor(r.Context(), floorID)
+	if err == nil {
+		ctx := audited(r, h.auditEntry(r, "floor.delete", "floor", floorID, map[string]interface{}{"before": floorFromRepo(floor)}))
+		err = h.repo.DeleteFloor(ctx, floorID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Floor not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrFloorHasRooms):
+			http.Error(w, "Floor still has rooms; move or delete them first", http.StatusConflict)
+		default:
+			storeError(w, "Failed to delete floor", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Floor " + floorID + " deleted"})
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_FloorCRUD(t *testing.T) {
+	h := newBookingsTestHandler(t)
+
+	// Seeded office-1 already has floors 1 to 8
+	w := httptest.NewRecorder()
+	h.CreateFloor(w, httptest.NewRequest("POST", "/api/admin/floors", strings.NewReader(`{"office_id":"office-1","number":3,"label":"Again"}`)))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	h.CreateFloor(w, httptest.NewRequest("POST", "/api/admin/floors", strings.NewReader(`{"office_id":"office-1","number":9,"label":"Roof"}`)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created Floor
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.ID)
+	assert.Equal(t, 9, created.Number)
+
+	req := withURLParam(httptest.NewRequest("PATCH", "/api/admin/floors/"+created.ID, strings.NewReader(`{"label":"Roof Terrace"}`)), "id", created.ID)
+	w = httptest.NewRecorder()
+	h.UpdateFloor(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated Floor
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, Floor{ID: created.ID, OfficeID: "office-1", Number: 9, Label: "Roof Terrace"}, updated)
+
+	w = httptest.NewRecorder()
+	h.ListFloors(w, httptest.NewRequest("GET", "/api/admin/floors?office_id=office-1", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var floors []Floor
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &floors))
+	require.Len(t, floors, 9)
+	assert.Equal(t, updated, floors[8])
+
+	req = withURLParam(httptest.NewRequest("DELETE", "/api/admin/floors/"+created.ID, nil), "id", created.ID)
+	w = httptest.NewRecorder()
+	h.DeleteFloor(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHandler_DeleteFloor_WithRooms(t *testing.T) {
+	h := newBookingsTestHandler(t)
+
+	req := withURLParam(httptest.NewRequest("DELETE", "/api/admin/floors/floor-1-1", nil), "id", "floor-1-1")
+	w := httptest.NewRecorder()
+	h.DeleteFloor(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	req = withURLParam(httptest.NewRequest("DELETE", "/api/admin/floors/missing", nil), "id", "missing")
+	w = httptest.NewRecorder()
+	h.DeleteFloor(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_CreateFloor_UnknownOffice(t *testing.T) {
+	h := newBookingsTestHandler(t)
+
+	w := httptest.NewRecorder()
+	h.CreateFloor(w, httptest.NewRequest("POST", "/api/admin/floors", strings.NewReader(`{"office_id":"nope","number":1}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -2,10 +2,11 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
 	"sync"
 	"time"
 
@@ -15,52 +16,159 @@ import (
 	"roombooker/internal/auth"
 	"roombooker/internal/config"
 	"roombooker/internal/msgraph"
+	"roombooker/internal/notify"
 	"roombooker/internal/repository"
 )
 
 type Handler struct {
-	repo        *repository.Repository
+	repo        repository.Store
 	authService *auth.Service
 	graphClient *msgraph.Client
+	notifier    notify.Notifier
 	config      *config.Config
 	logger      *zap.Logger
-	// in-memory bookings store for dev/testing
-	bookings   map[string][]Booking
-	bookingsMu sync.Mutex
+	// background work (Graph sync) that Shutdown waits for
+	bgCtx    context.Context
+	bgCancel context.CancelFunc
+	bgWG     sync.WaitGroup
 }
 
 // Booking represents a calendar booking returned to the frontend
 type Booking struct {
-	ID     string `json:"id"`
-	Title  string `json:"title"`
-	Start  string `json:"start"`
-	End    string `json:"end"`
-	UserID string `json:"user_id"`
-	RoomID string `json:"room_id"`
-	Color  string `json:"color,omitempty"`
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Start       string `json:"start"`
+	End         string `json:"end"`
+	UserID      string `json:"user_id"`
+	RoomID      string `json:"room_id"`
+	Status      string `json:"status,omitempty"`
+	Color       string `json:"color,omitempty"`
+	// Occurrences of a recurring booking carry its series id and rule, and
+	// the start the rule gave them
+	SeriesID     string `json:"series_id,omitempty"`
+	RRule        string `json:"rrule,omitempty"`
+	RecurrenceID string `json:"recurrence_id,omitempty"`
+	// Attendees is filled in where a single booking is returned
+	Attendees []Attendee `json:"attendees,omitempty"`
+}
+
+// defaultBookingColor is the calendar color used for bookings
+const defaultBookingColor = "#3788d8"
+
+func bookingFromRepo(b *repository.Booking) Booking {
+	out := Booking{
+		ID:          b.ID,
+		Title:       b.Title,
+		Description: b.Description,
+		Start:       b.StartsAt.UTC().Format(time.RFC3339),
+		End:         b.EndsAt.UTC().Format(time.RFC3339),
+		UserID:      b.CreatedBy,
+		RoomID:      b.RoomID,
+		Status:      b.Status,
+		Color:       defaultBookingColor,
+		SeriesID:    b.SeriesID,
+		RRule:       b.RRule,
+	}
+	if !b.RecurrenceID.IsZero() {
+		out.RecurrenceID = b.RecurrenceID.UTC().Format(time.RFC3339)
+	}
+	return out
+}
+
+// Office is an office as listed to the frontend
+type Office struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	Timezone        string `json:"timezone"`
+	ReminderMinutes int    `json:"reminder_minutes"`
+}
+
+func officeFromRepo(o *repository.Office) Office {
+	return Office{ID: o.ID, Name: o.Name, Timezone: o.Timezone, ReminderMinutes: o.ReminderMinutes}
+}
+
+// Room is a bookable room with the floor it is on
+type Room struct {
+	ID               string          `json:"id"`
+	Name             string          `json:"name"`
+	Capacity         int             `json:"capacity"`
+	Equipment        json.RawMessage `json:"equipment,omitempty"`
+	OfficeID         string          `json:"office_id"`
+	FloorID          string          `json:"floor_id"`
+	Floor            string          `json:"floor"`
+	FloorNumber      int             `json:"floor_number"`
+	Color            string          `json:"color,omitempty"`
+	GraphIntegration bool            `json:"graph_integration"`
+	GraphResourceID  string          `json:"graph_resource_id,omitempty"`
+	DecommissionedAt string          `json:"decommissioned_at,omitempty"`
+}
+
+func roomFromRepo(rm *repository.Room) Room {
+	out := Room{
+		ID:               rm.ID,
+		Name:             rm.Name,
+		Capacity:         rm.Capacity,
+		OfficeID:         rm.OfficeID,
+		FloorID:          rm.FloorID,
+		Floor:            rm.FloorLabel,
+		FloorNumber:      rm.FloorNumber,
+		Color:            rm.Color,
+		GraphIntegration: rm.GraphIntegration,
+		GraphResourceID:  rm.GraphResourceID,
+	}
+	// Equipment is stored as JSON text; pass it through when it is valid
+	if json.Valid([]byte(rm.Equipment)) {
+		out.Equipment = json.RawMessage(rm.Equipment)
+	}
+	if !rm.DecommissionedAt.IsZero() {
+		out.DecommissionedAt = rm.DecommissionedAt.UTC().Format(time.RFC3339)
+	}
+	return out
 }
 
 // CreateBookingRequest is the expected payload from the frontend
 type CreateBookingRequest struct {
-	Title     string   `json:"title"`
-	StartTime string   `json:"start_time"`
-	EndTime   string   `json:"end_time"`
-	Attendees []string `json:"attendees"`
-	RoomID    string   `json:"room_id"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	StartTime   string            `json:"start_time"`
+	EndTime     string            `json:"end_time"`
+	Attendees   []AttendeeRequest `json:"attendees"`
+	RoomID      string            `json:"room_id"`
+	// RRule makes the booking recurring, with start_time as the first
+	// occurrence; ExDates leaves out occurrences, by start time or local date
+	RRule   string   `json:"rrule"`
+	ExDates []string `json:"exdates"`
+	// TZ is the IANA zone zone-less times are given in; it defaults to the
+	// timezone of the room's office
+	TZ string `json:"tz"`
 }
 
-func NewHandler(repo *repository.Repository, authService *auth.Service, graphClient *msgraph.Client, cfg *config.Config, logger *zap.Logger) *Handler {
+func NewHandler(repo repository.Store, authService *auth.Service, graphClient *msgraph.Client, cfg *config.Config, logger *zap.Logger) *Handler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	bgCtx, bgCancel := context.WithCancel(context.Background())
 	return &Handler{
 		repo:        repo,
 		authService: authService,
 		graphClient: graphClient,
+		notifier:    notify.NewLogNotifier(logger),
 		config:      cfg,
 		logger:      logger,
-		bookings:    make(map[string][]Booking),
+		bgCtx:       bgCtx,
+		bgCancel:    bgCancel,
 	}
 }
 
-func SetupRoutes(r *chi.Mux, repo *repository.Repository, authService *auth.Service, graphClient *msgraph.Client, cfg *config.Config, logger *zap.Logger) {
+// SetNotifier replaces the notifier used to tell users about changes to their bookings.
+// Call it before serving requests.
+func (h *Handler) SetNotifier(n notify.Notifier) {
+	h.notifier = n
+}
+
+// SetupRoutes registers all routes on r and returns the handler so the caller can Shutdown it
+func SetupRoutes(r *chi.Mux, repo repository.Store, authService *auth.Service, graphClient *msgraph.Client, cfg *config.Config, logger *zap.Logger) *Handler {
 	h := NewHandler(repo, authService, graphClient, cfg, logger)
 
 	r.Get("/health", h.HealthCheck)
@@ -74,34 +182,34 @@ func SetupRoutes(r *chi.Mux, repo *repository.Repository, authService *auth.Serv
 
 	// Public routes
 	r.Get("/login", h.LoginPage)
+	// Calendar clients cannot sign in to fetch feeds
+	r.Get("/rooms/{id}/calendar.ics", h.GetRoomCalendarFeed)
+	r.Get("/feeds/{token}.ics", h.GetPersonalCalendarFeed)
 
 	// Protected routes
 	r.Group(func(r chi.Router) {
 		r.Use(h.AuthMiddleware)
 		r.Get("/me", h.GetMe)
+		r.Get("/me/calendar-feed", h.GetCalendarFeed)
+		r.Post("/me/calendar-feed", h.RotateCalendarFeed)
+		r.Delete("/me/calendar-feed", h.RevokeCalendarFeed)
+		r.Get("/me/reminders", h.GetReminderPreference)
+		r.Put("/me/reminders", h.SetReminderPreference)
 
 		// API routes
 		r.Route("/api", func(r chi.Router) {
 			r.Get("/offices", h.GetOffices)
 			r.Get("/offices/{officeId}/rooms", h.GetRoomsByOffice)
+			r.Get("/offices/{officeId}/holidays", h.GetOfficeHolidays)
 			r.Get("/rooms/{id}/bookings", h.GetRoomBookings)
+			r.Get("/availability", h.GetAvailability)
 			r.Post("/bookings", h.CreateBooking)
 			r.Get("/bookings/{id}", h.GetBooking)
 			r.Patch("/bookings/{id}", h.UpdateBooking)
 			r.Delete("/bookings/{id}", h.DeleteBooking)
+			r.Post("/bookings/{id}/rsvp", h.RSVPBooking)
 
-			// Admin routes
-			r.Route("/admin", func(r chi.Router) {
-				r.Use(h.AdminMiddleware)
-				r.Get("/users", h.GetUsers)
-				r.Patch("/users/{id}/role", h.UpdateUserRole)
-				r.Post("/rooms", h.CreateRoom)
-				r.Patch("/rooms/{id}", h.UpdateRoom)
-				r.Delete("/rooms/{id}", h.DeleteRoom)
-				r.Post("/offices", h.CreateOffice)
-				r.Patch("/offices/{id}", h.UpdateOffice)
-				r.Delete("/offices/{id}", h.DeleteOffice)
-			})
+			r.Route("/admin", h.adminRoutes)
 		})
 	})
 
@@ -110,6 +218,35 @@ func SetupRoutes(r *chi.Mux, repo *repository.Repository, authService *auth.Serv
 
 	// Main page
 	r.Get("/", h.MainPage)
+
+	return h
+}
+
+// goBackground runs fn outside the request lifecycle; Shutdown waits for it
+func (h *Handler) goBackground(fn func(ctx context.Context)) {
+	h.bgWG.Add(1)
+	go func() {
+		defer h.bgWG.Done()
+		fn(h.bgCtx)
+	}()
+}
+
+// Shutdown waits for background work to finish. If ctx expires first the
+// remaining work is cancelled and ctx's error is returned.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.bgWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		h.bgCancel()
+		return nil
+	case <-ctx.Done():
+		h.bgCancel()
+		return ctx.Err()
+	}
 }
 
 func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
@@ -229,9 +366,12 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	pwHash := h.authService.HashPassword(req.Password)
-	id, err := h.repo.CreateUser(req.Email, req.DisplayName, "user", string(pwHash))
+	ctx := h.auditedCreate(r, "user.register", "user", func(id string) interface{} {
+		return map[string]interface{}{"after": map[string]string{"id": id, "email": req.Email, "role": "user"}}
+	})
+	id, err := h.repo.CreateUser(ctx, req.Email, req.DisplayName, "user", string(pwHash))
 	if err != nil {
-		http.Error(w, "Failed to create user: "+err.Error(), http.StatusInternalServerError)
+		storeError(w, "Failed to create user", err)
 		return
 	}
 
@@ -261,16 +401,13 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, pwHashStr, role, _, err := h.repo.GetUserCredentials(req.Email)
-	if err != nil {
-		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+	id, pwHashStr, role, _, err := h.repo.GetUserCredentials(r.Context(), req.Email)
+	if errors.Is(err, context.DeadlineExceeded) {
+		storeError(w, "Failed to load user", err)
 		return
 	}
-	if pwHashStr == "" {
-		http.Error(w, "invalid credentials", http.StatusUnauthorized)
-		return
-	}
-	if !h.authService.VerifyPassword([]byte(pwHashStr), req.Password) {
+	if err != nil || pwHashStr == "" || !h.authService.VerifyPassword([]byte(pwHashStr), req.Password) {
+		h.recordAudit(r, "user.login_failed", "user", id, map[string]string{"email": req.Email})
 		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	}
@@ -281,6 +418,7 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	http.SetCookie(w, &http.Cookie{Name: "auth_token", Value: token, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	h.recordAudit(r.WithContext(context.WithValue(r.Context(), "user_id", id)), "user.login", "user", id, nil)
 	json.NewEncoder(w).Encode(map[string]string{"id": id, "role": role})
 }
 
@@ -317,88 +455,82 @@ func (h *Handler) ServeStatic(w http.ResponseWriter, r *http.Request) {
 
 // Get offices
 func (h *Handler) GetOffices(w http.ResponseWriter, r *http.Request) {
-	// Mock data for now
-	offices := []map[string]interface{}{
-		{"id": "1", "name": "Main Office"},
-		{"id": "2", "name": "Branch Office"},
+	offices, err := h.repo.ListOffices(r.Context())
+	if err != nil {
+		storeError(w, "Failed to load offices", err)
+		return
+	}
+	out := make([]Office, 0, len(offices))
+	for i := range offices {
+		out = append(out, officeFromRepo(&offices[i]))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(offices)
+	json.NewEncoder(w).Encode(out)
 }
 
 // Get rooms by office
 func (h *Handler) GetRoomsByOffice(w http.ResponseWriter, r *http.Request) {
 	officeID := chi.URLParam(r, "officeId")
 
-	// Mock data for now
-	rooms := []map[string]interface{}{
-		{"id": "1", "name": "Conference Room A", "capacity": 10, "office_id": officeID},
-		{"id": "2", "name": "Meeting Room B", "capacity": 6, "office_id": officeID},
+	if _, err := h.repo.GetOffice(r.Context(), officeID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Office not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to load office", err)
+		return
+	}
+	rooms, err := h.repo.ListRoomsByOffice(r.Context(), officeID)
+	if err != nil {
+		storeError(w, "Failed to load rooms", err)
+		return
+	}
+	out := make([]Room, 0, len(rooms))
+	for i := range rooms {
+		out = append(out, roomFromRepo(&rooms[i]))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(rooms)
+	json.NewEncoder(w).Encode(out)
 }
 
 // Get room bookings
 func (h *Handler) GetRoomBookings(w http.ResponseWriter, r *http.Request) {
 	roomID := chi.URLParam(r, "id")
-	// Try to parse optional from/to query params for filtering
-	fromStr := r.URL.Query().Get("from")
-	toStr := r.URL.Query().Get("to")
+	renderIn, ok := responseLocation(w, r)
+	if !ok {
+		return
+	}
+	// Optional from/to bounds; zone-less ones are read in the room office's
+	// zone, or in ?tz=
+	q := r.URL.Query()
 	var fromT, toT time.Time
-	var err error
-	if fromStr != "" {
-		fromT, err = time.Parse(time.RFC3339, fromStr)
-		if err != nil {
-			// ignore parse error and return all
-			fromT = time.Time{}
+	if q.Get("from") != "" || q.Get("to") != "" {
+		loc, ok := h.roomQueryLocation(w, r, roomID)
+		if !ok {
+			return
 		}
-	}
-	if toStr != "" {
-		toT, err = time.Parse(time.RFC3339, toStr)
-		if err != nil {
-			toT = time.Time{}
+		if v := q.Get("from"); v != "" {
+			if fromT, ok = parseTimeField(w, "from", v, loc); !ok {
+				return
+			}
 		}
-	}
-
-	h.bookingsMu.Lock()
-	defer h.bookingsMu.Unlock()
-
-	raw := h.bookings[roomID]
-	// If no bookings exist in store, return a small sample so calendar isn't empty
-	if len(raw) == 0 {
-		sample := Booking{
-			ID:     "sample-1",
-			Title:  "Team Meeting",
-			Start:  "2024-01-15T10:00:00Z",
-			End:    "2024-01-15T11:00:00Z",
-			UserID: "user1",
-			RoomID: roomID,
-			Color:  "#3788d8",
+		if v := q.Get("to"); v != "" {
+			if toT, ok = parseTimeField(w, "to", v, loc); !ok {
+				return
+			}
 		}
-		raw = []Booking{sample}
 	}
 
-	// Filter by range if provided
-	var out []Booking
-	for _, b := range raw {
-		if fromT.IsZero() && toT.IsZero() {
-			out = append(out, b)
-			continue
-		}
-		// parse booking times
-		sb, err1 := time.Parse(time.RFC3339, b.Start)
-		eb, err2 := time.Parse(time.RFC3339, b.End)
-		if err1 != nil || err2 != nil {
-			// skip invalid
-			continue
-		}
-		// overlap check: b.Start < to && b.End > from
-		if (toT.IsZero() || sb.Before(toT)) && (fromT.IsZero() || eb.After(fromT)) {
-			out = append(out, b)
-		}
+	bookings, err := h.repo.ListBookingsByRoom(r.Context(), roomID, fromT, toT)
+	if err != nil {
+		storeError(w, "Failed to load bookings", err)
+		return
+	}
+	out := make([]Booking, 0, len(bookings))
+	for i := range bookings {
+		out = append(out, bookingFromRepo(&bookings[i]).In(renderIn))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -413,80 +545,231 @@ func (h *Handler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Build booking and store in-memory
-	id := strconv.FormatInt(time.Now().UnixNano(), 10)
-	userID := "unknown"
+	if req.RoomID == "" {
+		http.Error(w, "room_id required", http.StatusBadRequest)
+		return
+	}
+	userID := ""
 	if v := r.Context().Value("user_id"); v != nil {
 		userID = fmt.Sprintf("%v", v)
 	}
-	// Normalize start/end times: accept RFC3339, datetime-local (no zone), or common variants and store as RFC3339
-	var startT, endT time.Time
-	var err error
-	parseCandidates := []string{
-		time.RFC3339,
-		"2006-01-02T15:04",
-		"2006-01-02T15:04:05",
-		"2006-01-02 15:04:05",
+
+	renderIn, ok := responseLocation(w, r)
+	if !ok {
+		return
+	}
+	// Times with an offset are taken as they are; datetime-local values are
+	// wall-clock times in the request's tz or the office's
+	loc, ok := h.inputLocation(w, r, req.TZ, req.RoomID)
+	if !ok {
+		return
+	}
+	startT, ok := parseTimeField(w, "start_time", req.StartTime, loc)
+	if !ok {
+		return
+	}
+	endT, ok := parseTimeField(w, "end_time", req.EndTime, loc)
+	if !ok {
+		return
+	}
+	participants, ok := attendeeParticipants(w, req.Attendees)
+	if !ok {
+		return
+	}
+	if req.RRule != "" {
+		h.createBookingSeries(w, r, &req, participants, userID, startT, endT, renderIn)
+		return
+	}
+	if len(req.ExDates) > 0 {
+		http.Error(w, "exdates need an rrule", http.StatusBadRequest)
+		return
+	}
+	slot := bookingSlot{roomID: req.RoomID, start: startT, end: endT}
+	checked, ok := h.checkBookingSlot(w, r, slot)
+	if !ok {
+		return
+	}
+	if !h.checkCapacity(w, r, req.RoomID, userID, participants) {
+		return
 	}
 
-	tryParse := func(val string) (time.Time, error) {
-		for _, layout := range parseCandidates {
-			if t, e := time.Parse(layout, val); e == nil {
-				return t, nil
-			}
+	booking := &repository.Booking{
+		RoomID:      req.RoomID,
+		CreatedBy:   userID,
+		Title:       req.Title,
+		Description: req.Description,
+		StartsAt:    startT,
+		EndsAt:      endT,
+		Status:      repository.BookingStatusActive,
+	}
+	checked.apply(booking)
+	if len(participants) > 0 {
+		booking.Participants = participants
+	}
+	ctx := repository.WithAudit(r.Context(), func(ids []string) []repository.AuditLog {
+		created := *booking
+		created.ID = ids[0]
+		entries := append([]repository.AuditLog{h.auditEntry(r, "booking.create", "booking", created.ID, map[string]interface{}{
+			"after": bookingFromRepo(&created),
+		})}, h.overrideAudit(r, created.ID, checked.overridden)...)
+		if len(participants) > 0 {
+			entries = append(entries, h.attendeesAudit(r, created.ID, nil, participants))
 		}
-		// If value looks like 'YYYY-MM-DDTHH:MM' without timezone, try appending Z
-		if len(val) == 16 && val[10] == 'T' {
-			if t, e := time.Parse(time.RFC3339, val+":00Z"); e == nil {
-				return t, nil
-			}
+		return entries
+	})
+	id, err := h.repo.CreateBooking(ctx, booking)
+	if err != nil {
+		var conflict *repository.ConflictError
+		if errors.As(err, &conflict) {
+			writeConflict(w, conflict)
+			return
+		}
+		if errors.Is(err, repository.ErrBufferTaken) {
+			h.bufferTaken(w, r, slot)
+			return
 		}
-		return time.Time{}, fmt.Errorf("no parse")
+		storeError(w, "Failed to create booking", err)
+		return
 	}
+	booking.ID = id
+	h.syncBookingToGraph(*booking)
+	h.notifyBookingChange(bookingCreated, []repository.Booking{*booking}, nil)
 
-	startT, err = tryParse(req.StartTime)
-	if err == nil {
-		// if parsed without zone, assume local and convert to UTC
-		if startT.Location() == time.Local {
-			startT = startT.UTC()
-		}
+	out, err := h.bookingWithAttendees(r.Context(), booking)
+	if err != nil {
+		storeError(w, "Failed to load attendees", err)
+		return
 	}
-	endT, err = tryParse(req.EndTime)
-	if err == nil {
-		if endT.Location() == time.Local {
-			endT = endT.UTC()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(out.In(renderIn))
+}
+
+// syncBookingToGraph mirrors a new booking into the room's Outlook calendar in the background
+func (h *Handler) syncBookingToGraph(b repository.Booking) {
+	if h.graphClient == nil {
+		return
+	}
+	h.goBackground(func(ctx context.Context) {
+		resourceID, err := h.repo.GetRoomGraphResource(ctx, b.RoomID)
+		if err != nil || resourceID == "" {
+			return
+		}
+		const graphTime = "2006-01-02T15:04:05"
+		event, err := h.graphClient.CreateEvent(ctx, resourceID, b.Title, b.StartsAt.Format(graphTime), b.EndsAt.Format(graphTime))
+		if err != nil {
+			h.logger.Warn("graph event sync failed", zap.String("booking_id", b.ID), zap.Error(err))
+			return
 		}
+		if event == nil || (*event).GetId() == nil {
+			return
+		}
+		if err := h.repo.SetBookingExternalEventID(ctx, b.ID, *(*event).GetId()); err != nil {
+			h.logger.Warn("failed to store graph event id", zap.String("booking_id", b.ID), zap.Error(err))
+		}
+	})
+}
+
+// storeError answers a failed store call: 503 when the database did not reply
+// within the query timeout, so clients can retry, otherwise 500 prefixed by msg
+func storeError(w http.ResponseWriter, msg string, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Database timed out, please retry", http.StatusServiceUnavailable)
+		return
 	}
+	http.Error(w, msg+": "+err.Error(), http.StatusInternalServerError)
+}
 
-	startStr := req.StartTime
-	endStr := req.EndTime
-	if !startT.IsZero() {
-		startStr = startT.Format(time.RFC3339)
+// auditEntry builds an audit entry for the request's user. A payload that
+// cannot be encoded is logged and left out.
+func (h *Handler) auditEntry(r *http.Request, action, entityType, entityID string, payload interface{}) repository.AuditLog {
+	return h.auditEntryCtx(r.Context(), action, entityType, entityID, payload)
+}
+
+// auditEntryCtx is auditEntry for work done outside a request, by the user
+// whose id ctx carries
+func (h *Handler) auditEntryCtx(ctx context.Context, action, entityType, entityID string, payload interface{}) repository.AuditLog {
+	entry := repository.AuditLog{Action: action, EntityType: entityType, EntityID: entityID}
+	if v := ctx.Value("user_id"); v != nil {
+		entry.ActorUserID = fmt.Sprintf("%v", v)
 	}
-	if !endT.IsZero() {
-		endStr = endT.Format(time.RFC3339)
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			h.logger.Warn("cannot encode audit payload", zap.String("action", action), zap.Error(err))
+		}
+		entry.Payload = string(data)
 	}
+	return entry
+}
 
-	b := Booking{
-		ID:     id,
-		Title:  req.Title,
-		Start:  startStr,
-		End:    endStr,
-		UserID: userID,
-		RoomID: req.RoomID,
-		Color:  "#3788d8",
-	}
+// audited returns the request's context carrying audit entries, so the next
+// write made with it records them in the same transaction
+func audited(r *http.Request, entries ...repository.AuditLog) context.Context {
+	return repository.WithAudit(r.Context(), func([]string) []repository.AuditLog { return entries })
+}
 
-	h.bookingsMu.Lock()
-	h.bookings[req.RoomID] = append(h.bookings[req.RoomID], b)
-	h.bookingsMu.Unlock()
+// auditedCreate is audited for a write creating one row; payload builds the
+// entry's payload once the row's id is known
+func (h *Handler) auditedCreate(r *http.Request, action, entityType string, payload func(id string) interface{}) context.Context {
+	return repository.WithAudit(r.Context(), func(ids []string) []repository.AuditLog {
+		id := ""
+		if len(ids) > 0 {
+			id = ids[0]
+		}
+		return []repository.AuditLog{h.auditEntry(r, action, entityType, id, payload(id))}
+	})
+}
 
+// recordAudit appends an entry for the request's user to the audit trail, for
+// events that write nothing else, such as logins. A failure is logged rather
+// than failing the request.
+func (h *Handler) recordAudit(r *http.Request, action, entityType, entityID string, payload interface{}) {
+	entry := h.auditEntry(r, action, entityType, entityID, payload)
+	if _, err := h.repo.CreateAuditLog(r.Context(), &entry); err != nil {
+		h.logger.Warn("failed to record audit entry", zap.String("action", action), zap.String("entity_id", entityID), zap.Error(err))
+	}
+}
+
+// writeConflict reports the bookings blocking a slot so the UI can show them
+func writeConflict(w http.ResponseWriter, conflict *repository.ConflictError) {
+	conflicts := make([]Booking, 0, len(conflict.Conflicts))
+	for i := range conflict.Conflicts {
+		conflicts = append(conflicts, bookingFromRepo(&conflict.Conflicts[i]))
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(b)
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   "Room is already booked for the requested time",
+		"conflicts": conflicts,
+	})
 }
 
-// Admin middleware
+// adminRoutes registers the routes under /api/admin, which only admins may use
+func (h *Handler) adminRoutes(r chi.Router) {
+	r.Use(h.AdminMiddleware)
+	r.Get("/users", h.GetUsers)
+	r.Get("/audit", h.ListAuditLogs)
+	r.Patch("/users/{id}/role", h.UpdateUserRole)
+	r.Get("/floors", h.ListFloors)
+	r.Post("/floors", h.CreateFloor)
+	r.Patch("/floors/{id}", h.UpdateFloor)
+	r.Delete("/floors/{id}", h.DeleteFloor)
+	r.Post("/rooms", h.CreateRoom)
+	r.Patch("/rooms/{id}", h.UpdateRoom)
+	r.Delete("/rooms/{id}", h.DeleteRoom)
+	r.Post("/rooms/{id}/import", h.ImportRoomBookings)
+	r.Post("/offices", h.CreateOffice)
+	r.Patch("/offices/{id}", h.UpdateOffice)
+	r.Delete("/offices/{id}", h.DeleteOffice)
+	r.Post("/holidays", h.CreateHoliday)
+	r.Post("/holidays/import", h.ImportHolidays)
+	r.Patch("/holidays/{id}", h.UpdateHoliday)
+	r.Delete("/holidays/{id}", h.DeleteHoliday)
+}
+
+// AdminMiddleware lets only users whose role is admin through
 func (h *Handler) AdminMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID := r.Context().Value("user_id")
@@ -495,11 +778,12 @@ func (h *Handler) AdminMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Check if user is admin (mock check for now)
-		// In real implementation, check user role from database
-		isAdmin := true // Mock admin check
-
-		if !isAdmin {
+		admin, err := h.isAdmin(r)
+		if err != nil {
+			storeError(w, "Failed to load user", err)
+			return
+		}
+		if !admin {
 			http.Error(w, "Admin access required", http.StatusForbidden)
 			return
 		}
@@ -519,23 +803,40 @@ func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(users)
 }
 
+// UpdateUserRole makes a user an admin or a regular user
 func (h *Handler) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
 	userID := chi.URLParam(r, "id")
 
-	var req map[string]string
+	var req struct {
+		Role string `json:"role"`
+	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-
-	// Mock response
-	response := map[string]interface{}{
-		"id":   userID,
-		"role": req["role"],
+	if req.Role != "user" && req.Role != "admin" {
+		http.Error(w, "role must be user or admin", http.StatusBadRequest)
+		return
+	}
+	user, err := h.repo.GetUserByID(r.Context(), userID)
+	if err == nil {
+		ctx := audited(r, h.auditEntry(r, "user.role", "user", userID, map[string]interface{}{
+			"before": map[string]string{"role": user.Role},
+			"after":  map[string]string{"role": req.Role},
+		}))
+		err = h.repo.UpdateUserRole(ctx, userID, req.Role)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to update user", err)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(map[string]string{"id": userID, "role": req.Role})
 }
 
 func (h *Handler) CreateRoom(w http.ResponseWriter, r *http.Request) {
@@ -549,9 +850,14 @@ func (h *Handler) CreateRoom(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-	id, err := h.repo.CreateRoom(req.FloorID, req.Name, req.Capacity, req.Equipment)
+	ctx := h.auditedCreate(r, "room.create", "room", func(id string) interface{} {
+		return map[string]interface{}{"after": map[string]interface{}{
+			"id": id, "floor_id": req.FloorID, "name": req.Name, "capacity": req.Capacity, "equipment": req.Equipment,
+		}}
+	})
+	id, err := h.repo.CreateRoom(ctx, req.FloorID, req.Name, req.Capacity, req.Equipment)
 	if err != nil {
-		http.Error(w, "Failed to create room: "+err.Error(), http.StatusInternalServerError)
+		storeError(w, "Failed to create room", err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -559,28 +865,6 @@ func (h *Handler) CreateRoom(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"id": id, "name": req.Name})
 }
 
-func (h *Handler) UpdateRoom(w http.ResponseWriter, r *http.Request) {
-	roomID := chi.URLParam(r, "id")
-
-	var room map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&room); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
-	}
-
-	room["id"] = roomID
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(room)
-}
-
-func (h *Handler) DeleteRoom(w http.ResponseWriter, r *http.Request) {
-	roomID := chi.URLParam(r, "id")
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Room " + roomID + " deleted"})
-}
-
 func (h *Handler) CreateOffice(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Name     string `json:"name"`
@@ -590,9 +874,19 @@ func (h *Handler) CreateOffice(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-	id, err := h.repo.CreateOffice(req.Name, req.Timezone)
+	if req.Timezone == "" {
+		req.Timezone = h.defaultLocation().String()
+	}
+	if _, err := loadTimezone(req.Timezone); err != nil {
+		http.Error(w, "invalid timezone: "+req.Timezone, http.StatusBadRequest)
+		return
+	}
+	ctx := h.auditedCreate(r, "office.create", "office", func(id string) interface{} {
+		return map[string]interface{}{"after": Office{ID: id, Name: req.Name, Timezone: req.Timezone, ReminderMinutes: repository.DefaultReminderMinutes}}
+	})
+	id, err := h.repo.CreateOffice(ctx, req.Name, req.Timezone)
 	if err != nil {
-		http.Error(w, "Failed to create office: "+err.Error(), http.StatusInternalServerError)
+		storeError(w, "Failed to create office", err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -600,33 +894,7 @@ func (h *Handler) CreateOffice(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"id": id, "name": req.Name})
 }
 
-func (h *Handler) UpdateOffice(w http.ResponseWriter, r *http.Request) {
-	officeID := chi.URLParam(r, "id")
-
-	var office map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&office); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
-	}
-
-	office["id"] = officeID
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(office)
-}
-
-func (h *Handler) DeleteOffice(w http.ResponseWriter, r *http.Request) {
-	officeID := chi.URLParam(r, "id")
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Office " + officeID + " deleted"})
-}
-
 // Placeholder handlers (keeping for compatibility)
 // func (h *Handler) Login(w http.ResponseWriter, r *http.Request)           { /* implemented above */ }
 func (h *Handler) GetRooms(w http.ResponseWriter, r *http.Request)        { /* implement */ }
 func (h *Handler) GetRoomCalendar(w http.ResponseWriter, r *http.Request) { /* implement */ }
-func (h *Handler) GetBooking(w http.ResponseWriter, r *http.Request)      { /* implement */ }
-func (h *Handler) UpdateBooking(w http.ResponseWriter, r *http.Request)   { /* implement */ }
-func (h *Handler) DeleteBooking(w http.ResponseWriter, r *http.Request)   { /* implement */ }
-func (h *Handler) GetAvailability(w http.ResponseWriter, r *http.Request) { /* implement */ }
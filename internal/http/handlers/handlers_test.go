@@ -1,13 +1,16 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
-	"roombooker/internal/config"
-
+	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/config"
 )
 
 func TestHandler_HealthCheck(t *testing.T) {
@@ -57,3 +60,29 @@ func TestHandler_AuthMiddleware_WithToken(t *testing.T) {
 	// Should proceed to next handler (though token validation would fail in real scenario)
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func TestHandler_AdminMiddleware(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	r := chi.NewRouter()
+	r.Route("/api/admin", h.adminRoutes)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/api/admin/audit", nil),
+		httptest.NewRequest("GET", "/api/admin/audit?format=csv", nil),
+		httptest.NewRequest("DELETE", "/api/admin/offices/office-1?force=true", nil),
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, withUser(req, "user-regular"))
+		assert.Equal(t, http.StatusForbidden, w.Code, req.URL)
+	}
+	_, err := h.repo.GetOffice(context.Background(), "office-1")
+	require.NoError(t, err, "the office is still there")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, withUser(httptest.NewRequest("GET", "/api/admin/audit", nil), "user-admin"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/admin/audit", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
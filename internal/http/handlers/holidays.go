@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"roombooker/internal/ical"
+	"roombooker/internal/repository"
+)
+
+// maxHolidayImportSize bounds an uploaded .ics file
+const maxHolidayImportSize = 1 << 20
+
+// Holiday is a day an office is closed, as a local date in the office timezone
+type Holiday struct {
+	ID          string `json:"id"`
+	OfficeID    string `json:"office_id"`
+	Date        string `json:"date"`
+	Description string `json:"description"`
+}
+
+func holidayFromRepo(h *repository.Holiday) Holiday {
+	return Holiday{ID: h.ID, OfficeID: h.OfficeID, Date: h.Date, Description: h.Description}
+}
+
+// holidaysBetween returns the holidays on local days that [from, to) touches.
+// A zero from or to leaves that side open.
+func holidaysBetween(holidays []repository.Holiday, from, to time.Time, loc *time.Location) []Holiday {
+	first, last := "", ""
+	if !from.IsZero() {
+		first = from.In(loc).Format(repository.DateLayout)
+	}
+	if !to.IsZero() {
+		last = to.Add(-time.Nanosecond).In(loc).Format(repository.DateLayout)
+	}
+	out := []Holiday{}
+	for i := range holidays {
+		if (first == "" || holidays[i].Date >= first) && (last == "" || holidays[i].Date <= last) {
+			out = append(out, holidayFromRepo(&holidays[i]))
+		}
+	}
+	return out
+}
+
+// loadOffice fetches the office named by the officeId URL parameter, or from
+// the office_id query parameter when there is none. It writes 404 if the office
+// does not exist.
+func (h *Handler) loadOffice(w http.ResponseWriter, r *http.Request) (*repository.Office, bool) {
+	officeID := chi.URLParam(r, "officeId")
+	if officeID == "" {
+		officeID = r.URL.Query().Get("office_id")
+	}
+	if officeID == "" {
+		http.Error(w, "office_id required", http.StatusBadRequest)
+		return nil, false
+	}
+	office, err := h.repo.GetOffice(r.Context(), officeID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Office not found", http.StatusNotFound)
+			return nil, false
+		}
+		storeError(w, "Failed to load office", err)
+		return nil, false
+	}
+	return office, true
+}
+
+// officeLocation returns the office's timezone, falling back to the default
+// zone if it is invalid
+func (h *Handler) officeLocation(office *repository.Office) *time.Location {
+	loc, err := loadTimezone(office.Timezone)
+	if err != nil {
+		h.logger.Warn("office has an invalid timezone; using the default", zap.String("office_id", office.ID), zap.Error(err))
+		return h.defaultLocation()
+	}
+	return loc
+}
+
+// GetOfficeHolidays lists an office's holidays ordered by date. Optional from
+// and to times limit it to the local days they span, so the calendar can ask
+// for the range it shows.
+func (h *Handler) GetOfficeHolidays(w http.ResponseWriter, r *http.Request) {
+	office, ok := h.loadOffice(w, r)
+	if !ok {
+		return
+	}
+	loc, ok := h.queryLocation(w, r, office)
+	if !ok {
+		return
+	}
+	var from, to time.Time
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, ok = parseTimeField(w, "from", v, loc); !ok {
+			return
+		}
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, ok = parseTimeField(w, "to", v, loc); !ok {
+			return
+		}
+	}
+	holidays, err := h.repo.ListHolidays(r.Context(), office.ID)
+	if err != nil {
+		storeError(w, "Failed to load holidays", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(holidaysBetween(holidays, from, to, h.officeLocation(office)))
+}
+
+// HolidayRequest holds a holiday's fields. On update omitted fields are kept
+// and office_id is ignored.
+type HolidayRequest struct {
+	OfficeID    string  `json:"office_id"`
+	Date        *string `json:"date"`
+	Description *string `json:"description"`
+}
+
+// validHolidayDate writes 400 and returns false unless date is a YYYY-MM-DD calendar day
+func validHolidayDate(w http.ResponseWriter, date string) bool {
+	if _, err := time.Parse(repository.DateLayout, date); err != nil {
+		http.Error(w, "date must be a YYYY-MM-DD calendar day", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// CreateHoliday closes an office on a date. Bookings are refused on it from then on.
+func (h *Handler) CreateHoliday(w http.ResponseWriter, r *http.Request) {
+	var req HolidayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.OfficeID == "" {
+		http.Error(w, "office_id required", http.StatusBadRequest)
+		return
+	}
+	if req.Date == nil {
+		http.Error(w, "date required", http.StatusBadRequest)
+		return
+	}
+	if !validHolidayDate(w, *req.Date) {
+		return
+	}
+	if _, err := h.repo.GetOffice(r.Context(), req.OfficeID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Unknown office_id", http.StatusBadRequest)
+			return
+		}
+		storeError(w, "Failed to load office", err)
+		return
+	}
+
+	holiday := &repository.Holiday{OfficeID: req.OfficeID, Date: *req.Date}
+	if req.Description != nil {
+		holiday.Description = *req.Description
+	}
+	id, err := h.repo.CreateHoliday(h.auditedCreate(r, "holiday.create", "holiday", func(id string) interface{} {
+		created := *holiday
+		created.ID = id
+		return map[string]interface{}{"after": holidayFromRepo(&created)}
+	}), holiday)
+	if err != nil {
+		if errors.Is(err, repository.ErrHolidayExists) {
+			http.Error(w, "The office already has a holiday on this date", http.StatusConflict)
+			return
+		}
+		storeError(w, "Failed to create holiday", err)
+		return
+	}
+	holiday.ID = id
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(holidayFromRepo(holiday))
+}
+
+// UpdateHoliday moves a holiday to another date or changes its description
+func (h *Handler) UpdateHoliday(w http.ResponseWriter, r *http.Request) {
+	var req HolidayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	holiday, err := h.repo.GetHoliday(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Holiday not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to load holiday", err)
+		return
+	}
+	before := *holiday
+	if req.Date != nil {
+		if !validHolidayDate(w, *req.Date) {
+			return
+		}
+		holiday.Date = *req.Date
+	}
+	if req.Description != nil {
+		holiday.Description = *req.Description
+	}
+
+	ctx := audited(r, h.auditEntry(r, "holiday.update", "holiday", holiday.ID, map[string]interface{}{
+		"before": holidayFromRepo(&before),
+		"after":  holidayFromRepo(holiday),
+	}))
+	if err := h.repo.UpdateHoliday(ctx, holiday); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Holiday not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrHolidayExists):
+			http.Error(w, "The office already has a holiday on this date", http.StatusConflict)
+		default:
+			storeError(w, "Failed to update holiday", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(holidayFromRepo(holiday))
+}
+
+// DeleteHoliday reopens an office on a holiday's date
+func (h *Handler) DeleteHoliday(w http.ResponseWriter, r *http.Request) {
+	holiday, err := h.repo.GetHoliday(r.Context(), chi.URLParam(r, "id"))
+	if err == nil {
+		ctx := audited(r, h.auditEntry(r, "holiday.delete", "holiday", holiday.ID, map[string]interface{}{"before": holidayFromRepo(holiday)}))
+		err = h.repo.DeleteHoliday(ctx, holiday.ID)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Holiday not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to delete holiday", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HolidayImportResponse lists the holidays an import created and the dates it
+// skipped because the office was already closed on them
+type HolidayImportResponse struct {
+	Imported []Holiday `json:"imported"`
+	Skipped  []string  `json:"skipped"`
+}
+
+// ImportHolidays adds the days of every event in an uploaded .ics file as
+// holidays of the office given by ?office_id=. All-day events close each day
+// they span; timed events close the local days they touch in the office
+// timezone. Importing the same file twice adds nothing.
+func (h *Handler) ImportHolidays(w http.ResponseWriter, r *http.Request) {
+	office, ok := h.loadOffice(w, r)
+	if !ok {
+		return
+	}
+	loc := h.officeLocation(office)
+	events, err := ical.Parse(http.MaxBytesReader(w, r.Body, maxHolidayImportSize), loc)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "The calendar file is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid calendar file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := HolidayImportResponse{Imported: []Holiday{}, Skipped: []string{}}
+	for _, ev := range events {
+		days := ev.Days(repository.DateLayout)
+		if !ev.AllDay {
+			days = holidayDates(ev.Start, ev.End, loc)
+		}
+		for _, date := range days {
+			holiday := &repository.Holiday{OfficeID: office.ID, Date: date, Description: strings.TrimSpace(ev.Summary)}
+			ctx := h.auditedCreate(r, "holiday.create", "holiday", func(id string) interface{} {
+				created := *holiday
+				created.ID = id
+				return map[string]interface{}{"after": holidayFromRepo(&created), "imported": true}
+			})
+			id, err := h.repo.CreateHoliday(ctx, holiday)
+			if errors.Is(err, repository.ErrHolidayExists) {
+				resp.Skipped = append(resp.Skipped, date)
+				continue
+			}
+			if err != nil {
+				storeError(w, "Failed to create holiday", err)
+				return
+			}
+			holiday.ID = id
+			resp.Imported = append(resp.Imported, holidayFromRepo(holiday))
+		}
+	}
+	h.recordAudit(r, "holiday.import", "office", office.ID, map[string]interface{}{
+		"imported": len(resp.Imported),
+		"skipped":  len(resp.Skipped),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// holidayDates returns the local dates a timed event touches
+func holidayDates(start, end time.Time, loc *time.Location) []string {
+	last := start
+	if end.After(start) {
+		last = end.Add(-time.Nanosecond)
+	}
+	y, m, d := start.In(loc).Date()
+	lastDate := last.In(loc).Format(repository.DateLayout)
+	var out []string
+	for day := time.Date(y, m, d, 0, 0, 0, 0, loc); ; day = day.AddDate(0, 0, 1) {
+		date := day.Format(repository.DateLayout)
+		if date > lastDate {
+			return out
+		}
+		out = append(out, date)
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/policy"
+	"roombooker/internal/repository"
+)
+
+func createTestHoliday(t *testing.T, h *Handler, date, description string) Holiday {
+	body := `{"office_id":"office-1","date":"` + date + `","description":"` + description + `"}`
+	w := httptest.NewRecorder()
+	h.CreateHoliday(w, withUser(httptest.NewRequest("POST", "/api/admin/holidays", strings.NewReader(body)), "user-admin"))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var holiday Holiday
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &holiday))
+	return holiday
+}
+
+func listTestHolidays(t *testing.T, h *Handler, query string) []Holiday {
+	req := withURLParam(httptest.NewRequest("GET", "/api/offices/office-1/holidays?"+query, nil), "officeId", "office-1")
+	w := httptest.NewRecorder()
+	h.GetOfficeHolidays(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var holidays []Holiday
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &holidays))
+	return holidays
+}
+
+func TestHandler_Holidays_CRUD(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	xmas := createTestHoliday(t, h, "2099-12-25", "Christmas Day")
+	assert.Equal(t, Holiday{ID: xmas.ID, OfficeID: "office-1", Date: "2099-12-25", Description: "Christmas Day"}, xmas)
+	createTestHoliday(t, h, "2099-07-04", "Independence Day")
+
+	holidays := listTestHolidays(t, h, "")
+	require.Len(t, holidays, 2)
+	assert.Equal(t, "2099-07-04", holidays[0].Date, "ordered by date")
+	// The window is read in New York, where 2099-12-26T03:00Z is still Christmas Day
+	holidays = listTestHolidays(t, h, "from=2099-12-26T00:00:00Z&to=2099-12-26T03:00:00Z")
+	require.Len(t, holidays, 1)
+	assert.Equal(t, xmas.ID, holidays[0].ID)
+	holidays = listTestHolidays(t, h, "from=2099-12-25T20:00&to=2099-12-25T22:00")
+	require.Len(t, holidays, 1, "zone-less times are New York time too")
+	assert.Empty(t, listTestHolidays(t, h, "from=2099-12-26T08:00&to=2099-12-26T10:00&tz=Europe/Berlin"))
+
+	for body, code := range map[string]int{
+		`{"office_id":"office-1","date":"2099-12-25"}`: http.StatusConflict,
+		`{"office_id":"office-1","date":"25/12/2099"}`: http.StatusBadRequest,
+		`{"office_id":"office-1"}`:                     http.StatusBadRequest,
+		`{"office_id":"nope","date":"2099-12-31"}`:     http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		h.CreateHoliday(w, withUser(httptest.NewRequest("POST", "/api/admin/holidays", strings.NewReader(body)), "user-admin"))
+		assert.Equal(t, code, w.Code, body)
+	}
+
+	req := withURLParam(withUser(httptest.NewRequest("PATCH", "/api/admin/holidays/"+xmas.ID, strings.NewReader(`{"date":"2099-12-24"}`)), "user-admin"), "id", xmas.ID)
+	w := httptest.NewRecorder()
+	h.UpdateHoliday(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated Holiday
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, "2099-12-24", updated.Date)
+	assert.Equal(t, "Christmas Day", updated.Description, "omitted fields are kept")
+
+	req = withURLParam(withUser(httptest.NewRequest("PATCH", "/api/admin/holidays/"+xmas.ID, strings.NewReader(`{"date":"2099-07-04"}`)), "user-admin"), "id", xmas.ID)
+	w = httptest.NewRecorder()
+	h.UpdateHoliday(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	req = withURLParam(withUser(httptest.NewRequest("DELETE", "/api/admin/holidays/"+xmas.ID, nil), "user-admin"), "id", xmas.ID)
+	w = httptest.NewRecorder()
+	h.DeleteHoliday(w, req)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	w = httptest.NewRecorder()
+	h.DeleteHoliday(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Len(t, listTestHolidays(t, h, ""), 1)
+
+	entries, err := h.repo.ListAuditLogs(context.Background(), repository.AuditFilter{EntityType: "holiday", EntityID: xmas.ID})
+	require.NoError(t, err)
+	assert.Len(t, entries, 3, "create, update and delete are audited")
+
+	req = withURLParam(httptest.NewRequest("GET", "/api/offices/nope/holidays", nil), "officeId", "nope")
+	w = httptest.NewRecorder()
+	h.GetOfficeHolidays(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_ImportHolidays(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	createTestHoliday(t, h, "2099-12-25", "Christmas Day")
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20991225",
+		"DTEND;VALUE=DATE:20991227",
+		"SUMMARY:Winter break",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		// 02:00Z is still the evening of 2099-12-31 in New York
+		"DTSTART:21000101T020000Z",
+		"DTEND:21000101T030000Z",
+		"SUMMARY:New Year's Eve party",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	req := withUser(httptest.NewRequest("POST", "/api/admin/holidays/import?office_id=office-1", strings.NewReader(ics)), "user-admin")
+	w := httptest.NewRecorder()
+	h.ImportHolidays(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp HolidayImportResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Imported, 2)
+	assert.Equal(t, "2099-12-26", resp.Imported[0].Date)
+	assert.Equal(t, "Winter break", resp.Imported[0].Description)
+	assert.Equal(t, "2099-12-31", resp.Imported[1].Date)
+	assert.Equal(t, []string{"2099-12-25"}, resp.Skipped, "days already closed are skipped")
+
+	// Importing again adds nothing
+	req = withUser(httptest.NewRequest("POST", "/api/admin/holidays/import?office_id=office-1", strings.NewReader(ics)), "user-admin")
+	w = httptest.NewRecorder()
+	h.ImportHolidays(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Empty(t, resp.Imported)
+	assert.Len(t, resp.Skipped, 3)
+	assert.Len(t, listTestHolidays(t, h, ""), 3)
+
+	req = withUser(httptest.NewRequest("POST", "/api/admin/holidays/import?office_id=office-1", strings.NewReader("BEGIN:VEVENT\nSUMMARY:No start\nEND:VEVENT")), "user-admin")
+	w = httptest.NewRecorder()
+	h.ImportHolidays(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req = withUser(httptest.NewRequest("POST", "/api/admin/holidays/import?office_id=nope", strings.NewReader(ics)), "user-admin")
+	w = httptest.NewRecorder()
+	h.ImportHolidays(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_CreateBooking_RefusedOnHoliday(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	createTestHoliday(t, h, "2099-03-02", "Founders' Day")
+
+	body := `{"title":"Planning","start_time":"2099-03-02T14:00:00Z","end_time":"2099-03-02T15:00:00Z","room_id":"room-101"}`
+	w := httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-regular"))
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+	var resp struct {
+		Violations []policy.Violation `json:"violations"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Violations, 1)
+	assert.Equal(t, policy.Violation{
+		Rule:    policy.RuleHoliday,
+		Limit:   "closed",
+		Actual:  "2099-03-02",
+		Message: "The office is closed on 2099-03-02 (Founders' Day)",
+	}, resp.Violations[0])
+
+	// 2099-03-03T02:00Z is the evening of the holiday in New York
+	body = `{"title":"Late","start_time":"2099-03-03T02:00:00Z","end_time":"2099-03-03T02:30:00Z","room_id":"room-101"}`
+	w = httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-regular"))
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `"rule":"holiday"`)
+
+	// The next day is open
+	createTestBooking(t, h, "room-101", "user-regular", "2099-03-03T14:00:00Z", "2099-03-03T15:00:00Z")
+}
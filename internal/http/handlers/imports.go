@@ -0,0 +1,533 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"roombooker/internal/ical"
+	"roombooker/internal/policy"
+	"roombooker/internal/repository"
+)
+
+// maxBookingImportSize bounds an uploaded calendar; exports of a busy room
+// over several years run to a few megabytes
+const maxBookingImportSize = 16 << 20
+
+var (
+	errInvalidCalendar    = errors.New("invalid calendar file")
+	errRoomDecommissioned = errors.New("room has been decommissioned")
+)
+
+// Statuses of an event in a booking import
+const (
+	// ImportReady events would be booked by committing the import
+	ImportReady   = "ready"
+	ImportCreated = "created"
+	ImportSkipped = "skipped"
+	// ImportFailed events could not be saved; importing again retries them
+	ImportFailed = "failed"
+)
+
+// BookingImportOptions says where and how to import a calendar
+type BookingImportOptions struct {
+	RoomID string
+	// ImportedBy is the id of the user importing. They are recorded in the
+	// audit trail and organise bookings whose ORGANIZER is not a user.
+	ImportedBy string
+	// Commit books the events; without it the import is a dry run
+	Commit bool
+	// Override books events breaking the office's booking rules rather than
+	// skipping them
+	Override bool
+}
+
+// BookingImport reports what an import did, or would do on a dry run, with
+// each event of the calendar
+type BookingImport struct {
+	RoomID    string          `json:"room_id"`
+	Committed bool            `json:"committed"`
+	Events    []ImportedEvent `json:"events"`
+}
+
+// Counts returns how many events were or would be booked and how many are
+// not, skipped or failed
+func (bi *BookingImport) Counts() (booked, skipped int) {
+	for _, e := range bi.Events {
+		if e.Status == ImportReady || e.Status == ImportCreated {
+			booked++
+		} else {
+			skipped++
+		}
+	}
+	return booked, skipped
+}
+
+// ImportedEvent is one event of an imported calendar: a booking, or a series
+// when it has an RRULE. Times are in the office timezone.
+type ImportedEvent struct {
+	UID         string     `json:"uid"`
+	Title       string     `json:"title"`
+	Start       string     `json:"start"`
+	End         string     `json:"end"`
+	RRule       string     `json:"rrule,omitempty"`
+	Occurrences int        `json:"occurrences"`
+	Organizer   string     `json:"organizer,omitempty"`
+	CreatedBy   string     `json:"created_by,omitempty"`
+	Attendees   []Attendee `json:"attendees"`
+	Status      string     `json:"status"`
+	// Reason says why a skipped event is not booked
+	Reason     string                `json:"reason,omitempty"`
+	Warnings   []string              `json:"warnings,omitempty"`
+	Conflicts  []OccurrenceConflict  `json:"conflicts,omitempty"`
+	Violations []OccurrenceViolation `json:"violations,omitempty"`
+	// BookingID is the new booking, or the series' first occurrence
+	BookingID string `json:"booking_id,omitempty"`
+
+	bookings     []repository.Booking
+	participants []repository.Participant
+	overridden   [][]policy.Violation
+}
+
+func (ie *ImportedEvent) skip(format string, args ...interface{}) {
+	ie.Status = ImportSkipped
+	ie.Reason = fmt.Sprintf(format, args...)
+}
+
+// partstatResponses maps PARTSTAT values to attendee responses
+var partstatResponses = map[string]string{
+	"ACCEPTED":  repository.ResponseAccepted,
+	"DECLINED":  repository.ResponseDeclined,
+	"TENTATIVE": repository.ResponseTentative,
+}
+
+// ImportBookings books the events of an iCalendar file, such as an export
+// from another booking system, in one room. ORGANIZERs who are users organise
+// their bookings and ATTENDEEs become attendees with their PARTSTAT; rooms and
+// resources among the attendees are left out. Recurring events become series
+// keeping their RRULE, less EXDATEs and cancelled occurrences, with changed
+// occurrences moved; occurrences more than a year ahead are left out.
+//
+// Each event is checked as the booking API would check it: events clashing
+// with the room's bookings or with earlier events of the file, or not fitting
+// the room, are skipped, as are events breaking the office's booking rules
+// unless Override is set. Lead times are not checked, since imported bookings
+// were made long ago. Without Commit nothing is written and the report says
+// what committing would do. Each event is committed on its own, with its
+// attendees; one that cannot be saved is reported as failed and the others
+// are still booked. Imported bookings are not copied to Outlook.
+func (h *Handler) ImportBookings(ctx context.Context, calendar io.Reader, opts BookingImportOptions) (*BookingImport, error) {
+	ctx = context.WithValue(ctx, "user_id", opts.ImportedBy)
+	room, err := h.repo.GetRoom(ctx, opts.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if !room.DecommissionedAt.IsZero() {
+		return nil, errRoomDecommissioned
+	}
+	ev, err := h.officePolicy(ctx, room)
+	if err != nil {
+		return nil, err
+	}
+	events, err := ical.Parse(calendar, ev.Location)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidCalendar, err)
+	}
+
+	report, err := h.planImport(ctx, room, ev, events, opts)
+	if err != nil || !opts.Commit {
+		return report, err
+	}
+	h.commitImport(ctx, report)
+	created, failed := 0, 0
+	for _, ie := range report.Events {
+		switch ie.Status {
+		case ImportCreated:
+			created++
+		case ImportFailed:
+			failed++
+		}
+	}
+	entry := h.auditEntryCtx(ctx, "booking.import", "room", room.ID, map[string]interface{}{
+		"created": created,
+		"skipped": len(report.Events) - created - failed,
+		"failed":  failed,
+	})
+	// The bookings are audited as they are made, so the report still stands
+	if _, err := h.repo.CreateAuditLog(ctx, &entry); err != nil {
+		h.logger.Warn("cannot record booking import", zap.String("room_id", room.ID), zap.Error(err))
+	}
+	return report, nil
+}
+
+// planImport turns each event into the bookings it would make and checks them
+func (h *Handler) planImport(ctx context.Context, room *repository.Room, ev policy.Evaluator, events []ical.Event, opts BookingImportOptions) (*BookingImport, error) {
+	report := &BookingImport{RoomID: room.ID, Events: []ImportedEvent{}}
+	now := time.Now()
+
+	// Changes to single occurrences come as events of their own with the
+	// series' UID and a RECURRENCE-ID
+	recurring := map[string]bool{}
+	for _, e := range events {
+		if e.RRule != "" && e.RecurrenceID.IsZero() {
+			recurring[e.UID] = true
+		}
+	}
+	changes := map[string][]ical.Event{}
+	var masters []ical.Event
+	for _, e := range events {
+		if !e.RecurrenceID.IsZero() && recurring[e.UID] {
+			changes[e.UID] = append(changes[e.UID], e)
+			continue
+		}
+		masters = append(masters, e)
+	}
+
+	var planned []ImportedEvent
+	for _, e := range masters {
+		ie, err := h.planEvent(ctx, room, ev, e, changes[e.UID], opts, now)
+		if err != nil {
+			return nil, err
+		}
+		planned = append(planned, ie)
+	}
+
+	// Check every booking against the room's bookings around the whole file,
+	// and against the earlier events of the file that are to be booked
+	var from, to time.Time
+	for _, ie := range planned {
+		for _, b := range ie.bookings {
+			if from.IsZero() || b.StartsAt.Before(from) {
+				from = b.StartsAt
+			}
+			if b.EndsAt.After(to) {
+				to = b.EndsAt
+			}
+		}
+	}
+	var existing []repository.Booking
+	if !from.IsZero() {
+		var err error
+		existing, err = h.repo.ListBookingsByRoom(ctx, room.ID, from.Add(-ev.Reach()), to.Add(ev.Reach()))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := range planned {
+		ie := &planned[i]
+		if ie.Status != ImportSkipped {
+			checkImport(ie, ev, existing, opts, now)
+		}
+		if ie.Status != ImportSkipped {
+			existing = append(existing, ie.bookings...)
+		}
+		report.Events = append(report.Events, *ie)
+	}
+	return report, nil
+}
+
+// planEvent works out the bookings and attendees of one event of an import
+func (h *Handler) planEvent(ctx context.Context, room *repository.Room, ev policy.Evaluator, e ical.Event, changes []ical.Event, opts BookingImportOptions, now time.Time) (ImportedEvent, error) {
+	loc := ev.Location
+	ie := ImportedEvent{
+		UID:       e.UID,
+		Title:     strings.TrimSpace(e.Summary),
+		Start:     e.Start.In(loc).Format(time.RFC3339),
+		End:       e.End.In(loc).Format(time.RFC3339),
+		RRule:     e.RRule,
+		Organizer: strings.ToLower(e.Organizer),
+		CreatedBy: opts.ImportedBy,
+		Attendees: []Attendee{},
+		Status:    ImportReady,
+	}
+	switch {
+	case e.Status == "CANCELLED":
+		ie.skip("the event is cancelled")
+		return ie, nil
+	case e.AllDay:
+		ie.skip("all-day events do not book a room")
+		return ie, nil
+	case !e.End.After(e.Start):
+		ie.skip("the event ends before it starts")
+		return ie, nil
+	}
+
+	if ie.Organizer != "" {
+		user, err := h.repo.GetUserByEmail(ctx, ie.Organizer)
+		switch {
+		case err == nil:
+			ie.CreatedBy = user.ID
+		case errors.Is(err, sql.ErrNoRows):
+			ie.Warnings = append(ie.Warnings, fmt.Sprintf("organizer %s is not a user; the importer organises it", ie.Organizer))
+		default:
+			return ie, err
+		}
+	}
+	seen := map[string]int{}
+	for _, a := range e.Attendees {
+		email := strings.ToLower(strings.TrimSpace(a.Email))
+		if email == "" || a.Kind == "ROOM" || a.Kind == "RESOURCE" {
+			continue
+		}
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+			ie.Warnings = append(ie.Warnings, fmt.Sprintf("attendee %q is not an email address and is left out", a.Email))
+			continue
+		}
+		if i, ok := seen[email]; ok {
+			ie.participants[i].Required = ie.participants[i].Required || a.Required()
+			continue
+		}
+		response := partstatResponses[a.Status]
+		if response == "" {
+			response = repository.ResponseNeedsAction
+		}
+		seen[email] = len(ie.participants)
+		ie.participants = append(ie.participants, repository.Participant{Email: email, Required: a.Required(), ResponseStatus: response})
+	}
+	ie.Attendees = attendeesFromRepo(ie.participants)
+	organiser := ""
+	if ie.CreatedBy != "" {
+		if user, err := h.repo.GetUserByID(ctx, ie.CreatedBy); err == nil {
+			organiser = strings.ToLower(user.Email)
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return ie, err
+		}
+	}
+	if err := overCapacity(room, organiser, ie.participants); err != nil {
+		ie.skip("%v", err)
+		return ie, nil
+	}
+
+	booking := repository.Booking{
+		RoomID:      room.ID,
+		CreatedBy:   ie.CreatedBy,
+		Title:       ie.Title,
+		Description: e.Description,
+		StartsAt:    e.Start.UTC(),
+		EndsAt:      e.End.UTC(),
+		Status:      repository.BookingStatusActive,
+	}
+	if e.RRule == "" {
+		ie.bookings = []repository.Booking{booking}
+		ie.Occurrences = 1
+		return ie, nil
+	}
+
+	rule, err := ical.ParseRRule(e.RRule, loc)
+	if err != nil {
+		ie.skip("unsupported rrule: %v", err)
+		return ie, nil
+	}
+	dtstart := e.Start.In(loc)
+	horizon := now.AddDate(maxSeriesYears, 0, 0)
+	starts := rule.Occurrences(dtstart, horizon)
+	if len(starts) == 0 {
+		ie.skip("the rule has no occurrences before %s", horizon.In(loc).Format(repository.DateLayout))
+		return ie, nil
+	}
+	// Store the rule with the end the series now has. An open-ended rule ends
+	// at the horizon as on the booking API; a bounded one cut short is noted.
+	last := starts[len(starts)-1]
+	if !rule.Bounded() {
+		rule.Until = last.UTC()
+	} else if len(rule.Occurrences(dtstart, horizon.AddDate(maxSeriesYears, 0, 0))) > len(starts) {
+		ie.Warnings = append(ie.Warnings, fmt.Sprintf("occurrences after %s are left out", horizon.In(loc).Format(repository.DateLayout)))
+		rule.Count, rule.Until = 0, last.UTC()
+	}
+	ie.RRule = rule.String()
+
+	excluded := map[int64]bool{}
+	for _, d := range e.ExDates {
+		excluded[d.Unix()] = true
+	}
+	moved := map[int64]ical.Event{}
+	for _, c := range changes {
+		moved[c.RecurrenceID.Unix()] = c
+	}
+	length := e.End.Sub(e.Start)
+	for _, s := range starts {
+		if excluded[s.Unix()] {
+			continue
+		}
+		o := booking
+		o.StartsAt, o.EndsAt = s.UTC(), s.Add(length).UTC()
+		o.RRule = ie.RRule
+		o.RecurrenceID = s.UTC()
+		if c, ok := moved[s.Unix()]; ok {
+			delete(moved, s.Unix())
+			if c.Status == "CANCELLED" {
+				continue
+			}
+			o.StartsAt, o.EndsAt = c.Start.UTC(), c.End.UTC()
+			if title := strings.TrimSpace(c.Summary); title != "" {
+				o.Title = title
+			}
+			if c.Description != "" {
+				o.Description = c.Description
+			}
+			if !o.EndsAt.After(o.StartsAt) {
+				ie.skip("the change to the occurrence at %s ends before it starts", s.Format(time.RFC3339))
+				return ie, nil
+			}
+		}
+		ie.bookings = append(ie.bookings, o)
+	}
+	for _, c := range moved {
+		ie.Warnings = append(ie.Warnings, fmt.Sprintf("the change to %s is not to an occurrence of the rule and is left out", c.RecurrenceID.In(loc).Format(time.RFC3339)))
+	}
+	sort.Strings(ie.Warnings)
+	ie.Occurrences = len(ie.bookings)
+	if len(ie.bookings) == 0 {
+		ie.skip("every occurrence is cancelled")
+	}
+	return ie, nil
+}
+
+// checkImport skips an event that clashes with others, or that breaks
+// booking rules without opts.Override
+func checkImport(ie *ImportedEvent, ev policy.Evaluator, existing []repository.Booking, opts BookingImportOptions, now time.Time) {
+	recurring := ie.RRule != ""
+	per := make([][]policy.Violation, len(ie.bookings))
+	broken := false
+	for i, b := range ie.bookings {
+		var clashes []Booking
+		for j := range existing {
+			o := &existing[j]
+			if o.StartsAt.Before(b.EndsAt) && b.StartsAt.Before(o.EndsAt) {
+				clashes = append(clashes, bookingFromRepo(o).In(ev.Location))
+			}
+		}
+		if len(clashes) > 0 {
+			ie.Conflicts = append(ie.Conflicts, OccurrenceConflict{
+				Start:     b.StartsAt.In(ev.Location).Format(time.RFC3339),
+				End:       b.EndsAt.In(ev.Location).Format(time.RFC3339),
+				Conflicts: clashes,
+			})
+		}
+		for _, v := range ev.Check(policy.Booking{Start: b.StartsAt, End: b.EndsAt, Recurring: recurring}, existing, now) {
+			if v.Rule != policy.RuleMinLeadTime {
+				per[i] = append(per[i], v)
+				broken = true
+			}
+		}
+	}
+	if broken {
+		ie.Violations = occurrenceViolations(ie.bookings, per)
+		ie.overridden = per
+	}
+	switch {
+	case len(ie.Conflicts) > 0:
+		ie.skip("%d of %d occurrences clash with other bookings", len(ie.Conflicts), len(ie.bookings))
+	case broken && !opts.Override:
+		ie.skip("the event breaks the office's booking rules; import with override to book it anyway")
+	}
+}
+
+// commitImport books the events of a planned import that are ready, each with
+// its attendees and their answers in one transaction. An event blocked since
+// it was planned is skipped; one the store fails on is marked failed.
+func (h *Handler) commitImport(ctx context.Context, report *BookingImport) {
+	report.Committed = true
+	for i := range report.Events {
+		ie := &report.Events[i]
+		if ie.Status != ImportReady {
+			continue
+		}
+		if len(ie.participants) > 0 {
+			for j := range ie.bookings {
+				ie.bookings[j].Participants = ie.participants
+			}
+		}
+		auditCtx := repository.WithAudit(ctx, func(ids []string) []repository.AuditLog {
+			var entries []repository.AuditLog
+			for j, id := range ids {
+				created := ie.bookings[j]
+				created.ID = id
+				if ie.RRule != "" {
+					created.SeriesID = ids[0]
+				}
+				entries = append(entries, h.auditEntryCtx(ctx, "booking.create", "booking", id, map[string]interface{}{
+					"after":    bookingFromRepo(&created),
+					"imported": true,
+				}))
+				if ie.overridden != nil && len(ie.overridden[j]) > 0 {
+					entries = append(entries, h.auditEntryCtx(ctx, "booking.policy_override", "booking", id, map[string]interface{}{
+						"violations": ie.overridden[j],
+					}))
+				}
+				if len(ie.participants) > 0 {
+					entries = append(entries, h.auditEntryCtx(ctx, "booking.attendees", "booking", id, map[string]interface{}{
+						"before": []Attendee{},
+						"after":  ie.Attendees,
+					}))
+				}
+			}
+			return entries
+		})
+		var ids []string
+		var err error
+		if ie.RRule != "" {
+			ids, err = h.repo.CreateBookingSeries(auditCtx, ie.bookings)
+		} else {
+			var id string
+			id, err = h.repo.CreateBooking(auditCtx, &ie.bookings[0])
+			ids = []string{id}
+		}
+		var conflict *repository.ConflictError
+		var seriesConflict *repository.SeriesConflictError
+		switch {
+		case errors.As(err, &conflict) || errors.As(err, &seriesConflict):
+			ie.skip("the room was booked at the same time while importing")
+		case err != nil:
+			h.logger.Warn("cannot save imported booking", zap.String("uid", ie.UID), zap.Error(err))
+			ie.Status = ImportFailed
+			ie.Reason = "the booking could not be saved; import the calendar again to retry"
+		default:
+			ie.Status, ie.BookingID = ImportCreated, ids[0]
+		}
+	}
+}
+
+// ImportRoomBookings books the events of an uploaded .ics file in the room
+// given by the path. It is a dry run unless ?commit=true; ?override=true books
+// events breaking booking rules too. See ImportBookings.
+func (h *Handler) ImportRoomBookings(w http.ResponseWriter, r *http.Request) {
+	opts := BookingImportOptions{
+		RoomID:   chi.URLParam(r, "id"),
+		Commit:   r.URL.Query().Get("commit") == "true",
+		Override: r.URL.Query().Get("override") == "true",
+	}
+	if v := r.Context().Value("user_id"); v != nil {
+		opts.ImportedBy = fmt.Sprintf("%v", v)
+	}
+	report, err := h.ImportBookings(r.Context(), http.MaxBytesReader(w, r.Body, maxBookingImportSize), opts)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			http.Error(w, "The calendar file is too large", http.StatusRequestEntityTooLarge)
+		case errors.Is(err, errInvalidCalendar):
+			http.Error(w, "Invalid calendar file: "+strings.TrimPrefix(err.Error(), errInvalidCalendar.Error()+": "), http.StatusBadRequest)
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Room not found", http.StatusNotFound)
+		case errors.Is(err, errRoomDecommissioned):
+			http.Error(w, "Room has been decommissioned", http.StatusConflict)
+		default:
+			storeError(w, "Failed to import bookings", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
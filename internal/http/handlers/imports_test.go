@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/repository"
+)
+
+// importWeek returns 00:00 New York time on a Monday at least a week ahead,
+// so imported bookings fall where the demo office's rule applies
+func importWeek(t *testing.T) time.Time {
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	y, m, d := time.Now().In(ny).AddDate(0, 0, 7).Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, ny)
+	for day.Weekday() != time.Monday {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day
+}
+
+func importCalendar(week time.Time) string {
+	at := func(days, hour int) string {
+		return week.AddDate(0, 0, days).Add(time.Duration(hour) * time.Hour).Format("20060102T150405")
+	}
+	return strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:review@old.example.com",
+		"SUMMARY:Review",
+		"DTSTART;TZID=America/New_York:" + at(1, 10),
+		"DTEND;TZID=America/New_York:" + at(1, 11),
+		"ORGANIZER:mailto:user@example.com",
+		"ATTENDEE;PARTSTAT=ACCEPTED:mailto:Admin@Example.com",
+		"ATTENDEE;ROLE=OPT-PARTICIPANT:mailto:carol@example.com",
+		"ATTENDEE;CUTYPE=ROOM:mailto:room-101@old.example.com",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:weekly@old.example.com",
+		"SUMMARY:Weekly",
+		"DTSTART;TZID=America/New_York:" + at(0, 14),
+		"DTEND;TZID=America/New_York:" + at(0, 15),
+		"RRULE:FREQ=WEEKLY;COUNT=4",
+		"EXDATE;TZID=America/New_York:" + at(7, 14),
+		"ORGANIZER:mailto:someone@old.example.com",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:weekly@old.example.com",
+		"RECURRENCE-ID;TZID=America/New_York:" + at(14, 14),
+		"SUMMARY:Weekly, later",
+		"DTSTART;TZID=America/New_York:" + at(14, 16),
+		"DTEND;TZID=America/New_York:" + at(14, 17),
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:clash@old.example.com",
+		"SUMMARY:Clash",
+		"DTSTART;TZID=America/New_York:" + at(2, 10),
+		"DTEND;TZID=America/New_York:" + at(2, 11),
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:late@old.example.com",
+		"SUMMARY:Late",
+		"DTSTART;TZID=America/New_York:" + at(3, 19),
+		"DTEND;TZID=America/New_York:" + at(3, 20),
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:gone@old.example.com",
+		"SUMMARY:Gone",
+		"STATUS:CANCELLED",
+		"DTSTART;TZID=America/New_York:" + at(4, 10),
+		"DTEND;TZID=America/New_York:" + at(4, 11),
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+}
+
+func importRequest(roomID, query, body string) *http.Request {
+	req := httptest.NewRequest("POST", "/api/admin/rooms/"+roomID+"/import"+query, strings.NewReader(body))
+	return withURLParam(withUser(req, "user-admin"), "id", roomID)
+}
+
+func runImport(t *testing.T, h *Handler, query, body string) BookingImport {
+	w := httptest.NewRecorder()
+	h.ImportRoomBookings(w, importRequest("room-101", query, body))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var report BookingImport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	return report
+}
+
+func importedByUID(report BookingImport) map[string]ImportedEvent {
+	out := map[string]ImportedEvent{}
+	for _, e := range report.Events {
+		out[e.UID] = e
+	}
+	return out
+}
+
+func TestHandler_ImportRoomBookings(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	week := importWeek(t)
+	existing := week.AddDate(0, 0, 2).Add(10*time.Hour + 30*time.Minute)
+	createTestBooking(t, h, "room-101", "user-regular", existing.Format(time.RFC3339), existing.Add(time.Hour).Format(time.RFC3339))
+	ctx := context.Background()
+	before, err := h.repo.ListRoomCalendar(ctx, "room-101", time.Time{})
+	require.NoError(t, err)
+
+	// A dry run reports without booking anything
+	report := runImport(t, h, "", importCalendar(week))
+	assert.False(t, report.Committed)
+	after, err := h.repo.ListRoomCalendar(ctx, "room-101", time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, after, len(before))
+
+	events := importedByUID(report)
+	require.Len(t, events, 5, "changes to an occurrence are part of their series")
+	review := events["review@old.example.com"]
+	assert.Equal(t, ImportReady, review.Status)
+	assert.Equal(t, "user-regular", review.CreatedBy)
+	assert.Equal(t, []Attendee{
+		{Email: "admin@example.com", Required: true, Response: repository.ResponseAccepted},
+		{Email: "carol@example.com", Required: false, Response: repository.ResponseNeedsAction},
+	}, review.Attendees, "the room itself is not an attendee")
+
+	weekly := events["weekly@old.example.com"]
+	assert.Equal(t, ImportReady, weekly.Status)
+	assert.Equal(t, "FREQ=WEEKLY;COUNT=4", weekly.RRule)
+	assert.Equal(t, 3, weekly.Occurrences, "less the EXDATE")
+	assert.Equal(t, "user-admin", weekly.CreatedBy, "an organizer who is not a user leaves the importer organising")
+	require.Len(t, weekly.Warnings, 1)
+	assert.Contains(t, weekly.Warnings[0], "someone@old.example.com")
+
+	clash := events["clash@old.example.com"]
+	assert.Equal(t, ImportSkipped, clash.Status)
+	require.Len(t, clash.Conflicts, 1)
+	assert.Equal(t, "Sync", clash.Conflicts[0].Conflicts[0].Title)
+
+	late := events["late@old.example.com"]
+	assert.Equal(t, ImportSkipped, late.Status)
+	assert.Contains(t, late.Reason, "override")
+	require.NotEmpty(t, late.Violations)
+	assert.Equal(t, "workday_end", late.Violations[0].Rule)
+
+	assert.Equal(t, ImportSkipped, events["gone@old.example.com"].Status)
+
+	// Committing books what the dry run said it would
+	report = runImport(t, h, "?commit=true", importCalendar(week))
+	assert.True(t, report.Committed)
+	booked, skipped := report.Counts()
+	assert.Equal(t, 2, booked)
+	assert.Equal(t, 3, skipped)
+	events = importedByUID(report)
+
+	review = events["review@old.example.com"]
+	require.Equal(t, ImportCreated, review.Status)
+	b, err := h.repo.GetBooking(ctx, review.BookingID)
+	require.NoError(t, err)
+	assert.Equal(t, "user-regular", b.CreatedBy)
+	participants, err := h.repo.ListParticipants(ctx, review.BookingID)
+	require.NoError(t, err)
+	assert.Equal(t, review.Attendees, attendeesFromRepo(participants), "answers given in the old system are kept")
+
+	weekly = events["weekly@old.example.com"]
+	require.Equal(t, ImportCreated, weekly.Status)
+	series, err := h.repo.ListBookingSeries(ctx, weekly.BookingID)
+	require.NoError(t, err)
+	require.Len(t, series, 3)
+	assert.Equal(t, "FREQ=WEEKLY;COUNT=4", series[0].RRule)
+	moved := series[1]
+	assert.Equal(t, "Weekly, later", moved.Title)
+	assert.Equal(t, week.AddDate(0, 0, 14).Add(16*time.Hour).UTC(), moved.StartsAt)
+	assert.Equal(t, week.AddDate(0, 0, 14).Add(14*time.Hour).UTC(), moved.RecurrenceID)
+
+	logs, err := h.repo.ListAuditLogs(ctx, repository.AuditFilter{Action: "booking.import"})
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Equal(t, "user-admin", logs[0].ActorUserID)
+
+	// Importing again finds the bookings already made; override books the late one
+	report = runImport(t, h, "?override=true", importCalendar(week))
+	events = importedByUID(report)
+	assert.NotEmpty(t, events["review@old.example.com"].Conflicts)
+	assert.Equal(t, ImportReady, events["late@old.example.com"].Status)
+}
+
+// seriesFailingStore cannot save booking series
+type seriesFailingStore struct {
+	repository.Store
+}
+
+func (seriesFailingStore) CreateBookingSeries(ctx context.Context, occurrences []repository.Booking) ([]string, error) {
+	return nil, errors.New("database unavailable")
+}
+
+func TestHandler_ImportRoomBookings_StoreErrors(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	h.repo = seriesFailingStore{Store: h.repo}
+	ctx := context.Background()
+
+	report := runImport(t, h, "?commit=true", importCalendar(importWeek(t)))
+	assert.True(t, report.Committed)
+	events := importedByUID(report)
+	weekly := events["weekly@old.example.com"]
+	assert.Equal(t, ImportFailed, weekly.Status, "the report says which event failed")
+	assert.Contains(t, weekly.Reason, "again")
+	review := events["review@old.example.com"]
+	require.Equal(t, ImportCreated, review.Status, "the other events are still booked")
+	participants, err := h.repo.ListParticipants(ctx, review.BookingID)
+	require.NoError(t, err)
+	assert.Equal(t, review.Attendees, attendeesFromRepo(participants))
+
+	logs, err := h.repo.ListAuditLogs(ctx, repository.AuditFilter{Action: "booking.import"})
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.JSONEq(t, `{"created":2,"skipped":2,"failed":1}`, logs[0].Payload)
+}
+
+func TestHandler_ImportRoomBookings_Errors(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	for _, tc := range []struct {
+		roomID, body string
+		code         int
+	}{
+		{"missing", "BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n", http.StatusNotFound},
+		{"room-101", "BEGIN:VEVENT\r\nSUMMARY:No start\r\nEND:VEVENT\r\n", http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		h.ImportRoomBookings(w, importRequest(tc.roomID, "", tc.body))
+		assert.Equal(t, tc.code, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+
+	"roombooker/internal/ical"
+	"roombooker/internal/notify"
+	"roombooker/internal/repository"
+)
+
+// Changes to a booking its organiser and attendees are emailed about
+const (
+	bookingCreated   = "created"
+	bookingUpdated   = "updated"
+	bookingCancelled = "cancelled"
+)
+
+// bookingReminder is the email reminding people of a booking about to start
+const bookingReminder = "reminder"
+
+const inviteProdID = "-//Roombooker//Invitation//EN"
+
+// bookingMail is what the booking email templates are given
+type bookingMail struct {
+	Change string
+	// Organising is set when the recipient made the booking, Removed when
+	// the change took them off its attendees
+	Organising bool
+	Removed    bool
+	// Partly is set for a cancellation that leaves part of a series booked
+	Partly      bool
+	Title       string
+	Room        string
+	When        string
+	Repeats     string
+	Organizer   string
+	Attendees   []string
+	Description string
+	Link        string
+	// StartsIn is how long until the booking starts, in reminders
+	StartsIn string
+}
+
+var bookingMailTemplates = template.Must(template.New("mail").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(`
+{{- define "created.subject"}}{{if .Organising}}Booked{{else}}Invitation{{end}}: {{.Title}} @ {{.When}}{{end}}
+{{- define "created.body"}}
+{{- if .Organising}}You booked {{.Room}}.{{else}}{{.Organizer}} invited you to a meeting in {{.Room}}.{{end}}
+
+{{template "details" .}}
+
+The attached invitation adds it to your calendar.
+{{- template "footer" .}}
+{{- end}}
+
+{{- define "updated.subject"}}{{if .Removed}}Cancelled{{else}}Updated{{end}}: {{.Title}} @ {{.When}}{{end}}
+{{- define "updated.body"}}
+{{- if .Removed}}{{.Organizer}} has taken you off the attendees of this meeting.{{else if .Organising}}Your booking of {{.Room}} has changed.{{else}}{{.Organizer}} has changed a meeting you are invited to.{{end}}
+
+{{template "details" .}}
+
+{{if .Removed}}The attached cancellation removes it from your calendar.{{else}}The attached update changes it in your calendar.{{end}}
+{{- template "footer" .}}
+{{- end}}
+
+{{- define "cancelled.subject"}}Cancelled: {{.Title}} @ {{.When}}{{end}}
+{{- define "cancelled.body"}}
+{{- if .Partly}}Part of this recurring meeting has been cancelled; the rest goes ahead.
+{{- else if .Organising}}Your booking of {{.Room}} has been cancelled.
+{{- else}}{{.Organizer}} has cancelled this meeting.{{end}}
+
+{{template "details" .}}
+
+{{if .Partly}}The attached update changes it in your calendar.{{else}}The attached cancellation removes it from your calendar.{{end}}
+{{- template "footer" .}}
+{{- end}}
+
+{{- define "reminder.subject"}}Reminder: {{.Title}} @ {{.When}}{{end}}
+{{- define "reminder.body"}}
+{{- if .Organising}}Your booking of {{.Room}} starts in {{.StartsIn}}.{{else}}A meeting you are invited to starts in {{.StartsIn}}.{{end}}
+
+{{template "details" .}}
+{{- template "footer" .}}
+{{- end}}
+
+{{- define "details"}}{{.Title}}
+When:      {{.When}}
+{{- with .Repeats}}
+Repeats:   {{.}}{{end}}
+Where:     {{.Room}}
+Organizer: {{.Organizer}}
+{{- with .Attendees}}
+Attendees: {{join . ", "}}{{end}}
+{{- with .Description}}
+
+{{.}}{{end}}{{end}}
+
+{{- define "footer"}}{{with .Link}}
+
+See your bookings at {{.}}{{end}}
+{{end}}
+`))
+
+// render returns the subject and body of the email for m.Change
+func (m bookingMail) render() (subject, body string, err error) {
+	var buf bytes.Buffer
+	if err := bookingMailTemplates.ExecuteTemplate(&buf, m.Change+".subject", m); err != nil {
+		return "", "", err
+	}
+	subject = buf.String()
+	buf.Reset()
+	if err := bookingMailTemplates.ExecuteTemplate(&buf, m.Change+".body", m); err != nil {
+		return "", "", err
+	}
+	return subject, buf.String(), nil
+}
+
+// responsePartstats maps attendee responses to PARTSTAT values
+var responsePartstats = map[string]string{
+	repository.ResponseNeedsAction: "NEEDS-ACTION",
+	repository.ResponseAccepted:    "ACCEPTED",
+	repository.ResponseDeclined:    "DECLINED",
+	repository.ResponseTentative:   "TENTATIVE",
+}
+
+// inviteSequence numbers the revisions of a booking for calendar clients:
+// the seconds between its creation and last change. Two changes within a
+// second share a number, and clients then go by the later DTSTAMP.
+func inviteSequence(b *repository.Booking) int {
+	if b.UpdatedAt.Before(b.CreatedAt) {
+		return 0
+	}
+	return int(b.UpdatedAt.Sub(b.CreatedAt) / time.Second)
+}
+
+// formatWhen describes when a booking is, in loc
+func formatWhen(start, end time.Time, loc *time.Location) string {
+	start, end = start.In(loc), end.In(loc)
+	endLayout := "15:04 MST"
+	if end.YearDay() != start.YearDay() || end.Year() != start.Year() {
+		endLayout = "Mon 2 Jan 2006 15:04 MST"
+	}
+	return start.Format("Mon 2 Jan 2006 15:04") + "–" + end.Format(endLayout)
+}
+
+// notifyBookingChange emails the organiser and attendees of changed bookings,
+// in the background, with an iCalendar invitation so the change lands in
+// their calendars: a REQUEST for what is booked, a CANCEL for what no longer
+// is. Occurrences of one series are sent as one recurring event. dropped are
+// attendees the change removed, who are sent a cancellation.
+func (h *Handler) notifyBookingChange(change string, bookings []repository.Booking, dropped []string) {
+	if h.notifier == nil || len(bookings) == 0 {
+		return
+	}
+	bookings = append([]repository.Booking(nil), bookings...)
+	h.goBackground(func(ctx context.Context) {
+		seen := map[string]bool{}
+		for i := range bookings {
+			key := bookings[i].ID
+			if bookings[i].SeriesID != "" {
+				key = bookings[i].SeriesID
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if err := h.sendBookingMail(ctx, change, &bookings[i], dropped); err != nil {
+				h.logger.Warn("booking notification failed", zap.String("booking_id", bookings[i].ID), zap.String("change", change), zap.Error(err))
+			}
+		}
+	})
+}
+
+// sendBookingMail emails everyone concerned by a change to b, or to the
+// series b is part of
+func (h *Handler) sendBookingMail(ctx context.Context, change string, b *repository.Booking, dropped []string) error {
+	occurrences := []repository.Booking{*b}
+	if b.SeriesID != "" {
+		var err error
+		if occurrences, err = h.repo.ListBookingSeries(ctx, b.SeriesID); err != nil {
+			return err
+		}
+		if len(occurrences) == 0 {
+			// Deleted since the change
+			return sql.ErrNoRows
+		}
+	} else if current, err := h.repo.GetBooking(ctx, b.ID); err == nil {
+		occurrences[0] = *current
+	} else {
+		return err
+	}
+	organizer := ""
+	if user, err := h.repo.GetUserByID(ctx, b.CreatedBy); err == nil {
+		organizer = strings.ToLower(user.Email)
+	} else {
+		h.logger.Warn("cannot find booking organiser", zap.String("user_id", b.CreatedBy), zap.Error(err))
+	}
+	room, err := h.feedRooms(ctx, h.defaultLocation())(b.RoomID)
+	if err != nil {
+		return err
+	}
+
+	// Attendees of every occurrence still on are invited to the series
+	var invited []string
+	isInvited := map[string]bool{}
+	invite := func(email string) {
+		if email != "" && !isInvited[email] {
+			isInvited[email] = true
+			invited = append(invited, email)
+		}
+	}
+	invite(organizer)
+	attendees := map[string][]ical.Attendee{}
+	active := 0
+	sequence := 0
+	for i := range occurrences {
+		o := &occurrences[i]
+		sequence = max(sequence, inviteSequence(o))
+		participants, err := h.repo.ListParticipants(ctx, o.ID)
+		if err != nil {
+			return err
+		}
+		for _, p := range participants {
+			role := "REQ-PARTICIPANT"
+			if !p.Required {
+				role = "OPT-PARTICIPANT"
+			}
+			attendees[o.ID] = append(attendees[o.ID], ical.Attendee{
+				Email:  p.Email,
+				Role:   role,
+				Status: responsePartstats[p.ResponseStatus],
+				RSVP:   p.ResponseStatus == repository.ResponseNeedsAction,
+			})
+		}
+		if o.Status == repository.BookingStatusActive {
+			active++
+			for _, p := range participants {
+				invite(p.Email)
+			}
+		}
+	}
+	if active == 0 {
+		// Everyone who was invited hears of the cancellation
+		for _, o := range occurrences {
+			for _, a := range attendees[o.ID] {
+				invite(a.Email)
+			}
+		}
+	}
+
+	now := time.Now().UTC()
+	event := func(o *repository.Booking) ical.Event {
+		e := h.bookingEvent(o, room.name, now)
+		e.Description = o.Description
+		e.Zone = room.loc
+		e.Organizer = organizer
+		e.Attendees = attendees[o.ID]
+		e.Sequence = inviteSequence(o)
+		return e
+	}
+	var events []ical.Event
+	if b.SeriesID == "" {
+		events = []ical.Event{event(&occurrences[0])}
+	} else {
+		all := func(*repository.Booking) bool { return true }
+		if events, err = h.seriesEvents(occurrences, all, event, room.loc); err != nil {
+			return err
+		}
+	}
+	// The series as a whole changed as much as its latest changed occurrence
+	events[0].Sequence = sequence
+	method := "REQUEST"
+	if events[0].Status == "CANCELLED" {
+		method = "CANCEL"
+	}
+
+	mail := bookingMail{
+		Change:      change,
+		Partly:      change == bookingCancelled && method == "REQUEST",
+		Title:       events[0].Summary,
+		Room:        room.name,
+		When:        formatWhen(b.StartsAt, b.EndsAt, room.loc),
+		Organizer:   organizer,
+		Description: b.Description,
+	}
+	if h.config != nil {
+		mail.Link = h.config.App.BaseURL
+	}
+	if mail.Room == "" {
+		mail.Room = "a room no longer listed"
+	}
+	if b.SeriesID != "" && active > 0 {
+		var last time.Time
+		for _, o := range occurrences {
+			if o.Status == repository.BookingStatusActive && o.StartsAt.After(last) {
+				last = o.StartsAt
+			}
+		}
+		mail.Repeats = fmt.Sprintf("%d occurrences, the last on %s", active, last.In(room.loc).Format("Mon 2 Jan 2006"))
+	}
+	for _, a := range events[0].Attendees {
+		mail.Attendees = append(mail.Attendees, a.Email)
+	}
+
+	for _, to := range invited {
+		m := mail
+		m.Organising = to == organizer
+		if err := h.sendInvite(ctx, to, m, method, events); err != nil {
+			return err
+		}
+	}
+	// Those taken off a booking are sent a cancellation of the whole event
+	for _, to := range dropped {
+		to = strings.ToLower(to)
+		if isInvited[to] {
+			continue
+		}
+		cancelled := events[0]
+		cancelled.Status = "CANCELLED"
+		cancelled.Attendees = []ical.Attendee{{Email: to}}
+		m := mail
+		m.Change, m.Removed = bookingUpdated, true
+		if err := h.sendInvite(ctx, to, m, "CANCEL", []ical.Event{cancelled}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendInvite emails m to one recipient with events attached as an iTIP message
+func (h *Handler) sendInvite(ctx context.Context, to string, m bookingMail, method string, events []ical.Event) error {
+	subject, body, err := m.render()
+	if err != nil {
+		return err
+	}
+	var cal bytes.Buffer
+	if err := ical.Write(&cal, ical.Calendar{ProdID: inviteProdID, Method: method, Events: events}); err != nil {
+		return err
+	}
+	filename := "invite.ics"
+	if method == "CANCEL" {
+		filename = "cancel.ics"
+	}
+	return h.notifier.Notify(ctx, notify.Message{
+		To:      []string{to},
+		Subject: subject,
+		Body:    body,
+		Attachments: []notify.Attachment{{
+			Filename:    filename,
+			ContentType: "text/calendar; method=" + method + "; charset=utf-8",
+			Data:        cal.Bytes(),
+		}},
+	})
+}
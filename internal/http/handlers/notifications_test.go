@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/ical"
+	"roombooker/internal/notify"
+	"roombooker/internal/repository"
+)
+
+// sentTo waits for background work and returns the messages sent since the
+// last call, by recipient
+func sentTo(t *testing.T, h *Handler, n *recordingNotifier, seen *int) map[string]notify.Message {
+	h.bgWG.Wait()
+	all := n.sent()
+	out := map[string]notify.Message{}
+	for _, m := range all[*seen:] {
+		require.Len(t, m.To, 1)
+		out[m.To[0]] = m
+	}
+	*seen = len(all)
+	return out
+}
+
+// invite reads the calendar attached to m, checking its iTIP method
+func invite(t *testing.T, m notify.Message, method string) []ical.Event {
+	require.Len(t, m.Attachments, 1)
+	a := m.Attachments[0]
+	assert.Equal(t, "text/calendar; method="+method+"; charset=utf-8", a.ContentType)
+	assert.Contains(t, string(a.Data), "METHOD:"+method+"\r\n")
+	events, err := ical.Parse(bytes.NewReader(a.Data), time.UTC)
+	require.NoError(t, err)
+	return events
+}
+
+func TestHandler_BookingNotifications(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	h.config.App.BaseURL = "http://rooms.example.com"
+	notifier := &recordingNotifier{}
+	h.SetNotifier(notifier)
+	seen := 0
+
+	body := `{"title":"Review","description":"Bring the numbers","start_time":"2099-03-06T15:00:00Z","end_time":"2099-03-06T16:00:00Z","room_id":"room-103",` +
+		`"attendees":["user@example.com",{"email":"carol@example.com","required":false}]}`
+	w := httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-admin"))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var b Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &b))
+
+	sent := sentTo(t, h, notifier, &seen)
+	require.Len(t, sent, 3, "the organiser and each attendee")
+	organiser := sent["admin@example.com"]
+	assert.Equal(t, "Booked: Review @ Fri 6 Mar 2099 10:00–11:00 EST", organiser.Subject, "in the office's timezone")
+	assert.Contains(t, organiser.Body, "You booked Room 103.")
+	assert.Contains(t, organiser.Body, "Attendees: carol@example.com, user@example.com")
+	assert.Contains(t, organiser.Body, "Bring the numbers")
+	assert.Contains(t, organiser.Body, "See your bookings at http://rooms.example.com")
+	assert.Equal(t, "Invitation: Review @ Fri 6 Mar 2099 10:00–11:00 EST", sent["user@example.com"].Subject)
+	assert.Contains(t, sent["carol@example.com"].Body, "admin@example.com invited you to a meeting in Room 103.")
+
+	events := invite(t, sent["user@example.com"], "REQUEST")
+	require.Len(t, events, 1)
+	assert.Equal(t, b.ID+"@rooms.example.com", events[0].UID, "the UID the feeds use")
+	assert.Equal(t, "admin@example.com", events[0].Organizer)
+	assert.Equal(t, "Room 103", events[0].Location)
+	assert.Equal(t, []ical.Attendee{
+		{Email: "carol@example.com", Role: "OPT-PARTICIPANT", Status: "NEEDS-ACTION", RSVP: true},
+		{Email: "user@example.com", Role: "REQ-PARTICIPANT", Status: "NEEDS-ACTION", RSVP: true},
+	}, events[0].Attendees)
+
+	// Taking an attendee off sends them a cancellation and the rest an update
+	w = httptest.NewRecorder()
+	req := withURLParam(withUser(httptest.NewRequest("PATCH", "/api/bookings/"+b.ID, strings.NewReader(`{"title":"Budget review","attendees":["user@example.com"]}`)), "user-admin"), "id", b.ID)
+	h.UpdateBooking(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	sent = sentTo(t, h, notifier, &seen)
+	require.Len(t, sent, 3)
+	assert.True(t, strings.HasPrefix(sent["user@example.com"].Subject, "Updated: Budget review @"))
+	assert.Equal(t, "Budget review", invite(t, sent["user@example.com"], "REQUEST")[0].Summary)
+	assert.True(t, strings.HasPrefix(sent["carol@example.com"].Subject, "Cancelled: Budget review @"))
+	assert.Contains(t, sent["carol@example.com"].Body, "taken you off the attendees")
+	removed := invite(t, sent["carol@example.com"], "CANCEL")
+	require.Len(t, removed, 1)
+	assert.Equal(t, b.ID+"@rooms.example.com", removed[0].UID)
+
+	w = httptest.NewRecorder()
+	h.DeleteBooking(w, withURLParam(withUser(httptest.NewRequest("DELETE", "/api/bookings/"+b.ID, nil), "user-admin"), "id", b.ID))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	sent = sentTo(t, h, notifier, &seen)
+	require.Len(t, sent, 2, "the organiser and the remaining attendee")
+	assert.Contains(t, sent["user@example.com"].Body, "admin@example.com has cancelled this meeting.")
+	cancelled := invite(t, sent["user@example.com"], "CANCEL")
+	assert.Equal(t, "CANCELLED", cancelled[0].Status)
+}
+
+func TestHandler_SeriesNotifications(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	notifier := &recordingNotifier{}
+	h.SetNotifier(notifier)
+	seen := 0
+
+	series := createTestSeries(t, h, `,"attendees":["admin@example.com"]`)
+	sent := sentTo(t, h, notifier, &seen)
+	require.Len(t, sent, 2, "one invitation each for the whole series")
+	assert.Contains(t, sent["admin@example.com"].Body, "Repeats:   4 occurrences, the last on Mon 23 Mar 2099")
+	events := invite(t, sent["admin@example.com"], "REQUEST")
+	require.Len(t, events, 1)
+	assert.Equal(t, series.ID+"@roombooker", events[0].UID)
+	assert.Equal(t, "FREQ=WEEKLY;COUNT=4", events[0].RRule)
+
+	// Cancelling one occurrence leaves the rest of the series in calendars
+	second := series.Occurrences[1]
+	w := httptest.NewRecorder()
+	h.DeleteBooking(w, scopedRequest("DELETE", second.ID, ScopeOccurrence, ""))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	sent = sentTo(t, h, notifier, &seen)
+	require.Len(t, sent, 2)
+	assert.Contains(t, sent["admin@example.com"].Body, "Part of this recurring meeting has been cancelled")
+	assert.Contains(t, sent["admin@example.com"].Subject, "Mon 9 Mar 2099", "names the occurrence cancelled")
+	events = invite(t, sent["admin@example.com"], "REQUEST")
+	require.Len(t, events, 1)
+	require.Len(t, events[0].ExDates, 1)
+	start, err := time.Parse(time.RFC3339, second.Start)
+	require.NoError(t, err)
+	assert.True(t, events[0].ExDates[0].Equal(start))
+
+	w = httptest.NewRecorder()
+	h.DeleteBooking(w, scopedRequest("DELETE", series.ID, ScopeSeries, ""))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	sent = sentTo(t, h, notifier, &seen)
+	require.Len(t, sent, 2)
+	events = invite(t, sent["admin@example.com"], "CANCEL")
+	assert.Equal(t, "CANCELLED", events[0].Status)
+}
+
+func TestHandler_SeriesNotifications_VanishedSeries(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	series := createTestSeries(t, h, "")
+	h.bgWG.Wait()
+	h.repo = vanishedSeriesStore{Store: h.repo}
+	notifier := &recordingNotifier{}
+	h.SetNotifier(notifier)
+	seen := 0
+
+	b, err := h.repo.GetBooking(context.Background(), series.ID)
+	require.NoError(t, err)
+	h.notifyBookingChange(bookingCancelled, []repository.Booking{*b}, nil)
+	assert.Empty(t, sentTo(t, h, notifier, &seen), "nothing is left to write about")
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"roombooker/internal/policy"
+	"roombooker/internal/repository"
+)
+
+// loadTimezone resolves an IANA zone name such as "Europe/Berlin". The
+// server-local zone is refused since it differs between deployments.
+func loadTimezone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, errors.New("timezone must be an IANA zone name")
+	}
+	return time.LoadLocation(name)
+}
+
+// UpdateOfficeRequest holds the office fields to change; omitted fields are kept
+type UpdateOfficeRequest struct {
+	Name            *string `json:"name"`
+	Timezone        *string `json:"timezone"`
+	ReminderMinutes *int    `json:"reminder_minutes"`
+}
+
+// UpdateOfficeResponse is the saved office and the future bookings that fall
+// outside working hours in its timezone
+type UpdateOfficeResponse struct {
+	Office               Office    `json:"office"`
+	BookingsOutsideHours []Booking `json:"bookings_outside_hours"`
+}
+
+// UpdateOffice renames an office or changes its timezone or reminder
+// default. Working hours are read in the office timezone, so a change that
+// would leave future bookings outside them is refused with 409 and the list
+// of those bookings unless ?force=true is given.
+func (h *Handler) UpdateOffice(w http.ResponseWriter, r *http.Request) {
+	officeID := chi.URLParam(r, "id")
+
+	var req UpdateOfficeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	before, err := h.repo.GetOffice(r.Context(), officeID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Office not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to load office", err)
+		return
+	}
+	office := *before
+	if req.Name != nil {
+		if strings.TrimSpace(*req.Name) == "" {
+			http.Error(w, "name must not be empty", http.StatusBadRequest)
+			return
+		}
+		office.Name = *req.Name
+	}
+	if req.Timezone != nil {
+		office.Timezone = *req.Timezone
+	}
+	if req.ReminderMinutes != nil {
+		if err := checkReminderMinutes(*req.ReminderMinutes); err != nil {
+			http.Error(w, "reminder_minutes "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		office.ReminderMinutes = *req.ReminderMinutes
+	}
+	loc, err := loadTimezone(office.Timezone)
+	if err != nil {
+		http.Error(w, "invalid timezone: "+office.Timezone, http.StatusBadRequest)
+		return
+	}
+
+	outside := []Booking{}
+	if office.Timezone != before.Timezone {
+		rules, err := h.repo.ListBookingRules(r.Context(), officeID)
+		if err != nil {
+			storeError(w, "Failed to load booking rules", err)
+			return
+		}
+		upcoming, err := h.repo.ListBookingsByOffice(r.Context(), officeID, time.Now(), time.Time{})
+		if err != nil {
+			storeError(w, "Failed to load bookings", err)
+			return
+		}
+		// Rules are read in the office timezone, so judge the bookings by the new one
+		ev := policy.Evaluator{Rules: rules, Location: loc}
+		for i := range upcoming {
+			if len(ev.Workday(upcoming[i].StartsAt, upcoming[i].EndsAt)) > 0 {
+				outside = append(outside, bookingFromRepo(&upcoming[i]))
+			}
+		}
+	}
+	force := r.URL.Query().Get("force") == "true"
+	if len(outside) > 0 && !force {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":                "Future bookings would fall outside working hours in " + office.Timezone + "; pass force=true to change it anyway",
+			"bookings_outside_hours": outside,
+		})
+		return
+	}
+
+	ctx := audited(r, h.auditEntry(r, "office.update", "office", officeID, map[string]interface{}{
+		"before":                 officeFromRepo(before),
+		"after":                  officeFromRepo(&office),
+		"bookings_outside_hours": len(outside),
+		"forced":                 force,
+	}))
+	if err := h.repo.UpdateOffice(ctx, &office); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Office not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to update office", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UpdateOfficeResponse{Office: officeFromRepo(&office), BookingsOutsideHours: outside})
+}
+
+// DeleteOffice deletes an office. One that still has floors is refused with
+// 409 and a count of what would go with it, unless ?force=true is given, in
+// which case its floors, rooms and bookings are deleted too.
+func (h *Handler) DeleteOffice(w http.ResponseWriter, r *http.Request) {
+	officeID := chi.URLParam(r, "id")
+	force := r.URL.Query().Get("force") == "true"
+
+	office, err := h.repo.GetOffice(r.Context(), officeID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Office not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to load office", err)
+		return
+	}
+	floors, err := h.repo.ListFloors(r.Context(), officeID)
+	if err != nil {
+		storeError(w, "Failed to load floors", err)
+		return
+	}
+	upcoming, err := h.repo.ListBookingsByOffice(r.Context(), officeID, time.Now(), time.Time{})
+	if err != nil {
+		storeError(w, "Failed to load bookings", err)
+		return
+	}
+	impact := map[string]interface{}{
+		"floors":          len(floors),
+		"future_bookings": len(upcoming),
+	}
+
+	ctx := audited(r, h.auditEntry(r, "office.delete", "office", officeID, map[string]interface{}{
+		"before":          officeFromRepo(office),
+		"forced":          force,
+		"floors":          len(floors),
+		"future_bookings": len(upcoming),
+	}))
+	if err := h.repo.DeleteOffice(ctx, officeID, force); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Office not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrOfficeNotEmpty):
+			impact["message"] = "Office still has floors; pass force=true to delete it with its floors, rooms and bookings"
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(impact)
+		default:
+			storeError(w, "Failed to delete office", err)
+		}
+		return
+	}
+	impact["message"] = "Office " + officeID + " deleted"
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(impact)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/repository"
+)
+
+func TestHandler_GetOffices(t *testing.T) {
+	h := newBookingsTestHandler(t)
+
+	w := httptest.NewRecorder()
+	h.GetOffices(w, httptest.NewRequest("GET", "/api/offices", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var offices []Office
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &offices))
+	require.Len(t, offices, 1)
+	assert.Equal(t, Office{ID: "office-1", Name: "Main Office", Timezone: "America/New_York", ReminderMinutes: 15}, offices[0])
+}
+
+func TestHandler_GetRoomsByOffice(t *testing.T) {
+	h := newBookingsTestHandler(t)
+
+	req := withURLParam(httptest.NewRequest("GET", "/api/offices/office-1/rooms", nil), "officeId", "office-1")
+	w := httptest.NewRecorder()
+	h.GetRoomsByOffice(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var rooms []Room
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rooms))
+	require.Len(t, rooms, 6)
+	first := rooms[0]
+	assert.Equal(t, "room-101", first.ID)
+	assert.Equal(t, "Room 101", first.Name)
+	assert.Equal(t, 4, first.Capacity)
+	assert.Equal(t, "floor-1-1", first.FloorID)
+	assert.Equal(t, "Floor 1", first.Floor)
+	assert.Equal(t, "#FF5733", first.Color)
+	assert.JSONEq(t, `{"screen": true, "vc": true}`, string(first.Equipment))
+}
+
+func TestHandler_GetRoomsByOffice_UnknownOffice(t *testing.T) {
+	h := newBookingsTestHandler(t)
+
+	req := withURLParam(httptest.NewRequest("GET", "/api/offices/nope/rooms", nil), "officeId", "nope")
+	w := httptest.NewRecorder()
+	h.GetRoomsByOffice(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func officeRequest(method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	return withURLParam(withUser(req, "user-admin"), "id", "office-1")
+}
+
+func TestHandler_UpdateOffice(t *testing.T) {
+	h := newBookingsTestHandler(t)
+
+	w := httptest.NewRecorder()
+	h.UpdateOffice(w, officeRequest("PATCH", "/api/admin/offices/office-1", `{"name":"Head Office"}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp UpdateOfficeResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, Office{ID: "office-1", Name: "Head Office", Timezone: "America/New_York", ReminderMinutes: 15}, resp.Office)
+	assert.Empty(t, resp.BookingsOutsideHours)
+
+	w = httptest.NewRecorder()
+	h.UpdateOffice(w, officeRequest("PATCH", "/api/admin/offices/office-1", `{"reminder_minutes":0}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 0, resp.Office.ReminderMinutes, "reminders off")
+
+	for _, body := range []string{`{"timezone":"Mars/Olympus_Mons"}`, `{"timezone":"Local"}`, `{"name":" "}`, `{"reminder_minutes":-5}`, `{"reminder_minutes":1441}`} {
+		w = httptest.NewRecorder()
+		h.UpdateOffice(w, officeRequest("PATCH", "/api/admin/offices/office-1", body))
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	req := withURLParam(httptest.NewRequest("PATCH", "/api/admin/offices/nope", strings.NewReader(`{}`)), "id", "nope")
+	w = httptest.NewRecorder()
+	h.UpdateOffice(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_UpdateOffice_TimezoneChangeShowsBookingsOutsideHours(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	// 09:00-10:00 in New York is 23:00 in Tokyo
+	late := createTestBooking(t, h, "room-101", "user-regular", "2099-03-02T14:00:00Z", "2099-03-02T15:00:00Z")
+	// 20:00-21:00 UTC is 15:00 in New York and 05:00 in Tokyo
+	createTestBooking(t, h, "room-102", "user-regular", "2099-03-02T20:00:00Z", "2099-03-02T21:00:00Z")
+	// 00:00-01:00 UTC is 19:00 in New York, already outside hours, and 09:00 in Tokyo
+	_, err := h.repo.CreateBooking(context.Background(), &repository.Booking{
+		RoomID:    "room-103",
+		CreatedBy: "user-regular",
+		Title:     "Evening",
+		StartsAt:  time.Date(2099, 3, 3, 0, 0, 0, 0, time.UTC),
+		EndsAt:    time.Date(2099, 3, 3, 1, 0, 0, 0, time.UTC),
+		Status:    repository.BookingStatusActive,
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	h.UpdateOffice(w, officeRequest("PATCH", "/api/admin/offices/office-1", `{"timezone":"Asia/Tokyo"}`))
+	require.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	var conflict UpdateOfficeResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &conflict))
+	require.Len(t, conflict.BookingsOutsideHours, 2)
+	assert.Equal(t, late.ID, conflict.BookingsOutsideHours[0].ID)
+
+	office, err := h.repo.GetOffice(context.Background(), "office-1")
+	require.NoError(t, err)
+	assert.Equal(t, "America/New_York", office.Timezone, "a refused change is not saved")
+
+	w = httptest.NewRecorder()
+	h.UpdateOffice(w, officeRequest("PATCH", "/api/admin/offices/office-1?force=true", `{"timezone":"Asia/Tokyo"}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp UpdateOfficeResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Asia/Tokyo", resp.Office.Timezone)
+	assert.Len(t, resp.BookingsOutsideHours, 2)
+
+	rules, err := h.repo.ListBookingRules(context.Background(), "office-1")
+	require.NoError(t, err)
+	assert.Equal(t, "Asia/Tokyo", rules[0].Timezone)
+
+	entries, err := h.repo.ListAuditLogs(context.Background(), repository.AuditFilter{EntityType: "office", EntityID: "office-1"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "office.update", entries[0].Action)
+	assert.Equal(t, "user-admin", entries[0].ActorUserID)
+	assert.Contains(t, entries[0].Payload, `"forced":true`)
+}
+
+func TestHandler_DeleteOffice(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	booking := createTestBooking(t, h, "room-101", "user-regular", "2099-03-02T14:00:00Z", "2099-03-02T15:00:00Z")
+
+	w := httptest.NewRecorder()
+	h.DeleteOffice(w, officeRequest("DELETE", "/api/admin/offices/office-1", ""))
+	require.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	var impact map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &impact))
+	assert.EqualValues(t, 8, impact["floors"])
+	assert.EqualValues(t, 1, impact["future_bookings"])
+	_, err := h.repo.GetOffice(context.Background(), "office-1")
+	require.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	h.DeleteOffice(w, officeRequest("DELETE", "/api/admin/offices/office-1?force=true", ""))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	_, err = h.repo.GetOffice(context.Background(), "office-1")
+	assert.Error(t, err)
+	_, err = h.repo.GetBooking(context.Background(), booking.ID)
+	assert.Error(t, err, "bookings go with the office")
+
+	entries, err := h.repo.ListAuditLogs(context.Background(), repository.AuditFilter{Action: "office.delete"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "office-1", entries[0].EntityID)
+	assert.Contains(t, entries[0].Payload, `"Main Office"`)
+
+	w = httptest.NewRecorder()
+	h.DeleteOffice(w, officeRequest("DELETE", "/api/admin/offices/office-1", ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"roombooker/internal/notify"
+	"roombooker/internal/repository"
+)
+
+// maxReminderMinutes is the longest a reminder may come before a booking,
+// and so how far ahead the scheduler looks for bookings to remind people of
+const maxReminderMinutes = 24 * 60
+
+// reminderLease is how long a server's claim on a reminder holds. Should it
+// die before sending, another server sends the reminder once the claim lapses.
+const reminderLease = 5 * time.Minute
+
+func checkReminderMinutes(minutes int) error {
+	if minutes < 0 || minutes > maxReminderMinutes {
+		return fmt.Errorf("must be between 0 and %d", maxReminderMinutes)
+	}
+	return nil
+}
+
+// ReminderPreference is how many minutes before their bookings start a user
+// is reminded of them: 0 for never, null for the default of each office
+type ReminderPreference struct {
+	Minutes *int `json:"minutes"`
+}
+
+// GetReminderPreference returns the signed-in user's reminder preference
+func (h *Handler) GetReminderPreference(w http.ResponseWriter, r *http.Request) {
+	userID := fmt.Sprintf("%v", r.Context().Value("user_id"))
+	user, err := h.repo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to load reminder preference", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ReminderPreference{Minutes: user.ReminderMinutes})
+}
+
+// SetReminderPreference changes how long before their bookings the signed-in
+// user is reminded of them
+func (h *Handler) SetReminderPreference(w http.ResponseWriter, r *http.Request) {
+	userID := fmt.Sprintf("%v", r.Context().Value("user_id"))
+	var req ReminderPreference
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Minutes != nil {
+		if err := checkReminderMinutes(*req.Minutes); err != nil {
+			http.Error(w, "minutes "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	ctx := audited(r, h.auditEntry(r, "user.reminders", "user", userID, map[string]interface{}{"minutes": req.Minutes}))
+	if err := h.repo.SetReminderMinutes(ctx, userID, req.Minutes); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to save reminder preference", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req)
+}
+
+// RunReminders sends booking reminders as they fall due, checking every
+// interval until ctx is done. Reminders are claimed in the store before they
+// are sent, so any number of servers may run it at once, and those falling
+// due while no server ran go out as soon as one starts, if the booking has
+// not begun.
+func (h *Handler) RunReminders(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		if _, err := h.SendDueReminders(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			h.logger.Warn("sending booking reminders failed", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendDueReminders reminds the organisers and attendees of bookings starting
+// soon whose reminders are due at now, and returns how many it sent. Each
+// person is reminded the number of minutes they chose, or else the number
+// the booked room's office sets, before the booking starts. Declined
+// attendees, and bookings made after their reminder was due, are skipped.
+// A booking that cannot be looked up is logged and left for the next run, so
+// it does not hold up the others.
+func (h *Handler) SendDueReminders(ctx context.Context, now time.Time) (int, error) {
+	if h.notifier == nil {
+		return 0, nil
+	}
+	now = now.UTC()
+	bookings, err := h.repo.ListBookingsStarting(ctx, now, now.Add(maxReminderMinutes*time.Minute))
+	if err != nil {
+		return 0, err
+	}
+	rooms := h.feedRooms(ctx, h.defaultLocation())
+	officeMinutes := h.officeReminderMinutes(ctx)
+	users := map[string]*repository.User{}
+	userByEmail := func(email string) (*repository.User, error) {
+		if u, ok := users[email]; ok {
+			return u, nil
+		}
+		u, err := h.repo.GetUserByEmail(ctx, email)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		users[email] = u
+		return u, nil
+	}
+
+	sent := 0
+	for i := range bookings {
+		b := &bookings[i]
+		warn := func(msg string, err error, fields ...zap.Field) {
+			h.logger.Warn(msg, append(fields, zap.String("booking_id", b.ID), zap.Error(err))...)
+		}
+		defaultMinutes, err := officeMinutes(b.RoomID)
+		if err != nil {
+			warn("cannot look up booking reminder default", err)
+			continue
+		}
+		participants, err := h.repo.ListParticipants(ctx, b.ID)
+		if err != nil {
+			warn("cannot list booking attendees to remind", err)
+			continue
+		}
+		organizer := ""
+		if u, err := h.repo.GetUserByID(ctx, b.CreatedBy); err == nil {
+			organizer = strings.ToLower(u.Email)
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			warn("cannot find booking organiser to remind", err)
+			continue
+		}
+		recipients := []string{}
+		if organizer != "" {
+			recipients = append(recipients, organizer)
+		}
+		attendees := make([]string, 0, len(participants))
+		for _, p := range participants {
+			attendees = append(attendees, p.Email)
+			if p.ResponseStatus != repository.ResponseDeclined && p.Email != organizer {
+				recipients = append(recipients, p.Email)
+			}
+		}
+
+		for _, to := range recipients {
+			minutes := defaultMinutes
+			u, err := userByEmail(to)
+			if err != nil {
+				warn("cannot look up reminder preference", err, zap.String("to", to))
+				continue
+			}
+			if u != nil && u.ReminderMinutes != nil {
+				minutes = *u.ReminderMinutes
+			}
+			due := b.StartsAt.Add(-time.Duration(minutes) * time.Minute)
+			if minutes == 0 || now.Before(due) || b.CreatedAt.After(due) {
+				continue
+			}
+			rem := repository.Reminder{BookingID: b.ID, Email: to, StartsAt: b.StartsAt}
+			claimed, err := h.repo.ClaimReminder(ctx, rem, now, now.Add(-reminderLease))
+			if err != nil {
+				warn("cannot claim booking reminder", err, zap.String("to", to))
+				continue
+			}
+			if !claimed {
+				continue
+			}
+			room, err := rooms(b.RoomID)
+			if err == nil {
+				err = h.sendReminder(ctx, to, b, room, organizer, attendees, now)
+			}
+			if err != nil {
+				// Let the next run try again
+				if releaseErr := h.repo.ReleaseReminder(ctx, rem); releaseErr != nil {
+					warn("cannot release booking reminder", releaseErr, zap.String("to", to))
+				}
+				warn("booking reminder failed", err, zap.String("to", to))
+				continue
+			}
+			sent++
+			// The reminder went out; should recording that fail, it may go
+			// out again once the claim lapses
+			if err := h.repo.MarkReminderSent(ctx, rem, time.Now()); err != nil {
+				warn("cannot record booking reminder as sent", err, zap.String("to", to))
+			}
+		}
+	}
+	return sent, nil
+}
+
+// officeReminderMinutes looks up the reminder default of the office each
+// room is in, once per room. Rooms since deleted get DefaultReminderMinutes.
+func (h *Handler) officeReminderMinutes(ctx context.Context) func(roomID string) (int, error) {
+	byRoom := map[string]int{}
+	return func(roomID string) (int, error) {
+		if minutes, ok := byRoom[roomID]; ok {
+			return minutes, nil
+		}
+		minutes := repository.DefaultReminderMinutes
+		room, err := h.repo.GetRoom(ctx, roomID)
+		if err == nil {
+			var office *repository.Office
+			if office, err = h.repo.GetOffice(ctx, room.OfficeID); err == nil {
+				minutes = office.ReminderMinutes
+			}
+		}
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+		byRoom[roomID] = minutes
+		return minutes, nil
+	}
+}
+
+// sendReminder emails one person a reminder of b
+func (h *Handler) sendReminder(ctx context.Context, to string, b *repository.Booking, room feedRoom, organizer string, attendees []string, now time.Time) error {
+	mail := bookingMail{
+		Change:      bookingReminder,
+		Organising:  to == organizer,
+		Title:       b.Title,
+		Room:        room.name,
+		When:        formatWhen(b.StartsAt, b.EndsAt, room.loc),
+		StartsIn:    formatStartsIn(b.StartsAt.Sub(now)),
+		Organizer:   organizer,
+		Attendees:   attendees,
+		Description: b.Description,
+	}
+	if h.config != nil {
+		mail.Link = h.config.App.BaseURL
+	}
+	if mail.Room == "" {
+		mail.Room = "a room no longer listed"
+	}
+	subject, body, err := mail.render()
+	if err != nil {
+		return err
+	}
+	return h.notifier.Notify(ctx, notify.Message{To: []string{to}, Subject: subject, Body: body})
+}
+
+// formatStartsIn says how long until a booking starts, to the minute
+func formatStartsIn(d time.Duration) string {
+	minutes := int((d + time.Minute - 1) / time.Minute)
+	hours, minutes := minutes/60, minutes%60
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return "1 " + unit
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	switch {
+	case hours == 0:
+		return plural(minutes, "minute")
+	case minutes == 0:
+		return plural(hours, "hour")
+	}
+	return plural(hours, "hour") + " " + plural(minutes, "minute")
+}
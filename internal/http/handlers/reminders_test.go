@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/notify"
+	"roombooker/internal/repository"
+)
+
+// failingNotifier fails every delivery
+type failingNotifier struct{}
+
+func (failingNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	return errors.New("mail server down")
+}
+
+// createRemindedBooking books room-103 for 2099-03-06 15:00–16:00 UTC as
+// user-admin, inviting user@example.com and carol@example.com
+func createRemindedBooking(t *testing.T, h *Handler) (Booking, time.Time) {
+	body := `{"title":"Review","start_time":"2099-03-06T15:00:00Z","end_time":"2099-03-06T16:00:00Z","room_id":"room-103",` +
+		`"attendees":["user@example.com","carol@example.com"]}`
+	w := httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-admin"))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var b Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &b))
+	// The invitations go out before reminders are watched
+	h.bgWG.Wait()
+	return b, time.Date(2099, 3, 6, 15, 0, 0, 0, time.UTC)
+}
+
+func TestHandler_SendDueReminders(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	h.config.App.BaseURL = "http://rooms.example.com"
+	b, start := createRemindedBooking(t, h)
+	ctx := context.Background()
+	hour := 60
+	require.NoError(t, h.repo.SetReminderMinutes(ctx, "user-regular", &hour))
+	notifier := &recordingNotifier{}
+	h.SetNotifier(notifier)
+	seen := 0
+
+	n, err := h.SendDueReminders(ctx, start.Add(-2*time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	n, err = h.SendDueReminders(ctx, start.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	sent := sentTo(t, h, notifier, &seen)
+	require.Contains(t, sent, "user@example.com", "who asked for an hour's notice")
+	reminder := sent["user@example.com"]
+	assert.Equal(t, "Reminder: Review @ Fri 6 Mar 2099 10:00–11:00 EST", reminder.Subject)
+	assert.Contains(t, reminder.Body, "A meeting you are invited to starts in 1 hour.")
+	assert.Contains(t, reminder.Body, "Organizer: admin@example.com")
+	assert.Contains(t, reminder.Body, "See your bookings at http://rooms.example.com")
+	assert.Empty(t, reminder.Attachments)
+
+	// The office's 15 minutes for everyone else, caught up on if late
+	n, err = h.SendDueReminders(ctx, start.Add(-14*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	sent = sentTo(t, h, notifier, &seen)
+	require.Len(t, sent, 2)
+	assert.Contains(t, sent["admin@example.com"].Body, "Your booking of Room 103 starts in 14 minutes.")
+	assert.Contains(t, sent["carol@example.com"].Body, "starts in 14 minutes")
+
+	n, err = h.SendDueReminders(ctx, start.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Zero(t, n, "each reminder is sent once")
+
+	// Moving the booking calls for new reminders
+	w := httptest.NewRecorder()
+	req := withURLParam(withUser(httptest.NewRequest("PATCH", "/api/bookings/"+b.ID,
+		strings.NewReader(`{"start_time":"2099-03-06T17:00:00Z","end_time":"2099-03-06T18:00:00Z"}`)), "user-admin"), "id", b.ID)
+	h.UpdateBooking(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	h.bgWG.Wait()
+	n, err = h.SendDueReminders(ctx, start.Add(2*time.Hour-10*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+}
+
+func TestHandler_SendDueReminders_Skips(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	b, start := createRemindedBooking(t, h)
+	ctx := context.Background()
+	off := 0
+	require.NoError(t, h.repo.SetReminderMinutes(ctx, "user-admin", &off))
+	require.NoError(t, h.repo.SetParticipantResponse(ctx, b.ID, "carol@example.com", repository.ResponseDeclined))
+	notifier := &recordingNotifier{}
+	h.SetNotifier(notifier)
+	seen := 0
+
+	_, err := h.SendDueReminders(ctx, start.Add(-10*time.Minute))
+	require.NoError(t, err)
+	sent := sentTo(t, h, notifier, &seen)
+	assert.Len(t, sent, 1, "not those who turned reminders off or declined")
+	assert.Contains(t, sent, "user@example.com")
+
+	// Bookings made after their reminder was due need none
+	soon := time.Now().Add(5 * time.Minute)
+	_, err = h.repo.CreateBooking(ctx, &repository.Booking{RoomID: "room-104", CreatedBy: "user-regular", Title: "Standup", StartsAt: soon, EndsAt: soon.Add(15 * time.Minute)})
+	require.NoError(t, err)
+	n, err := h.SendDueReminders(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestHandler_SendDueReminders_RetriesFailures(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	_, start := createRemindedBooking(t, h)
+	ctx := context.Background()
+
+	h.SetNotifier(failingNotifier{})
+	n, err := h.SendDueReminders(ctx, start.Add(-15*time.Minute))
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	notifier := &recordingNotifier{}
+	h.SetNotifier(notifier)
+	n, err = h.SendDueReminders(ctx, start.Add(-14*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n, "failed reminders are sent on the next run")
+}
+
+// flakyReminderStore fails to list the attendees of one booking and to record
+// any reminder as sent
+type flakyReminderStore struct {
+	repository.Store
+	failBookingID string
+}
+
+func (s flakyReminderStore) ListParticipants(ctx context.Context, bookingID string) ([]repository.Participant, error) {
+	if bookingID == s.failBookingID {
+		return nil, errors.New("database unavailable")
+	}
+	return s.Store.ListParticipants(ctx, bookingID)
+}
+
+func (s flakyReminderStore) MarkReminderSent(ctx context.Context, rem repository.Reminder, at time.Time) error {
+	return errors.New("database unavailable")
+}
+
+func TestHandler_SendDueReminders_StoreErrors(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	failing, start := createRemindedBooking(t, h)
+	createTestBooking(t, h, "room-104", "user-regular", "2099-03-06T15:00:00Z", "2099-03-06T16:00:00Z")
+	h.bgWG.Wait()
+	h.repo = flakyReminderStore{Store: h.repo, failBookingID: failing.ID}
+	notifier := &recordingNotifier{}
+	h.SetNotifier(notifier)
+	seen := 0
+
+	n, err := h.SendDueReminders(context.Background(), start.Add(-10*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n, "the other booking is not held up")
+	sent := sentTo(t, h, notifier, &seen)
+	require.Len(t, sent, 1)
+	assert.Contains(t, sent, "user@example.com")
+}
+
+func TestHandler_SendDueReminders_SeveralServers(t *testing.T) {
+	first := newBookingsTestHandler(t)
+	_, start := createRemindedBooking(t, first)
+	second := NewHandler(first.repo, nil, nil, first.config, nil)
+	notifier := &recordingNotifier{}
+	first.SetNotifier(notifier)
+	second.SetNotifier(notifier)
+
+	var wg sync.WaitGroup
+	for _, h := range []*Handler{first, second, first, second} {
+		wg.Add(1)
+		go func(h *Handler) {
+			defer wg.Done()
+			_, err := h.SendDueReminders(context.Background(), start.Add(-10*time.Minute))
+			assert.NoError(t, err)
+		}(h)
+	}
+	wg.Wait()
+	assert.Len(t, notifier.sent(), 3, "one reminder each, however many servers run")
+}
+
+func TestHandler_ReminderPreference(t *testing.T) {
+	h := newBookingsTestHandler(t)
+
+	w := httptest.NewRecorder()
+	h.GetReminderPreference(w, withUser(httptest.NewRequest("GET", "/me/reminders", nil), "user-regular"))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"minutes":null}`, w.Body.String(), "the office default")
+
+	w = httptest.NewRecorder()
+	h.SetReminderPreference(w, withUser(httptest.NewRequest("PUT", "/me/reminders", strings.NewReader(`{"minutes":30}`)), "user-regular"))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = httptest.NewRecorder()
+	h.GetReminderPreference(w, withUser(httptest.NewRequest("GET", "/me/reminders", nil), "user-regular"))
+	assert.JSONEq(t, `{"minutes":30}`, w.Body.String())
+
+	logs, err := h.repo.ListAuditLogs(context.Background(), repository.AuditFilter{Action: "user.reminders"})
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+
+	for _, body := range []string{`{"minutes":-1}`, `{"minutes":1441}`, `nope`} {
+		w = httptest.NewRecorder()
+		h.SetReminderPreference(w, withUser(httptest.NewRequest("PUT", "/me/reminders", strings.NewReader(body)), "user-regular"))
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	w = httptest.NewRecorder()
+	h.SetReminderPreference(w, withUser(httptest.NewRequest("PUT", "/me/reminders", strings.NewReader(`{"minutes":null}`)), "nobody"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
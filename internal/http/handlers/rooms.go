@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"roombooker/internal/notify"
+	"roombooker/internal/repository"
+)
+
+// bookableRoom loads roomID for a new or moved booking. It writes an error and
+// returns false unless the room exists and is in service.
+func (h *Handler) bookableRoom(w http.ResponseWriter, r *http.Request, roomID string) (*repository.Room, bool) {
+	room, err := h.repo.GetRoom(r.Context(), roomID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Unknown room_id", http.StatusBadRequest)
+			return nil, false
+		}
+		storeError(w, "Failed to load room", err)
+		return nil, false
+	}
+	if !room.DecommissionedAt.IsZero() {
+		http.Error(w, "Room has been decommissioned", http.StatusConflict)
+		return nil, false
+	}
+	return room, true
+}
+
+// UpdateRoomRequest holds the room fields to change; omitted fields are kept.
+// Equipment may be a JSON object or a string holding JSON.
+type UpdateRoomRequest struct {
+	Name            *string         `json:"name"`
+	Capacity        *int            `json:"capacity"`
+	Equipment       json.RawMessage `json:"equipment"`
+	Color           *string         `json:"color"`
+	GraphResourceID *string         `json:"graph_resource_id"`
+}
+
+func (h *Handler) UpdateRoom(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "id")
+
+	var req UpdateRoomRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	room, err := h.repo.GetRoom(r.Context(), roomID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to load room", err)
+		return
+	}
+	before := *room
+
+	if req.Name != nil {
+		if strings.TrimSpace(*req.Name) == "" {
+			http.Error(w, "name must not be empty", http.StatusBadRequest)
+			return
+		}
+		room.Name = *req.Name
+	}
+	if req.Capacity != nil {
+		if *req.Capacity <= 0 {
+			http.Error(w, "capacity must be positive", http.StatusBadRequest)
+			return
+		}
+		room.Capacity = *req.Capacity
+	}
+	if len(req.Equipment) > 0 {
+		equipment, err := equipmentText(req.Equipment)
+		if err != nil {
+			http.Error(w, "invalid equipment", http.StatusBadRequest)
+			return
+		}
+		room.Equipment = equipment
+	}
+	if req.Color != nil {
+		room.Color = *req.Color
+	}
+	if req.GraphResourceID != nil {
+		room.GraphResourceID = strings.TrimSpace(*req.GraphResourceID)
+		room.GraphIntegration = room.GraphResourceID != ""
+	}
+
+	ctx := audited(r, h.auditEntry(r, "room.update", "room", roomID, map[string]interface{}{
+		"before": roomFromRepo(&before),
+		"after":  roomFromRepo(room),
+	}))
+	if err := h.repo.UpdateRoom(ctx, room); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to update room", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(roomFromRepo(room))
+}
+
+// equipmentText returns the JSON text to store for an equipment value given as an object or a JSON string
+func equipmentText(raw json.RawMessage) (string, error) {
+	if string(raw) == "null" {
+		return "", nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if s != "" && !json.Valid([]byte(s)) {
+			return "", errors.New("equipment is not JSON")
+		}
+		return s, nil
+	}
+	return string(raw), nil
+}
+
+// DecommissionResponse reports what decommissioning a room did to its bookings
+type DecommissionResponse struct {
+	Room              Room      `json:"room"`
+	FutureBookings    []Booking `json:"future_bookings"`
+	BookingsCancelled bool      `json:"bookings_cancelled"`
+}
+
+// DeleteRoom decommissions a room: it disappears from room lists and takes no new
+// bookings, but keeps its history. Its future bookings are reported and, with
+// ?cancel_bookings=true, cancelled; their bookers are notified either way.
+// ?purge=true deletes the row instead, which is only allowed for rooms never booked.
+func (h *Handler) DeleteRoom(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "id")
+	room, err := h.repo.GetRoom(r.Context(), roomID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to load room", err)
+		return
+	}
+	before := *room
+
+	if r.URL.Query().Get("purge") == "true" {
+		ctx := audited(r, h.auditEntry(r, "room.delete", "room", roomID, map[string]interface{}{"before": roomFromRepo(&before)}))
+		if err := h.repo.DeleteRoom(ctx, roomID); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				http.Error(w, "Room not found", http.StatusNotFound)
+			case errors.Is(err, repository.ErrRoomHasBookings):
+				http.Error(w, "Room has booking history; decommission it instead", http.StatusConflict)
+			default:
+				storeError(w, "Failed to delete room", err)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Room " + roomID + " deleted"})
+		return
+	}
+
+	now := time.Now().UTC()
+	after := before
+	if after.DecommissionedAt.IsZero() {
+		after.DecommissionedAt = now
+	}
+	decommission := h.auditEntry(r, "room.decommission", "room", roomID, map[string]interface{}{
+		"before": roomFromRepo(&before),
+		"after":  roomFromRepo(&after),
+	})
+	// The store picks the bookings to cancel under the room's booking lock,
+	// so none made meanwhile is left behind in a room out of service
+	ctx := repository.WithAudit(r.Context(), func(ids []string) []repository.AuditLog {
+		entries := []repository.AuditLog{decommission}
+		for _, id := range ids {
+			entries = append(entries, h.auditEntry(r, "booking.cancel", "booking", id, map[string]interface{}{
+				"reason": "room_decommissioned",
+			}))
+		}
+		return entries
+	})
+	cancelBookings := r.URL.Query().Get("cancel_bookings") == "true"
+	future, err := h.repo.DecommissionRoom(ctx, roomID, now, cancelBookings)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to decommission room", err)
+		return
+	}
+	if !cancelBookings {
+		// The bookings are kept; their bookers are told to move them
+		upcoming, err := h.repo.ListBookingsByRoom(r.Context(), roomID, now, time.Time{})
+		if err != nil {
+			storeError(w, "Failed to load bookings", err)
+			return
+		}
+		// Meetings already under way are left alone
+		for _, b := range upcoming {
+			if !b.StartsAt.Before(now) {
+				future = append(future, b)
+			}
+		}
+	}
+	room, err = h.repo.GetRoom(r.Context(), roomID)
+	if err != nil {
+		storeError(w, "Failed to load room", err)
+		return
+	}
+	h.notifyRoomDecommissioned(*room, future, cancelBookings)
+
+	resp := DecommissionResponse{Room: roomFromRepo(room), FutureBookings: make([]Booking, 0, len(future)), BookingsCancelled: cancelBookings}
+	for i := range future {
+		resp.FutureBookings = append(resp.FutureBookings, bookingFromRepo(&future[i]))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// notifyRoomDecommissioned tells each booker, in the background, which of their bookings are affected
+func (h *Handler) notifyRoomDecommissioned(room repository.Room, bookings []repository.Booking, cancelled bool) {
+	if h.notifier == nil || len(bookings) == 0 {
+		return
+	}
+	byUser := map[string][]repository.Booking{}
+	for _, b := range bookings {
+		if b.CreatedBy != "" {
+			byUser[b.CreatedBy] = append(byUser[b.CreatedBy], b)
+		}
+	}
+	h.goBackground(func(ctx context.Context) {
+		for userID, userBookings := range byUser {
+			user, err := h.repo.GetUserByID(ctx, userID)
+			if err != nil {
+				h.logger.Warn("cannot notify booker", zap.String("user_id", userID), zap.Error(err))
+				continue
+			}
+			if err := h.notifier.Notify(ctx, decommissionMessage(user.Email, room, userBookings, cancelled)); err != nil {
+				h.logger.Warn("decommission notification failed", zap.String("user_id", userID), zap.Error(err))
+			}
+		}
+	})
+}
+
+func decommissionMessage(to string, room repository.Room, bookings []repository.Booking, cancelled bool) notify.Message {
+	sort.Slice(bookings, func(i, j int) bool { return bookings[i].StartsAt.Before(bookings[j].StartsAt) })
+	var body strings.Builder
+	if cancelled {
+		fmt.Fprintf(&body, "%s has been taken out of service and these bookings were cancelled:\n\n", room.Name)
+	} else {
+		fmt.Fprintf(&body, "%s has been taken out of service. These bookings need a new room:\n\n", room.Name)
+	}
+	for _, b := range bookings {
+		start, end := b.StartsAt.UTC(), b.EndsAt.UTC()
+		endLayout := "15:04"
+		if end.YearDay() != start.YearDay() || end.Year() != start.Year() {
+			endLayout = "Mon 2 Jan 2006 15:04"
+		}
+		fmt.Fprintf(&body, "- %s: %s to %s (UTC)\n", b.Title, start.Format("Mon 2 Jan 2006 15:04"), end.Format(endLayout))
+	}
+	return notify.Message{
+		To:      []string{to},
+		Subject: fmt.Sprintf("%s is no longer available", room.Name),
+		Body:    body.String(),
+	}
+}
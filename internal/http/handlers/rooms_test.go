@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/notify"
+	"roombooker/internal/repository"
+)
+
+// recordingNotifier keeps every message it is asked to send
+type recordingNotifier struct {
+	mu       sync.Mutex
+	messages []notify.Message
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.messages = append(n.messages, msg)
+	return nil
+}
+
+func (n *recordingNotifier) sent() []notify.Message {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]notify.Message(nil), n.messages...)
+}
+
+func createTestBooking(t *testing.T, h *Handler, roomID, userID, start, end string) Booking {
+	body := `{"title":"Sync","start_time":"` + start + `","end_time":"` + end + `","room_id":"` + roomID + `"}`
+	req := withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), userID)
+	w := httptest.NewRecorder()
+	h.CreateBooking(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var b Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &b))
+	return b
+}
+
+func TestHandler_UpdateRoom(t *testing.T) {
+	h := newBookingsTestHandler(t)
+
+	body := `{"name":"Room 101 Deluxe","capacity":12,"equipment":{"vc":true},"graph_resource_id":"room101@example.com"}`
+	req := withURLParam(httptest.NewRequest("PATCH", "/api/admin/rooms/room-101", strings.NewReader(body)), "id", "room-101")
+	w := httptest.NewRecorder()
+	h.UpdateRoom(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var room Room
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &room))
+	assert.Equal(t, "Room 101 Deluxe", room.Name)
+	assert.Equal(t, 12, room.Capacity)
+	assert.JSONEq(t, `{"vc":true}`, string(room.Equipment))
+	assert.Equal(t, "#FF5733", room.Color, "omitted fields are kept")
+	assert.True(t, room.GraphIntegration)
+	assert.Equal(t, "room101@example.com", room.GraphResourceID)
+
+	req = withURLParam(httptest.NewRequest("PATCH", "/api/admin/rooms/room-101", strings.NewReader(`{"capacity":0}`)), "id", "room-101")
+	w = httptest.NewRecorder()
+	h.UpdateRoom(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req = withURLParam(httptest.NewRequest("PATCH", "/api/admin/rooms/missing", strings.NewReader(`{}`)), "id", "missing")
+	w = httptest.NewRecorder()
+	h.UpdateRoom(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_DeleteRoom_DecommissionsAndCancels(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	notifier := &recordingNotifier{}
+	h.SetNotifier(notifier)
+
+	future := createTestBooking(t, h, "room-102", "user-regular", "2099-03-01T15:00:00Z", "2099-03-01T16:00:00Z")
+	later := createTestBooking(t, h, "room-102", "user-regular", "2099-03-08T15:00:00Z", "2099-03-08T16:00:00Z")
+
+	req := withURLParam(httptest.NewRequest("DELETE", "/api/admin/rooms/room-102?cancel_bookings=true", nil), "id", "room-102")
+	w := httptest.NewRecorder()
+	h.DeleteRoom(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp DecommissionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.NotEmpty(t, resp.Room.DecommissionedAt)
+	assert.True(t, resp.BookingsCancelled)
+	require.Len(t, resp.FutureBookings, 2)
+	assert.Equal(t, future.ID, resp.FutureBookings[0].ID)
+	assert.Equal(t, later.ID, resp.FutureBookings[1].ID)
+	assert.Equal(t, "cancelled", resp.FutureBookings[1].Status)
+
+	// The bookings are cancelled but kept, and the room takes no new bookings
+	for _, id := range []string{future.ID, later.ID} {
+		b, err := h.repo.GetBooking(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, "cancelled", b.Status)
+		logs, err := h.repo.ListAuditLogs(context.Background(), repository.AuditFilter{Action: "booking.cancel", EntityID: id})
+		require.NoError(t, err)
+		require.Len(t, logs, 1, "one entry per cancelled booking")
+		assert.JSONEq(t, `{"reason":"room_decommissioned"}`, logs[0].Payload)
+	}
+	body := `{"title":"Late","start_time":"2099-03-02T15:00:00Z","end_time":"2099-03-02T16:00:00Z","room_id":"room-102"}`
+	w = httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-regular"))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	require.NoError(t, h.Shutdown(context.Background()))
+	// Making the booking sent its own confirmation
+	var sent []notify.Message
+	for _, m := range notifier.sent() {
+		if strings.Contains(m.Subject, "no longer available") {
+			sent = append(sent, m)
+		}
+	}
+	require.Len(t, sent, 1)
+	assert.Equal(t, []string{"user@example.com"}, sent[0].To)
+	assert.Contains(t, sent[0].Subject, "Room 102")
+	assert.Contains(t, sent[0].Body, "cancelled")
+}
+
+func TestHandler_DeleteRoom_KeepsBookingsByDefault(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	future := createTestBooking(t, h, "room-103", "user-regular", "2099-03-01T15:00:00Z", "2099-03-01T16:00:00Z")
+
+	req := withURLParam(httptest.NewRequest("DELETE", "/api/admin/rooms/room-103", nil), "id", "room-103")
+	w := httptest.NewRecorder()
+	h.DeleteRoom(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp DecommissionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.False(t, resp.BookingsCancelled)
+	require.Len(t, resp.FutureBookings, 1)
+
+	b, err := h.repo.GetBooking(context.Background(), future.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "active", b.Status)
+}
+
+func TestHandler_DeleteRoom_PurgeRefusedWithHistory(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	createTestBooking(t, h, "room-104", "user-regular", "2024-01-10T10:00:00Z", "2024-01-10T11:00:00Z")
+
+	req := withURLParam(httptest.NewRequest("DELETE", "/api/admin/rooms/room-104?purge=true", nil), "id", "room-104")
+	w := httptest.NewRecorder()
+	h.DeleteRoom(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	req = withURLParam(httptest.NewRequest("DELETE", "/api/admin/rooms/room-105?purge=true", nil), "id", "room-105")
+	w = httptest.NewRecorder()
+	h.DeleteRoom(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, err := h.repo.GetRoom(context.Background(), "room-105")
+	assert.Error(t, err)
+}
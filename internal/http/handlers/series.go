@@ -0,0 +1,540 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"roombooker/internal/ical"
+	"roombooker/internal/policy"
+	"roombooker/internal/repository"
+)
+
+// maxSeriesYears bounds how far ahead a recurring booking is booked. A rule
+// without COUNT or UNTIL ends at its last occurrence within it.
+const maxSeriesYears = 1
+
+// Scopes of a change to an occurrence of a recurring booking
+const (
+	ScopeOccurrence = "occurrence"
+	ScopeFollowing  = "following"
+	ScopeSeries     = "series"
+)
+
+// BookingSeries is a recurring booking with the occurrences a request created or changed
+type BookingSeries struct {
+	ID          string    `json:"id"`
+	RRule       string    `json:"rrule"`
+	Occurrences []Booking `json:"occurrences"`
+}
+
+// OccurrenceViolation is a booking rule broken by one occurrence of a series
+type OccurrenceViolation struct {
+	policy.Violation
+	Occurrence string `json:"occurrence"`
+}
+
+// OccurrenceConflict is an occurrence of a series and the bookings blocking it
+type OccurrenceConflict struct {
+	Start     string    `json:"start"`
+	End       string    `json:"end"`
+	Conflicts []Booking `json:"conflicts"`
+}
+
+// bookingScope reads ?scope=, which defaults to the single occurrence
+func bookingScope(w http.ResponseWriter, r *http.Request) (string, bool) {
+	switch scope := r.URL.Query().Get("scope"); scope {
+	case "", ScopeOccurrence:
+		return ScopeOccurrence, true
+	case ScopeFollowing, ScopeSeries:
+		return scope, true
+	default:
+		http.Error(w, "scope must be occurrence, following or series", http.StatusBadRequest)
+		return "", false
+	}
+}
+
+// expandSeries returns the starts of a new series' occurrences in loc, less
+// the exdates, and the rule to store with them: an open-ended rule gets an
+// UNTIL at its last occurrence. start must be the rule's first occurrence.
+func expandSeries(value string, start time.Time, exdates []string, loc *time.Location) ([]time.Time, ical.RRule, error) {
+	rule, err := ical.ParseRRule(value, loc)
+	if err != nil {
+		return nil, ical.RRule{}, fmt.Errorf("invalid rrule: %v", err)
+	}
+	dtstart := start.In(loc)
+	horizon := dtstart.AddDate(maxSeriesYears, 0, 0)
+	tooLong := fmt.Errorf("a recurring booking may span at most %d year", maxSeriesYears)
+	if !rule.Until.IsZero() && rule.Until.After(horizon) {
+		return nil, ical.RRule{}, tooLong
+	}
+	starts := rule.Occurrences(dtstart, horizon)
+	if rule.Count > 0 && len(starts) < rule.Count {
+		return nil, ical.RRule{}, tooLong
+	}
+	if len(starts) == 0 || !starts[0].Equal(start) {
+		return nil, ical.RRule{}, errors.New("start_time must be the first occurrence of the rrule")
+	}
+	if !rule.Bounded() {
+		rule.Until = starts[len(starts)-1].UTC()
+	}
+
+	excluded := make([]bool, len(starts))
+	for _, v := range exdates {
+		date, dateErr := time.ParseInLocation(repository.DateLayout, v, loc)
+		at, timeErr := parseLocalTime(v, loc)
+		if dateErr != nil && timeErr != nil {
+			return nil, ical.RRule{}, fmt.Errorf("invalid exdate %q", v)
+		}
+		found := false
+		for i, s := range starts {
+			if (dateErr == nil && s.Format(repository.DateLayout) == date.Format(repository.DateLayout)) || (timeErr == nil && s.Equal(at)) {
+				excluded[i], found = true, true
+			}
+		}
+		if !found {
+			return nil, ical.RRule{}, fmt.Errorf("exdate %q is not an occurrence of the series", v)
+		}
+	}
+	kept := starts[:0]
+	for i, s := range starts {
+		if !excluded[i] {
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, ical.RRule{}, errors.New("exdates leave no occurrences")
+	}
+	return kept, rule, nil
+}
+
+// seriesViolations checks each active booking of a batch against the
+// evaluator and returns the violations of each, or nil if there are none.
+// Bookings of the batch are judged by their new times, not their stored ones.
+// Unlike a single booking's, a batch's buffers are not checked again as it is
+// saved, so a booking made meanwhile may come within them.
+func (h *Handler) seriesViolations(ctx context.Context, ev policy.Evaluator, bookings []repository.Booking) ([][]policy.Violation, error) {
+	inBatch := map[string]bool{}
+	var from, to time.Time
+	rooms := map[string]bool{}
+	for _, b := range bookings {
+		if b.ID != "" {
+			inBatch[b.ID] = true
+		}
+		if b.Status != repository.BookingStatusActive {
+			continue
+		}
+		rooms[b.RoomID] = true
+		if from.IsZero() || b.StartsAt.Before(from) {
+			from = b.StartsAt
+		}
+		if b.EndsAt.After(to) {
+			to = b.EndsAt
+		}
+	}
+	nearby := map[string][]repository.Booking{}
+	for roomID := range rooms {
+		found, err := h.repo.ListBookingsByRoom(ctx, roomID, from.Add(-ev.Reach()), to.Add(ev.Reach()))
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range found {
+			if !inBatch[b.ID] {
+				nearby[roomID] = append(nearby[roomID], b)
+			}
+		}
+	}
+
+	per := make([][]policy.Violation, len(bookings))
+	broken := false
+	now := time.Now()
+	for i, b := range bookings {
+		if b.Status != repository.BookingStatusActive {
+			continue
+		}
+		per[i] = ev.Check(policy.Booking{Start: b.StartsAt, End: b.EndsAt, Recurring: true}, nearby[b.RoomID], now)
+		broken = broken || len(per[i]) > 0
+	}
+	if !broken {
+		return nil, nil
+	}
+	return per, nil
+}
+
+// occurrenceViolations lists the violations of a batch with the occurrence breaking each
+func occurrenceViolations(bookings []repository.Booking, per [][]policy.Violation) []OccurrenceViolation {
+	var out []OccurrenceViolation
+	for i, violations := range per {
+		for _, v := range violations {
+			out = append(out, OccurrenceViolation{Violation: v, Occurrence: bookings[i].StartsAt.UTC().Format(time.RFC3339)})
+		}
+	}
+	return out
+}
+
+// writeSeriesConflict reports every occurrence that is blocked and what blocks it
+func writeSeriesConflict(w http.ResponseWriter, conflict *repository.SeriesConflictError) {
+	occurrences := make([]OccurrenceConflict, 0, len(conflict.Occurrences))
+	for _, occ := range conflict.Occurrences {
+		c := OccurrenceConflict{
+			Start:     occ.StartsAt.UTC().Format(time.RFC3339),
+			End:       occ.EndsAt.UTC().Format(time.RFC3339),
+			Conflicts: make([]Booking, 0, len(occ.Conflicts)),
+		}
+		for i := range occ.Conflicts {
+			c.Conflicts = append(c.Conflicts, bookingFromRepo(&occ.Conflicts[i]))
+		}
+		occurrences = append(occurrences, c)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":     "Room is already booked for some occurrences of the series",
+		"occurrences": occurrences,
+	})
+}
+
+// In returns the series with its occurrences' times written with loc's offset
+func (s BookingSeries) In(loc *time.Location) BookingSeries {
+	for i := range s.Occurrences {
+		s.Occurrences[i] = s.Occurrences[i].In(loc)
+	}
+	return s
+}
+
+func seriesFromRepo(id string, rule ical.RRule, bookings []repository.Booking) BookingSeries {
+	out := BookingSeries{ID: id, RRule: rule.String(), Occurrences: make([]Booking, 0, len(bookings))}
+	for i := range bookings {
+		out.Occurrences = append(out.Occurrences, bookingFromRepo(&bookings[i]))
+	}
+	return out
+}
+
+// createBookingSeries books every occurrence of req.RRule, expanded in the
+// office timezone so occurrences keep their local time across daylight saving
+// changes. The series is booked whole or not at all: blocked occurrences
+// answer 409 and rule violations 422, each listing the occurrences concerned.
+func (h *Handler) createBookingSeries(w http.ResponseWriter, r *http.Request, req *CreateBookingRequest, participants []repository.Participant, userID string, start, end time.Time, renderIn *time.Location) {
+	if !end.After(start) {
+		http.Error(w, "end_time must be after start_time", http.StatusBadRequest)
+		return
+	}
+	ev, ok := h.bookingPolicy(w, r, req.RoomID)
+	if !ok {
+		return
+	}
+	if !h.checkCapacity(w, r, req.RoomID, userID, participants) {
+		return
+	}
+	starts, rule, err := expandSeries(req.RRule, start, req.ExDates, ev.Location)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	occurrences := make([]repository.Booking, 0, len(starts))
+	for _, s := range starts {
+		occurrences = append(occurrences, repository.Booking{
+			RoomID:       req.RoomID,
+			CreatedBy:    userID,
+			Title:        req.Title,
+			Description:  req.Description,
+			StartsAt:     s.UTC(),
+			EndsAt:       s.Add(end.Sub(start)).UTC(),
+			RRule:        rule.String(),
+			Status:       repository.BookingStatusActive,
+			RecurrenceID: s.UTC(),
+		})
+		if len(participants) > 0 {
+			occurrences[len(occurrences)-1].Participants = participants
+		}
+	}
+	overridden, err := h.seriesViolations(r.Context(), ev, occurrences)
+	if err != nil {
+		storeError(w, "Failed to load bookings", err)
+		return
+	}
+	if overridden != nil && !h.overrideRules(w, r, occurrenceViolations(occurrences, overridden)) {
+		return
+	}
+
+	ctx := repository.WithAudit(r.Context(), func(ids []string) []repository.AuditLog {
+		var entries []repository.AuditLog
+		for i, id := range ids {
+			created := occurrences[i]
+			created.ID, created.SeriesID = id, ids[0]
+			entries = append(entries, h.auditEntry(r, "booking.create", "booking", id, map[string]interface{}{
+				"after": bookingFromRepo(&created),
+			}))
+			if overridden != nil {
+				entries = append(entries, h.overrideAudit(r, id, overridden[i])...)
+			}
+			if len(participants) > 0 {
+				entries = append(entries, h.attendeesAudit(r, id, nil, participants))
+			}
+		}
+		return entries
+	})
+	ids, err := h.repo.CreateBookingSeries(ctx, occurrences)
+	if err != nil {
+		var conflict *repository.SeriesConflictError
+		if errors.As(err, &conflict) {
+			writeSeriesConflict(w, conflict)
+			return
+		}
+		storeError(w, "Failed to create booking", err)
+		return
+	}
+	for i := range occurrences {
+		occurrences[i].ID = ids[i]
+		occurrences[i].SeriesID = ids[0]
+		h.syncBookingToGraph(occurrences[i])
+	}
+	h.notifyBookingChange(bookingCreated, occurrences, nil)
+
+	out := seriesFromRepo(ids[0], rule, occurrences)
+	if len(participants) > 0 {
+		attendees, err := h.repo.ListParticipants(r.Context(), ids[0])
+		if err != nil {
+			storeError(w, "Failed to load attendees", err)
+			return
+		}
+		for i := range out.Occurrences {
+			out.Occurrences[i].Attendees = attendeesFromRepo(attendees)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(out.In(renderIn))
+}
+
+// splitSeries divides the occurrences of a series at the one starting the
+// rule at from, returning those before it and it with the ones after
+func splitSeries(occurrences []repository.Booking, from time.Time) (earlier, following []repository.Booking) {
+	for _, o := range occurrences {
+		if o.RecurrenceID.Before(from) {
+			earlier = append(earlier, o)
+		} else {
+			following = append(following, o)
+		}
+	}
+	return earlier, following
+}
+
+// endSeriesBefore returns rule ending just before the occurrence at from
+func endSeriesBefore(rule ical.RRule, from time.Time) string {
+	rule.Count = 0
+	rule.Until = from.Add(-time.Second)
+	return rule.String()
+}
+
+// loadSeries returns the occurrences of b's series and its parsed rule
+func (h *Handler) loadSeries(w http.ResponseWriter, r *http.Request, b *repository.Booking, loc *time.Location) ([]repository.Booking, ical.RRule, bool) {
+	occurrences, err := h.repo.ListBookingSeries(r.Context(), b.SeriesID)
+	if err != nil {
+		storeError(w, "Failed to load series", err)
+		return nil, ical.RRule{}, false
+	}
+	rule, err := ical.ParseRRule(b.RRule, loc)
+	if err != nil {
+		storeError(w, "Failed to read series rule", err)
+		return nil, ical.RRule{}, false
+	}
+	return occurrences, rule, true
+}
+
+// updateSeries applies a change made to one occurrence to it and the ones
+// after it, or to the whole series. A new time moves every occurrence to that
+// local time of day on its own day, shifted by as many days as the chosen one
+// moved. Editing the following occurrences splits them into a series of their
+// own, named after the chosen occurrence, and ends the earlier part before it.
+// New attendees, if req has them, replace those of every affected occurrence.
+func (h *Handler) updateSeries(w http.ResponseWriter, r *http.Request, before, chosen *repository.Booking, req *UpdateBookingRequest, participants []repository.Participant, scope string, renderIn *time.Location) {
+	timeChanged := !chosen.StartsAt.Equal(before.StartsAt) || !chosen.EndsAt.Equal(before.EndsAt)
+	moved := timeChanged || chosen.RoomID != before.RoomID
+	var ev policy.Evaluator
+	if moved {
+		if !chosen.EndsAt.After(chosen.StartsAt) {
+			http.Error(w, "end_time must be after start_time", http.StatusBadRequest)
+			return
+		}
+		var ok bool
+		if ev, ok = h.bookingPolicy(w, r, chosen.RoomID); !ok {
+			return
+		}
+	} else {
+		ev.Location = time.UTC
+	}
+	loc := ev.Location
+	occurrences, rule, ok := h.loadSeries(w, r, before, loc)
+	if !ok {
+		return
+	}
+
+	oy, om, od := before.StartsAt.In(loc).Date()
+	ny, nm, nd := chosen.StartsAt.In(loc).Date()
+	dayShift := int(time.Date(ny, nm, nd, 0, 0, 0, 0, time.UTC).Sub(time.Date(oy, om, od, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+	if dayShift != 0 && (len(rule.ByDay) > 0 || len(rule.ByMonthDay) > 0) {
+		http.Error(w, "This series repeats on set days; only its time of day can be changed for several occurrences", http.StatusBadRequest)
+		return
+	}
+	hour, minute, sec := chosen.StartsAt.In(loc).Clock()
+	duration := chosen.EndsAt.Sub(chosen.StartsAt)
+
+	earlier, affected := splitSeries(occurrences, before.RecurrenceID)
+	if scope == ScopeSeries {
+		earlier, affected = nil, occurrences
+	}
+	seriesID := before.SeriesID
+	if len(earlier) > 0 {
+		seriesID = before.ID
+		if rule.Count > 0 {
+			rule.Count = len(affected)
+		}
+	}
+	var beforeRows []repository.Booking
+	for i := range affected {
+		o := &affected[i]
+		beforeRows = append(beforeRows, *o)
+		if req.Title != nil {
+			o.Title = *req.Title
+		}
+		if req.Description != nil {
+			o.Description = *req.Description
+		}
+		if req.RoomID != nil {
+			o.RoomID = *req.RoomID
+		}
+		if timeChanged {
+			y, m, d := o.RecurrenceID.In(loc).Date()
+			start := time.Date(y, m, d+dayShift, hour, minute, sec, 0, loc)
+			o.StartsAt, o.EndsAt, o.RecurrenceID = start.UTC(), start.Add(duration).UTC(), start.UTC()
+			if o.ID == chosen.ID {
+				o.StartsAt, o.EndsAt = chosen.StartsAt, chosen.EndsAt
+			}
+		}
+		o.SeriesID = seriesID
+	}
+	if timeChanged && !rule.Until.IsZero() {
+		rule.Until = affected[len(affected)-1].RecurrenceID
+	}
+	for i := range affected {
+		affected[i].RRule = rule.String()
+	}
+
+	var overridden [][]policy.Violation
+	if moved {
+		var err error
+		if overridden, err = h.seriesViolations(r.Context(), ev, affected); err != nil {
+			storeError(w, "Failed to load bookings", err)
+			return
+		}
+		if overridden != nil && !h.overrideRules(w, r, occurrenceViolations(affected, overridden)) {
+			return
+		}
+	}
+
+	var entries []repository.AuditLog
+	var dropped []string
+	for i := range affected {
+		if affected[i].Status != repository.BookingStatusActive {
+			continue
+		}
+		entries = append(entries, h.auditEntry(r, "booking.update", "booking", affected[i].ID, map[string]interface{}{
+			"scope":  scope,
+			"before": bookingFromRepo(&beforeRows[i]),
+			"after":  bookingFromRepo(&affected[i]),
+		}))
+		if overridden != nil {
+			entries = append(entries, h.overrideAudit(r, affected[i].ID, overridden[i])...)
+		}
+		if req.Attendees == nil {
+			continue
+		}
+		existing, err := h.repo.ListParticipants(r.Context(), affected[i].ID)
+		if err != nil {
+			storeError(w, "Failed to load attendees", err)
+			return
+		}
+		affected[i].Participants = participants
+		entries = append(entries, h.attendeesAudit(r, affected[i].ID, existing, participants))
+		dropped = append(dropped, removedAttendees(existing, participants)...)
+	}
+	batch := append([]repository.Booking(nil), affected...)
+	for i, o := range earlier {
+		o.RRule = endSeriesBefore(rule, before.RecurrenceID)
+		batch = append(batch, o)
+		entries = append(entries, h.auditEntry(r, "booking.update", "booking", o.ID, map[string]interface{}{
+			"scope":  scope,
+			"before": bookingFromRepo(&earlier[i]),
+			"after":  bookingFromRepo(&o),
+		}))
+	}
+	if err := h.repo.UpdateBookings(audited(r, entries...), batch); err != nil {
+		var conflict *repository.SeriesConflictError
+		switch {
+		case errors.As(err, &conflict):
+			writeSeriesConflict(w, conflict)
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Booking not found", http.StatusNotFound)
+		default:
+			storeError(w, "Failed to update booking", err)
+		}
+		return
+	}
+	h.notifyBookingChange(bookingUpdated, batch, dropped)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(seriesFromRepo(seriesID, rule, affected).In(renderIn))
+}
+
+// cancelSeries cancels an occurrence and the ones after it, or the whole
+// series. Cancelling the following occurrences ends the series' rule before them.
+func (h *Handler) cancelSeries(w http.ResponseWriter, r *http.Request, b *repository.Booking, scope string) {
+	occurrences, rule, ok := h.loadSeries(w, r, b, time.UTC)
+	if !ok {
+		return
+	}
+	earlier, following := splitSeries(occurrences, b.RecurrenceID)
+	if scope == ScopeSeries {
+		earlier, following = nil, occurrences
+	}
+	var batch []repository.Booking
+	var entries []repository.AuditLog
+	for _, o := range following {
+		if o.Status == repository.BookingStatusActive {
+			entries = append(entries, h.auditEntry(r, "booking.cancel", "booking", o.ID, map[string]interface{}{
+				"scope":  scope,
+				"before": bookingFromRepo(&o),
+			}))
+			o.Status = repository.BookingStatusCancelled
+			batch = append(batch, o)
+		}
+	}
+	for i, o := range earlier {
+		o.RRule = endSeriesBefore(rule, b.RecurrenceID)
+		batch = append(batch, o)
+		entries = append(entries, h.auditEntry(r, "booking.update", "booking", o.ID, map[string]interface{}{
+			"scope":  scope,
+			"before": bookingFromRepo(&earlier[i]),
+			"after":  bookingFromRepo(&o),
+		}))
+	}
+	if len(batch) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := h.repo.UpdateBookings(audited(r, entries...), batch); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Booking not found", http.StatusNotFound)
+			return
+		}
+		storeError(w, "Failed to cancel booking", err)
+		return
+	}
+	h.notifyBookingChange(bookingCancelled, []repository.Booking{*b}, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
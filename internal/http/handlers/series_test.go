@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/policy"
+	"roombooker/internal/repository"
+)
+
+// createTestSeries books a weekly series in room-101 starting Monday
+// 2099-03-02 10:00 New York; clocks go forward on 8 March
+func createTestSeries(t *testing.T, h *Handler, extra string) BookingSeries {
+	body := `{"title":"Weekly","start_time":"2099-03-02T15:00:00Z","end_time":"2099-03-02T16:00:00Z","room_id":"room-101","rrule":"FREQ=WEEKLY;COUNT=4"` + extra + `}`
+	w := httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-regular"))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var series BookingSeries
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &series))
+	return series
+}
+
+func scopedRequest(method, id, scope, body string) *http.Request {
+	req := httptest.NewRequest(method, "/api/bookings/"+id+"?scope="+scope, strings.NewReader(body))
+	return withURLParam(withUser(req, "user-regular"), "id", id)
+}
+
+func starts(bookings []Booking) []string {
+	var out []string
+	for _, b := range bookings {
+		out = append(out, b.Start)
+	}
+	return out
+}
+
+func TestHandler_CreateBooking_Recurring(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	series := createTestSeries(t, h, "")
+	assert.Equal(t, "FREQ=WEEKLY;COUNT=4", series.RRule)
+	assert.Equal(t, []string{"2099-03-02T15:00:00Z", "2099-03-09T14:00:00Z", "2099-03-16T14:00:00Z", "2099-03-23T14:00:00Z"},
+		starts(series.Occurrences), "occurrences keep 10:00 local across the clock change")
+	for _, occ := range series.Occurrences {
+		assert.Equal(t, series.ID, occ.SeriesID)
+		assert.Equal(t, occ.Start, occ.RecurrenceID)
+	}
+	assert.Equal(t, series.ID, series.Occurrences[0].ID)
+
+	// The calendar sees each occurrence in its range
+	req := withURLParam(httptest.NewRequest("GET", "/api/rooms/room-101/bookings?from=2099-03-09T00:00:00Z&to=2099-03-17T00:00:00Z", nil), "id", "room-101")
+	w := httptest.NewRecorder()
+	h.GetRoomBookings(w, req)
+	var listed []Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	assert.Equal(t, []string{"2099-03-09T14:00:00Z", "2099-03-16T14:00:00Z"}, starts(listed))
+	assert.Equal(t, "FREQ=WEEKLY;COUNT=4", listed[0].RRule)
+}
+
+func TestHandler_CreateBooking_RecurringExDatesAndLimits(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	series := createTestSeries(t, h, `,"exdates":["2099-03-09","2099-03-23T14:00:00Z"]`)
+	assert.Equal(t, []string{"2099-03-02T15:00:00Z", "2099-03-16T14:00:00Z"}, starts(series.Occurrences))
+
+	// An open-ended rule is booked for a year and stored with its last occurrence
+	body := `{"title":"Standup","start_time":"2099-03-02T20:00:00Z","end_time":"2099-03-02T20:30:00Z","room_id":"room-102","rrule":"FREQ=WEEKLY;BYDAY=MO"}`
+	w := httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-regular"))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &series))
+	assert.Len(t, series.Occurrences, 53)
+	assert.Equal(t, "FREQ=WEEKLY;UNTIL=21000301T200000Z;BYDAY=MO", series.RRule)
+
+	for _, extra := range []string{
+		`"rrule":"FREQ=YEARLY"`,
+		`"rrule":"FREQ=DAILY;COUNT=400"`,
+		`"rrule":"FREQ=WEEKLY;BYDAY=TU;COUNT=2"`,
+		`"rrule":"FREQ=WEEKLY;COUNT=2","exdates":["2099-03-03"]`,
+		`"rrule":"FREQ=WEEKLY;COUNT=1","exdates":["2099-03-02"]`,
+		`"exdates":["2099-03-02"]`,
+	} {
+		body := `{"title":"Bad","start_time":"2099-03-02T15:00:00Z","end_time":"2099-03-02T16:00:00Z","room_id":"room-103",` + extra + `}`
+		w := httptest.NewRecorder()
+		h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-regular"))
+		assert.Equal(t, http.StatusBadRequest, w.Code, extra)
+	}
+}
+
+func TestHandler_CreateBooking_RecurringConflicts(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	blocker := createTestBooking(t, h, "room-101", "user-admin", "2099-03-16T14:30:00Z", "2099-03-16T15:00:00Z")
+
+	body := `{"title":"Weekly","start_time":"2099-03-02T15:00:00Z","end_time":"2099-03-02T16:00:00Z","room_id":"room-101","rrule":"FREQ=WEEKLY;COUNT=4"}`
+	w := httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-regular"))
+	require.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	var resp struct {
+		Occurrences []OccurrenceConflict `json:"occurrences"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Occurrences, 1)
+	assert.Equal(t, "2099-03-16T14:00:00Z", resp.Occurrences[0].Start)
+	require.Len(t, resp.Occurrences[0].Conflicts, 1)
+	assert.Equal(t, blocker.ID, resp.Occurrences[0].Conflicts[0].ID)
+
+	// Occurrences breaking rules are named too
+	createTestHoliday(t, h, "2099-03-10", "Closed")
+	body = `{"title":"Tuesdays","start_time":"2099-03-03T15:00:00Z","end_time":"2099-03-03T16:00:00Z","room_id":"room-102","rrule":"FREQ=WEEKLY;COUNT=3"}`
+	w = httptest.NewRecorder()
+	h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body)), "user-regular"))
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+	var violations struct {
+		Violations []OccurrenceViolation `json:"violations"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &violations))
+	require.Len(t, violations.Violations, 1)
+	assert.Equal(t, "2099-03-10T14:00:00Z", violations.Violations[0].Occurrence)
+	assert.Equal(t, policy.RuleHoliday, violations.Violations[0].Rule)
+}
+
+func TestHandler_UpdateBooking_Scopes(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	series := createTestSeries(t, h, "")
+	occ := series.Occurrences
+
+	// A single occurrence moves alone and keeps its place in the series
+	w := httptest.NewRecorder()
+	h.UpdateBooking(w, scopedRequest("PATCH", occ[1].ID, "occurrence", `{"start_time":"2099-03-09T18:00:00Z","end_time":"2099-03-09T19:00:00Z"}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var moved Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &moved))
+	assert.Equal(t, "2099-03-09T18:00:00Z", moved.Start)
+	assert.Equal(t, "2099-03-09T14:00:00Z", moved.RecurrenceID)
+	assert.Equal(t, series.ID, moved.SeriesID)
+
+	// From the third on: an hour later, renamed, and split off as a series of its own
+	w = httptest.NewRecorder()
+	h.UpdateBooking(w, scopedRequest("PATCH", occ[2].ID, "following", `{"title":"Moved","start_time":"2099-03-16T15:00:00Z","end_time":"2099-03-16T16:00:00Z"}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var following BookingSeries
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &following))
+	assert.Equal(t, occ[2].ID, following.ID)
+	assert.Equal(t, "FREQ=WEEKLY;COUNT=2", following.RRule)
+	assert.Equal(t, []string{"2099-03-16T15:00:00Z", "2099-03-23T15:00:00Z"}, starts(following.Occurrences))
+	for _, b := range following.Occurrences {
+		assert.Equal(t, "Moved", b.Title)
+		assert.Equal(t, occ[2].ID, b.SeriesID)
+	}
+	first, err := h.repo.GetBooking(context.Background(), occ[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Weekly", first.Title)
+	assert.Equal(t, "FREQ=WEEKLY;UNTIL=20990316T135959Z", first.RRule, "the earlier part ends before the split")
+
+	// The whole series: only the earlier part is left in it
+	w = httptest.NewRecorder()
+	h.UpdateBooking(w, scopedRequest("PATCH", occ[0].ID, "series", `{"description":"Bring notes"}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var whole BookingSeries
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &whole))
+	require.Len(t, whole.Occurrences, 2)
+	assert.Equal(t, "2099-03-09T18:00:00Z", whole.Occurrences[1].Start, "a title change keeps moved occurrences in place")
+	for _, b := range whole.Occurrences {
+		assert.Equal(t, "Bring notes", b.Description)
+	}
+
+	// Moving the series onto another booking reports the blocked occurrence
+	createTestBooking(t, h, "room-101", "user-admin", "2099-03-09T16:00:00Z", "2099-03-09T17:00:00Z")
+	w = httptest.NewRecorder()
+	h.UpdateBooking(w, scopedRequest("PATCH", occ[0].ID, "series", `{"start_time":"2099-03-02T17:00:00Z","end_time":"2099-03-02T18:00:00Z"}`))
+	require.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"start":"2099-03-09T16:00:00Z"`)
+
+	w = httptest.NewRecorder()
+	h.UpdateBooking(w, scopedRequest("PATCH", occ[0].ID, "everything", `{}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandler_DeleteBooking_Scopes(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	series := createTestSeries(t, h, "")
+	occ := series.Occurrences
+	status := func(id string) string {
+		b, err := h.repo.GetBooking(context.Background(), id)
+		require.NoError(t, err)
+		return b.Status
+	}
+
+	w := httptest.NewRecorder()
+	h.DeleteBooking(w, scopedRequest("DELETE", occ[0].ID, "occurrence", ""))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, repository.BookingStatusCancelled, status(occ[0].ID))
+	assert.Equal(t, repository.BookingStatusActive, status(occ[1].ID))
+
+	w = httptest.NewRecorder()
+	h.DeleteBooking(w, scopedRequest("DELETE", occ[2].ID, "following", ""))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, repository.BookingStatusActive, status(occ[1].ID))
+	assert.Equal(t, repository.BookingStatusCancelled, status(occ[2].ID))
+	assert.Equal(t, repository.BookingStatusCancelled, status(occ[3].ID))
+	second, err := h.repo.GetBooking(context.Background(), occ[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "FREQ=WEEKLY;UNTIL=20990316T135959Z", second.RRule)
+
+	w = httptest.NewRecorder()
+	h.DeleteBooking(w, scopedRequest("DELETE", occ[1].ID, "series", ""))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, repository.BookingStatusCancelled, status(occ[1].ID))
+
+	entries, err := h.repo.ListAuditLogs(context.Background(), repository.AuditFilter{Action: "booking.cancel"})
+	require.NoError(t, err)
+	assert.Len(t, entries, 4, "each cancelled occurrence is audited once")
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"roombooker/internal/config"
+)
+
+func TestHandler_Shutdown_WaitsForBackgroundWork(t *testing.T) {
+	h := NewHandler(nil, nil, nil, &config.Config{}, nil)
+
+	var finished atomic.Bool
+	h.goBackground(func(ctx context.Context) {
+		time.Sleep(50 * time.Millisecond)
+		finished.Store(true)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, h.Shutdown(ctx))
+	assert.True(t, finished.Load())
+}
+
+func TestHandler_Shutdown_CancelsOnTimeout(t *testing.T) {
+	h := NewHandler(nil, nil, nil, &config.Config{}, nil)
+
+	cancelled := make(chan struct{})
+	h.goBackground(func(ctx context.Context) {
+		<-ctx.Done()
+		close(cancelled)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, h.Shutdown(ctx), context.DeadlineExceeded)
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("background work was not cancelled")
+	}
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"roombooker/internal/repository"
+)
+
+// localTimeLayouts are the zone-less forms a booking time may take, such as
+// the value of a datetime-local input
+var localTimeLayouts = []string{
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// LocalTimeError reports a wall-clock time that a timezone skips or repeats
+// at a daylight saving change
+type LocalTimeError struct {
+	Value    string
+	Location string
+	// Repeated is set when the clocks go back and the time happens twice
+	Repeated bool
+}
+
+func (e *LocalTimeError) Error() string {
+	if e.Repeated {
+		return fmt.Sprintf("%s happens twice in %s as the clocks go back; give a UTC offset to pick one", e.Value, e.Location)
+	}
+	return fmt.Sprintf("%s does not exist in %s as the clocks go forward", e.Value, e.Location)
+}
+
+// parseLocalTime reads a booking time. A time with a zone or offset names an
+// instant as it is; a zone-less one is a wall-clock time in loc, and is
+// refused with a *LocalTimeError if loc skips or repeats it.
+func parseLocalTime(val string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		return t.UTC(), nil
+	}
+	for _, layout := range localTimeLayouts {
+		wall, err := time.Parse(layout, val)
+		if err != nil {
+			continue
+		}
+		// The instants loc could mean are the wall time less each offset in
+		// force around it; those that read back as the same wall time count
+		var found []time.Time
+	probes:
+		for _, probe := range []time.Duration{-48 * time.Hour, 0, 48 * time.Hour} {
+			_, offset := wall.Add(probe).In(loc).Zone()
+			t := wall.Add(-time.Duration(offset) * time.Second)
+			if !sameWallTime(t.In(loc), wall) {
+				continue
+			}
+			for _, f := range found {
+				if f.Equal(t) {
+					continue probes
+				}
+			}
+			found = append(found, t)
+		}
+		switch len(found) {
+		case 0:
+			return time.Time{}, &LocalTimeError{Value: val, Location: loc.String()}
+		case 1:
+			return found[0].UTC(), nil
+		default:
+			return time.Time{}, &LocalTimeError{Value: val, Location: loc.String(), Repeated: true}
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised time %q", val)
+}
+
+func sameWallTime(t, wall time.Time) bool {
+	y, mo, d := t.Date()
+	wy, wmo, wd := wall.Date()
+	return y == wy && mo == wmo && d == wd && t.Hour() == wall.Hour() && t.Minute() == wall.Minute() && t.Second() == wall.Second()
+}
+
+// parseTimeField reads the named booking time field, writing 400 and
+// returning false if it is invalid or falls in a daylight saving change
+func parseTimeField(w http.ResponseWriter, field, val string, loc *time.Location) (time.Time, bool) {
+	t, err := parseLocalTime(val, loc)
+	if err != nil {
+		var local *LocalTimeError
+		if errors.As(err, &local) {
+			http.Error(w, field+": "+local.Error(), http.StatusBadRequest)
+			return time.Time{}, false
+		}
+		http.Error(w, "invalid "+field, http.StatusBadRequest)
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// defaultLocation is the zone of offices that do not set a valid one: the
+// configured OFFICE_TZ, or UTC
+func (h *Handler) defaultLocation() *time.Location {
+	if h.config != nil && h.config.App.OfficeTZ != "" {
+		loc, err := loadTimezone(h.config.App.OfficeTZ)
+		if err == nil {
+			return loc
+		}
+		h.logger.Warn("OFFICE_TZ is not a valid timezone; using UTC", zap.String("office_tz", h.config.App.OfficeTZ), zap.Error(err))
+	}
+	return time.UTC
+}
+
+// inputLocation returns the zone zone-less booking times are read in: tz if
+// the request names one, otherwise the timezone of the room's office. It
+// writes 400 and returns false for an invalid tz or an unknown room.
+func (h *Handler) inputLocation(w http.ResponseWriter, r *http.Request, tz, roomID string) (*time.Location, bool) {
+	if tz != "" {
+		loc, err := loadTimezone(tz)
+		if err != nil {
+			http.Error(w, "invalid tz: "+tz, http.StatusBadRequest)
+			return nil, false
+		}
+		return loc, true
+	}
+	room, err := h.repo.GetRoom(r.Context(), roomID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Unknown room_id", http.StatusBadRequest)
+			return nil, false
+		}
+		storeError(w, "Failed to load room", err)
+		return nil, false
+	}
+	office, err := h.repo.GetOffice(r.Context(), room.OfficeID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return h.defaultLocation(), true
+		}
+		storeError(w, "Failed to load office", err)
+		return nil, false
+	}
+	return h.officeLocation(office), true
+}
+
+// queryLocation returns the zone zone-less from and to query times are read
+// in: ?tz= if the request names one, otherwise the office's timezone, or the
+// default zone when the request is not about one office. It writes 400 and
+// returns false for an invalid tz.
+func (h *Handler) queryLocation(w http.ResponseWriter, r *http.Request, office *repository.Office) (*time.Location, bool) {
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		loc, err := loadTimezone(tz)
+		if err != nil {
+			http.Error(w, "invalid tz: "+tz, http.StatusBadRequest)
+			return nil, false
+		}
+		return loc, true
+	}
+	if office != nil {
+		return h.officeLocation(office), true
+	}
+	return h.defaultLocation(), true
+}
+
+// roomQueryLocation is queryLocation for the office of a room. Unknown rooms,
+// which have no bookings to list, get the default zone.
+func (h *Handler) roomQueryLocation(w http.ResponseWriter, r *http.Request, roomID string) (*time.Location, bool) {
+	var office *repository.Office
+	room, err := h.repo.GetRoom(r.Context(), roomID)
+	if err == nil {
+		office, err = h.repo.GetOffice(r.Context(), room.OfficeID)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		storeError(w, "Failed to load room", err)
+		return nil, false
+	}
+	return h.queryLocation(w, r, office)
+}
+
+// responseLocation returns the zone asked for with ?tz= to render booking
+// times in, or nil to render them in UTC. It writes 400 for an invalid zone.
+func responseLocation(w http.ResponseWriter, r *http.Request) (*time.Location, bool) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return nil, true
+	}
+	loc, err := loadTimezone(tz)
+	if err != nil {
+		http.Error(w, "invalid tz: "+tz, http.StatusBadRequest)
+		return nil, false
+	}
+	return loc, true
+}
+
+// In returns the booking with its times written with loc's offset; a nil loc
+// leaves them in UTC
+func (b Booking) In(loc *time.Location) Booking {
+	if loc == nil {
+		return b
+	}
+	for _, v := range []*string{&b.Start, &b.End, &b.RecurrenceID} {
+		if t, err := time.Parse(time.RFC3339, *v); err == nil {
+			*v = t.In(loc).Format(time.RFC3339)
+		}
+	}
+	return b
+}
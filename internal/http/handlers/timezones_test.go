@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLocalTime(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	got, err := parseLocalTime("2024-01-15T10:00", ny)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 15, 15, 0, 0, 0, time.UTC), got)
+
+	got, err = parseLocalTime("2024-07-15 10:00:00", ny)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 7, 15, 14, 0, 0, 0, time.UTC), got, "summer time is UTC-4")
+
+	got, err = parseLocalTime("2024-01-15T10:00:00+01:00", ny)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC), got, "an offset wins over the zone")
+
+	// 02:30 is skipped when the clocks go forward...
+	_, err = parseLocalTime("2024-03-10T02:30", ny)
+	var local *LocalTimeError
+	require.ErrorAs(t, err, &local)
+	assert.False(t, local.Repeated)
+
+	// ...and 01:30 happens twice when they go back, unless an offset says which
+	_, err = parseLocalTime("2024-11-03T01:30", ny)
+	require.ErrorAs(t, err, &local)
+	assert.True(t, local.Repeated)
+	got, err = parseLocalTime("2024-11-03T01:30:00-05:00", ny)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 11, 3, 6, 30, 0, 0, time.UTC), got)
+
+	_, err = parseLocalTime("tomorrow", ny)
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &local))
+}
+
+func TestHandler_CreateBooking_Timezones(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	create := func(query, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.CreateBooking(w, withUser(httptest.NewRequest("POST", "/api/bookings"+query, strings.NewReader(body)), "user-regular"))
+		return w
+	}
+
+	// A tz in the request wins over the office's New York time
+	w := create("", `{"start_time":"2099-03-02T15:00","end_time":"2099-03-02T16:00","room_id":"room-101","tz":"Europe/London"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "2099-03-02T15:00:00Z", created.Start)
+
+	// ?tz= renders the answer in another zone
+	w = create("?tz=America/New_York", `{"start_time":"2099-03-02T13:00","end_time":"2099-03-02T14:00","room_id":"room-101"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "2099-03-02T13:00:00-05:00", created.Start)
+	assert.Equal(t, "2099-03-02T14:00:00-05:00", created.End)
+
+	w = httptest.NewRecorder()
+	h.GetBooking(w, withURLParam(httptest.NewRequest("GET", "/api/bookings/"+created.ID+"?tz=Asia/Tokyo", nil), "id", created.ID))
+	require.Equal(t, http.StatusOK, w.Code)
+	var got Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, "2099-03-03T03:00:00+09:00", got.Start)
+
+	for _, bad := range []struct{ query, body, message string }{
+		{"", `{"start_time":"2099-03-02T09:00","end_time":"2099-03-02T10:00","room_id":"room-101","tz":"Mars/Olympus"}`, "invalid tz"},
+		{"?tz=Local", `{"start_time":"2099-03-02T09:00","end_time":"2099-03-02T10:00","room_id":"room-101"}`, "invalid tz"},
+		{"", `{"start_time":"2024-03-10T02:30","end_time":"2024-03-10T03:30","room_id":"room-101"}`, "does not exist"},
+		{"", `{"start_time":"2024-11-03T01:30","end_time":"2024-11-03T02:30","room_id":"room-101"}`, "happens twice"},
+	} {
+		w := create(bad.query, bad.body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, bad.body)
+		assert.Contains(t, w.Body.String(), bad.message)
+	}
+}
+
+func TestHandler_UpdateBooking_Timezones(t *testing.T) {
+	h := newBookingsTestHandler(t)
+	created := createTestBooking(t, h, "room-101", "user-regular", "2099-03-02T14:00:00Z", "2099-03-02T15:00:00Z")
+
+	w := httptest.NewRecorder()
+	h.UpdateBooking(w, bookingRequest("PATCH", created.ID, "user-regular", `{"start_time":"2099-03-02T10:00","end_time":"2099-03-02T11:00"}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated Booking
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, "2099-03-02T15:00:00Z", updated.Start)
+	assert.Equal(t, "2099-03-02T16:00:00Z", updated.End)
+}
@@ -0,0 +1,253 @@
+// Package ical reads the parts of iCalendar (RFC 5545) the app exchanges with
+// other calendars
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a VEVENT. All-day events have midnight Start and End in UTC, with
+// End being the day after the last one.
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	Location    string
+	// Status is CONFIRMED, TENTATIVE or CANCELLED, or empty if not given
+	Status string
+	// RRule makes the event recurring from Start; ExDates are the starts it
+	// leaves out
+	RRule   string
+	ExDates []time.Time
+	// RecurrenceID marks the event as a change to the occurrence of the
+	// recurring event with the same UID that the rule starts then
+	RecurrenceID time.Time
+	// Organizer is an email address, without the mailto: of the URI
+	Organizer string
+	Attendees []Attendee
+	// Sequence counts the revisions of an event sent as an invitation, so
+	// clients apply a later one over an earlier one
+	Sequence int
+	// Stamp is when the event was written, the current time if zero; it is
+	// not read
+	Stamp time.Time
+	// Zone is the zone the event's times are written in, if not the calendar's
+	Zone *time.Location
+}
+
+// Attendee is an ATTENDEE of an event
+type Attendee struct {
+	Email string
+	// Role is REQ-PARTICIPANT, OPT-PARTICIPANT, NON-PARTICIPANT or CHAIR, or
+	// empty if not given
+	Role string
+	// Status is the PARTSTAT, such as ACCEPTED or DECLINED, or empty if not given
+	Status string
+	// Kind is the CUTYPE, such as INDIVIDUAL, ROOM or RESOURCE, or empty if not given
+	Kind string
+	// RSVP asks the attendee to reply to an invitation
+	RSVP bool
+}
+
+// Required reports whether the attendee's presence is expected. Attendees
+// without a role are, as RFC 5545 makes REQ-PARTICIPANT the default.
+func (a Attendee) Required() bool {
+	return a.Role != "OPT-PARTICIPANT" && a.Role != "NON-PARTICIPANT"
+}
+
+// Days returns the calendar days of an all-day event, formatted with layout
+func (e Event) Days(layout string) []string {
+	var out []string
+	for d := e.Start; d.Before(e.End); d = d.AddDate(0, 0, 1) {
+		out = append(out, d.Format(layout))
+	}
+	return out
+}
+
+// property is one content line: NAME;PARAM=VALUE:value
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parse reads the events of an iCalendar stream. Floating times, which name no
+// zone, are read in loc.
+func Parse(r io.Reader, loc *time.Location) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	var events []Event
+	var current *Event
+	var hasEnd bool
+	for n, line := range lines {
+		if line == "" {
+			continue
+		}
+		p, err := parseProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		switch {
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VEVENT"):
+			current, hasEnd = &Event{}, false
+		case p.name == "END" && strings.EqualFold(p.value, "VEVENT"):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: END:VEVENT without BEGIN", n+1)
+			}
+			if current.Start.IsZero() {
+				return nil, fmt.Errorf("line %d: event %q has no DTSTART", n+1, current.Summary)
+			}
+			if !hasEnd {
+				// RFC 5545: an all-day event without an end lasts one day, a timed one is instantaneous
+				current.End = current.Start
+				if current.AllDay {
+					current.End = current.Start.AddDate(0, 0, 1)
+				}
+			}
+			events = append(events, *current)
+			current = nil
+		case current == nil:
+			// Properties of the calendar itself or of other components
+		case p.name == "UID":
+			current.UID = p.value
+		case p.name == "SUMMARY":
+			current.Summary = unescape(p.value)
+		case p.name == "DESCRIPTION":
+			current.Description = unescape(p.value)
+		case p.name == "LOCATION":
+			current.Location = unescape(p.value)
+		case p.name == "STATUS":
+			current.Status = strings.ToUpper(p.value)
+		case p.name == "DTSTART":
+			if current.Start, current.AllDay, err = parseTime(p, loc); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+		case p.name == "RRULE":
+			current.RRule = p.value
+		case p.name == "EXDATE":
+			for _, v := range strings.Split(p.value, ",") {
+				ex := p
+				ex.value = v
+				t, _, err := parseTime(ex, loc)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", n+1, err)
+				}
+				current.ExDates = append(current.ExDates, t)
+			}
+		case p.name == "RECURRENCE-ID":
+			if current.RecurrenceID, _, err = parseTime(p, loc); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+		case p.name == "ORGANIZER":
+			current.Organizer = calAddress(p.value)
+		case p.name == "ATTENDEE":
+			current.Attendees = append(current.Attendees, Attendee{
+				Email:  calAddress(p.value),
+				Role:   strings.ToUpper(p.params["ROLE"]),
+				Status: strings.ToUpper(p.params["PARTSTAT"]),
+				Kind:   strings.ToUpper(p.params["CUTYPE"]),
+				RSVP:   strings.EqualFold(p.params["RSVP"], "TRUE"),
+			})
+		case p.name == "SEQUENCE":
+			if current.Sequence, err = strconv.Atoi(p.value); err != nil {
+				return nil, fmt.Errorf("line %d: invalid SEQUENCE %q", n+1, p.value)
+			}
+		case p.name == "DTEND":
+			if current.End, _, err = parseTime(p, loc); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			hasEnd = true
+		}
+	}
+	if current != nil {
+		return nil, fmt.Errorf("unterminated VEVENT %q", current.Summary)
+	}
+	return events, nil
+}
+
+// unfold joins continuation lines, which start with a space or tab, onto the line before
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, sc.Err()
+}
+
+func parseProperty(line string) (property, error) {
+	// The value starts at the first colon outside a quoted parameter value
+	colon, quoted := -1, false
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return property{}, fmt.Errorf("malformed content line %q", line)
+	}
+	parts := strings.Split(line[:colon], ";")
+	p := property{name: strings.ToUpper(parts[0]), params: map[string]string{}, value: line[colon+1:]}
+	for _, param := range parts[1:] {
+		if k, v, ok := strings.Cut(param, "="); ok {
+			p.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return p, nil
+}
+
+func parseTime(p property, loc *time.Location) (t time.Time, allDay bool, err error) {
+	if strings.EqualFold(p.params["VALUE"], "DATE") || len(p.value) == len("20060102") {
+		t, err = time.Parse("20060102", p.value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s %q", p.name, p.value)
+		}
+		return t, true, nil
+	}
+	if strings.HasSuffix(p.value, "Z") {
+		t, err = time.Parse("20060102T150405Z", p.value)
+	} else {
+		if tzid := p.params["TZID"]; tzid != "" {
+			if loc, err = time.LoadLocation(tzid); err != nil {
+				return time.Time{}, false, fmt.Errorf("unknown TZID %q", tzid)
+			}
+		}
+		t, err = time.ParseInLocation("20060102T150405", p.value, loc)
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid %s %q", p.name, p.value)
+	}
+	return t, false, nil
+}
+
+// calAddress returns the email address of a CAL-ADDRESS value, a mailto: URI
+func calAddress(value string) string {
+	if len(value) >= len("mailto:") && strings.EqualFold(value[:len("mailto:")], "mailto:") {
+		value = value[len("mailto:"):]
+	}
+	return strings.TrimSpace(value)
+}
+
+// unescape resolves the backslash escapes of TEXT values
+func unescape(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
@@ -0,0 +1,132 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const holidaysICS = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Example//Holidays//EN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:xmas@example.com\r\n" +
+	"DTSTART;VALUE=DATE:20241225\r\n" +
+	"DTEND;VALUE=DATE:20241227\r\n" +
+	"SUMMARY:Christmas\\, Boxing Day\r\n" +
+	"DESCRIPTION:Office closed\\nsee you\r\n" +
+	"  in the new year\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:ny@example.com\r\n" +
+	"DTSTART;VALUE=DATE:20250101\r\n" +
+	"SUMMARY:New Year\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse_AllDayEvents(t *testing.T) {
+	events, err := Parse(strings.NewReader(holidaysICS), time.UTC)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	assert.Equal(t, "xmas@example.com", events[0].UID)
+	assert.Equal(t, "Christmas, Boxing Day", events[0].Summary)
+	assert.Equal(t, "Office closed\nsee you in the new year", events[0].Description)
+	assert.True(t, events[0].AllDay)
+	assert.Equal(t, []string{"2024-12-25", "2024-12-26"}, events[0].Days("2006-01-02"))
+
+	assert.Equal(t, []string{"2025-01-01"}, events[1].Days("2006-01-02"), "an all-day event without DTEND lasts one day")
+}
+
+func TestParse_TimedEvents(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"DTSTART:20240304T090000Z",
+		"DTEND:20240304T100000Z",
+		"SUMMARY:UTC",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		`DTSTART;TZID="America/New_York":20240304T090000`,
+		"DTEND;TZID=America/New_York:20240304T093000",
+		"SUMMARY:Zoned",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART:20240304T090000",
+		"SUMMARY:Floating",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\n")
+
+	events, err := Parse(strings.NewReader(ics), berlin)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC), events[0].Start)
+	assert.Equal(t, time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC), events[0].End)
+	assert.False(t, events[0].AllDay)
+	assert.Equal(t, time.Date(2024, 3, 4, 14, 0, 0, 0, time.UTC), events[1].Start.UTC())
+	assert.Equal(t, 30*time.Minute, events[1].End.Sub(events[1].Start))
+	assert.Equal(t, time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC), events[2].Start.UTC(), "floating times are read in loc")
+	assert.Equal(t, events[2].Start, events[2].End)
+}
+
+func TestParse_RecurringMeeting(t *testing.T) {
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:weekly@example.com",
+		"DTSTART;TZID=Europe/Berlin:20240304T090000",
+		"DTEND;TZID=Europe/Berlin:20240304T093000",
+		"RRULE:FREQ=WEEKLY;COUNT=4",
+		"EXDATE;TZID=Europe/Berlin:20240311T090000,20240318T090000",
+		"ORGANIZER;CN=Alice:mailto:alice@example.com",
+		"ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=ACCEPTED:MAILTO:bob@example.com",
+		"ATTENDEE;ROLE=OPT-PARTICIPANT:mailto:carol@example.com",
+		"ATTENDEE;CUTYPE=ROOM:mailto:room1@example.com",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:weekly@example.com",
+		"RECURRENCE-ID;TZID=Europe/Berlin:20240325T090000",
+		"DTSTART;TZID=Europe/Berlin:20240325T100000",
+		"DTEND;TZID=Europe/Berlin:20240325T103000",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	events, err := Parse(strings.NewReader(ics), time.UTC)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	weekly := events[0]
+	assert.Equal(t, "FREQ=WEEKLY;COUNT=4", weekly.RRule)
+	require.Len(t, weekly.ExDates, 2)
+	assert.Equal(t, time.Date(2024, 3, 18, 8, 0, 0, 0, time.UTC), weekly.ExDates[1].UTC())
+	assert.Equal(t, "alice@example.com", weekly.Organizer)
+	assert.Equal(t, []Attendee{
+		{Email: "bob@example.com", Role: "REQ-PARTICIPANT", Status: "ACCEPTED"},
+		{Email: "carol@example.com", Role: "OPT-PARTICIPANT"},
+		{Email: "room1@example.com", Kind: "ROOM"},
+	}, weekly.Attendees)
+	assert.True(t, weekly.Attendees[0].Required())
+	assert.False(t, weekly.Attendees[1].Required())
+
+	assert.Equal(t, time.Date(2024, 3, 25, 8, 0, 0, 0, time.UTC), events[1].RecurrenceID.UTC())
+	assert.Equal(t, time.Date(2024, 3, 25, 9, 0, 0, 0, time.UTC), events[1].Start.UTC())
+}
+
+func TestParse_Errors(t *testing.T) {
+	for name, ics := range map[string]string{
+		"no colon":     "BEGIN:VEVENT\nDTSTART\nEND:VEVENT",
+		"bad date":     "BEGIN:VEVENT\nDTSTART;VALUE=DATE:2024-12-25\nEND:VEVENT",
+		"no start":     "BEGIN:VEVENT\nSUMMARY:Nothing\nEND:VEVENT",
+		"unknown zone": "BEGIN:VEVENT\nDTSTART;TZID=Mars/Olympus:20240304T090000\nEND:VEVENT",
+		"unterminated": "BEGIN:VEVENT\nDTSTART:20240304T090000Z",
+	} {
+		_, err := Parse(strings.NewReader(ics), time.UTC)
+		assert.Error(t, err, name)
+	}
+}
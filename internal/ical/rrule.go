@@ -0,0 +1,315 @@
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence frequencies supported in an RRULE
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+)
+
+// WeekdayNum is a BYDAY entry: a weekday, and for monthly rules optionally the
+// nth (or with N < 0, nth from last) such weekday of the month
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+// RRule is a parsed recurrence rule (RFC 5545 section 3.3.10). Weeks start on Monday.
+type RRule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+}
+
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// ParseRRule parses the value of an RRULE, e.g. "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10".
+// A leading "RRULE:" is accepted. A date-only UNTIL is read as the end of that
+// day in loc.
+func ParseRRule(s string, loc *time.Location) (RRule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	rule := RRule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return RRule{}, fmt.Errorf("malformed rule part %q", part)
+		}
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(value)
+			if rule.Freq != Daily && rule.Freq != Weekly && rule.Freq != Monthly {
+				return RRule{}, fmt.Errorf("unsupported FREQ %q; use DAILY, WEEKLY or MONTHLY", value)
+			}
+		case "INTERVAL":
+			if rule.Interval, err = strconv.Atoi(value); err != nil || rule.Interval < 1 {
+				return RRule{}, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+		case "COUNT":
+			if rule.Count, err = strconv.Atoi(value); err != nil || rule.Count < 1 {
+				return RRule{}, fmt.Errorf("invalid COUNT %q", value)
+			}
+		case "UNTIL":
+			if rule.Until, err = parseUntil(value, loc); err != nil {
+				return RRule{}, err
+			}
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				wd, err := parseWeekdayNum(code)
+				if err != nil {
+					return RRule{}, err
+				}
+				rule.ByDay = append(rule.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				d, err := strconv.Atoi(v)
+				if err != nil || d == 0 || d < -31 || d > 31 {
+					return RRule{}, fmt.Errorf("invalid BYMONTHDAY %q", v)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, d)
+			}
+		case "WKST":
+			if strings.ToUpper(value) != "MO" {
+				return RRule{}, errors.New("only WKST=MO is supported")
+			}
+		default:
+			return RRule{}, fmt.Errorf("unsupported rule part %q", key)
+		}
+	}
+	if rule.Freq == "" {
+		return RRule{}, errors.New("FREQ is required")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return RRule{}, errors.New("COUNT and UNTIL cannot both be given")
+	}
+	for _, wd := range rule.ByDay {
+		if wd.N != 0 && rule.Freq != Monthly {
+			return RRule{}, errors.New("numbered BYDAY entries need FREQ=MONTHLY")
+		}
+	}
+	return rule, nil
+}
+
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102T150405", value, loc); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseInLocation("20060102", value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid UNTIL %q", value)
+	}
+	return d.AddDate(0, 0, 1).Add(-time.Second), nil
+}
+
+func parseWeekdayNum(code string) (WeekdayNum, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) < 2 {
+		return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", code)
+	}
+	day, ok := weekdayCodes[code[len(code)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", code)
+	}
+	n := 0
+	if prefix := code[:len(code)-2]; prefix != "" {
+		var err error
+		if n, err = strconv.Atoi(prefix); err != nil || n == 0 || n < -5 || n > 5 {
+			return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", code)
+		}
+	}
+	return WeekdayNum{N: n, Day: day}, nil
+}
+
+// String formats the rule as an RRULE value, with UNTIL in UTC
+func (r RRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, 0, len(r.ByDay))
+		for _, wd := range r.ByDay {
+			code := strings.ToUpper(wd.Day.String()[:2])
+			if wd.N != 0 {
+				code = strconv.Itoa(wd.N) + code
+			}
+			codes = append(codes, code)
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, 0, len(r.ByMonthDay))
+		for _, d := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(d))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Bounded reports whether the rule ends by itself through COUNT or UNTIL
+func (r RRule) Bounded() bool {
+	return r.Count > 0 || !r.Until.IsZero()
+}
+
+// Occurrences returns the starts of the series beginning at dtstart, in order,
+// up to COUNT or UNTIL and before limit. They keep dtstart's wall-clock time in
+// its location, so a 09:00 series stays at 09:00 across daylight saving changes.
+// Days a rule names that do not exist, such as 31 June, are skipped.
+func (r RRule) Occurrences(dtstart, limit time.Time) []time.Time {
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	var out []time.Time
+	for period := 0; ; period++ {
+		first, candidates := r.period(dtstart, period*interval)
+		if !first.Before(limit) {
+			return out
+		}
+		for _, t := range candidates {
+			if t.Before(dtstart) {
+				continue
+			}
+			if !t.Before(limit) || (!r.Until.IsZero() && t.After(r.Until)) {
+				return out
+			}
+			out = append(out, t)
+			if r.Count > 0 && len(out) == r.Count {
+				return out
+			}
+		}
+	}
+}
+
+// period returns the start of the nth day, week or month after dtstart's and
+// the rule's candidates within it, in order
+func (r RRule) period(dtstart time.Time, n int) (time.Time, []time.Time) {
+	y, m, d := dtstart.Date()
+	h, mi, s := dtstart.Clock()
+	loc := dtstart.Location()
+	at := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, h, mi, s, 0, loc) }
+
+	switch r.Freq {
+	case Daily:
+		day := at(y, m, d+n)
+		if r.matchesDay(day) {
+			return day, []time.Time{day}
+		}
+		return day, nil
+	case Weekly:
+		monday := d - (int(dtstart.Weekday())+6)%7 + 7*n
+		start := at(y, m, monday)
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []WeekdayNum{{Day: dtstart.Weekday()}}
+		}
+		var out []time.Time
+		for offset := 0; offset < 7; offset++ {
+			day := at(y, m, monday+offset)
+			for _, wd := range days {
+				if day.Weekday() == wd.Day && r.matchesMonthDay(day) {
+					out = append(out, day)
+					break
+				}
+			}
+		}
+		return start, out
+	default:
+		month := time.Date(y, m+time.Month(n), 1, 0, 0, 0, 0, loc)
+		my, mm, _ := month.Date()
+		length := time.Date(my, mm+1, 0, 0, 0, 0, 0, loc).Day()
+		var days []int
+		for day := 1; day <= length; day++ {
+			if r.matchesMonthly(my, mm, day, length, d, loc) {
+				days = append(days, day)
+			}
+		}
+		sort.Ints(days)
+		out := make([]time.Time, 0, len(days))
+		for _, day := range days {
+			out = append(out, at(my, mm, day))
+		}
+		return at(my, mm, 1), out
+	}
+}
+
+// matchesDay applies the BYDAY and BYMONTHDAY filters of a daily rule
+func (r RRule) matchesDay(t time.Time) bool {
+	if len(r.ByDay) > 0 {
+		found := false
+		for _, wd := range r.ByDay {
+			if t.Weekday() == wd.Day {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return r.matchesMonthDay(t)
+}
+
+func (r RRule) matchesMonthDay(t time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	length := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+	for _, md := range r.ByMonthDay {
+		if md == t.Day() || (md < 0 && length+md+1 == t.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMonthly reports whether day of a month of the given length is in a
+// monthly rule. Without BYDAY or BYMONTHDAY the series repeats on dtstartDay.
+func (r RRule) matchesMonthly(y int, m time.Month, day, length, dtstartDay int, loc *time.Location) bool {
+	if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+		return day == dtstartDay
+	}
+	t := time.Date(y, m, day, 0, 0, 0, 0, loc)
+	if len(r.ByMonthDay) > 0 && !r.matchesMonthDay(t) {
+		return false
+	}
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, wd := range r.ByDay {
+		if t.Weekday() != wd.Day {
+			continue
+		}
+		nth, fromEnd := (day-1)/7+1, -((length-day)/7 + 1)
+		if wd.N == 0 || wd.N == nth || wd.N == fromEnd {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package ical
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dates(ts []time.Time) []string {
+	out := make([]string, 0, len(ts))
+	for _, t := range ts {
+		out = append(out, t.Format("2006-01-02 15:04"))
+	}
+	return out
+}
+
+func TestParseRRule(t *testing.T) {
+	rule, err := ParseRRule("RRULE:FREQ=MONTHLY;INTERVAL=2;BYDAY=-1FR,2MO;COUNT=4", time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, RRule{
+		Freq:     Monthly,
+		Interval: 2,
+		Count:    4,
+		ByDay:    []WeekdayNum{{N: -1, Day: time.Friday}, {N: 2, Day: time.Monday}},
+	}, rule)
+	assert.Equal(t, "FREQ=MONTHLY;INTERVAL=2;COUNT=4;BYDAY=-1FR,2MO", rule.String())
+	assert.True(t, rule.Bounded())
+
+	rule, err = ParseRRule("FREQ=DAILY;UNTIL=20240310", time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 10, 23, 59, 59, 0, time.UTC), rule.Until, "a date-only UNTIL includes the whole day")
+
+	for _, bad := range []string{
+		"",
+		"FREQ=YEARLY",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;INTERVAL=-1",
+		"FREQ=DAILY;COUNT=2;UNTIL=20240310T000000Z",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;BYHOUR=9",
+		"FREQ",
+	} {
+		_, err := ParseRRule(bad, time.UTC)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestRRule_Occurrences(t *testing.T) {
+	// Monday 2024-03-04 09:00 UTC
+	start := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	limit := start.AddDate(1, 0, 0)
+	cases := []struct {
+		rule string
+		want []string
+	}{
+		{"FREQ=DAILY;COUNT=3", []string{"2024-03-04 09:00", "2024-03-05 09:00", "2024-03-06 09:00"}},
+		{"FREQ=DAILY;INTERVAL=2;UNTIL=20240310T090000Z", []string{"2024-03-04 09:00", "2024-03-06 09:00", "2024-03-08 09:00", "2024-03-10 09:00"}},
+		{"FREQ=DAILY;BYDAY=MO,FR;COUNT=3", []string{"2024-03-04 09:00", "2024-03-08 09:00", "2024-03-11 09:00"}},
+		{"FREQ=WEEKLY;COUNT=3", []string{"2024-03-04 09:00", "2024-03-11 09:00", "2024-03-18 09:00"}},
+		{"FREQ=WEEKLY;BYDAY=WE,MO;COUNT=4", []string{"2024-03-04 09:00", "2024-03-06 09:00", "2024-03-11 09:00", "2024-03-13 09:00"}},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO;COUNT=3", []string{"2024-03-04 09:00", "2024-03-18 09:00", "2024-04-01 09:00"}},
+		{"FREQ=MONTHLY;COUNT=3", []string{"2024-03-04 09:00", "2024-04-04 09:00", "2024-05-04 09:00"}},
+		{"FREQ=MONTHLY;BYDAY=1MO;COUNT=3", []string{"2024-03-04 09:00", "2024-04-01 09:00", "2024-05-06 09:00"}},
+		{"FREQ=MONTHLY;BYDAY=-1FR;COUNT=2", []string{"2024-03-29 09:00", "2024-04-26 09:00"}},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3", []string{"2024-03-31 09:00", "2024-04-30 09:00", "2024-05-31 09:00"}},
+	}
+	for _, c := range cases {
+		rule, err := ParseRRule(c.rule, time.UTC)
+		require.NoError(t, err, c.rule)
+		assert.Equal(t, c.want, dates(rule.Occurrences(start, limit)), c.rule)
+	}
+
+	// Months without the day are skipped rather than moved
+	rule, err := ParseRRule("FREQ=MONTHLY;COUNT=3", time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2024-01-31 09:00", "2024-03-31 09:00", "2024-05-31 09:00"},
+		dates(rule.Occurrences(time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC), limit)))
+
+	// Unbounded rules stop at the limit
+	rule, err = ParseRRule("FREQ=WEEKLY", time.UTC)
+	require.NoError(t, err)
+	assert.False(t, rule.Bounded())
+	assert.Len(t, rule.Occurrences(start, start.AddDate(0, 0, 28)), 4)
+}
+
+func TestRRule_Occurrences_KeepWallClock(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	rule, err := ParseRRule("FREQ=DAILY;COUNT=3", loc)
+	require.NoError(t, err)
+
+	// Clocks go forward on 2024-03-10
+	got := rule.Occurrences(time.Date(2024, 3, 9, 9, 0, 0, 0, loc), time.Date(2025, 1, 1, 0, 0, 0, 0, loc))
+	require.Len(t, got, 3)
+	for _, occ := range got {
+		assert.Equal(t, 9, occ.Hour())
+	}
+	assert.Equal(t, 23*time.Hour, got[1].Sub(got[0]))
+}
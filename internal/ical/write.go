@@ -0,0 +1,291 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Calendar is a VCALENDAR to write
+type Calendar struct {
+	ProdID string
+	// Name is shown by clients subscribing to the calendar
+	Name string
+	// Method is the iTIP method, such as REQUEST or CANCEL; empty for a feed
+	Method string
+	// Location is the zone event times are written in, unless an event names
+	// its own, with a VTIMEZONE describing it. Nil or UTC writes them in UTC.
+	Location *time.Location
+	Events   []Event
+}
+
+const (
+	utcLayout   = "20060102T150405Z"
+	localLayout = "20060102T150405"
+	dateLayout  = "20060102"
+	// maxLineOctets is the longest content line RFC 5545 allows, without the CRLF
+	maxLineOctets = 75
+)
+
+// Write writes cal as an iCalendar stream with CRLF line endings, folding
+// lines longer than RFC 5545 allows
+func Write(w io.Writer, cal Calendar) error {
+	bw := bufio.NewWriter(w)
+	line := func(s string) {
+		for i, part := range fold(s) {
+			if i > 0 {
+				bw.WriteString(" ")
+			}
+			bw.WriteString(part)
+			bw.WriteString("\r\n")
+		}
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:" + cal.ProdID)
+	line("CALSCALE:GREGORIAN")
+	if cal.Method != "" {
+		line("METHOD:" + cal.Method)
+	}
+	if cal.Name != "" {
+		line("X-WR-CALNAME:" + escape(cal.Name))
+	}
+	if zone(cal.Location) != nil {
+		line("X-WR-TIMEZONE:" + cal.Location.String())
+	}
+	// One VTIMEZONE for each zone, covering the events written in it
+	var zones []*time.Location
+	spans := map[string][]Event{}
+	for _, e := range cal.Events {
+		loc := eventZone(cal, e)
+		if loc == nil {
+			continue
+		}
+		if _, ok := spans[loc.String()]; !ok {
+			zones = append(zones, loc)
+		}
+		spans[loc.String()] = append(spans[loc.String()], e)
+	}
+	for _, loc := range zones {
+		from, to, _ := eventSpan(spans[loc.String()])
+		for _, l := range timezoneLines(loc, from, to) {
+			line(l)
+		}
+	}
+
+	for _, e := range cal.Events {
+		loc := eventZone(cal, e)
+		stamp := e.Stamp
+		if stamp.IsZero() {
+			stamp = time.Now()
+		}
+		line("BEGIN:VEVENT")
+		line("UID:" + e.UID)
+		line("DTSTAMP:" + stamp.UTC().Format(utcLayout))
+		if e.AllDay {
+			line("DTSTART;VALUE=DATE:" + e.Start.Format(dateLayout))
+			line("DTEND;VALUE=DATE:" + e.End.Format(dateLayout))
+		} else {
+			line("DTSTART" + timeValue(e.Start, loc))
+			line("DTEND" + timeValue(e.End, loc))
+		}
+		if !e.RecurrenceID.IsZero() {
+			line("RECURRENCE-ID" + timeValue(e.RecurrenceID, loc))
+		}
+		if e.RRule != "" {
+			line("RRULE:" + e.RRule)
+		}
+		if len(e.ExDates) > 0 {
+			values := make([]string, 0, len(e.ExDates))
+			for _, d := range e.ExDates {
+				values = append(values, localValue(d, loc))
+			}
+			params := ""
+			if loc != nil {
+				params = ";TZID=" + loc.String()
+			}
+			line("EXDATE" + params + ":" + strings.Join(values, ","))
+		}
+		line("SUMMARY:" + escape(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION:" + escape(e.Description))
+		}
+		if e.Location != "" {
+			line("LOCATION:" + escape(e.Location))
+		}
+		if e.Status != "" {
+			line("STATUS:" + e.Status)
+		}
+		if e.Sequence > 0 {
+			line(fmt.Sprintf("SEQUENCE:%d", e.Sequence))
+		}
+		if e.Organizer != "" {
+			line("ORGANIZER:mailto:" + e.Organizer)
+		}
+		for _, a := range e.Attendees {
+			line("ATTENDEE" + attendeeParams(a) + ":mailto:" + a.Email)
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return bw.Flush()
+}
+
+// zone returns loc, or nil for UTC, whose times need no VTIMEZONE
+func zone(loc *time.Location) *time.Location {
+	if loc == nil || loc == time.UTC || loc.String() == "UTC" {
+		return nil
+	}
+	return loc
+}
+
+// eventZone returns the zone e is written in, or nil for UTC
+func eventZone(cal Calendar, e Event) *time.Location {
+	if e.Zone != nil {
+		return zone(e.Zone)
+	}
+	return zone(cal.Location)
+}
+
+// timeValue returns the parameters and value of a DATE-TIME property: a
+// local time with its TZID, or a UTC time when loc is nil
+func timeValue(t time.Time, loc *time.Location) string {
+	if loc == nil {
+		return ":" + localValue(t, loc)
+	}
+	return ";TZID=" + loc.String() + ":" + localValue(t, loc)
+}
+
+// localValue formats t in loc, or in UTC when loc is nil
+func localValue(t time.Time, loc *time.Location) string {
+	if loc == nil {
+		return t.UTC().Format(utcLayout)
+	}
+	return t.In(loc).Format(localLayout)
+}
+
+// attendeeParams returns the parameters of an ATTENDEE property
+func attendeeParams(a Attendee) string {
+	var params string
+	for _, p := range []struct{ name, value string }{
+		{"CUTYPE", a.Kind},
+		{"ROLE", a.Role},
+		{"PARTSTAT", a.Status},
+	} {
+		if p.value != "" {
+			params += ";" + p.name + "=" + p.value
+		}
+	}
+	if a.RSVP {
+		params += ";RSVP=TRUE"
+	}
+	return params
+}
+
+// escape writes the backslash escapes of TEXT values
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// fold splits a content line into parts of at most maxLineOctets octets, the
+// first with the line's start and the rest to follow a space, never
+// splitting a UTF-8 character
+func fold(s string) []string {
+	var parts []string
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		parts = append(parts, s[:cut])
+		s = s[cut:]
+		limit = maxLineOctets - 1
+	}
+	return append(parts, s)
+}
+
+// eventSpan returns the earliest start and latest end of the events
+func eventSpan(events []Event) (from, to time.Time, ok bool) {
+	for _, e := range events {
+		start, end := e.Start, e.End
+		if !e.RecurrenceID.IsZero() && e.RecurrenceID.Before(start) {
+			start = e.RecurrenceID
+		}
+		for _, d := range e.ExDates {
+			if d.After(end) {
+				end = d
+			}
+		}
+		if !ok || start.Before(from) {
+			from = start
+		}
+		if !ok || end.After(to) {
+			to = end
+		}
+		ok = true
+	}
+	return from, to, ok
+}
+
+// timezoneLines describes loc from from to to as a VTIMEZONE. Go does not
+// expose a zone's rules, so it lists the observance in force at from and each
+// change of offset found up to a year after to, which covers recurring events
+// running on from their last written date.
+func timezoneLines(loc *time.Location, from, to time.Time) []string {
+	lines := []string{"BEGIN:VTIMEZONE", "TZID:" + loc.String()}
+	observance := func(at time.Time, fromOffset int) {
+		name, offset := at.In(loc).Zone()
+		kind := "STANDARD"
+		if at.In(loc).IsDST() {
+			kind = "DAYLIGHT"
+		}
+		lines = append(lines,
+			"BEGIN:"+kind,
+			"DTSTART:"+at.In(time.FixedZone("", fromOffset)).Format(localLayout),
+			"TZOFFSETFROM:"+formatOffset(fromOffset),
+			"TZOFFSETTO:"+formatOffset(offset),
+			"TZNAME:"+name,
+			"END:"+kind,
+		)
+	}
+
+	at := from.Add(-24 * time.Hour)
+	_, offset := at.In(loc).Zone()
+	observance(at, offset)
+	end := to.AddDate(1, 0, 0)
+	for day := at; day.Before(end); {
+		next := day.Add(24 * time.Hour)
+		_, nextOffset := next.In(loc).Zone()
+		if nextOffset == offset {
+			day = next
+			continue
+		}
+		// Find the second the offset changes
+		lo, hi := day, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, o := mid.In(loc).Zone(); o == offset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		observance(hi, offset)
+		_, offset = hi.In(loc).Zone()
+		day = hi
+	}
+	return append(lines, "END:VTIMEZONE")
+}
+
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
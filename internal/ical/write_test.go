@@ -0,0 +1,161 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite_RoundTrip(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	stamp := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	start := time.Date(2024, 3, 4, 9, 0, 0, 0, ny)
+	cal := Calendar{
+		ProdID:   "-//Example//Test//EN",
+		Name:     "Room 101",
+		Location: ny,
+		Events: []Event{
+			{
+				UID:     "weekly@example.com",
+				Summary: "Stand-up; daily, mostly",
+				Start:   start,
+				End:     start.Add(30 * time.Minute),
+				RRule:   "FREQ=WEEKLY;COUNT=4",
+				ExDates: []time.Time{start.AddDate(0, 0, 7)},
+				Status:  "CONFIRMED",
+				Stamp:   stamp,
+			},
+			{
+				UID:          "weekly@example.com",
+				Summary:      "Stand-up, moved",
+				Start:        start.AddDate(0, 0, 14).Add(time.Hour),
+				End:          start.AddDate(0, 0, 14).Add(90 * time.Minute),
+				RecurrenceID: start.AddDate(0, 0, 14),
+				Stamp:        stamp,
+			},
+			{
+				UID:         "gone@example.com",
+				Summary:     "Cancelled",
+				Description: strings.Repeat("A very long description that needs folding. ", 4),
+				Start:       start.AddDate(0, 0, 1),
+				End:         start.AddDate(0, 0, 1).Add(time.Hour),
+				Status:      "CANCELLED",
+				Stamp:       stamp,
+			},
+		},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, cal))
+	out := buf.String()
+
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75, line)
+		assert.NotContains(t, line, "\n")
+	}
+	assert.Contains(t, out, "X-WR-CALNAME:Room 101\r\n")
+	assert.Contains(t, out, "DTSTAMP:20240101T000000Z\r\n")
+	assert.Contains(t, out, "DTSTART;TZID=America/New_York:20240304T090000\r\n")
+	assert.Contains(t, out, "EXDATE;TZID=America/New_York:20240311T090000\r\n")
+	assert.Contains(t, out, "RECURRENCE-ID;TZID=America/New_York:20240318T090000\r\n")
+	assert.Contains(t, out, "SUMMARY:Stand-up\\; daily\\, mostly\r\n")
+	assert.Contains(t, out, "STATUS:CANCELLED\r\n")
+
+	// New York went onto summer time on 10 March 2024
+	assert.Contains(t, out, "BEGIN:DAYLIGHT\r\nDTSTART:20240310T020000\r\nTZOFFSETFROM:-0500\r\nTZOFFSETTO:-0400\r\nTZNAME:EDT\r\nEND:DAYLIGHT\r\n")
+
+	events, err := Parse(&buf, time.UTC)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, "Stand-up; daily, mostly", events[0].Summary)
+	assert.True(t, events[0].Start.Equal(start))
+	assert.True(t, events[1].Start.Equal(start.AddDate(0, 0, 14).Add(time.Hour)), "summer time applies after the change")
+	assert.Equal(t, cal.Events[2].Description, events[2].Description, "folded lines unfold")
+}
+
+func TestWrite_UTC(t *testing.T) {
+	start := time.Date(2024, 3, 4, 14, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, Calendar{
+		ProdID: "-//Example//Test//EN",
+		Method: "CANCEL",
+		Events: []Event{{UID: "a@example.com", Summary: "Sync", Start: start, End: start.Add(time.Hour)}},
+	}))
+	out := buf.String()
+	assert.NotContains(t, out, "VTIMEZONE")
+	assert.Contains(t, out, "METHOD:CANCEL\r\n")
+	assert.Contains(t, out, "DTSTART:20240304T140000Z\r\n")
+	assert.Contains(t, out, "DTEND:20240304T150000Z\r\n")
+}
+
+func TestWrite_Invitation(t *testing.T) {
+	start := time.Date(2024, 3, 4, 14, 0, 0, 0, time.UTC)
+	event := Event{
+		UID:       "a@example.com",
+		Summary:   "Sync",
+		Start:     start,
+		End:       start.Add(time.Hour),
+		Sequence:  2,
+		Organizer: "ann@example.com",
+		Attendees: []Attendee{
+			{Email: "bob@example.com", Role: "REQ-PARTICIPANT", Status: "ACCEPTED"},
+			{Email: "cy@example.com", Role: "OPT-PARTICIPANT", Status: "NEEDS-ACTION", RSVP: true},
+		},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, Calendar{ProdID: "-//Example//Test//EN", Method: "REQUEST", Events: []Event{event}}))
+	out := buf.String()
+	assert.Contains(t, out, "METHOD:REQUEST\r\n")
+	assert.Contains(t, out, "SEQUENCE:2\r\n")
+	assert.Contains(t, out, "ORGANIZER:mailto:ann@example.com\r\n")
+	assert.Contains(t, out, "ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=ACCEPTED:mailto:bob@example.com\r\n")
+	assert.Contains(t, out, ";RSVP=TRUE:")
+
+	events, err := Parse(&buf, time.UTC)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, event.Sequence, events[0].Sequence)
+	assert.Equal(t, event.Organizer, events[0].Organizer)
+	assert.Equal(t, event.Attendees, events[0].Attendees)
+}
+
+func TestWrite_EventZones(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	start := time.Date(2024, 3, 4, 14, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, Calendar{
+		ProdID:   "-//Example//Test//EN",
+		Location: ny,
+		Events: []Event{
+			{UID: "a@example.com", Summary: "Here", Start: start, End: start.Add(time.Hour)},
+			{UID: "b@example.com", Summary: "There", Start: start, End: start.Add(time.Hour), Zone: berlin},
+		},
+	}))
+	out := buf.String()
+	assert.Contains(t, out, "X-WR-TIMEZONE:America/New_York\r\n")
+	assert.Equal(t, 1, strings.Count(out, "TZID:America/New_York\r\n"))
+	assert.Equal(t, 1, strings.Count(out, "TZID:Europe/Berlin\r\n"))
+	assert.Contains(t, out, "DTSTART;TZID=America/New_York:20240304T090000\r\n")
+	assert.Contains(t, out, "DTSTART;TZID=Europe/Berlin:20240304T150000\r\n")
+}
+
+func TestFold(t *testing.T) {
+	assert.Equal(t, []string{"short"}, fold("short"))
+	parts := fold(strings.Repeat("é", 100))
+	for i, p := range parts {
+		limit := 75
+		if i > 0 {
+			limit = 74
+		}
+		assert.LessOrEqual(t, len(p), limit)
+		assert.True(t, strings.HasPrefix(p, "é"), "characters are not split")
+	}
+	assert.Equal(t, strings.Repeat("é", 100), strings.Join(parts, ""))
+}
@@ -0,0 +1,166 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/migrations"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n)
+	require.NoError(t, err)
+	return n > 0
+}
+
+var testFS = fstest.MapFS{
+	"000001_a.up.sql":   {Data: []byte("CREATE TABLE a (id INTEGER);")},
+	"000001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	"000002_b.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER); INSERT INTO b VALUES (1);")},
+	"000002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	"000003_c.up.sql":   {Data: []byte("CREATE TABLE c (id INTEGER);")},
+	"000003_c.down.sql": {Data: []byte("DROP TABLE c;")},
+	"README.md":         {Data: []byte("ignored")},
+}
+
+func TestLoad(t *testing.T) {
+	migs, err := Load(testFS)
+	require.NoError(t, err)
+	require.Len(t, migs, 3)
+	assert.Equal(t, 1, migs[0].Version)
+	assert.Equal(t, "a", migs[0].Name)
+	assert.Contains(t, migs[1].Up, "CREATE TABLE b")
+	assert.Contains(t, migs[2].Down, "DROP TABLE c")
+}
+
+func TestLoad_MissingUp(t *testing.T) {
+	_, err := Load(fstest.MapFS{"000001_a.down.sql": {Data: []byte("DROP TABLE a;")}})
+	assert.Error(t, err)
+}
+
+func TestMigrator_UpDownGoto(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	m, err := New(db, "sqlite3", testFS)
+	require.NoError(t, err)
+
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, applied)
+	assert.True(t, tableExists(t, db, "c"))
+
+	// Running again is a no-op
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	reverted, err := m.Down(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3}, reverted)
+	assert.False(t, tableExists(t, db, "c"))
+
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	moved, err := m.Goto(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 1}, moved)
+	assert.False(t, tableExists(t, db, "a"))
+
+	moved, err = m.Goto(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, moved)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	assert.True(t, statuses[0].Applied)
+	assert.True(t, statuses[1].Applied)
+	assert.False(t, statuses[2].Applied)
+	assert.False(t, statuses[0].AppliedAt.IsZero())
+
+	_, err = m.Goto(ctx, 9)
+	assert.Error(t, err)
+}
+
+func TestMigrator_FailedMigrationRollsBack(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	fsys := fstest.MapFS{
+		"000001_a.up.sql": {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"000002_b.up.sql": {Data: []byte("CREATE TABLE b (id INTEGER); INSERT INTO missing VALUES (1);")},
+	}
+	m, err := New(db, "sqlite3", fsys)
+	require.NoError(t, err)
+
+	applied, err := m.Up(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, []int{1}, applied)
+	assert.False(t, tableExists(t, db, "b"))
+
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, version)
+}
+
+func TestMigrator_EmbeddedMigrations(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	fsys, err := migrations.ForDriver("sqlite3")
+	require.NoError(t, err)
+	m, err := New(db, "sqlite3", fsys)
+	require.NoError(t, err)
+
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+	for _, table := range []string{"users", "offices", "floors", "rooms", "bookings", "booking_rules", "holidays", "audit_logs"} {
+		assert.True(t, tableExists(t, db, table), table)
+	}
+	var rooms int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM rooms").Scan(&rooms))
+	assert.Equal(t, 6, rooms)
+
+	_, err = m.Goto(ctx, 0)
+	require.NoError(t, err)
+	assert.False(t, tableExists(t, db, "users"))
+}
+
+func TestEmbeddedMigrations_DialectsInStep(t *testing.T) {
+	sqliteFS, err := migrations.ForDriver("sqlite3")
+	require.NoError(t, err)
+	postgresFS, err := migrations.ForDriver("postgres")
+	require.NoError(t, err)
+
+	sqliteMigs, err := Load(sqliteFS)
+	require.NoError(t, err)
+	postgresMigs, err := Load(postgresFS)
+	require.NoError(t, err)
+
+	require.Equal(t, len(sqliteMigs), len(postgresMigs))
+	for i := range sqliteMigs {
+		assert.Equal(t, sqliteMigs[i].Version, postgresMigs[i].Version)
+		assert.Equal(t, sqliteMigs[i].Name, postgresMigs[i].Name)
+		assert.NotEmpty(t, postgresMigs[i].Down)
+	}
+	assert.Contains(t, postgresMigs[0].Up, "EXCLUDE USING gist")
+	assert.NotContains(t, postgresMigs[0].Up, "randomblob")
+
+	_, err = migrations.ForDriver("mysql")
+	assert.Error(t, err)
+}
@@ -32,7 +32,8 @@ func NewClient(cfg *config.Config) (*Client, error) {
 	return &Client{graphClient: graphClient}, nil
 }
 
-func (c *Client) CreateEvent(resourceID, subject, startTime, endTime string) (*models.Eventable, error) {
+// CreateEvent posts an event to the calendar of resourceID. Times are "2006-01-02T15:04:05" in UTC.
+func (c *Client) CreateEvent(ctx context.Context, resourceID, subject, startTime, endTime string) (*models.Eventable, error) {
 	if c == nil || c.graphClient == nil {
 		return nil, nil
 	}
@@ -50,7 +51,7 @@ func (c *Client) CreateEvent(resourceID, subject, startTime, endTime string) (*m
 	end.SetTimeZone(&[]string{"UTC"}[0])
 	event.SetEnd(end)
 
-	result, err := c.graphClient.Users().ByUserId(resourceID).Events().Post(context.Background(), event, nil)
+	result, err := c.graphClient.Users().ByUserId(resourceID).Events().Post(ctx, event, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,57 @@
+// Package notify delivers messages to users outside the web UI
+package notify
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// Message is a plain-text notification to one or more email addresses
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+	// Attachments are sent with the body, such as a calendar invitation
+	Attachments []Attachment
+}
+
+// Attachment is a file sent with a message
+type Attachment struct {
+	Filename string
+	// ContentType is the MIME type with its parameters, such as
+	// text/calendar; method=REQUEST; charset=utf-8
+	ContentType string
+	Data        []byte
+}
+
+// Notifier delivers messages
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// LogNotifier writes messages to the log instead of delivering them. It is
+// the default until a real transport is configured.
+type LogNotifier struct {
+	logger *zap.Logger
+}
+
+func NewLogNotifier(logger *zap.Logger) *LogNotifier {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &LogNotifier{logger: logger}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, msg Message) error {
+	attachments := make([]string, 0, len(msg.Attachments))
+	for _, a := range msg.Attachments {
+		attachments = append(attachments, a.Filename)
+	}
+	n.logger.Info("notification",
+		zap.Strings("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("body", msg.Body),
+		zap.Strings("attachments", attachments))
+	return nil
+}
@@ -0,0 +1,25 @@
+package notify
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogNotifier_Notify(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	n := NewLogNotifier(zap.New(core))
+
+	err := n.Notify(context.Background(), Message{To: []string{"a@example.com"}, Subject: "Hi", Body: "Hello"})
+	require.NoError(t, err)
+
+	entries := logs.All()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "Hi", fields["subject"])
+	assert.Equal(t, "Hello", fields["body"])
+}
@@ -0,0 +1,255 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"roombooker/internal/config"
+)
+
+// TLS modes of an SMTP connection
+const (
+	SMTPStartTLS = "starttls"
+	SMTPTLS      = "tls"
+	SMTPNoTLS    = "none"
+)
+
+// smtpTimeout bounds a delivery whose context has no deadline
+const smtpTimeout = 30 * time.Second
+
+// SMTPNotifier sends messages as email through a mail server, one SMTP
+// session per message
+type SMTPNotifier struct {
+	addr      string
+	host      string
+	from      *mail.Address
+	auth      smtp.Auth
+	tlsMode   string
+	tlsConfig *tls.Config
+}
+
+// NewSMTPNotifier checks cfg and returns a notifier sending through the
+// server it names. Credentials are only sent over TLS, or to localhost.
+func NewSMTPNotifier(cfg config.SMTPConfig) (*SMTPNotifier, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("smtp: no host configured")
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("smtp: invalid from address %q: %w", cfg.From, err)
+	}
+	mode := strings.ToLower(cfg.TLS)
+	if mode == "" {
+		mode = SMTPStartTLS
+	}
+	if mode != SMTPStartTLS && mode != SMTPTLS && mode != SMTPNoTLS {
+		return nil, fmt.Errorf("smtp: TLS must be starttls, tls or none, not %q", cfg.TLS)
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+	}
+	n := &SMTPNotifier{
+		addr:      net.JoinHostPort(cfg.Host, strconv.Itoa(port)),
+		host:      cfg.Host,
+		from:      from,
+		tlsMode:   mode,
+		tlsConfig: &tls.Config{ServerName: cfg.Host, MinVersion: tls.VersionTLS12},
+	}
+	if cfg.Username != "" {
+		n.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return n, nil
+}
+
+// Notify sends msg as one email to all its recipients
+func (n *SMTPNotifier) Notify(ctx context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return errors.New("smtp: message has no recipients")
+	}
+	to := make([]*mail.Address, 0, len(msg.To))
+	for _, addr := range msg.To {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return fmt.Errorf("smtp: invalid recipient %q: %w", addr, err)
+		}
+		to = append(to, a)
+	}
+	data, err := buildMessage(n.from, to, msg, time.Now())
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+	conn.SetDeadline(deadline)
+	// Closing the connection aborts the session when ctx is cancelled
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	if n.tlsMode == SMTPTLS {
+		conn = tls.Client(conn, n.tlsConfig)
+	}
+
+	if err := n.send(conn, to, data); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("smtp: %w", ctx.Err())
+		}
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+// send runs an SMTP session on conn delivering data to the recipients
+func (n *SMTPNotifier) send(conn net.Conn, to []*mail.Address, data []byte) error {
+	c, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if n.tlsMode == SMTPStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not offer STARTTLS; set SMTP_TLS=none to send in the clear", n.addr)
+		}
+		if err := c.StartTLS(n.tlsConfig); err != nil {
+			return err
+		}
+	}
+	if n.auth != nil {
+		if err := c.Auth(n.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.from.Address); err != nil {
+		return err
+	}
+	for _, a := range to {
+		if err := c.Rcpt(a.Address); err != nil {
+			return fmt.Errorf("recipient %s: %w", a.Address, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// buildMessage writes msg as a MIME email: a plain-text body, or with
+// attachments a multipart/mixed one whose first part is the body
+func buildMessage(from *mail.Address, to []*mail.Address, msg Message, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	recipients := make([]string, 0, len(to))
+	for _, a := range to {
+		recipients = append(recipients, a.String())
+	}
+	id, err := messageID(from)
+	if err != nil {
+		return nil, err
+	}
+	header("From", from.String())
+	header("To", strings.Join(recipients, ", "))
+	// Q-encoding also keeps line breaks out of the header
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", id)
+	header("MIME-Version", "1.0")
+
+	if len(msg.Attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, msg.Body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mw.Boundary()}))
+	buf.WriteString("\r\n")
+	body, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintable(body, msg.Body); err != nil {
+		return nil, err
+	}
+	for _, a := range msg.Attachments {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			fmt.Fprintf(part, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", encoded)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(text)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// messageID returns a unique Message-ID in the sender's domain
+func messageID(from *mail.Address) (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	domain := "localhost"
+	if i := strings.LastIndex(from.Address, "@"); i >= 0 {
+		domain = from.Address[i+1:]
+	}
+	return "<" + hex.EncodeToString(b[:]) + "@" + domain + ">", nil
+}
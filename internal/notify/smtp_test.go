@@ -0,0 +1,204 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/config"
+)
+
+// sunkMail is a message an smtpSink accepted
+type sunkMail struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpSink is a local mail server that accepts every message it is sent
+type smtpSink struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	mails []sunkMail
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &smtpSink{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// config returns the settings for sending to the sink
+func (s *smtpSink) config() config.SMTPConfig {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return config.SMTPConfig{Host: host, Port: p, From: "Room Booker <rooms@example.com>", TLS: SMTPNoTLS}
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 sink ESMTP")
+	var m sunkMail
+	arg := func(line string) string {
+		_, v, _ := strings.Cut(line, ":")
+		return strings.Trim(v, "<> ")
+	}
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		switch verb, _, _ := strings.Cut(line, " "); strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 sink")
+		case "MAIL":
+			m = sunkMail{from: arg(line)}
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			m.to = append(m.to, arg(line))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			m.data = string(data)
+			s.mu.Lock()
+			s.mails = append(s.mails, m)
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func (s *smtpSink) received() []sunkMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sunkMail(nil), s.mails...)
+}
+
+func TestSMTPNotifier_Notify(t *testing.T) {
+	sink := newSMTPSink(t)
+	n, err := NewSMTPNotifier(sink.config())
+	require.NoError(t, err)
+
+	invite := "BEGIN:VCALENDAR\r\nMETHOD:REQUEST\r\nEND:VCALENDAR\r\n"
+	err = n.Notify(context.Background(), Message{
+		To:      []string{"ann@example.com", "Bob <bob@example.com>"},
+		Subject: "Invitation: Café sync",
+		Body:    "You are invited.\n\nSee you there.",
+		Attachments: []Attachment{{
+			Filename:    "invite.ics",
+			ContentType: "text/calendar; method=REQUEST; charset=utf-8",
+			Data:        []byte(invite),
+		}},
+	})
+	require.NoError(t, err)
+
+	mails := sink.received()
+	require.Len(t, mails, 1)
+	assert.Equal(t, "rooms@example.com", mails[0].from)
+	assert.Equal(t, []string{"ann@example.com", "bob@example.com"}, mails[0].to)
+
+	msg, err := mail.ReadMessage(strings.NewReader(mails[0].data))
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Invitation: Café sync", subject)
+	assert.Equal(t, `"Room Booker" <rooms@example.com>`, msg.Header.Get("From"))
+	assert.NotEmpty(t, msg.Header.Get("Message-ID"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/mixed", mediaType)
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+
+	body, err := parts.NextPart()
+	require.NoError(t, err)
+	text, err := io.ReadAll(body)
+	require.NoError(t, err)
+	// The sink reads CRLF line endings as LF
+	assert.Equal(t, "You are invited.\n\nSee you there.", string(text))
+
+	attachment, err := parts.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "text/calendar; method=REQUEST; charset=utf-8", attachment.Header.Get("Content-Type"))
+	assert.Equal(t, "invite.ics", attachment.FileName())
+	data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, attachment))
+	require.NoError(t, err)
+	assert.Equal(t, invite, string(data))
+
+	_, err = parts.NextPart()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestSMTPNotifier_PlainText(t *testing.T) {
+	sink := newSMTPSink(t)
+	n, err := NewSMTPNotifier(sink.config())
+	require.NoError(t, err)
+
+	require.NoError(t, n.Notify(context.Background(), Message{To: []string{"ann@example.com"}, Subject: "Hi\r\nBcc: eve@example.com", Body: "Hello"}))
+	mails := sink.received()
+	require.Len(t, mails, 1)
+	msg, err := mail.ReadMessage(strings.NewReader(mails[0].data))
+	require.NoError(t, err)
+	assert.Empty(t, msg.Header.Get("Bcc"), "line breaks cannot add headers")
+	assert.Equal(t, "text/plain; charset=utf-8", msg.Header.Get("Content-Type"))
+	body, err := io.ReadAll(msg.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", strings.TrimSpace(string(body)))
+}
+
+func TestSMTPNotifier_RequiresSTARTTLS(t *testing.T) {
+	sink := newSMTPSink(t)
+	cfg := sink.config()
+	cfg.TLS = SMTPStartTLS
+	n, err := NewSMTPNotifier(cfg)
+	require.NoError(t, err)
+
+	err = n.Notify(context.Background(), Message{To: []string{"ann@example.com"}, Subject: "Hi", Body: "Hello"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "STARTTLS")
+	assert.Empty(t, sink.received(), "nothing is sent in the clear")
+}
+
+func TestNewSMTPNotifier_Invalid(t *testing.T) {
+	for _, cfg := range []config.SMTPConfig{
+		{},
+		{Host: "mail.example.com", From: "not an address"},
+		{Host: "mail.example.com", From: "rooms@example.com", TLS: "ssl3"},
+	} {
+		_, err := NewSMTPNotifier(cfg)
+		assert.Error(t, err, "%+v", cfg)
+	}
+}
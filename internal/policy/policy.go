@@ -0,0 +1,256 @@
+// Package policy checks bookings against an office's booking rules
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"roombooker/internal/repository"
+)
+
+// Rule names reported in violations; they match the booking_rules columns
+const (
+	RuleWorkdayStart   = "workday_start"
+	RuleWorkdayEnd     = "workday_end"
+	RuleMaxDuration    = "max_duration"
+	RuleMinLeadTime    = "min_lead_time"
+	RuleBufferBefore   = "buffer_before"
+	RuleBufferAfter    = "buffer_after"
+	RuleAllowRecurring = "allow_recurring"
+	// RuleHoliday is broken by bookings on a day the office is closed
+	RuleHoliday = "holiday"
+)
+
+// Violation is one rule a booking breaks: the rule, the limit it sets and
+// what the booking asked for
+type Violation struct {
+	Rule    string `json:"rule"`
+	Limit   string `json:"limit"`
+	Actual  string `json:"actual"`
+	Message string `json:"message"`
+}
+
+// Booking is the booking being checked
+type Booking struct {
+	Start     time.Time
+	End       time.Time
+	Recurring bool
+}
+
+// Evaluator checks bookings against one office's rules. Rules must be ordered
+// by effective_from; clock times and holiday dates are read in Location, the
+// office timezone.
+type Evaluator struct {
+	Rules    []repository.BookingRule
+	Location *time.Location
+	// Holidays maps the office's closed days, as repository.DateLayout, to their description
+	Holidays map[string]string
+}
+
+// HolidayMap indexes holidays by date for an Evaluator
+func HolidayMap(holidays []repository.Holiday) map[string]string {
+	out := make(map[string]string, len(holidays))
+	for _, h := range holidays {
+		out[h.Date] = h.Description
+	}
+	return out
+}
+
+// Closed reports whether the office is closed on a local date and why
+func (e Evaluator) Closed(date string) (description string, closed bool) {
+	description, closed = e.Holidays[date]
+	return description, closed
+}
+
+// RuleAt returns the rule in effect at t, or nil if none has taken effect yet
+func (e Evaluator) RuleAt(t time.Time) *repository.BookingRule {
+	var rule *repository.BookingRule
+	for i := range e.Rules {
+		if !e.Rules[i].EffectiveFrom.After(t) {
+			rule = &e.Rules[i]
+		}
+	}
+	return rule
+}
+
+// Blocked is the time around a booking that the rule in effect at t keeps
+// from others: buffer_after before it, so a booking ending there still has
+// its buffer_after free, and buffer_before after it, likewise
+func (e Evaluator) Blocked(t time.Time) (before, after time.Duration) {
+	rule := e.RuleAt(t)
+	if rule == nil {
+		return 0, 0
+	}
+	return rule.BufferAfter, rule.BufferBefore
+}
+
+// Reach is the longest gap any rule asks for, i.e. how far around a slot
+// other bookings can matter
+func (e Evaluator) Reach() time.Duration {
+	var reach time.Duration
+	for _, rule := range e.Rules {
+		reach = max(reach, rule.BufferBefore, rule.BufferAfter)
+	}
+	return reach
+}
+
+// Check returns the rules b breaks: holidays, and the rule in effect when it
+// starts. others are the room's other active bookings; ones overlapping b are
+// left to the conflict check. b needs buffer_before free between it and the
+// booking before it, and buffer_after between it and the booking after it.
+// Beyond holidays, a booking no rule covers yet breaks nothing.
+func (e Evaluator) Check(b Booking, others []repository.Booking, now time.Time) []Violation {
+	violations := e.HolidayViolations(b.Start, b.End)
+	rule := e.RuleAt(b.Start)
+	if rule == nil {
+		return violations
+	}
+	violations = append(violations, e.Workday(b.Start, b.End)...)
+	if d := b.End.Sub(b.Start); rule.MaxDuration > 0 && d > rule.MaxDuration {
+		violations = append(violations, Violation{
+			Rule:    RuleMaxDuration,
+			Limit:   formatDuration(rule.MaxDuration),
+			Actual:  formatDuration(d),
+			Message: "Bookings may last at most " + formatDuration(rule.MaxDuration),
+		})
+	}
+	if lead := b.Start.Sub(now); lead < rule.MinLeadTime {
+		violations = append(violations, Violation{
+			Rule:    RuleMinLeadTime,
+			Limit:   formatDuration(rule.MinLeadTime),
+			Actual:  formatDuration(lead),
+			Message: "Bookings must be made at least " + formatDuration(rule.MinLeadTime) + " in advance",
+		})
+	}
+	if b.Recurring && !rule.AllowRecurring {
+		violations = append(violations, Violation{
+			Rule:    RuleAllowRecurring,
+			Limit:   "false",
+			Actual:  "true",
+			Message: "Recurring bookings are not allowed in this office",
+		})
+	}
+	for _, o := range others {
+		var (
+			gap   time.Duration
+			name  string
+			limit time.Duration
+			side  string
+		)
+		switch {
+		case !o.StartsAt.Before(b.End):
+			gap, name, limit, side = o.StartsAt.Sub(b.End), RuleBufferAfter, rule.BufferAfter, "after"
+		case !o.EndsAt.After(b.Start):
+			gap, name, limit, side = b.Start.Sub(o.EndsAt), RuleBufferBefore, rule.BufferBefore, "before"
+		default:
+			continue
+		}
+		if gap < limit {
+			violations = append(violations, Violation{
+				Rule:    name,
+				Limit:   formatDuration(limit),
+				Actual:  formatDuration(gap),
+				Message: fmt.Sprintf("Bookings need %s free %s them; %q is %s away", formatDuration(limit), side, o.Title, formatDuration(gap)),
+			})
+		}
+	}
+	return violations
+}
+
+// HolidayViolations returns a violation for each holiday [start, end) touches
+// in the office timezone
+func (e Evaluator) HolidayViolations(start, end time.Time) []Violation {
+	if len(e.Holidays) == 0 || !end.After(start) {
+		return nil
+	}
+	loc := e.location()
+	var violations []Violation
+	last := end.Add(-time.Nanosecond).In(loc)
+	y, m, d := start.In(loc).Date()
+	for day := time.Date(y, m, d, 0, 0, 0, 0, loc); !day.After(last); day = day.AddDate(0, 0, 1) {
+		date := day.Format(repository.DateLayout)
+		description, closed := e.Closed(date)
+		if !closed {
+			continue
+		}
+		message := "The office is closed on " + date
+		if description != "" {
+			message += " (" + description + ")"
+		}
+		violations = append(violations, Violation{Rule: RuleHoliday, Limit: "closed", Actual: date, Message: message})
+	}
+	return violations
+}
+
+// Workday returns the violations of [start, end) against the working hours of
+// the rule in effect at start. A booking must end on the local day it starts.
+func (e Evaluator) Workday(start, end time.Time) []Violation {
+	rule := e.RuleAt(start)
+	if rule == nil {
+		return nil
+	}
+	loc := e.location()
+	y, m, d := start.In(loc).Date()
+	open := ClockOn(y, m, d, rule.WorkdayStart, loc)
+	closing := ClockOn(y, m, d, rule.WorkdayEnd, loc)
+	var violations []Violation
+	if start.Before(open) {
+		violations = append(violations, Violation{
+			Rule:    RuleWorkdayStart,
+			Limit:   open.Format("15:04"),
+			Actual:  start.In(loc).Format("15:04"),
+			Message: "Bookings may not start before " + open.Format("15:04") + " " + loc.String(),
+		})
+	}
+	if end.After(closing) {
+		actual := end.In(loc).Format("15:04")
+		if ey, em, ed := end.In(loc).Date(); ey != y || em != m || ed != d {
+			actual = end.In(loc).Format("2006-01-02 15:04")
+		}
+		violations = append(violations, Violation{
+			Rule:    RuleWorkdayEnd,
+			Limit:   closing.Format("15:04"),
+			Actual:  actual,
+			Message: "Bookings must end by " + closing.Format("15:04") + " " + loc.String(),
+		})
+	}
+	return violations
+}
+
+// OpenOn returns the working hours on the local day y-m-d and the rule setting
+// them: the newest rule in effect by the end of that day. rule is nil when no
+// rule covers the day yet.
+func (e Evaluator) OpenOn(y int, m time.Month, d int) (open, closing time.Time, rule *repository.BookingRule) {
+	loc := e.location()
+	rule = e.RuleAt(time.Date(y, m, d+1, 0, 0, 0, 0, loc).Add(-time.Nanosecond))
+	if rule == nil {
+		return time.Time{}, time.Time{}, nil
+	}
+	return ClockOn(y, m, d, rule.WorkdayStart, loc), ClockOn(y, m, d, rule.WorkdayEnd, loc), rule
+}
+
+func (e Evaluator) location() *time.Location {
+	if e.Location == nil {
+		return time.UTC
+	}
+	return e.Location
+}
+
+// ClockOn returns the wall-clock time offset from midnight on the given day, so
+// 09:00 stays 09:00 on days when daylight saving starts or ends
+func ClockOn(y int, m time.Month, d int, offset time.Duration, loc *time.Location) time.Time {
+	return time.Date(y, m, d, int(offset/time.Hour), int(offset%time.Hour/time.Minute), int(offset%time.Minute/time.Second), 0, loc)
+}
+
+// formatDuration renders whole minutes without trailing zero units, e.g. "4h", "1h30m", "15m"
+func formatDuration(d time.Duration) string {
+	s := d.Round(time.Minute).String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,172 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/repository"
+)
+
+func newYorkEvaluator(t *testing.T, rules ...repository.BookingRule) Evaluator {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	return Evaluator{Rules: rules, Location: loc}
+}
+
+func standardRule(from time.Time) repository.BookingRule {
+	return repository.BookingRule{
+		WorkdayStart:  9 * time.Hour,
+		WorkdayEnd:    18 * time.Hour,
+		MaxDuration:   4 * time.Hour,
+		MinLeadTime:   30 * time.Minute,
+		BufferBefore:  15 * time.Minute,
+		BufferAfter:   10 * time.Minute,
+		EffectiveFrom: from,
+	}
+}
+
+func rules(violations []Violation) []string {
+	var out []string
+	for _, v := range violations {
+		out = append(out, v.Rule)
+	}
+	return out
+}
+
+func TestEvaluator_Check(t *testing.T) {
+	now := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	ev := newYorkEvaluator(t, standardRule(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+	// 2024-03-05 14:00Z is 09:00 in New York
+	at := func(h, m int) time.Time { return time.Date(2024, 3, 5, h, m, 0, 0, time.UTC) }
+
+	assert.Empty(t, ev.Check(Booking{Start: at(14, 0), End: at(15, 0)}, nil, now))
+
+	got := ev.Check(Booking{Start: at(13, 0), End: at(14, 0)}, nil, now)
+	require.Equal(t, []string{RuleWorkdayStart}, rules(got))
+	assert.Equal(t, Violation{
+		Rule:    RuleWorkdayStart,
+		Limit:   "09:00",
+		Actual:  "08:00",
+		Message: "Bookings may not start before 09:00 America/New_York",
+	}, got[0])
+
+	got = ev.Check(Booking{Start: at(22, 0), End: at(23, 30)}, nil, now)
+	require.Equal(t, []string{RuleWorkdayEnd}, rules(got))
+	assert.Equal(t, "18:30", got[0].Actual)
+
+	got = ev.Check(Booking{Start: at(14, 0), End: at(19, 30)}, nil, now)
+	require.Equal(t, []string{RuleMaxDuration}, rules(got))
+	assert.Equal(t, "4h", got[0].Limit)
+	assert.Equal(t, "5h30m", got[0].Actual)
+
+	got = ev.Check(Booking{Start: at(15, 0), End: at(16, 0)}, nil, at(14, 50))
+	require.Equal(t, []string{RuleMinLeadTime}, rules(got))
+	assert.Equal(t, "10m", got[0].Actual)
+
+	got = ev.Check(Booking{Start: at(14, 0), End: at(15, 0), Recurring: true}, nil, now)
+	require.Equal(t, []string{RuleAllowRecurring}, rules(got))
+}
+
+func TestEvaluator_Check_Buffers(t *testing.T) {
+	now := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	ev := newYorkEvaluator(t, standardRule(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+	at := func(h, m int) time.Time { return time.Date(2024, 3, 5, h, m, 0, 0, time.UTC) }
+	others := []repository.Booking{
+		{ID: "a", Title: "Standup", StartsAt: at(15, 0), EndsAt: at(15, 30)},
+		{ID: "b", Title: "Overlap", StartsAt: at(16, 0), EndsAt: at(17, 0)},
+	}
+
+	// 12 minutes after Standup covers buffer_after (10m) but not buffer_before (15m)
+	got := ev.Check(Booking{Start: at(15, 42), End: at(15, 50)}, others[:1], now)
+	require.Equal(t, []string{RuleBufferBefore}, rules(got))
+	assert.Equal(t, "12m", got[0].Actual)
+	assert.Contains(t, got[0].Message, "Standup")
+
+	// Ending 5 minutes before Standup breaks only buffer_after
+	got = ev.Check(Booking{Start: at(14, 0), End: at(14, 55)}, others[:1], now)
+	require.Equal(t, []string{RuleBufferAfter}, rules(got))
+	assert.Contains(t, got[0].Message, "free after them")
+
+	assert.Empty(t, ev.Check(Booking{Start: at(16, 30), End: at(17, 30)}, others[1:], now), "overlaps are left to the conflict check")
+	assert.Empty(t, ev.Check(Booking{Start: at(17, 15), End: at(18, 0)}, others[1:], now))
+}
+
+func TestEvaluator_Check_AsymmetricBuffers(t *testing.T) {
+	now := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	rule := standardRule(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	rule.BufferBefore, rule.BufferAfter = 0, 15*time.Minute
+	ev := newYorkEvaluator(t, rule)
+	at := func(h, m int) time.Time { return time.Date(2024, 3, 5, h, m, 0, 0, time.UTC) }
+	standup := []repository.Booking{{ID: "a", Title: "Standup", StartsAt: at(15, 0), EndsAt: at(15, 30)}}
+
+	// Straight after Standup needs nothing free before it
+	assert.Empty(t, ev.Check(Booking{Start: at(15, 30), End: at(16, 0)}, standup, now))
+
+	// Ending 5 minutes before Standup breaks buffer_after alone
+	got := ev.Check(Booking{Start: at(14, 0), End: at(14, 55)}, standup, now)
+	require.Equal(t, []string{RuleBufferAfter}, rules(got))
+	assert.Equal(t, "15m", got[0].Limit)
+	assert.Equal(t, "5m", got[0].Actual)
+	assert.Equal(t, `Bookings need 15m free after them; "Standup" is 5m away`, got[0].Message)
+}
+
+func TestEvaluator_RulesChangeOverTime(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	longer := standardRule(time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC))
+	longer.WorkdayEnd = 20 * time.Hour
+	ev := newYorkEvaluator(t, standardRule(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)), longer)
+
+	// 19:00-19:30 New York, in daylight saving time (UTC-4)
+	march := Booking{Start: time.Date(2024, 3, 20, 23, 0, 0, 0, time.UTC), End: time.Date(2024, 3, 20, 23, 30, 0, 0, time.UTC)}
+	april := Booking{Start: time.Date(2024, 4, 20, 23, 0, 0, 0, time.UTC), End: time.Date(2024, 4, 20, 23, 30, 0, 0, time.UTC)}
+	assert.Equal(t, []string{RuleWorkdayEnd}, rules(ev.Check(march, nil, now)))
+	assert.Empty(t, ev.Check(april, nil, now), "the later rule applies from its effective_from")
+
+	before := Booking{Start: time.Date(2023, 12, 1, 3, 0, 0, 0, time.UTC), End: time.Date(2023, 12, 1, 4, 0, 0, 0, time.UTC)}
+	assert.Empty(t, ev.Check(before, nil, now), "bookings before any rule break nothing")
+
+	blockedBefore, blockedAfter := ev.Blocked(march.Start)
+	assert.Equal(t, 10*time.Minute, blockedBefore)
+	assert.Equal(t, 15*time.Minute, blockedAfter)
+	blockedBefore, blockedAfter = ev.Blocked(before.Start)
+	assert.Zero(t, blockedBefore)
+	assert.Zero(t, blockedAfter)
+	assert.Equal(t, 15*time.Minute, ev.Reach())
+}
+
+func TestEvaluator_Workday_DaylightSaving(t *testing.T) {
+	ev := newYorkEvaluator(t, standardRule(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	// Clocks go forward on 2024-03-10, so 09:00 local is 13:00Z rather than 14:00Z
+	assert.Empty(t, ev.Workday(time.Date(2024, 3, 10, 13, 0, 0, 0, time.UTC), time.Date(2024, 3, 10, 14, 0, 0, 0, time.UTC)))
+	assert.Equal(t, []string{RuleWorkdayStart}, rules(ev.Workday(time.Date(2024, 3, 9, 13, 0, 0, 0, time.UTC), time.Date(2024, 3, 9, 15, 0, 0, 0, time.UTC))))
+
+	open, closing, rule := ev.OpenOn(2024, time.March, 10)
+	require.NotNil(t, rule)
+	assert.Equal(t, time.Date(2024, 3, 10, 13, 0, 0, 0, time.UTC), open.UTC())
+	assert.Equal(t, time.Date(2024, 3, 10, 22, 0, 0, 0, time.UTC), closing.UTC())
+
+	// A booking running past midnight reports the day it ends on
+	got := ev.Workday(time.Date(2024, 3, 11, 20, 0, 0, 0, time.UTC), time.Date(2024, 3, 12, 5, 0, 0, 0, time.UTC))
+	require.Equal(t, []string{RuleWorkdayEnd}, rules(got))
+	assert.Equal(t, "2024-03-12 01:00", got[0].Actual)
+}
+
+func TestEvaluator_Check_Holidays(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	ev := newYorkEvaluator(t)
+	ev.Holidays = HolidayMap([]repository.Holiday{{Date: "2024-07-04", Description: "Independence Day"}})
+
+	// 2024-07-05 01:00Z is still 4 July in New York; with no rules only the holiday applies
+	got := ev.Check(Booking{Start: time.Date(2024, 7, 5, 1, 0, 0, 0, time.UTC), End: time.Date(2024, 7, 5, 2, 0, 0, 0, time.UTC)}, nil, now)
+	require.Equal(t, []string{RuleHoliday}, rules(got))
+	assert.Equal(t, "2024-07-04", got[0].Actual)
+	assert.Equal(t, "The office is closed on 2024-07-04 (Independence Day)", got[0].Message)
+
+	assert.Empty(t, ev.Check(Booking{Start: time.Date(2024, 7, 5, 14, 0, 0, 0, time.UTC), End: time.Date(2024, 7, 5, 15, 0, 0, 0, time.UTC)}, nil, now))
+	// Ending at midnight does not touch the next day
+	assert.Empty(t, ev.HolidayViolations(time.Date(2024, 7, 3, 23, 0, 0, 0, ev.Location), time.Date(2024, 7, 4, 0, 0, 0, 0, ev.Location)))
+}
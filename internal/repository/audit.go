@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// AuditLog is one row of audit_logs. Payload holds JSON text.
+type AuditLog struct {
+	ID          string
+	ActorUserID string
+	Action      string
+	EntityType  string
+	EntityID    string
+	Payload     string
+	CreatedAt   time.Time
+}
+
+// AuditFilter narrows ListAuditLogs; zero fields are ignored
+type AuditFilter struct {
+	ActorUserID string
+	Action      string
+	EntityType  string
+	EntityID    string
+	From        time.Time
+	To          time.Time
+	Limit       int
+	Offset      int
+}
+
+// AuditFunc returns the audit entries for a write; ids are the rows the write
+// created, in order, and empty for writes that create none. DecommissionRoom
+// passes the bookings it cancelled instead.
+type AuditFunc func(ids []string) []AuditLog
+
+type auditKey struct{}
+
+// pendingAudit is the AuditFunc a context carries until a write takes it
+type pendingAudit struct {
+	mu sync.Mutex
+	fn AuditFunc
+}
+
+// WithAudit returns a context under which the next Store write also records
+// the entries fn returns, in the same transaction, so a change and its audit
+// trail are saved or lost together. Only one write takes the entries; a write
+// that fails or changes nothing records none.
+func WithAudit(ctx context.Context, fn AuditFunc) context.Context {
+	return context.WithValue(ctx, auditKey{}, &pendingAudit{fn: fn})
+}
+
+// auditPending reports whether ctx carries audit entries no write has taken
+func auditPending(ctx context.Context) bool {
+	p, ok := ctx.Value(auditKey{}).(*pendingAudit)
+	if !ok {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.fn != nil
+}
+
+// errNoChange rolls back a statement that changed nothing, with its audit entries
+var errNoChange = errors.New("no rows changed")
+
+// TakeAudit removes and returns the AuditFunc pending on ctx, or nil. Store
+// implementations call it as they write.
+func TakeAudit(ctx context.Context) AuditFunc {
+	p, ok := ctx.Value(auditKey{}).(*pendingAudit)
+	if !ok {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fn := p.fn
+	p.fn = nil
+	return fn
+}
+
+// writeAudit records the entries of fn, if any, in tx
+func (r *Repository) writeAudit(ctx context.Context, tx *sql.Tx, fn AuditFunc, ids ...string) error {
+	if fn == nil {
+		return nil
+	}
+	for _, entry := range fn(ids) {
+		if _, err := r.insertAuditLog(ctx, tx, &entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// audited runs fn in a transaction that also records the audit entries
+// pending on ctx, if any; fn returns the ids of the rows it created
+func (r *Repository) audited(ctx context.Context, fn func(tx *sql.Tx) ([]string, error)) ([]string, error) {
+	audit := TakeAudit(ctx)
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	ids, err := fn(tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.writeAudit(ctx, tx, audit, ids...); err != nil {
+		return nil, err
+	}
+	return ids, tx.Commit()
+}
+
+// insert runs an INSERT through the dialect and returns the new row's id,
+// recording the audit entries pending on ctx with it
+func (r *Repository) insert(ctx context.Context, query string, args ...interface{}) (string, error) {
+	if !auditPending(ctx) {
+		return r.dialect.InsertReturningID(ctx, r.db, query, args...)
+	}
+	ids, err := r.audited(ctx, func(tx *sql.Tx) ([]string, error) {
+		id, err := r.dialect.InsertReturningID(ctx, tx, query, args...)
+		return []string{id}, err
+	})
+	if err != nil {
+		return "", err
+	}
+	return ids[0], nil
+}
+
+func (r *Repository) insertAuditLog(ctx context.Context, q queryRower, entry *AuditLog) (string, error) {
+	createdAt := entry.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	return r.dialect.InsertReturningID(ctx, q,
+		`INSERT INTO audit_logs(actor_user_id, action, entity_type, entity_id, payload_json, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		nullString(entry.ActorUserID), entry.Action, entry.EntityType, entry.EntityID,
+		nullString(entry.Payload), createdAt.UTC())
+}
+
+// CreateAuditLog appends an entry to the audit trail and returns its id
+func (r *Repository) CreateAuditLog(ctx context.Context, entry *AuditLog) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return r.insertAuditLog(ctx, r.db, entry)
+}
+
+// ListAuditLogs returns matching entries, newest first
+func (r *Repository) ListAuditLogs(ctx context.Context, filter AuditFilter) ([]AuditLog, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	query := `SELECT id, actor_user_id, action, entity_type, entity_id, CAST(payload_json AS TEXT), created_at
+		FROM audit_logs WHERE 1 = 1`
+	var args []interface{}
+	for _, c := range []struct {
+		column string
+		value  string
+	}{
+		{"actor_user_id", filter.ActorUserID},
+		{"action", filter.Action},
+		{"entity_type", filter.EntityType},
+		{"entity_id", filter.EntityID},
+	} {
+		if c.value != "" {
+			query += " AND " + c.column + " = ?"
+			args = append(args, c.value)
+		}
+	}
+	if !filter.From.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, filter.To.UTC())
+	}
+	query += " ORDER BY created_at DESC, id"
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := r.query(ctx, query, args...)
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	defer rows.Close()
+	var out []AuditLog
+	for rows.Next() {
+		var e AuditLog
+		var actor, payload sql.NullString
+		if err := rows.Scan(&e.ID, &actor, &e.Action, &e.EntityType, &e.EntityID, &payload, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.ActorUserID = actor.String
+		e.Payload = payload.String
+		e.CreatedAt = e.CreatedAt.UTC()
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
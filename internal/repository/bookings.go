@@ -0,0 +1,638 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Booking statuses stored in bookings.status
+const (
+	BookingStatusActive    = "active"
+	BookingStatusCancelled = "cancelled"
+)
+
+// Booking is a row of the bookings table. Times are always UTC.
+//
+// Each occurrence of a recurring booking is a row of its own carrying the
+// series' RRule. SeriesID is the id of the series' first occurrence and
+// RecurrenceID the start the rule gave the occurrence; both are empty for
+// one-off bookings.
+//
+// Participants, when not nil, replace the booking's attendees in the same
+// transaction as a write saves the booking, as SetParticipants would. Reads
+// leave it nil.
+//
+// BufferBefore and BufferAfter are the free time CreateBooking and
+// UpdateBooking keep, under the room's booking lock, between the booking and
+// the active bookings before and after it; they are not saved.
+type Booking struct {
+	ID              string
+	RoomID          string
+	CreatedBy       string
+	Title           string
+	Description     string
+	StartsAt        time.Time
+	EndsAt          time.Time
+	RRule           string
+	Status          string
+	ExternalEventID string
+	SeriesID        string
+	RecurrenceID    time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Participants    []Participant
+	BufferBefore    time.Duration
+	BufferAfter     time.Duration
+}
+
+const bookingColumns = "id, room_id, created_by, title, description, starts_at_utc, ends_at_utc, rrule, status, external_event_id, series_id, recurrence_id, created_at, updated_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBooking(s rowScanner) (*Booking, error) {
+	var b Booking
+	var roomID, createdBy, description, rrule, status, externalID, seriesID sql.NullString
+	var recurrenceID, createdAt, updatedAt sql.NullTime
+	err := s.Scan(&b.ID, &roomID, &createdBy, &b.Title, &description, &b.StartsAt, &b.EndsAt, &rrule, &status, &externalID,
+		&seriesID, &recurrenceID, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	b.RoomID = roomID.String
+	b.CreatedBy = createdBy.String
+	b.Description = description.String
+	b.RRule = rrule.String
+	b.Status = status.String
+	b.ExternalEventID = externalID.String
+	b.SeriesID = seriesID.String
+	if recurrenceID.Valid {
+		b.RecurrenceID = recurrenceID.Time.UTC()
+	}
+	b.StartsAt = b.StartsAt.UTC()
+	b.EndsAt = b.EndsAt.UTC()
+	if createdAt.Valid {
+		b.CreatedAt = createdAt.Time.UTC()
+	}
+	if updatedAt.Valid {
+		b.UpdatedAt = updatedAt.Time.UTC()
+	}
+	return &b, nil
+}
+
+// nullString maps an empty string to SQL NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullTime maps the zero time to SQL NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+// ErrBookingConflict is returned when a booking overlaps an active booking in the same room
+var ErrBookingConflict = errors.New("booking conflicts with an existing booking")
+
+// ErrBufferTaken is returned when a booking would leave less than its
+// BufferBefore or BufferAfter free between it and another
+var ErrBufferTaken = errors.New("booking is too close to another booking")
+
+// ConflictError carries the active bookings that block the requested slot
+type ConflictError struct {
+	Conflicts []Booking
+}
+
+func (e *ConflictError) Error() string {
+	return ErrBookingConflict.Error()
+}
+
+func (e *ConflictError) Unwrap() error {
+	return ErrBookingConflict
+}
+
+// OccurrenceConflict is a blocked occurrence of a series and the bookings in its way
+type OccurrenceConflict struct {
+	StartsAt  time.Time
+	EndsAt    time.Time
+	Conflicts []Booking
+}
+
+// SeriesConflictError carries every blocked occurrence when several bookings
+// are written together
+type SeriesConflictError struct {
+	Occurrences []OccurrenceConflict
+}
+
+func (e *SeriesConflictError) Error() string {
+	return ErrBookingConflict.Error()
+}
+
+func (e *SeriesConflictError) Unwrap() error {
+	return ErrBookingConflict
+}
+
+// CreateBooking inserts a new active booking and returns its id.
+// It fails with a *ConflictError if the room is already booked for any part of the slot.
+func (r *Repository) CreateBooking(ctx context.Context, b *Booking) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	status := b.Status
+	if status == "" {
+		status = BookingStatusActive
+	}
+	ids, err := r.withBookingLock(ctx, b.RoomID, func(tx *sql.Tx) ([]string, error) {
+		if status == BookingStatusActive {
+			if err := r.checkConflicts(ctx, tx, b.RoomID, b.StartsAt, b.EndsAt, ""); err != nil {
+				return nil, err
+			}
+			if err := r.checkBuffers(ctx, tx, b, ""); err != nil {
+				return nil, err
+			}
+		}
+		id, err := r.insertBooking(ctx, tx, b, status)
+		if err != nil {
+			return nil, err
+		}
+		return []string{id}, r.writeParticipants(ctx, tx, id, b.Participants)
+	})
+	if err != nil {
+		return "", r.bookingWriteError(ctx, err, b.RoomID, b.StartsAt, b.EndsAt, "")
+	}
+	return ids[0], nil
+}
+
+func (r *Repository) insertBooking(ctx context.Context, tx *sql.Tx, b *Booking, status string) (string, error) {
+	return r.dialect.InsertReturningID(ctx, tx,
+		`INSERT INTO bookings(room_id, created_by, title, description, starts_at_utc, ends_at_utc, rrule, status, series_id, recurrence_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		b.RoomID, nullString(b.CreatedBy), b.Title, nullString(b.Description),
+		b.StartsAt.UTC(), b.EndsAt.UTC(), nullString(b.RRule), status, nullString(b.SeriesID), nullTime(b.RecurrenceID))
+}
+
+// CreateBookingSeries inserts the occurrences of a recurring booking, all in
+// one room, and returns their ids in order. Each gets the first one's id as
+// SeriesID. If any occurrence is blocked nothing is inserted and a
+// *SeriesConflictError lists every blocked occurrence.
+func (r *Repository) CreateBookingSeries(ctx context.Context, occurrences []Booking) ([]string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	roomID, err := seriesRoom(occurrences)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := r.withBookingLock(ctx, roomID, func(tx *sql.Tx) ([]string, error) {
+		if err := r.checkSeriesConflicts(ctx, tx, occurrences); err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(occurrences))
+		for _, b := range occurrences {
+			b.SeriesID = ""
+			if len(ids) > 0 {
+				b.SeriesID = ids[0]
+			}
+			status := b.Status
+			if status == "" {
+				status = BookingStatusActive
+			}
+			id, err := r.insertBooking(ctx, tx, &b, status)
+			if err != nil {
+				return nil, err
+			}
+			if err := r.writeParticipants(ctx, tx, id, b.Participants); err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		// The first occurrence's id only exists once it is inserted
+		_, err := tx.ExecContext(ctx, r.dialect.Rebind("UPDATE bookings SET series_id = ? WHERE id = ?"), ids[0], ids[0])
+		return ids, err
+	})
+	if err != nil {
+		return nil, r.seriesWriteError(ctx, err, occurrences)
+	}
+	return ids, nil
+}
+
+// seriesRoom returns the room shared by the occurrences of a new series
+func seriesRoom(bookings []Booking) (string, error) {
+	if len(bookings) == 0 {
+		return "", errors.New("no bookings to write")
+	}
+	for _, b := range bookings[1:] {
+		if b.RoomID != bookings[0].RoomID {
+			return "", errors.New("the occurrences of a series must share a room")
+		}
+	}
+	return bookings[0].RoomID, nil
+}
+
+// checkSeriesConflicts returns a *SeriesConflictError if any active booking in
+// the batch overlaps another active booking, in the database or in the batch.
+// Database rows that are part of the batch are judged by their new times.
+func (r *Repository) checkSeriesConflicts(ctx context.Context, q queryer, bookings []Booking) error {
+	inBatch := map[string]bool{}
+	for _, b := range bookings {
+		if b.ID != "" {
+			inBatch[b.ID] = true
+		}
+	}
+	var blocked []OccurrenceConflict
+	for i, b := range bookings {
+		if b.Status != "" && b.Status != BookingStatusActive {
+			continue
+		}
+		found, err := r.overlapping(ctx, q, b.RoomID, b.StartsAt, b.EndsAt, "")
+		if err != nil {
+			return err
+		}
+		var conflicts []Booking
+		for _, c := range found {
+			if !inBatch[c.ID] {
+				conflicts = append(conflicts, c)
+			}
+		}
+		for j, o := range bookings {
+			active := o.Status == "" || o.Status == BookingStatusActive
+			if j != i && active && o.RoomID == b.RoomID && o.StartsAt.Before(b.EndsAt) && o.EndsAt.After(b.StartsAt) {
+				conflicts = append(conflicts, o)
+			}
+		}
+		if len(conflicts) > 0 {
+			blocked = append(blocked, OccurrenceConflict{StartsAt: b.StartsAt, EndsAt: b.EndsAt, Conflicts: conflicts})
+		}
+	}
+	if len(blocked) > 0 {
+		return &SeriesConflictError{Occurrences: blocked}
+	}
+	return nil
+}
+
+// seriesWriteError maps the database rejecting an overlap in a batch write to
+// a *SeriesConflictError, like bookingWriteError does for single bookings
+func (r *Repository) seriesWriteError(ctx context.Context, err error, bookings []Booking) error {
+	if err == nil || !r.dialect.IsConflict(err) {
+		return err
+	}
+	if cerr := r.checkSeriesConflicts(ctx, r.db, bookings); cerr != nil {
+		return cerr
+	}
+	return &SeriesConflictError{}
+}
+
+// withBookingLock runs fn in a transaction holding the room's booking lock.
+// The transaction records the audit entries pending on ctx; fn returns the
+// ids of the bookings it created.
+func (r *Repository) withBookingLock(ctx context.Context, roomID string, fn func(tx *sql.Tx) ([]string, error)) ([]string, error) {
+	return r.withBookingLocks(ctx, []string{roomID}, fn)
+}
+
+// withBookingLocks is withBookingLock for writes touching several rooms. The
+// rooms are locked in id order so concurrent writers cannot deadlock.
+func (r *Repository) withBookingLocks(ctx context.Context, roomIDs []string, fn func(tx *sql.Tx) ([]string, error)) ([]string, error) {
+	if r.dialect.SerializeWrites() {
+		r.bookingMu.Lock()
+		defer r.bookingMu.Unlock()
+	}
+	rooms := append([]string(nil), roomIDs...)
+	sort.Strings(rooms)
+	return r.audited(ctx, func(tx *sql.Tx) ([]string, error) {
+		for i, roomID := range rooms {
+			if i > 0 && roomID == rooms[i-1] {
+				continue
+			}
+			if err := r.dialect.LockRoom(ctx, tx, roomID); err != nil {
+				return nil, err
+			}
+		}
+		return fn(tx)
+	})
+}
+
+// checkConflicts returns a *ConflictError if active bookings in the room overlap [start, end).
+// excludeID skips the booking being moved.
+func (r *Repository) checkConflicts(ctx context.Context, tx *sql.Tx, roomID string, start, end time.Time, excludeID string) error {
+	conflicts, err := r.overlapping(ctx, tx, roomID, start, end, excludeID)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return &ConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (r *Repository) overlapping(ctx context.Context, q queryer, roomID string, start, end time.Time, excludeID string) ([]Booking, error) {
+	query := "SELECT " + bookingColumns + ` FROM bookings
+		WHERE room_id = ? AND status = ? AND starts_at_utc < ? AND ends_at_utc > ?`
+	args := []interface{}{roomID, BookingStatusActive, end.UTC(), start.UTC()}
+	if excludeID != "" {
+		query += " AND id <> ?"
+		args = append(args, excludeID)
+	}
+	rows, err := q.QueryContext(ctx, r.dialect.Rebind(query+" ORDER BY starts_at_utc"), args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanBookings(rows)
+}
+
+// checkBuffers returns ErrBufferTaken if an active booking in b's room, other
+// than excludeID, ends less than b.BufferBefore before b starts or starts less
+// than b.BufferAfter after it ends. Overlaps are left to checkConflicts.
+func (r *Repository) checkBuffers(ctx context.Context, tx *sql.Tx, b *Booking, excludeID string) error {
+	if b.BufferBefore <= 0 && b.BufferAfter <= 0 {
+		return nil
+	}
+	near, err := r.overlapping(ctx, tx, b.RoomID, b.StartsAt.Add(-b.BufferBefore), b.EndsAt.Add(b.BufferAfter), excludeID)
+	if err != nil {
+		return err
+	}
+	if len(near) > 0 {
+		return ErrBufferTaken
+	}
+	return nil
+}
+
+func scanBookings(rows *sql.Rows) ([]Booking, error) {
+	defer rows.Close()
+	var out []Booking
+	for rows.Next() {
+		b, err := scanBooking(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *b)
+	}
+	return out, rows.Err()
+}
+
+// bookingWriteError maps the database rejecting an overlap, raised when a concurrent
+// writer won the race, to a *ConflictError listing the bookings now in the way
+func (r *Repository) bookingWriteError(ctx context.Context, err error, roomID string, start, end time.Time, excludeID string) error {
+	if err == nil || !r.dialect.IsConflict(err) {
+		return err
+	}
+	conflicts, qerr := r.overlapping(ctx, r.db, roomID, start, end, excludeID)
+	if qerr != nil {
+		return &ConflictError{}
+	}
+	return &ConflictError{Conflicts: conflicts}
+}
+
+// GetBooking fetches a single booking by id
+func (r *Repository) GetBooking(ctx context.Context, id string) (*Booking, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	b, err := scanBooking(r.queryRow(ctx, "SELECT "+bookingColumns+" FROM bookings WHERE id = ?", id))
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	return b, nil
+}
+
+// ListBookingsByRoom returns the active bookings of a room overlapping [from, to).
+// A zero from or to leaves that side of the range open.
+func (r *Repository) ListBookingsByRoom(ctx context.Context, roomID string, from, to time.Time) ([]Booking, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	query := "SELECT " + bookingColumns + " FROM bookings WHERE room_id = ? AND status = ?"
+	args := []interface{}{roomID, BookingStatusActive}
+	if !to.IsZero() {
+		query += " AND starts_at_utc < ?"
+		args = append(args, to.UTC())
+	}
+	if !from.IsZero() {
+		query += " AND ends_at_utc > ?"
+		args = append(args, from.UTC())
+	}
+	rows, err := r.query(ctx, query+" ORDER BY starts_at_utc", args...)
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	return scanBookings(rows)
+}
+
+// ListBookingsByOffice returns the active bookings in every room of an office
+// overlapping [from, to), decommissioned rooms included. Zero bounds are open.
+func (r *Repository) ListBookingsByOffice(ctx context.Context, officeID string, from, to time.Time) ([]Booking, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	query := "SELECT " + bookingColumns + ` FROM bookings WHERE status = ? AND room_id IN
+		(SELECT r.id FROM rooms r JOIN floors f ON f.id = r.floor_id WHERE f.office_id = ?)`
+	args := []interface{}{BookingStatusActive, officeID}
+	if !to.IsZero() {
+		query += " AND starts_at_utc < ?"
+		args = append(args, to.UTC())
+	}
+	if !from.IsZero() {
+		query += " AND ends_at_utc > ?"
+		args = append(args, from.UTC())
+	}
+	rows, err := r.query(ctx, query+" ORDER BY starts_at_utc, id", args...)
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	return scanBookings(rows)
+}
+
+// ListBookingsStarting returns the active bookings of every room starting in
+// [from, to), ordered by start
+func (r *Repository) ListBookingsStarting(ctx context.Context, from, to time.Time) ([]Booking, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.query(ctx, "SELECT "+bookingColumns+` FROM bookings WHERE status = ? AND starts_at_utc >= ? AND starts_at_utc < ?
+		ORDER BY starts_at_utc, id`, BookingStatusActive, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	return scanBookings(rows)
+}
+
+// UpdateBooking saves the editable fields of a booking.
+// Moving an active booking onto an occupied slot fails with a *ConflictError.
+func (r *Repository) UpdateBooking(ctx context.Context, b *Booking) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.withBookingLock(ctx, b.RoomID, func(tx *sql.Tx) ([]string, error) {
+		if b.Status == "" || b.Status == BookingStatusActive {
+			if err := r.checkConflicts(ctx, tx, b.RoomID, b.StartsAt, b.EndsAt, b.ID); err != nil {
+				return nil, err
+			}
+			if err := r.checkBuffers(ctx, tx, b, b.ID); err != nil {
+				return nil, err
+			}
+		}
+		res, err := tx.ExecContext(ctx, r.dialect.Rebind(`UPDATE bookings SET room_id = ?, title = ?, description = ?,
+			starts_at_utc = ?, ends_at_utc = ?, rrule = ?, updated_at = ? WHERE id = ?`),
+			b.RoomID, b.Title, nullString(b.Description), b.StartsAt.UTC(), b.EndsAt.UTC(),
+			nullString(b.RRule), time.Now().UTC(), b.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := expectAffected(res); err != nil {
+			return nil, err
+		}
+		return nil, r.writeParticipants(ctx, tx, b.ID, b.Participants)
+	})
+	return r.lookupErr(r.bookingWriteError(ctx, err, b.RoomID, b.StartsAt, b.EndsAt, b.ID))
+}
+
+// UpdateBookings saves several bookings at once, such as the occurrences of a
+// series moved together, including their status and series fields. Either all
+// are saved or none; if any active booking would be blocked a
+// *SeriesConflictError lists every blocked one.
+func (r *Repository) UpdateBookings(ctx context.Context, bookings []Booking) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	if len(bookings) == 0 {
+		return nil
+	}
+	rooms := make([]string, 0, len(bookings))
+	for _, b := range bookings {
+		rooms = append(rooms, b.RoomID)
+	}
+	_, err := r.withBookingLocks(ctx, rooms, func(tx *sql.Tx) ([]string, error) {
+		if err := r.checkSeriesConflicts(ctx, tx, bookings); err != nil {
+			return nil, err
+		}
+		// Park the rows first so one moving onto another's old slot does not
+		// trip the database's overlap check halfway through
+		for _, b := range bookings {
+			res, err := tx.ExecContext(ctx, r.dialect.Rebind("UPDATE bookings SET status = ? WHERE id = ?"), BookingStatusCancelled, b.ID)
+			if err != nil {
+				return nil, err
+			}
+			if err := expectAffected(res); err != nil {
+				return nil, err
+			}
+		}
+		now := time.Now().UTC()
+		for _, b := range bookings {
+			status := b.Status
+			if status == "" {
+				status = BookingStatusActive
+			}
+			_, err := tx.ExecContext(ctx, r.dialect.Rebind(`UPDATE bookings SET room_id = ?, title = ?, description = ?,
+				starts_at_utc = ?, ends_at_utc = ?, rrule = ?, status = ?, series_id = ?, recurrence_id = ?, updated_at = ? WHERE id = ?`),
+				b.RoomID, b.Title, nullString(b.Description), b.StartsAt.UTC(), b.EndsAt.UTC(), nullString(b.RRule),
+				status, nullString(b.SeriesID), nullTime(b.RecurrenceID), now, b.ID)
+			if err != nil {
+				return nil, err
+			}
+			if err := r.writeParticipants(ctx, tx, b.ID, b.Participants); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	return r.lookupErr(r.seriesWriteError(ctx, err, bookings))
+}
+
+// ListRoomCalendar returns every booking of a room ending after since,
+// cancelled ones included, ordered by start
+func (r *Repository) ListRoomCalendar(ctx context.Context, roomID string, since time.Time) ([]Booking, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.query(ctx, "SELECT "+bookingColumns+" FROM bookings WHERE room_id = ? AND ends_at_utc > ? ORDER BY starts_at_utc, id", roomID, since.UTC())
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	return scanBookings(rows)
+}
+
+// ListUserCalendar returns every booking a user made or is invited to by
+// email that ends after since, cancelled ones included, ordered by start
+func (r *Repository) ListUserCalendar(ctx context.Context, userID, email string, since time.Time) ([]Booking, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.query(ctx, "SELECT "+bookingColumns+` FROM bookings WHERE ends_at_utc > ? AND (created_by = ?
+		OR id IN (SELECT booking_id FROM booking_participants WHERE email = ?)) ORDER BY starts_at_utc, id`,
+		since.UTC(), userID, strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	return scanBookings(rows)
+}
+
+// ListBookingSeries returns every occurrence of a series, cancelled ones
+// included, in the order the rule gives them
+func (r *Repository) ListBookingSeries(ctx context.Context, seriesID string) ([]Booking, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.query(ctx, "SELECT "+bookingColumns+" FROM bookings WHERE series_id = ? ORDER BY recurrence_id, starts_at_utc, id", seriesID)
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	return scanBookings(rows)
+}
+
+// CancelBookings cancels several bookings at once; either all are cancelled or none
+func (r *Repository) CancelBookings(ctx context.Context, ids []string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.audited(ctx, func(tx *sql.Tx) ([]string, error) {
+		return nil, r.cancelBookings(ctx, tx, ids)
+	})
+	return r.lookupErr(err)
+}
+
+// cancelBookings cancels the bookings ids in tx, failing with sql.ErrNoRows
+// if any is missing
+func (r *Repository) cancelBookings(ctx context.Context, tx *sql.Tx, ids []string) error {
+	now := time.Now().UTC()
+	for _, id := range ids {
+		res, err := tx.ExecContext(ctx, r.dialect.Rebind("UPDATE bookings SET status = ?, updated_at = ? WHERE id = ?"),
+			BookingStatusCancelled, now, id)
+		if err != nil {
+			return err
+		}
+		if err := expectAffected(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CancelBooking marks a booking as cancelled; the row is kept for history
+func (r *Repository) CancelBooking(ctx context.Context, id string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.exec(ctx, "UPDATE bookings SET status = ?, updated_at = ? WHERE id = ?",
+		BookingStatusCancelled, time.Now().UTC(), id)
+	if err != nil {
+		return r.lookupErr(err)
+	}
+	return expectAffected(res)
+}
+
+// SetBookingExternalEventID records the id of the calendar event mirroring a booking
+func (r *Repository) SetBookingExternalEventID(ctx context.Context, id, externalID string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.exec(ctx, "UPDATE bookings SET external_event_id = ? WHERE id = ?", externalID, id)
+	if err != nil {
+		return r.lookupErr(err)
+	}
+	return expectAffected(res)
+}
+
+// expectAffected turns an update that matched no rows into sql.ErrNoRows
+func expectAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/migrate"
+	"roombooker/migrations"
+)
+
+// newBookingsTestRepo returns a repository over a SQLite file database with
+// the embedded schema and demo data applied, whose rooms the tests book
+func newBookingsTestRepo(t *testing.T) *Repository {
+	return newBookingsTestRepos(t, 1)[0]
+}
+
+// newBookingsTestRepos returns n repositories sharing one database file, as
+// n server processes would
+func newBookingsTestRepos(t *testing.T, n int) []*Repository {
+	// A file database gives the pool real concurrent connections
+	dsn := "file:" + filepath.Join(t.TempDir(), "bookings.db") + "?_busy_timeout=5000&_fk=1"
+	var repos []*Repository
+	for i := 0; i < n; i++ {
+		db, err := sql.Open("sqlite3", dsn)
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		if i == 0 {
+			fsys, err := migrations.ForDriver("sqlite3")
+			require.NoError(t, err)
+			m, err := migrate.New(db, "sqlite3", fsys)
+			require.NoError(t, err)
+			_, err = m.Up(context.Background())
+			require.NoError(t, err)
+		}
+		repos = append(repos, New(db, "sqlite3"))
+	}
+	return repos
+}
+
+func TestRepository_CreateAndGetBooking(t *testing.T) {
+	repo := newBookingsTestRepo(t)
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	id, err := repo.CreateBooking(context.Background(), &Booking{
+		RoomID:    "room-101",
+		CreatedBy: "user-regular",
+		Title:     "Standup",
+		StartsAt:  start,
+		EndsAt:    start.Add(30 * time.Minute),
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	b, err := repo.GetBooking(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, "room-101", b.RoomID)
+	assert.Equal(t, "user-regular", b.CreatedBy)
+	assert.Equal(t, "Standup", b.Title)
+	assert.Equal(t, BookingStatusActive, b.Status)
+	assert.True(t, start.Equal(b.StartsAt))
+	assert.True(t, start.Add(30*time.Minute).Equal(b.EndsAt))
+}
+
+func TestRepository_GetBooking_NotFound(t *testing.T) {
+	repo := newBookingsTestRepo(t)
+
+	b, err := repo.GetBooking(context.Background(), "missing")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.Nil(t, b)
+}
+
+func TestRepository_ListBookingsByRoom(t *testing.T) {
+	repo := newBookingsTestRepo(t)
+	day := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	for _, h := range []int{9, 11, 14} {
+		_, err := repo.CreateBooking(context.Background(), &Booking{
+			RoomID:   "room-101",
+			Title:    "Meeting",
+			StartsAt: day.Add(time.Duration(h) * time.Hour),
+			EndsAt:   day.Add(time.Duration(h+1) * time.Hour),
+		})
+		require.NoError(t, err)
+	}
+	_, err := repo.CreateBooking(context.Background(), &Booking{
+		RoomID:   "room-102",
+		Title:    "Other room",
+		StartsAt: day.Add(11 * time.Hour),
+		EndsAt:   day.Add(12 * time.Hour),
+	})
+	require.NoError(t, err)
+
+	all, err := repo.ListBookingsByRoom(context.Background(), "room-101", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	// 09:30-11:30 overlaps the 09:00 and 11:00 bookings only
+	ranged, err := repo.ListBookingsByRoom(context.Background(), "room-101", day.Add(9*time.Hour+30*time.Minute), day.Add(11*time.Hour+30*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, ranged, 2)
+	assert.Equal(t, 9, ranged[0].StartsAt.Hour())
+	assert.Equal(t, 11, ranged[1].StartsAt.Hour())
+
+	// Bookings touching the range edge are not included
+	edge, err := repo.ListBookingsByRoom(context.Background(), "room-101", day.Add(10*time.Hour), day.Add(11*time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, edge, 0)
+}
+
+func TestRepository_UpdateAndCancelBooking(t *testing.T) {
+	repo := newBookingsTestRepo(t)
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	id, err := repo.CreateBooking(context.Background(), &Booking{RoomID: "room-101", Title: "Draft", StartsAt: start, EndsAt: start.Add(time.Hour)})
+	require.NoError(t, err)
+
+	b, err := repo.GetBooking(context.Background(), id)
+	require.NoError(t, err)
+	b.Title = "Final"
+	b.StartsAt = start.Add(2 * time.Hour)
+	b.EndsAt = start.Add(3 * time.Hour)
+	require.NoError(t, repo.UpdateBooking(context.Background(), b))
+
+	updated, err := repo.GetBooking(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, "Final", updated.Title)
+	assert.Equal(t, 12, updated.StartsAt.Hour())
+
+	require.NoError(t, repo.CancelBooking(context.Background(), id))
+	cancelled, err := repo.GetBooking(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, BookingStatusCancelled, cancelled.Status)
+
+	listed, err := repo.ListBookingsByRoom(context.Background(), "room-101", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, listed, 0)
+
+	assert.ErrorIs(t, repo.CancelBooking(context.Background(), "missing"), sql.ErrNoRows)
+}
+
+func TestRepository_CreateBooking_Conflict(t *testing.T) {
+	repo := newBookingsTestRepo(t)
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	firstID, err := repo.CreateBooking(context.Background(), &Booking{RoomID: "room-101", Title: "First", StartsAt: start, EndsAt: start.Add(time.Hour)})
+	require.NoError(t, err)
+
+	_, err = repo.CreateBooking(context.Background(), &Booking{RoomID: "room-101", Title: "Overlap", StartsAt: start.Add(30 * time.Minute), EndsAt: start.Add(90 * time.Minute)})
+	require.ErrorIs(t, err, ErrBookingConflict)
+	var conflict *ConflictError
+	require.True(t, errors.As(err, &conflict))
+	require.Len(t, conflict.Conflicts, 1)
+	assert.Equal(t, firstID, conflict.Conflicts[0].ID)
+
+	// Back-to-back slots and other rooms are fine
+	_, err = repo.CreateBooking(context.Background(), &Booking{RoomID: "room-101", Title: "Next", StartsAt: start.Add(time.Hour), EndsAt: start.Add(2 * time.Hour)})
+	assert.NoError(t, err)
+	_, err = repo.CreateBooking(context.Background(), &Booking{RoomID: "room-102", Title: "Elsewhere", StartsAt: start, EndsAt: start.Add(time.Hour)})
+	assert.NoError(t, err)
+
+	// A cancelled booking no longer blocks the slot
+	require.NoError(t, repo.CancelBooking(context.Background(), firstID))
+	_, err = repo.CreateBooking(context.Background(), &Booking{RoomID: "room-101", Title: "Rebooked", StartsAt: start, EndsAt: start.Add(time.Hour)})
+	assert.NoError(t, err)
+}
+
+func TestRepository_UpdateBooking_Conflict(t *testing.T) {
+	repo := newBookingsTestRepo(t)
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	_, err := repo.CreateBooking(context.Background(), &Booking{RoomID: "room-101", Title: "Fixed", StartsAt: start, EndsAt: start.Add(time.Hour)})
+	require.NoError(t, err)
+	movingID, err := repo.CreateBooking(context.Background(), &Booking{RoomID: "room-101", Title: "Moving", StartsAt: start.Add(2 * time.Hour), EndsAt: start.Add(3 * time.Hour)})
+	require.NoError(t, err)
+
+	moving, err := repo.GetBooking(context.Background(), movingID)
+	require.NoError(t, err)
+
+	// Extending a booking over its own slot is not a conflict
+	moving.EndsAt = start.Add(4 * time.Hour)
+	require.NoError(t, repo.UpdateBooking(context.Background(), moving))
+
+	moving.StartsAt = start.Add(30 * time.Minute)
+	assert.ErrorIs(t, repo.UpdateBooking(context.Background(), moving), ErrBookingConflict)
+}
+
+func TestRepository_CreateBooking_ConcurrentSameSlot(t *testing.T) {
+	raceForSlot(t, newBookingsTestRepos(t, 1))
+}
+
+func TestRepository_CreateBooking_ConcurrentProcesses(t *testing.T) {
+	// Each repository has its own in-process lock, so only the database's
+	// write lock keeps them apart
+	raceForSlot(t, newBookingsTestRepos(t, 3))
+}
+
+// raceForSlot has many workers spread over repos book overlapping slots of
+// room-101 at once, and checks exactly one gets it and the rest are told of
+// the conflict
+func raceForSlot(t *testing.T, repos []*Repository) {
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	const workers = 25
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created, conflicts := 0, 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Every worker asks for a slot overlapping 10:00-11:00
+			offset := time.Duration(i%4) * 15 * time.Minute
+			_, err := repos[i%len(repos)].CreateBooking(context.Background(), &Booking{RoomID: "room-101", Title: "Race", StartsAt: start.Add(offset), EndsAt: start.Add(offset + time.Hour)})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				created++
+			case errors.Is(err, ErrBookingConflict):
+				conflicts++
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, created)
+	assert.Equal(t, workers-1, conflicts)
+	stored, err := repos[0].ListBookingsByRoom(context.Background(), "room-101", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, stored, 1)
+}
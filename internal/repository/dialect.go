@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Dialect hides the SQL differences between database drivers. Repository
+// queries are written once with ? placeholders and rebound by the dialect.
+type Dialect interface {
+	// Rebind rewrites ? placeholders into the driver's bind syntax
+	Rebind(query string) string
+	// InsertReturningID runs an INSERT and returns the id the database generated for the row
+	InsertReturningID(ctx context.Context, q queryRower, query string, args ...interface{}) (string, error)
+	// LockRoom serialises booking writes for a room inside tx
+	LockRoom(ctx context.Context, tx *sql.Tx, roomID string) error
+	// SerializeWrites reports whether booking writes also need an in-process lock
+	SerializeWrites() bool
+	// IsConflict reports whether err is the database rejecting overlapping bookings
+	IsConflict(err error) bool
+	// IsDuplicate reports whether err is a unique index rejecting a row
+	IsDuplicate(err error) bool
+	// IsInvalidID reports whether err means an id could never match a row (e.g. a malformed uuid)
+	IsInvalidID(err error) bool
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+var (
+	dialectsMu sync.RWMutex
+	dialects   = map[string]Dialect{
+		"sqlite3":  sqliteDialect{},
+		"postgres": postgresDialect{},
+	}
+)
+
+// RegisterDialect makes a dialect available to New for the given driver name
+func RegisterDialect(driver string, d Dialect) {
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	dialects[driver] = d
+}
+
+// dialectFor returns the dialect registered for driver, defaulting to PostgreSQL syntax
+func dialectFor(driver string) Dialect {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	if d, ok := dialects[driver]; ok {
+		return d
+	}
+	return postgresDialect{}
+}
+
+// sqliteDialect targets mattn/go-sqlite3. SQLite has no row locks or range
+// constraints, so booking writes take the database's write lock before they
+// check for overlaps, and are also serialised in-process so that writers in
+// one server queue in Go rather than in the busy timeout.
+type sqliteDialect struct{}
+
+func (sqliteDialect) Rebind(query string) string { return query }
+
+func (sqliteDialect) InsertReturningID(ctx context.Context, q queryRower, query string, args ...interface{}) (string, error) {
+	var id string
+	err := q.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+// LockRoom takes the write lock of the whole database, as BEGIN IMMEDIATE
+// would, by writing before tx reads anything. Writers in other processes wait
+// for it up to the busy timeout, then see this one's bookings.
+func (sqliteDialect) LockRoom(ctx context.Context, tx *sql.Tx, roomID string) error {
+	_, err := tx.ExecContext(ctx, "UPDATE rooms SET name = name WHERE id = ?", roomID)
+	return err
+}
+
+func (sqliteDialect) SerializeWrites() bool { return true }
+
+func (sqliteDialect) IsConflict(err error) bool { return false }
+
+func (sqliteDialect) IsDuplicate(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+func (sqliteDialect) IsInvalidID(err error) bool { return false }
+
+// postgresDialect targets lib/pq
+type postgresDialect struct{}
+
+const (
+	// pgExclusionViolation is the SQLSTATE raised by the bookings EXCLUDE constraint
+	pgExclusionViolation = "23P01"
+	// pgInvalidTextRepresentation is raised when a non-uuid string is compared to a uuid column
+	pgInvalidTextRepresentation = "22P02"
+	// pgUniqueViolation is raised when a row breaks a unique index
+	pgUniqueViolation = "23505"
+)
+
+func (postgresDialect) Rebind(query string) string {
+	return rebindNumbered(query, '$')
+}
+
+func (postgresDialect) InsertReturningID(ctx context.Context, q queryRower, query string, args ...interface{}) (string, error) {
+	var id string
+	err := q.QueryRowContext(ctx, rebindNumbered(query+" RETURNING id", '$'), args...).Scan(&id)
+	return id, err
+}
+
+func (postgresDialect) LockRoom(ctx context.Context, tx *sql.Tx, roomID string) error {
+	var locked string
+	err := tx.QueryRowContext(ctx, "SELECT id FROM rooms WHERE id = $1 FOR UPDATE", roomID).Scan(&locked)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return nil
+}
+
+func (postgresDialect) SerializeWrites() bool { return false }
+
+func (postgresDialect) IsConflict(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pgExclusionViolation
+}
+
+func (postgresDialect) IsDuplicate(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pgUniqueViolation
+}
+
+func (postgresDialect) IsInvalidID(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pgInvalidTextRepresentation
+}
+
+// rebindNumbered replaces each ? outside string literals with prefix followed by its 1-based position
+func rebindNumbered(query string, prefix byte) string {
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inString = !inString
+		case c == '?' && !inString:
+			n++
+			b.WriteByte(prefix)
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
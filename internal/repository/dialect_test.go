@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresDialect_Rebind(t *testing.T) {
+	d := postgresDialect{}
+	assert.Equal(t, "SELECT * FROM t WHERE a = $1 AND b = $2", d.Rebind("SELECT * FROM t WHERE a = ? AND b = ?"))
+	// Question marks inside string literals are left alone
+	assert.Equal(t, "SELECT '?' FROM t WHERE a = $1", d.Rebind("SELECT '?' FROM t WHERE a = ?"))
+	assert.Equal(t, "SELECT 1", d.Rebind("SELECT 1"))
+}
+
+func TestSQLiteDialect_Rebind(t *testing.T) {
+	assert.Equal(t, "SELECT * FROM t WHERE a = ?", sqliteDialect{}.Rebind("SELECT * FROM t WHERE a = ?"))
+}
+
+// colonDialect is a stand-in third driver using :1-style placeholders
+type colonDialect struct{ sqliteDialect }
+
+func (colonDialect) Rebind(query string) string { return rebindNumbered(query, ':') }
+
+func TestRegisterDialect(t *testing.T) {
+	RegisterDialect("colon-test", colonDialect{})
+	repo := New(nil, "colon-test")
+	assert.Equal(t, "UPDATE users SET role = :1 WHERE id = :2", repo.dialect.Rebind("UPDATE users SET role = ? WHERE id = ?"))
+
+	// Unknown drivers keep the PostgreSQL syntax the repository always used
+	assert.IsType(t, postgresDialect{}, New(nil, "unknown").dialect)
+}
+
+func TestRepository_LookupErr(t *testing.T) {
+	repo := New(nil, "sqlite3")
+	assert.NoError(t, repo.lookupErr(nil))
+	assert.ErrorIs(t, repo.lookupErr(sql.ErrNoRows), sql.ErrNoRows)
+	assert.ErrorIs(t, repo.lookupErr(assert.AnError), assert.AnError)
+}
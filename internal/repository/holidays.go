@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DateLayout is the format of holiday dates: a calendar day in the office timezone
+const DateLayout = "2006-01-02"
+
+// Holiday is a row of holidays: a day the office is closed
+type Holiday struct {
+	ID          string
+	OfficeID    string
+	Date        string
+	Description string
+}
+
+// ErrHolidayExists is returned when the office already has a holiday on the date
+var ErrHolidayExists = errors.New("office already has a holiday on this date")
+
+// CreateHoliday inserts a holiday and returns its id. Date must use DateLayout,
+// and an office has at most one holiday per date.
+func (r *Repository) CreateHoliday(ctx context.Context, h *Holiday) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	if _, err := time.Parse(DateLayout, h.Date); err != nil {
+		return "", fmt.Errorf("invalid holiday date %q", h.Date)
+	}
+	if err := r.checkHolidayDate(ctx, h.OfficeID, h.Date, ""); err != nil {
+		return "", err
+	}
+	return r.insert(ctx, "INSERT INTO holidays(office_id, date, description) VALUES (?, ?, ?)",
+		h.OfficeID, h.Date, nullString(h.Description))
+}
+
+// checkHolidayDate returns ErrHolidayExists if a holiday other than excludeID falls on date in the office
+func (r *Repository) checkHolidayDate(ctx context.Context, officeID, date, excludeID string) error {
+	query := "SELECT COUNT(*) FROM holidays WHERE office_id = ? AND date = ?"
+	args := []interface{}{officeID, date}
+	if excludeID != "" {
+		query += " AND id <> ?"
+		args = append(args, excludeID)
+	}
+	var n int
+	if err := r.queryRow(ctx, query, args...).Scan(&n); err != nil {
+		return r.lookupErr(err)
+	}
+	if n > 0 {
+		return ErrHolidayExists
+	}
+	return nil
+}
+
+// GetHoliday fetches a single holiday by id
+func (r *Repository) GetHoliday(ctx context.Context, id string) (*Holiday, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var h Holiday
+	var description sql.NullString
+	err := r.queryRow(ctx, "SELECT id, office_id, CAST(date AS TEXT), description FROM holidays WHERE id = ?", id).
+		Scan(&h.ID, &h.OfficeID, &h.Date, &description)
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	h.Description = description.String
+	return &h, nil
+}
+
+// UpdateHoliday saves a holiday's date and description
+func (r *Repository) UpdateHoliday(ctx context.Context, h *Holiday) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	if _, err := time.Parse(DateLayout, h.Date); err != nil {
+		return fmt.Errorf("invalid holiday date %q", h.Date)
+	}
+	existing, err := r.GetHoliday(ctx, h.ID)
+	if err != nil {
+		return err
+	}
+	if err := r.checkHolidayDate(ctx, existing.OfficeID, h.Date, h.ID); err != nil {
+		return err
+	}
+	res, err := r.exec(ctx, "UPDATE holidays SET date = ?, description = ? WHERE id = ?", h.Date, nullString(h.Description), h.ID)
+	if err != nil {
+		return r.lookupErr(err)
+	}
+	return expectAffected(res)
+}
+
+// DeleteHoliday removes a holiday
+func (r *Repository) DeleteHoliday(ctx context.Context, id string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.exec(ctx, "DELETE FROM holidays WHERE id = ?", id)
+	if err != nil {
+		return r.lookupErr(err)
+	}
+	return expectAffected(res)
+}
+
+// ListHolidays returns an office's holidays ordered by date
+func (r *Repository) ListHolidays(ctx context.Context, officeID string) ([]Holiday, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	// Cast so SQLite TEXT and PostgreSQL date both scan as YYYY-MM-DD
+	rows, err := r.query(ctx, "SELECT id, office_id, CAST(date AS TEXT), description FROM holidays WHERE office_id = ? ORDER BY date, id", officeID)
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	defer rows.Close()
+	var out []Holiday
+	for rows.Next() {
+		var h Holiday
+		var description sql.NullString
+		if err := rows.Scan(&h.ID, &h.OfficeID, &h.Date, &description); err != nil {
+			return nil, err
+		}
+		h.Description = description.String
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
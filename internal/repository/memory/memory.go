@@ -0,0 +1,1483 @@
+// Package memory is an in-process implementation of repository.Store for
+// tests and DATABASE_DRIVER=memory development mode. Nothing is persisted.
+package memory
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"roombooker/internal/repository"
+)
+
+type userRecord struct {
+	repository.User
+	DisplayName   string
+	PasswordHash  string
+	FeedTokenHash string
+}
+
+// reminderKey identifies a row of booking_reminders
+type reminderKey struct {
+	bookingID string
+	email     string
+	startsAt  int64
+}
+
+func keyOfReminder(rem repository.Reminder) reminderKey {
+	return reminderKey{rem.BookingID, strings.ToLower(rem.Email), rem.StartsAt.UnixNano()}
+}
+
+type reminderRecord struct {
+	claimedAt time.Time
+	sentAt    time.Time
+}
+
+// Store keeps every table in maps guarded by one lock. Calls fail with the
+// context's error once it is done, like the SQL store.
+type Store struct {
+	mu       sync.RWMutex
+	users    map[string]*userRecord
+	offices  map[string]*repository.Office
+	floors   map[string]*repository.Floor
+	rooms    map[string]*repository.Room
+	bookings map[string]*repository.Booking
+	// participants are keyed by booking id
+	participants map[string][]repository.Participant
+	reminders    map[reminderKey]*reminderRecord
+	rules        map[string]*repository.BookingRule
+	holidays     map[string]*repository.Holiday
+	audit        []repository.AuditLog
+}
+
+var _ repository.Store = (*Store)(nil)
+
+// New returns an empty store
+func New() *Store {
+	return &Store{
+		users:        map[string]*userRecord{},
+		offices:      map[string]*repository.Office{},
+		floors:       map[string]*repository.Floor{},
+		rooms:        map[string]*repository.Room{},
+		bookings:     map[string]*repository.Booking{},
+		participants: map[string][]repository.Participant{},
+		reminders:    map[reminderKey]*reminderRecord{},
+		rules:        map[string]*repository.BookingRule{},
+		holidays:     map[string]*repository.Holiday{},
+	}
+}
+
+// newID returns a random version 4 UUID, matching the ids the SQL schemas generate
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// Users
+
+func (s *Store) GetUserByID(ctx context.Context, id string) (*repository.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	user := u.User
+	return &user, nil
+}
+
+func (s *Store) userByEmail(email string) *userRecord {
+	for _, u := range s.users {
+		if u.Email == email {
+			return u
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (*repository.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u := s.userByEmail(email)
+	if u == nil {
+		return nil, sql.ErrNoRows
+	}
+	user := u.User
+	return &user, nil
+}
+
+func (s *Store) GetUserCredentials(ctx context.Context, email string) (string, string, string, string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", "", "", "", err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u := s.userByEmail(email)
+	if u == nil {
+		return "", "", "", "", sql.ErrNoRows
+	}
+	return u.ID, u.PasswordHash, u.Role, u.DisplayName, nil
+}
+
+func (s *Store) CreateUser(ctx context.Context, email, displayName, role, passwordHash string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.userByEmail(email) != nil {
+		return "", fmt.Errorf("user with email %q already exists", email)
+	}
+	id := newID()
+	s.users[id] = &userRecord{
+		User:         repository.User{ID: id, Email: email, Role: role, Timezone: "UTC"},
+		DisplayName:  displayName,
+		PasswordHash: passwordHash,
+	}
+	s.auditLocked(ctx, id)
+	return id, nil
+}
+
+func (s *Store) ListUsers(ctx context.Context) ([]repository.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]repository.User, 0, len(s.users))
+	for _, u := range s.users {
+		out = append(out, u.User)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Email < out[j].Email })
+	return out, nil
+}
+
+func (s *Store) UpdateUserRole(ctx context.Context, id, role string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	u.Role = role
+	s.auditLocked(ctx)
+	return nil
+}
+
+func (s *Store) SetFeedToken(ctx context.Context, id, tokenHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if tokenHash != "" {
+		for _, other := range s.users {
+			if other != u && other.FeedTokenHash == tokenHash {
+				return fmt.Errorf("feed token already in use")
+			}
+		}
+	}
+	u.FeedTokenHash = tokenHash
+	s.auditLocked(ctx)
+	return nil
+}
+
+func (s *Store) HasFeedToken(ctx context.Context, id string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[id]
+	if !ok {
+		return false, sql.ErrNoRows
+	}
+	return u.FeedTokenHash != "", nil
+}
+
+func (s *Store) GetUserByFeedToken(ctx context.Context, tokenHash string) (*repository.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if tokenHash == "" {
+		return nil, sql.ErrNoRows
+	}
+	for _, u := range s.users {
+		if u.FeedTokenHash == tokenHash {
+			user := u.User
+			return &user, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) SetReminderMinutes(ctx context.Context, id string, minutes *int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	u.ReminderMinutes = nil
+	if minutes != nil {
+		m := *minutes
+		u.ReminderMinutes = &m
+	}
+	s.auditLocked(ctx)
+	return nil
+}
+
+// Offices, floors and rooms
+
+func (s *Store) CreateOffice(ctx context.Context, name, timezone string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	id := newID()
+	s.offices[id] = &repository.Office{ID: id, Name: name, Timezone: timezone, ReminderMinutes: repository.DefaultReminderMinutes}
+	s.auditLocked(ctx, id)
+	return id, nil
+}
+
+func (s *Store) CreateFloor(ctx context.Context, officeID string, number int, label string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.offices[officeID]; !ok {
+		return "", fmt.Errorf("office %q does not exist", officeID)
+	}
+	if s.floorNumberTakenLocked(officeID, number, "") {
+		return "", repository.ErrFloorNumberTaken
+	}
+	id := newID()
+	s.floors[id] = &repository.Floor{ID: id, OfficeID: officeID, Number: number, Label: label}
+	s.auditLocked(ctx, id)
+	return id, nil
+}
+
+func (s *Store) floorNumberTakenLocked(officeID string, number int, excludeID string) bool {
+	for _, f := range s.floors {
+		if f.ID != excludeID && f.OfficeID == officeID && f.Number == number {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) GetFloor(ctx context.Context, id string) (*repository.Floor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, ok := s.floors[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	out := *f
+	return &out, nil
+}
+
+func (s *Store) UpdateFloor(ctx context.Context, f *repository.Floor) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.floors[f.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if s.floorNumberTakenLocked(existing.OfficeID, f.Number, f.ID) {
+		return repository.ErrFloorNumberTaken
+	}
+	existing.Number = f.Number
+	existing.Label = f.Label
+	s.auditLocked(ctx)
+	return nil
+}
+
+func (s *Store) DeleteFloor(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.floors[id]; !ok {
+		return sql.ErrNoRows
+	}
+	for _, rm := range s.rooms {
+		if rm.FloorID == id {
+			return repository.ErrFloorHasRooms
+		}
+	}
+	delete(s.floors, id)
+	s.auditLocked(ctx)
+	return nil
+}
+
+func (s *Store) CreateRoom(ctx context.Context, floorID, name string, capacity int, equipment string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.floors[floorID]; !ok {
+		return "", fmt.Errorf("floor %q does not exist", floorID)
+	}
+	id := newID()
+	s.rooms[id] = &repository.Room{ID: id, FloorID: floorID, Name: name, Capacity: capacity, Equipment: equipment}
+	s.auditLocked(ctx, id)
+	return id, nil
+}
+
+func (s *Store) GetRoomGraphResource(ctx context.Context, roomID string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rm, ok := s.rooms[roomID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	if !rm.GraphIntegration {
+		return "", nil
+	}
+	return rm.GraphResourceID, nil
+}
+
+func (s *Store) ListOffices(ctx context.Context) ([]repository.Office, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []repository.Office
+	for _, o := range s.offices {
+		out = append(out, *o)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+func (s *Store) GetOffice(ctx context.Context, id string) (*repository.Office, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o, ok := s.offices[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	out := *o
+	return &out, nil
+}
+
+func (s *Store) UpdateOffice(ctx context.Context, o *repository.Office) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.offices[o.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	existing.Name = o.Name
+	existing.Timezone = o.Timezone
+	existing.ReminderMinutes = o.ReminderMinutes
+	for _, rule := range s.rules {
+		if rule.OfficeID == o.ID {
+			rule.Timezone = o.Timezone
+		}
+	}
+	s.auditLocked(ctx)
+	return nil
+}
+
+// DeleteOffice mirrors the SQL foreign keys: with cascade everything under the office goes too
+func (s *Store) DeleteOffice(ctx context.Context, id string, cascade bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.offices[id]; !ok {
+		return sql.ErrNoRows
+	}
+	floors := map[string]bool{}
+	for _, f := range s.floors {
+		if f.OfficeID == id {
+			floors[f.ID] = true
+		}
+	}
+	if len(floors) > 0 && !cascade {
+		return repository.ErrOfficeNotEmpty
+	}
+	rooms := map[string]bool{}
+	for _, rm := range s.rooms {
+		if floors[rm.FloorID] {
+			rooms[rm.ID] = true
+			delete(s.rooms, rm.ID)
+		}
+	}
+	for _, b := range s.bookings {
+		if rooms[b.RoomID] {
+			delete(s.bookings, b.ID)
+			delete(s.participants, b.ID)
+		}
+	}
+	for key := range s.reminders {
+		if _, ok := s.bookings[key.bookingID]; !ok {
+			delete(s.reminders, key)
+		}
+	}
+	for fid := range floors {
+		delete(s.floors, fid)
+	}
+	for _, rule := range s.rules {
+		if rule.OfficeID == id {
+			delete(s.rules, rule.ID)
+		}
+	}
+	for _, h := range s.holidays {
+		if h.OfficeID == id {
+			delete(s.holidays, h.ID)
+		}
+	}
+	delete(s.offices, id)
+	s.auditLocked(ctx)
+	return nil
+}
+
+func (s *Store) ListFloors(ctx context.Context, officeID string) ([]repository.Floor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []repository.Floor
+	for _, f := range s.floors {
+		if f.OfficeID == officeID {
+			out = append(out, *f)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Number != out[j].Number {
+			return out[i].Number < out[j].Number
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+// roomLocked returns a copy of a room with its floor and office filled in
+func (s *Store) roomLocked(rm *repository.Room) repository.Room {
+	out := *rm
+	if f, ok := s.floors[rm.FloorID]; ok {
+		out.OfficeID = f.OfficeID
+		out.FloorNumber = f.Number
+		out.FloorLabel = f.Label
+	}
+	return out
+}
+
+func (s *Store) ListRoomsByOffice(ctx context.Context, officeID string) ([]repository.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []repository.Room
+	for _, rm := range s.rooms {
+		if room := s.roomLocked(rm); room.OfficeID == officeID && room.DecommissionedAt.IsZero() {
+			out = append(out, room)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].FloorNumber != out[j].FloorNumber {
+			return out[i].FloorNumber < out[j].FloorNumber
+		}
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+func (s *Store) GetRoom(ctx context.Context, id string) (*repository.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rm, ok := s.rooms[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	room := s.roomLocked(rm)
+	return &room, nil
+}
+
+func (s *Store) UpdateRoom(ctx context.Context, room *repository.Room) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rm, ok := s.rooms[room.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	rm.Name = room.Name
+	rm.Capacity = room.Capacity
+	rm.Equipment = room.Equipment
+	rm.Color = room.Color
+	rm.GraphIntegration = room.GraphIntegration
+	rm.GraphResourceID = room.GraphResourceID
+	s.auditLocked(ctx)
+	return nil
+}
+
+func (s *Store) DecommissionRoom(ctx context.Context, id string, at time.Time, cancelBookings bool) ([]repository.Booking, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rm, ok := s.rooms[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	var cancelled []repository.Booking
+	var ids []string
+	if cancelBookings {
+		for _, b := range s.bookings {
+			if b.RoomID == id && b.Status == repository.BookingStatusActive && !b.StartsAt.Before(at) {
+				cancelled = append(cancelled, *b)
+			}
+		}
+		sortBookings(cancelled)
+		for i := range cancelled {
+			ids = append(ids, cancelled[i].ID)
+			cancelled[i].Status = repository.BookingStatusCancelled
+		}
+		if err := s.cancelBookingsLocked(ids); err != nil {
+			return nil, err
+		}
+	}
+	if rm.DecommissionedAt.IsZero() {
+		rm.DecommissionedAt = at.UTC()
+	}
+	s.auditLocked(ctx, ids...)
+	return cancelled, nil
+}
+
+func (s *Store) DeleteRoom(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[id]; !ok {
+		return sql.ErrNoRows
+	}
+	for _, b := range s.bookings {
+		if b.RoomID == id {
+			return repository.ErrRoomHasBookings
+		}
+	}
+	delete(s.rooms, id)
+	s.auditLocked(ctx)
+	return nil
+}
+
+// Bookings
+
+func overlaps(b *repository.Booking, start, end time.Time) bool {
+	return b.StartsAt.Before(end) && b.EndsAt.After(start)
+}
+
+// conflictsLocked returns active bookings in the room overlapping [start, end), ordered by start
+func (s *Store) conflictsLocked(roomID string, start, end time.Time, excludeID string) []repository.Booking {
+	var out []repository.Booking
+	for _, b := range s.bookings {
+		if b.ID == excludeID || b.RoomID != roomID || b.Status != repository.BookingStatusActive {
+			continue
+		}
+		if overlaps(b, start, end) {
+			out = append(out, *b)
+		}
+	}
+	sortBookings(out)
+	return out
+}
+
+func sortBookings(bs []repository.Booking) {
+	sort.Slice(bs, func(i, j int) bool {
+		if !bs[i].StartsAt.Equal(bs[j].StartsAt) {
+			return bs[i].StartsAt.Before(bs[j].StartsAt)
+		}
+		return bs[i].ID < bs[j].ID
+	})
+}
+
+func (s *Store) checkBookingRefsLocked(b *repository.Booking) error {
+	if _, ok := s.rooms[b.RoomID]; !ok {
+		return fmt.Errorf("room %q does not exist", b.RoomID)
+	}
+	if b.CreatedBy != "" {
+		if _, ok := s.users[b.CreatedBy]; !ok {
+			return fmt.Errorf("user %q does not exist", b.CreatedBy)
+		}
+	}
+	return nil
+}
+
+// buffersTakenLocked reports whether an active booking other than excludeID
+// lies within b's BufferBefore or BufferAfter
+func (s *Store) buffersTakenLocked(b *repository.Booking, excludeID string) bool {
+	if b.BufferBefore <= 0 && b.BufferAfter <= 0 {
+		return false
+	}
+	return len(s.conflictsLocked(b.RoomID, b.StartsAt.Add(-b.BufferBefore), b.EndsAt.Add(b.BufferAfter), excludeID)) > 0
+}
+
+func (s *Store) CreateBooking(ctx context.Context, b *repository.Booking) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkBookingRefsLocked(b); err != nil {
+		return "", err
+	}
+	stored := *b
+	if stored.Status == "" {
+		stored.Status = repository.BookingStatusActive
+	}
+	if stored.Status == repository.BookingStatusActive {
+		if conflicts := s.conflictsLocked(b.RoomID, b.StartsAt, b.EndsAt, ""); len(conflicts) > 0 {
+			return "", &repository.ConflictError{Conflicts: conflicts}
+		}
+		if s.buffersTakenLocked(b, "") {
+			return "", repository.ErrBufferTaken
+		}
+	}
+	now := time.Now().UTC()
+	stored.ID = newID()
+	participants, err := s.participantsLocked(stored.ID, b.Participants)
+	if err != nil {
+		return "", err
+	}
+	stored.StartsAt = stored.StartsAt.UTC()
+	stored.EndsAt = stored.EndsAt.UTC()
+	stored.CreatedAt = now
+	stored.UpdatedAt = now
+	stored.Participants = nil
+	stored.BufferBefore, stored.BufferAfter = 0, 0
+	s.bookings[stored.ID] = &stored
+	if participants != nil {
+		s.participants[stored.ID] = participants
+	}
+	s.auditLocked(ctx, stored.ID)
+	return stored.ID, nil
+}
+
+func (s *Store) CreateBookingSeries(ctx context.Context, occurrences []repository.Booking) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := checkSameRoom(occurrences); err != nil {
+		return nil, err
+	}
+	for i := range occurrences {
+		if err := s.checkBookingRefsLocked(&occurrences[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.seriesConflictsLocked(occurrences); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	ids := make([]string, 0, len(occurrences))
+	participants := make([][]repository.Participant, len(occurrences))
+	for i, b := range occurrences {
+		ids = append(ids, newID())
+		var err error
+		if participants[i], err = s.participantsLocked(ids[i], b.Participants); err != nil {
+			return nil, err
+		}
+	}
+	for i, b := range occurrences {
+		stored := b
+		if stored.Status == "" {
+			stored.Status = repository.BookingStatusActive
+		}
+		stored.ID = ids[i]
+		if i == 0 {
+			stored.SeriesID = stored.ID
+		} else {
+			stored.SeriesID = ids[0]
+		}
+		stored.StartsAt = stored.StartsAt.UTC()
+		stored.EndsAt = stored.EndsAt.UTC()
+		stored.RecurrenceID = stored.RecurrenceID.UTC()
+		stored.CreatedAt = now
+		stored.UpdatedAt = now
+		stored.Participants = nil
+		stored.BufferBefore, stored.BufferAfter = 0, 0
+		s.bookings[stored.ID] = &stored
+		if participants[i] != nil {
+			s.participants[stored.ID] = participants[i]
+		}
+	}
+	s.auditLocked(ctx, ids...)
+	return ids, nil
+}
+
+// checkSameRoom requires the occurrences of a new series to share a room
+func checkSameRoom(bookings []repository.Booking) error {
+	if len(bookings) == 0 {
+		return errors.New("no bookings to write")
+	}
+	for _, b := range bookings[1:] {
+		if b.RoomID != bookings[0].RoomID {
+			return errors.New("the occurrences of a series must share a room")
+		}
+	}
+	return nil
+}
+
+// seriesConflictsLocked checks bookings written together against the store and
+// each other; stored bookings that are part of the batch are judged by their new times
+func (s *Store) seriesConflictsLocked(bookings []repository.Booking) error {
+	inBatch := map[string]bool{}
+	for _, b := range bookings {
+		if b.ID != "" {
+			inBatch[b.ID] = true
+		}
+	}
+	active := func(b *repository.Booking) bool {
+		return b.Status == "" || b.Status == repository.BookingStatusActive
+	}
+	var blocked []repository.OccurrenceConflict
+	for i := range bookings {
+		b := &bookings[i]
+		if !active(b) {
+			continue
+		}
+		var conflicts []repository.Booking
+		for _, c := range s.conflictsLocked(b.RoomID, b.StartsAt, b.EndsAt, "") {
+			if !inBatch[c.ID] {
+				conflicts = append(conflicts, c)
+			}
+		}
+		for j := range bookings {
+			if j != i && active(&bookings[j]) && bookings[j].RoomID == b.RoomID && overlaps(&bookings[j], b.StartsAt, b.EndsAt) {
+				conflicts = append(conflicts, bookings[j])
+			}
+		}
+		if len(conflicts) > 0 {
+			blocked = append(blocked, repository.OccurrenceConflict{StartsAt: b.StartsAt, EndsAt: b.EndsAt, Conflicts: conflicts})
+		}
+	}
+	if len(blocked) > 0 {
+		return &repository.SeriesConflictError{Occurrences: blocked}
+	}
+	return nil
+}
+
+func (s *Store) GetBooking(ctx context.Context, id string) (*repository.Booking, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.bookings[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	out := *b
+	return &out, nil
+}
+
+func (s *Store) ListBookingsByRoom(ctx context.Context, roomID string, from, to time.Time) ([]repository.Booking, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []repository.Booking
+	for _, b := range s.bookings {
+		if b.RoomID != roomID || b.Status != repository.BookingStatusActive {
+			continue
+		}
+		if !to.IsZero() && !b.StartsAt.Before(to) {
+			continue
+		}
+		if !from.IsZero() && !b.EndsAt.After(from) {
+			continue
+		}
+		out = append(out, *b)
+	}
+	sortBookings(out)
+	return out, nil
+}
+
+func (s *Store) ListRoomCalendar(ctx context.Context, roomID string, since time.Time) ([]repository.Booking, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []repository.Booking
+	for _, b := range s.bookings {
+		if b.RoomID == roomID && b.EndsAt.After(since) {
+			out = append(out, *b)
+		}
+	}
+	sortBookings(out)
+	return out, nil
+}
+
+func (s *Store) ListUserCalendar(ctx context.Context, userID, email string, since time.Time) ([]repository.Booking, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	email = strings.ToLower(strings.TrimSpace(email))
+	var out []repository.Booking
+	for _, b := range s.bookings {
+		if !b.EndsAt.After(since) {
+			continue
+		}
+		invited := false
+		for _, p := range s.participants[b.ID] {
+			if p.Email == email {
+				invited = true
+				break
+			}
+		}
+		if b.CreatedBy == userID || invited {
+			out = append(out, *b)
+		}
+	}
+	sortBookings(out)
+	return out, nil
+}
+
+func (s *Store) ListBookingsByOffice(ctx context.Context, officeID string, from, to time.Time) ([]repository.Booking, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []repository.Booking
+	for _, b := range s.bookings {
+		if b.Status != repository.BookingStatusActive || s.officeOfRoomLocked(b.RoomID) != officeID {
+			continue
+		}
+		if !to.IsZero() && !b.StartsAt.Before(to) {
+			continue
+		}
+		if !from.IsZero() && !b.EndsAt.After(from) {
+			continue
+		}
+		out = append(out, *b)
+	}
+	sortBookings(out)
+	return out, nil
+}
+
+func (s *Store) ListBookingsStarting(ctx context.Context, from, to time.Time) ([]repository.Booking, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []repository.Booking
+	for _, b := range s.bookings {
+		if b.Status == repository.BookingStatusActive && !b.StartsAt.Before(from) && b.StartsAt.Before(to) {
+			out = append(out, *b)
+		}
+	}
+	sortBookings(out)
+	return out, nil
+}
+
+func (s *Store) officeOfRoomLocked(roomID string) string {
+	rm, ok := s.rooms[roomID]
+	if !ok {
+		return ""
+	}
+	if f, ok := s.floors[rm.FloorID]; ok {
+		return f.OfficeID
+	}
+	return ""
+}
+
+func (s *Store) UpdateBooking(ctx context.Context, b *repository.Booking) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.bookings[b.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if _, ok := s.rooms[b.RoomID]; !ok {
+		return fmt.Errorf("room %q does not exist", b.RoomID)
+	}
+	if b.Status == "" || b.Status == repository.BookingStatusActive {
+		if conflicts := s.conflictsLocked(b.RoomID, b.StartsAt, b.EndsAt, b.ID); len(conflicts) > 0 {
+			return &repository.ConflictError{Conflicts: conflicts}
+		}
+		if s.buffersTakenLocked(b, b.ID) {
+			return repository.ErrBufferTaken
+		}
+	}
+	participants, err := s.participantsLocked(b.ID, b.Participants)
+	if err != nil {
+		return err
+	}
+	existing.RoomID = b.RoomID
+	existing.Title = b.Title
+	existing.Description = b.Description
+	existing.StartsAt = b.StartsAt.UTC()
+	existing.EndsAt = b.EndsAt.UTC()
+	existing.RRule = b.RRule
+	existing.UpdatedAt = time.Now().UTC()
+	if participants != nil {
+		s.participants[b.ID] = participants
+	}
+	s.auditLocked(ctx)
+	return nil
+}
+
+func (s *Store) UpdateBookings(ctx context.Context, bookings []repository.Booking) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range bookings {
+		if _, ok := s.bookings[b.ID]; !ok {
+			return sql.ErrNoRows
+		}
+		if _, ok := s.rooms[b.RoomID]; !ok {
+			return fmt.Errorf("room %q does not exist", b.RoomID)
+		}
+	}
+	if err := s.seriesConflictsLocked(bookings); err != nil {
+		return err
+	}
+	participants := make([][]repository.Participant, len(bookings))
+	for i, b := range bookings {
+		var err error
+		if participants[i], err = s.participantsLocked(b.ID, b.Participants); err != nil {
+			return err
+		}
+	}
+	now := time.Now().UTC()
+	for i, b := range bookings {
+		existing := s.bookings[b.ID]
+		existing.RoomID = b.RoomID
+		existing.Title = b.Title
+		existing.Description = b.Description
+		existing.StartsAt = b.StartsAt.UTC()
+		existing.EndsAt = b.EndsAt.UTC()
+		existing.RRule = b.RRule
+		existing.Status = b.Status
+		if existing.Status == "" {
+			existing.Status = repository.BookingStatusActive
+		}
+		existing.SeriesID = b.SeriesID
+		existing.RecurrenceID = b.RecurrenceID.UTC()
+		existing.UpdatedAt = now
+		if participants[i] != nil {
+			s.participants[b.ID] = participants[i]
+		}
+	}
+	s.auditLocked(ctx)
+	return nil
+}
+
+func (s *Store) ListBookingSeries(ctx context.Context, seriesID string) ([]repository.Booking, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []repository.Booking
+	for _, b := range s.bookings {
+		if b.SeriesID == seriesID {
+			out = append(out, *b)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].RecurrenceID.Equal(out[j].RecurrenceID) {
+			return out[i].RecurrenceID.Before(out[j].RecurrenceID)
+		}
+		if !out[i].StartsAt.Equal(out[j].StartsAt) {
+			return out[i].StartsAt.Before(out[j].StartsAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+func (s *Store) CancelBookings(ctx context.Context, ids []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.cancelBookingsLocked(ids); err != nil {
+		return err
+	}
+	s.auditLocked(ctx)
+	return nil
+}
+
+// cancelBookingsLocked cancels the bookings ids, or none if any is missing
+func (s *Store) cancelBookingsLocked(ids []string) error {
+	for _, id := range ids {
+		if _, ok := s.bookings[id]; !ok {
+			return sql.ErrNoRows
+		}
+	}
+	now := time.Now().UTC()
+	for _, id := range ids {
+		s.bookings[id].Status = repository.BookingStatusCancelled
+		s.bookings[id].UpdatedAt = now
+	}
+	return nil
+}
+
+func (s *Store) CancelBooking(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.bookings[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	b.Status = repository.BookingStatusCancelled
+	b.UpdatedAt = time.Now().UTC()
+	s.auditLocked(ctx)
+	return nil
+}
+
+func (s *Store) SetBookingExternalEventID(ctx context.Context, id, externalID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.bookings[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	b.ExternalEventID = externalID
+	s.auditLocked(ctx)
+	return nil
+}
+
+// Participants
+
+func (s *Store) ListParticipants(ctx context.Context, bookingID string) ([]repository.Participant, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := append([]repository.Participant(nil), s.participants[bookingID]...)
+	sort.Slice(out, func(i, j int) bool { return out[i].Email < out[j].Email })
+	return out, nil
+}
+
+func (s *Store) SetParticipants(ctx context.Context, bookingID string, participants []repository.Participant) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.bookings[bookingID]; !ok {
+		return sql.ErrNoRows
+	}
+	if participants == nil {
+		participants = []repository.Participant{}
+	}
+	stored, err := s.participantsLocked(bookingID, participants)
+	if err != nil {
+		return err
+	}
+	s.participants[bookingID] = stored
+	s.auditLocked(ctx)
+	return nil
+}
+
+// participantsLocked returns the attendees to store for a booking, keeping the
+// responses of those already invited, or nil if participants is nil
+func (s *Store) participantsLocked(bookingID string, participants []repository.Participant) ([]repository.Participant, error) {
+	if participants == nil {
+		return nil, nil
+	}
+	responses := map[string]string{}
+	for _, p := range s.participants[bookingID] {
+		responses[p.Email] = p.ResponseStatus
+	}
+	stored := make([]repository.Participant, 0, len(participants))
+	for _, p := range participants {
+		email := strings.ToLower(strings.TrimSpace(p.Email))
+		for _, other := range stored {
+			if other.Email == email {
+				return nil, fmt.Errorf("%s is invited twice", email)
+			}
+		}
+		status := responses[email]
+		if status == "" {
+			status = p.ResponseStatus
+		}
+		if status == "" {
+			status = repository.ResponseNeedsAction
+		}
+		stored = append(stored, repository.Participant{
+			ID:             newID(),
+			BookingID:      bookingID,
+			Email:          email,
+			Required:       p.Required,
+			ResponseStatus: status,
+		})
+	}
+	return stored, nil
+}
+
+func (s *Store) SetParticipantResponse(ctx context.Context, bookingID, email, status string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	email = strings.ToLower(strings.TrimSpace(email))
+	for i := range s.participants[bookingID] {
+		if s.participants[bookingID][i].Email == email {
+			s.participants[bookingID][i].ResponseStatus = status
+			s.auditLocked(ctx)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// Reminders
+
+func (s *Store) ClaimReminder(ctx context.Context, rem repository.Reminder, now, staleBefore time.Time) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.bookings[rem.BookingID]; !ok {
+		return false, sql.ErrNoRows
+	}
+	key := keyOfReminder(rem)
+	if r, ok := s.reminders[key]; ok && (!r.sentAt.IsZero() || !r.claimedAt.Before(staleBefore)) {
+		return false, nil
+	}
+	s.reminders[key] = &reminderRecord{claimedAt: now}
+	return true, nil
+}
+
+func (s *Store) MarkReminderSent(ctx context.Context, rem repository.Reminder, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.reminders[keyOfReminder(rem)]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	r.sentAt = at
+	return nil
+}
+
+func (s *Store) ReleaseReminder(ctx context.Context, rem repository.Reminder) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := keyOfReminder(rem)
+	if r, ok := s.reminders[key]; ok && r.sentAt.IsZero() {
+		delete(s.reminders, key)
+	}
+	return nil
+}
+
+// Booking rules
+
+func (s *Store) CreateBookingRule(ctx context.Context, rule *repository.BookingRule) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.offices[rule.OfficeID]; !ok {
+		return "", fmt.Errorf("office %q does not exist", rule.OfficeID)
+	}
+	stored := *rule
+	stored.ID = newID()
+	if stored.EffectiveFrom.IsZero() {
+		stored.EffectiveFrom = time.Now()
+	}
+	stored.EffectiveFrom = stored.EffectiveFrom.UTC()
+	if stored.Timezone == "" {
+		stored.Timezone = "UTC"
+	}
+	s.rules[stored.ID] = &stored
+	s.auditLocked(ctx, stored.ID)
+	return stored.ID, nil
+}
+
+func (s *Store) ListBookingRules(ctx context.Context, officeID string) ([]repository.BookingRule, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []repository.BookingRule
+	for _, rule := range s.rules {
+		if rule.OfficeID == officeID {
+			out = append(out, *rule)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].EffectiveFrom.Before(out[j].EffectiveFrom) })
+	return out, nil
+}
+
+// Holidays
+
+func (s *Store) CreateHoliday(ctx context.Context, h *repository.Holiday) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if _, err := time.Parse(repository.DateLayout, h.Date); err != nil {
+		return "", fmt.Errorf("invalid holiday date %q", h.Date)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.offices[h.OfficeID]; !ok {
+		return "", fmt.Errorf("office %q does not exist", h.OfficeID)
+	}
+	if s.holidayDateTaken(h.OfficeID, h.Date, "") {
+		return "", repository.ErrHolidayExists
+	}
+	stored := *h
+	stored.ID = newID()
+	s.holidays[stored.ID] = &stored
+	s.auditLocked(ctx, stored.ID)
+	return stored.ID, nil
+}
+
+func (s *Store) holidayDateTaken(officeID, date, excludeID string) bool {
+	for _, h := range s.holidays {
+		if h.OfficeID == officeID && h.Date == date && h.ID != excludeID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) GetHoliday(ctx context.Context, id string) (*repository.Holiday, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, ok := s.holidays[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	out := *h
+	return &out, nil
+}
+
+func (s *Store) UpdateHoliday(ctx context.Context, h *repository.Holiday) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if _, err := time.Parse(repository.DateLayout, h.Date); err != nil {
+		return fmt.Errorf("invalid holiday date %q", h.Date)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.holidays[h.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if s.holidayDateTaken(existing.OfficeID, h.Date, h.ID) {
+		return repository.ErrHolidayExists
+	}
+	existing.Date = h.Date
+	existing.Description = h.Description
+	s.auditLocked(ctx)
+	return nil
+}
+
+func (s *Store) DeleteHoliday(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.holidays[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(s.holidays, id)
+	s.auditLocked(ctx)
+	return nil
+}
+
+func (s *Store) ListHolidays(ctx context.Context, officeID string) ([]repository.Holiday, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []repository.Holiday
+	for _, h := range s.holidays {
+		if h.OfficeID == officeID {
+			out = append(out, *h)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Date != out[j].Date {
+			return out[i].Date < out[j].Date
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+// Audit
+
+func (s *Store) CreateAuditLog(ctx context.Context, entry *repository.AuditLog) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.appendAuditLocked(*entry), nil
+}
+
+func (s *Store) appendAuditLocked(entry repository.AuditLog) string {
+	entry.ID = newID()
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	entry.CreatedAt = entry.CreatedAt.UTC()
+	s.audit = append(s.audit, entry)
+	return entry.ID
+}
+
+// auditLocked records the audit entries pending on ctx. Writes call it once
+// they have succeeded, under the same lock, as the SQL store records them in
+// the write's transaction.
+func (s *Store) auditLocked(ctx context.Context, ids ...string) {
+	fn := repository.TakeAudit(ctx)
+	if fn == nil {
+		return
+	}
+	for _, entry := range fn(ids) {
+		s.appendAuditLocked(entry)
+	}
+}
+
+func (s *Store) ListAuditLogs(ctx context.Context, filter repository.AuditFilter) ([]repository.AuditLog, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []repository.AuditLog
+	for _, e := range s.audit {
+		if filter.ActorUserID != "" && e.ActorUserID != filter.ActorUserID ||
+			filter.Action != "" && e.Action != filter.Action ||
+			filter.EntityType != "" && e.EntityType != filter.EntityType ||
+			filter.EntityID != "" && e.EntityID != filter.EntityID ||
+			!filter.From.IsZero() && e.CreatedAt.Before(filter.From) ||
+			!filter.To.IsZero() && !e.CreatedAt.Before(filter.To) {
+			continue
+		}
+		out = append(out, e)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	if filter.Limit > 0 {
+		if filter.Offset >= len(out) {
+			return nil, nil
+		}
+		out = out[filter.Offset:]
+		if len(out) > filter.Limit {
+			out = out[:filter.Limit]
+		}
+	}
+	return out, nil
+}
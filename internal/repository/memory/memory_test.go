@@ -0,0 +1,35 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/repository"
+	"roombooker/internal/repository/storetest"
+)
+
+func TestStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) repository.Store { return New() })
+}
+
+func TestStore_SeedDemoData(t *testing.T) {
+	s := New()
+	s.SeedDemoData()
+
+	admin, err := s.GetUserByEmail(context.Background(), "admin@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "user-admin", admin.ID)
+	assert.Equal(t, "admin", admin.Role)
+
+	rules, err := s.ListBookingRules(context.Background(), "office-1")
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.True(t, rules[0].AllowRecurring)
+
+	// Seeded rooms accept bookings like any other
+	_, err = s.GetRoomGraphResource(context.Background(), "room-106")
+	assert.NoError(t, err)
+}
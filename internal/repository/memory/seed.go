@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"fmt"
+	"time"
+
+	"roombooker/internal/repository"
+)
+
+// SeedDemoData loads the same demo office, floors, rooms, users and booking
+// rule as migrations/sqlite3/000002_seed_data.up.sql, using the same ids.
+func (s *Store) SeedDemoData() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.offices["office-1"] = &repository.Office{ID: "office-1", Name: "Main Office", Timezone: "America/New_York", ReminderMinutes: repository.DefaultReminderMinutes}
+	for n := 1; n <= 8; n++ {
+		id := fmt.Sprintf("floor-1-%d", n)
+		s.floors[id] = &repository.Floor{ID: id, OfficeID: "office-1", Number: n, Label: fmt.Sprintf("Floor %d", n)}
+	}
+	for _, rm := range []repository.Room{
+		{ID: "room-101", Name: "Room 101", Capacity: 4, Equipment: `{"screen": true, "vc": true}`, Color: "#FF5733"},
+		{ID: "room-102", Name: "Room 102", Capacity: 6, Equipment: `{"screen": true, "whiteboard": true}`, Color: "#33FF57"},
+		{ID: "room-103", Name: "Room 103", Capacity: 4, Equipment: `{"vc": true}`, Color: "#3357FF"},
+		{ID: "room-104", Name: "Room 104", Capacity: 8, Equipment: `{"screen": true, "vc": true, "whiteboard": true}`, Color: "#FF33A1"},
+		{ID: "room-105", Name: "Room 105", Capacity: 6, Equipment: `{"screen": true}`, Color: "#A133FF"},
+		{ID: "room-106", Name: "Room 106", Capacity: 4, Equipment: `{"whiteboard": true}`, Color: "#33FFA1"},
+	} {
+		rm := rm
+		rm.FloorID = "floor-1-1"
+		s.rooms[rm.ID] = &rm
+	}
+	s.users["user-admin"] = &userRecord{
+		User:        repository.User{ID: "user-admin", Email: "admin@example.com", Role: "admin", Timezone: "America/New_York"},
+		DisplayName: "Admin User",
+	}
+	s.users["user-regular"] = &userRecord{
+		User:        repository.User{ID: "user-regular", Email: "user@example.com", Role: "user", Timezone: "America/New_York"},
+		DisplayName: "Regular User",
+	}
+	s.rules["rule-1"] = &repository.BookingRule{
+		ID:             "rule-1",
+		OfficeID:       "office-1",
+		WorkdayStart:   9 * time.Hour,
+		WorkdayEnd:     18 * time.Hour,
+		MaxDuration:    4 * time.Hour,
+		MinLeadTime:    30 * time.Minute,
+		BufferBefore:   15 * time.Minute,
+		BufferAfter:    15 * time.Minute,
+		AllowRecurring: true,
+		Timezone:       "America/New_York",
+		EffectiveFrom:  time.Now().UTC(),
+	}
+}
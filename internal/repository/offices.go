@@ -0,0 +1,387 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// DefaultReminderMinutes is how long before its bookings start a new office
+// reminds people of them
+const DefaultReminderMinutes = 15
+
+// Office is a row of offices. ReminderMinutes is how long before a booking
+// starts its organiser and attendees are reminded of it, unless they chose
+// otherwise; 0 means not at all.
+type Office struct {
+	ID              string
+	Name            string
+	Timezone        string
+	ReminderMinutes int
+}
+
+// Floor is a row of floors
+type Floor struct {
+	ID       string
+	OfficeID string
+	Number   int
+	Label    string
+}
+
+// Room is a row of rooms together with the floor and office it sits in.
+// Equipment holds the JSON text stored in the column. A zero DecommissionedAt
+// means the room is in service.
+type Room struct {
+	ID               string
+	FloorID          string
+	OfficeID         string
+	FloorNumber      int
+	FloorLabel       string
+	Name             string
+	Capacity         int
+	Equipment        string
+	GraphIntegration bool
+	GraphResourceID  string
+	Color            string
+	DecommissionedAt time.Time
+}
+
+const roomColumns = `r.id, r.floor_id, f.office_id, f.number, f.label, r.name, r.capacity, r.equipment,
+	r.has_graph_integration, r.graph_resource_id, r.color, r.decommissioned_at`
+
+const roomFrom = " FROM rooms r JOIN floors f ON f.id = r.floor_id"
+
+// ListOffices returns every office ordered by name
+func (r *Repository) ListOffices(ctx context.Context) ([]Office, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.query(ctx, "SELECT id, name, timezone, reminder_minutes FROM offices ORDER BY name, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Office
+	for rows.Next() {
+		o, err := scanOffice(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *o)
+	}
+	return out, rows.Err()
+}
+
+// GetOffice fetches a single office by id
+func (r *Repository) GetOffice(ctx context.Context, id string) (*Office, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	o, err := scanOffice(r.queryRow(ctx, "SELECT id, name, timezone, reminder_minutes FROM offices WHERE id = ?", id))
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	return o, nil
+}
+
+func scanOffice(s rowScanner) (*Office, error) {
+	var o Office
+	var tz sql.NullString
+	if err := s.Scan(&o.ID, &o.Name, &tz, &o.ReminderMinutes); err != nil {
+		return nil, err
+	}
+	o.Timezone = tz.String
+	if o.Timezone == "" {
+		o.Timezone = "UTC"
+	}
+	return &o, nil
+}
+
+// ErrOfficeNotEmpty is returned when deleting an office that still has floors without cascading
+var ErrOfficeNotEmpty = errors.New("office still has floors")
+
+// UpdateOffice saves an office's name, timezone and reminder default. Booking
+// rules are interpreted in the office timezone, so the office's rules follow it.
+func (r *Repository) UpdateOffice(ctx context.Context, o *Office) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.audited(ctx, func(tx *sql.Tx) ([]string, error) {
+		res, err := tx.ExecContext(ctx, r.dialect.Rebind("UPDATE offices SET name = ?, timezone = ?, reminder_minutes = ? WHERE id = ?"),
+			o.Name, o.Timezone, o.ReminderMinutes, o.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := expectAffected(res); err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, r.dialect.Rebind("UPDATE booking_rules SET timezone = ? WHERE office_id = ?"), o.Timezone, o.ID)
+		return nil, err
+	})
+	return r.lookupErr(err)
+}
+
+// DeleteOffice removes an office. Unless cascade is set it fails with
+// ErrOfficeNotEmpty while the office has floors; with cascade its floors,
+// rooms, bookings, rules and holidays are deleted with it.
+func (r *Repository) DeleteOffice(ctx context.Context, id string, cascade bool) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	query, args := "DELETE FROM offices WHERE id = ?", []interface{}{id}
+	if !cascade {
+		query += " AND NOT EXISTS (SELECT 1 FROM floors WHERE office_id = ?)"
+		args = append(args, id)
+	}
+	res, err := r.exec(ctx, query, args...)
+	if err != nil {
+		return r.lookupErr(err)
+	}
+	if err := expectAffected(res); cascade || !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if _, err := r.GetOffice(ctx, id); err != nil {
+		return err
+	}
+	return ErrOfficeNotEmpty
+}
+
+// ErrFloorNumberTaken is returned when another floor of the office already has the number
+var ErrFloorNumberTaken = errors.New("floor number already used in this office")
+
+// ErrFloorHasRooms is returned when deleting a floor that still has rooms
+var ErrFloorHasRooms = errors.New("floor still has rooms")
+
+// CreateFloor inserts a new floor under an office and returns its id.
+// Floor numbers are unique within an office.
+func (r *Repository) CreateFloor(ctx context.Context, officeID string, number int, label string) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	if err := r.checkFloorNumber(ctx, officeID, number, ""); err != nil {
+		return "", err
+	}
+	id, err := r.insert(ctx, "INSERT INTO floors(office_id, number, label) VALUES (?, ?, ?)",
+		officeID, number, label)
+	return id, r.floorWriteError(err)
+}
+
+// floorWriteError maps a floor taking its number between checkFloorNumber
+// and the write to ErrFloorNumberTaken
+func (r *Repository) floorWriteError(err error) error {
+	if r.dialect.IsDuplicate(err) {
+		return ErrFloorNumberTaken
+	}
+	return err
+}
+
+// checkFloorNumber returns ErrFloorNumberTaken if a floor other than excludeID uses number in the office
+func (r *Repository) checkFloorNumber(ctx context.Context, officeID string, number int, excludeID string) error {
+	query := "SELECT COUNT(*) FROM floors WHERE office_id = ? AND number = ?"
+	args := []interface{}{officeID, number}
+	if excludeID != "" {
+		query += " AND id <> ?"
+		args = append(args, excludeID)
+	}
+	var n int
+	if err := r.queryRow(ctx, query, args...).Scan(&n); err != nil {
+		return r.lookupErr(err)
+	}
+	if n > 0 {
+		return ErrFloorNumberTaken
+	}
+	return nil
+}
+
+// GetFloor fetches a single floor by id
+func (r *Repository) GetFloor(ctx context.Context, id string) (*Floor, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var f Floor
+	var label sql.NullString
+	err := r.queryRow(ctx, "SELECT id, office_id, number, label FROM floors WHERE id = ?", id).
+		Scan(&f.ID, &f.OfficeID, &f.Number, &label)
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	f.Label = label.String
+	return &f, nil
+}
+
+// UpdateFloor saves a floor's number and label
+func (r *Repository) UpdateFloor(ctx context.Context, f *Floor) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	existing, err := r.GetFloor(ctx, f.ID)
+	if err != nil {
+		return err
+	}
+	if err := r.checkFloorNumber(ctx, existing.OfficeID, f.Number, f.ID); err != nil {
+		return err
+	}
+	res, err := r.exec(ctx, "UPDATE floors SET number = ?, label = ? WHERE id = ?", f.Number, f.Label, f.ID)
+	if err != nil {
+		return r.lookupErr(r.floorWriteError(err))
+	}
+	return expectAffected(res)
+}
+
+// DeleteFloor removes an empty floor. It fails with ErrFloorHasRooms while rooms remain on it.
+func (r *Repository) DeleteFloor(ctx context.Context, id string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.exec(ctx, "DELETE FROM floors WHERE id = ? AND NOT EXISTS (SELECT 1 FROM rooms WHERE floor_id = ?)", id, id)
+	if err != nil {
+		return r.lookupErr(err)
+	}
+	if err := expectAffected(res); !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	// Nothing deleted: either the floor is missing or it still has rooms
+	if _, err := r.GetFloor(ctx, id); err != nil {
+		return err
+	}
+	return ErrFloorHasRooms
+}
+
+// ListFloors returns the floors of an office ordered by number
+func (r *Repository) ListFloors(ctx context.Context, officeID string) ([]Floor, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.query(ctx, "SELECT id, office_id, number, label FROM floors WHERE office_id = ? ORDER BY number, id", officeID)
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	defer rows.Close()
+	var out []Floor
+	for rows.Next() {
+		var f Floor
+		var label sql.NullString
+		if err := rows.Scan(&f.ID, &f.OfficeID, &f.Number, &label); err != nil {
+			return nil, err
+		}
+		f.Label = label.String
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// ListRoomsByOffice returns the in-service rooms on all floors of an office, ordered by floor number then name
+func (r *Repository) ListRoomsByOffice(ctx context.Context, officeID string) ([]Room, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.query(ctx, "SELECT "+roomColumns+roomFrom+" WHERE f.office_id = ? AND r.decommissioned_at IS NULL ORDER BY f.number, r.name, r.id", officeID)
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	defer rows.Close()
+	var out []Room
+	for rows.Next() {
+		room, err := scanRoom(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *room)
+	}
+	return out, rows.Err()
+}
+
+// GetRoom fetches a single room with its floor and office
+func (r *Repository) GetRoom(ctx context.Context, id string) (*Room, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	room, err := scanRoom(r.queryRow(ctx, "SELECT "+roomColumns+roomFrom+" WHERE r.id = ?", id))
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	return room, nil
+}
+
+func scanRoom(s rowScanner) (*Room, error) {
+	var room Room
+	var label, equipment, resourceID, color sql.NullString
+	var graph sql.NullBool
+	var decommissioned sql.NullTime
+	err := s.Scan(&room.ID, &room.FloorID, &room.OfficeID, &room.FloorNumber, &label, &room.Name, &room.Capacity,
+		&equipment, &graph, &resourceID, &color, &decommissioned)
+	if err != nil {
+		return nil, err
+	}
+	room.FloorLabel = label.String
+	room.Equipment = equipment.String
+	room.GraphIntegration = graph.Bool
+	room.GraphResourceID = resourceID.String
+	room.Color = color.String
+	if decommissioned.Valid {
+		room.DecommissionedAt = decommissioned.Time.UTC()
+	}
+	return &room, nil
+}
+
+// ErrRoomHasBookings is returned when hard-deleting a room that has booking history
+var ErrRoomHasBookings = errors.New("room has bookings")
+
+// UpdateRoom saves a room's name, capacity, equipment, color and Graph settings
+func (r *Repository) UpdateRoom(ctx context.Context, room *Room) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.exec(ctx, `UPDATE rooms SET name = ?, capacity = ?, equipment = ?, color = ?,
+		has_graph_integration = ?, graph_resource_id = ? WHERE id = ?`,
+		room.Name, room.Capacity, nullString(room.Equipment), nullString(room.Color),
+		room.GraphIntegration, nullString(room.GraphResourceID), room.ID)
+	if err != nil {
+		return r.lookupErr(err)
+	}
+	return expectAffected(res)
+}
+
+// DecommissionRoom takes a room out of service at the given time and, if
+// cancelBookings is set, cancels its active bookings starting from then on,
+// all at once, returning them. The audit entries get the cancelled ids. The
+// row and its bookings are kept; decommissioning twice keeps the first time.
+func (r *Repository) DecommissionRoom(ctx context.Context, id string, at time.Time, cancelBookings bool) ([]Booking, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var cancelled []Booking
+	_, err := r.withBookingLock(ctx, id, func(tx *sql.Tx) ([]string, error) {
+		res, err := tx.ExecContext(ctx, r.dialect.Rebind("UPDATE rooms SET decommissioned_at = COALESCE(decommissioned_at, ?) WHERE id = ?"), at.UTC(), id)
+		if err != nil {
+			return nil, err
+		}
+		if err := expectAffected(res); err != nil || !cancelBookings {
+			return nil, err
+		}
+		rows, err := tx.QueryContext(ctx, r.dialect.Rebind("SELECT "+bookingColumns+` FROM bookings
+			WHERE room_id = ? AND status = ? AND starts_at_utc >= ? ORDER BY starts_at_utc`), id, BookingStatusActive, at.UTC())
+		if err != nil {
+			return nil, err
+		}
+		if cancelled, err = scanBookings(rows); err != nil {
+			return nil, err
+		}
+		ids := make([]string, len(cancelled))
+		for i := range cancelled {
+			ids[i] = cancelled[i].ID
+			cancelled[i].Status = BookingStatusCancelled
+		}
+		return ids, r.cancelBookings(ctx, tx, ids)
+	})
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	return cancelled, nil
+}
+
+// DeleteRoom removes a room that has never been booked. Rooms with booking
+// history fail with ErrRoomHasBookings, since deleting would cascade to it.
+func (r *Repository) DeleteRoom(ctx context.Context, id string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.exec(ctx, "DELETE FROM rooms WHERE id = ? AND NOT EXISTS (SELECT 1 FROM bookings WHERE room_id = ?)", id, id)
+	if err != nil {
+		return r.lookupErr(err)
+	}
+	if err := expectAffected(res); !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if _, err := r.GetRoom(ctx, id); err != nil {
+		return err
+	}
+	return ErrRoomHasBookings
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// Attendee responses stored in booking_participants.response_status
+const (
+	ResponseNeedsAction = "needs_action"
+	ResponseAccepted    = "accepted"
+	ResponseDeclined    = "declined"
+	ResponseTentative   = "tentative"
+)
+
+// Participant is a row of booking_participants: someone invited to a booking.
+// Emails are stored lower-case.
+type Participant struct {
+	ID             string
+	BookingID      string
+	Email          string
+	Required       bool
+	ResponseStatus string
+}
+
+// ListParticipants returns a booking's attendees ordered by email
+func (r *Repository) ListParticipants(ctx context.Context, bookingID string) ([]Participant, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.query(ctx, `SELECT id, booking_id, email, is_required, response_status
+		FROM booking_participants WHERE booking_id = ? ORDER BY email`, bookingID)
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	defer rows.Close()
+	var out []Participant
+	for rows.Next() {
+		var p Participant
+		var required sql.NullBool
+		var status sql.NullString
+		if err := rows.Scan(&p.ID, &p.BookingID, &p.Email, &required, &status); err != nil {
+			return nil, err
+		}
+		p.Required = !required.Valid || required.Bool
+		p.ResponseStatus = status.String
+		if p.ResponseStatus == "" {
+			p.ResponseStatus = ResponseNeedsAction
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// SetParticipants replaces a booking's attendees. Attendees who stay keep
+// their response; new ones start with their ResponseStatus, or needs_action.
+// It returns sql.ErrNoRows if the booking does not exist.
+func (r *Repository) SetParticipants(ctx context.Context, bookingID string, participants []Participant) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.audited(ctx, func(tx *sql.Tx) ([]string, error) {
+		var found string
+		if err := tx.QueryRowContext(ctx, r.dialect.Rebind("SELECT id FROM bookings WHERE id = ?"), bookingID).Scan(&found); err != nil {
+			return nil, err
+		}
+		if participants == nil {
+			participants = []Participant{}
+		}
+		return nil, r.writeParticipants(ctx, tx, bookingID, participants)
+	})
+	return r.lookupErr(err)
+}
+
+// writeParticipants replaces a booking's attendees in tx as SetParticipants
+// does; nil leaves them as they are
+func (r *Repository) writeParticipants(ctx context.Context, tx *sql.Tx, bookingID string, participants []Participant) error {
+	if participants == nil {
+		return nil
+	}
+	rows, err := tx.QueryContext(ctx, r.dialect.Rebind("SELECT email, response_status FROM booking_participants WHERE booking_id = ?"), bookingID)
+	if err != nil {
+		return err
+	}
+	responses := map[string]string{}
+	for rows.Next() {
+		var email string
+		var status sql.NullString
+		if err := rows.Scan(&email, &status); err != nil {
+			rows.Close()
+			return err
+		}
+		responses[email] = status.String
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, r.dialect.Rebind("DELETE FROM booking_participants WHERE booking_id = ?"), bookingID); err != nil {
+		return err
+	}
+	for _, p := range participants {
+		email := strings.ToLower(strings.TrimSpace(p.Email))
+		status := responses[email]
+		if status == "" {
+			status = p.ResponseStatus
+		}
+		if status == "" {
+			status = ResponseNeedsAction
+		}
+		_, err := tx.ExecContext(ctx, r.dialect.Rebind(`INSERT INTO booking_participants(booking_id, email, is_required, response_status)
+			VALUES (?, ?, ?, ?)`), bookingID, email, p.Required, status)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetParticipantResponse records an attendee's answer to an invitation. It
+// returns sql.ErrNoRows if email is not invited to the booking.
+func (r *Repository) SetParticipantResponse(ctx context.Context, bookingID, email, status string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.exec(ctx, "UPDATE booking_participants SET response_status = ? WHERE booking_id = ? AND email = ?",
+		status, bookingID, strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		return r.lookupErr(err)
+	}
+	return expectAffected(res)
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Reminder is a row of booking_reminders: one person's reminder of one start
+// of a booking. Moving the booking calls for a new reminder.
+type Reminder struct {
+	BookingID string
+	Email     string
+	StartsAt  time.Time
+}
+
+// ClaimReminder records that the caller is sending a reminder, so no other
+// server sends it too. It reports false if the reminder was sent already, or
+// claimed since staleBefore; older claims are taken to have been abandoned.
+func (r *Repository) ClaimReminder(ctx context.Context, rem Reminder, now, staleBefore time.Time) (bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	email, start := strings.ToLower(rem.Email), rem.StartsAt.UTC()
+	res, err := r.exec(ctx, `INSERT INTO booking_reminders(booking_id, email, starts_at_utc, claimed_at)
+		VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING`, rem.BookingID, email, start, now.UTC())
+	if err != nil {
+		return false, r.lookupErr(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return n > 0, err
+	}
+	res, err = r.exec(ctx, `UPDATE booking_reminders SET claimed_at = ?
+		WHERE booking_id = ? AND email = ? AND starts_at_utc = ? AND sent_at IS NULL AND claimed_at < ?`,
+		now.UTC(), rem.BookingID, email, start, staleBefore.UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// MarkReminderSent records that a claimed reminder went out
+func (r *Repository) MarkReminderSent(ctx context.Context, rem Reminder, at time.Time) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.exec(ctx, "UPDATE booking_reminders SET sent_at = ? WHERE booking_id = ? AND email = ? AND starts_at_utc = ?",
+		at.UTC(), rem.BookingID, strings.ToLower(rem.Email), rem.StartsAt.UTC())
+	if err != nil {
+		return r.lookupErr(err)
+	}
+	return expectAffected(res)
+}
+
+// ReleaseReminder gives up a claim on a reminder that could not be sent, so it
+// can be claimed again straight away
+func (r *Repository) ReleaseReminder(ctx context.Context, rem Reminder) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.exec(ctx, "DELETE FROM booking_reminders WHERE booking_id = ? AND email = ? AND starts_at_utc = ? AND sent_at IS NULL",
+		rem.BookingID, strings.ToLower(rem.Email), rem.StartsAt.UTC())
+	return r.lookupErr(err)
+}
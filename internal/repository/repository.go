@@ -1,17 +1,38 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"errors"
+	"sync"
+	"time"
 )
 
 type Repository struct {
-	db     *sql.DB
-	driver string
+	db      *sql.DB
+	driver  string
+	dialect Dialect
+	// queryTimeout bounds each repository call; zero leaves only the caller's deadline
+	queryTimeout time.Duration
+	// bookingMu serialises booking writes on dialects without row locks (SQLite)
+	bookingMu sync.Mutex
 }
 
 func New(db *sql.DB, driver string) *Repository {
-	return &Repository{db: db, driver: driver}
+	return &Repository{db: db, driver: driver, dialect: dialectFor(driver)}
+}
+
+// SetQueryTimeout sets the deadline applied to every repository call. Zero disables it.
+func (r *Repository) SetQueryTimeout(d time.Duration) {
+	r.queryTimeout = d
+}
+
+// withTimeout derives the context a repository call runs under
+func (r *Repository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.queryTimeout)
 }
 
 func (r *Repository) DB() *sql.DB {
@@ -22,76 +43,105 @@ func (r *Repository) Driver() string {
 	return r.driver
 }
 
-// Placeholder for user methods
+// exec, query and queryRow run a ?-placeholder query through the dialect.
+// exec records the audit entries pending on ctx with the statement, unless
+// it changes no rows.
+func (r *Repository) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if !auditPending(ctx) {
+		return r.db.ExecContext(ctx, r.dialect.Rebind(query), args...)
+	}
+	var res sql.Result
+	_, err := r.audited(ctx, func(tx *sql.Tx) ([]string, error) {
+		var err error
+		if res, err = tx.ExecContext(ctx, r.dialect.Rebind(query), args...); err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return nil, errNoChange
+		}
+		return nil, nil
+	})
+	if errors.Is(err, errNoChange) {
+		return res, nil
+	}
+	return res, err
+}
+
+func (r *Repository) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return r.db.QueryContext(ctx, r.dialect.Rebind(query), args...)
+}
+
+func (r *Repository) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return r.db.QueryRowContext(ctx, r.dialect.Rebind(query), args...)
+}
+
+// lookupErr reports ids the database rejects outright (such as a malformed uuid) as sql.ErrNoRows
+func (r *Repository) lookupErr(err error) error {
+	if err != nil && r.dialect.IsInvalidID(err) {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+// User is a row of users. ReminderMinutes, when set, overrides how long
+// before a booking starts the office reminds the user of it.
 type User struct {
-	ID       string
-	Email    string
-	Role     string
-	Timezone string
+	ID              string
+	Email           string
+	Role            string
+	Timezone        string
+	ReminderMinutes *int
 }
 
-func (r *Repository) GetUserByID(id string) (*User, error) {
+const userColumns = "id, email, role, timezone, reminder_minutes"
+
+func scanUser(s rowScanner) (*User, error) {
 	var user User
-	query := "SELECT id, email, role, timezone FROM users WHERE id = $1"
-	if r.driver == "sqlite3" {
-		query = "SELECT id, email, role, timezone FROM users WHERE id = ?"
-	}
-	err := r.db.QueryRow(query, id).Scan(&user.ID, &user.Email, &user.Role, &user.Timezone)
-	if err != nil {
+	var reminder sql.NullInt64
+	if err := s.Scan(&user.ID, &user.Email, &user.Role, &user.Timezone, &reminder); err != nil {
 		return nil, err
 	}
+	if reminder.Valid {
+		minutes := int(reminder.Int64)
+		user.ReminderMinutes = &minutes
+	}
 	return &user, nil
 }
 
-// CreateUser inserts a new user and returns the new ID
-func (r *Repository) CreateUser(email, displayName, role, passwordHash string) (string, error) {
-	var query string
-	if r.driver == "sqlite3" {
-		query = "INSERT INTO users(email, display_name, role, password_hash) VALUES (?, ?, ?, ?)"
-	} else {
-		query = "INSERT INTO users(email, display_name, role, password_hash) VALUES ($1, $2, $3, $4)"
-	}
-	if _, err := r.db.Exec(query, email, displayName, role, passwordHash); err != nil {
-		return "", err
-	}
-	// Try to select id by email
-	sel := "SELECT id FROM users WHERE email = $1"
-	if r.driver == "sqlite3" {
-		sel = "SELECT id FROM users WHERE email = ?"
-	}
-	var id string
-	if err := r.db.QueryRow(sel, email).Scan(&id); err != nil {
-		return email, nil
+func (r *Repository) GetUserByID(ctx context.Context, id string) (*User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	user, err := scanUser(r.queryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", id))
+	if err != nil {
+		return nil, r.lookupErr(err)
 	}
-	return id, nil
+	return user, nil
+}
+
+// CreateUser inserts a new user and returns the new ID
+func (r *Repository) CreateUser(ctx context.Context, email, displayName, role, passwordHash string) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return r.insert(ctx,
+		"INSERT INTO users(email, display_name, role, password_hash) VALUES (?, ?, ?, ?)",
+		email, displayName, role, passwordHash)
 }
 
 // GetUserByEmail fetches a user by email
-func (r *Repository) GetUserByEmail(email string) (*User, error) {
-	var user User
-	query := "SELECT id, email, role, timezone, display_name, password_hash FROM users WHERE email = $1"
-	if r.driver == "sqlite3" {
-		query = "SELECT id, email, role, timezone, display_name, password_hash FROM users WHERE email = ?"
-	}
-	var displayName sql.NullString
-	var passwordHash sql.NullString
-	err := r.db.QueryRow(query, email).Scan(&user.ID, &user.Email, &user.Role, &user.Timezone, &displayName, &passwordHash)
-	if err != nil {
-		return nil, err
-	}
-	// Note: password_hash and display_name not stored in struct currently; user of this method can query DB directly if needed
-	return &user, nil
+func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return scanUser(r.queryRow(ctx, "SELECT "+userColumns+" FROM users WHERE email = ?", email))
 }
 
 // GetUserCredentials returns id, password_hash, role, display_name for an email
-func (r *Repository) GetUserCredentials(email string) (id string, passwordHash string, role string, displayName string, err error) {
-	query := "SELECT id, password_hash, role, display_name FROM users WHERE email = $1"
-	if r.driver == "sqlite3" {
-		query = "SELECT id, password_hash, role, display_name FROM users WHERE email = ?"
-	}
+func (r *Repository) GetUserCredentials(ctx context.Context, email string) (id string, passwordHash string, role string, displayName string, err error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 	var ph sql.NullString
 	var dn sql.NullString
-	err = r.db.QueryRow(query, email).Scan(&id, &ph, &role, &dn)
+	err = r.queryRow(ctx, "SELECT id, password_hash, role, display_name FROM users WHERE email = ?", email).
+		Scan(&id, &ph, &role, &dn)
 	if err != nil {
 		return "", "", "", "", err
 	}
@@ -105,83 +155,112 @@ func (r *Repository) GetUserCredentials(email string) (id string, passwordHash s
 }
 
 // ListUsers returns a simple list of users
-func (r *Repository) ListUsers() ([]User, error) {
-	query := "SELECT id, email, role, timezone FROM users"
-	if r.driver == "sqlite3" {
-		query = "SELECT id, email, role, timezone FROM users"
-	}
-	rows, err := r.db.Query(query)
+func (r *Repository) ListUsers(ctx context.Context) ([]User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.query(ctx, "SELECT "+userColumns+" FROM users")
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var out []User
 	for rows.Next() {
-		var u User
-		if err := rows.Scan(&u.ID, &u.Email, &u.Role, &u.Timezone); err != nil {
+		u, err := scanUser(rows)
+		if err != nil {
 			continue
 		}
-		out = append(out, u)
+		out = append(out, *u)
 	}
-	return out, nil
+	return out, rows.Err()
 }
 
-// UpdateUserRole updates a user's role
-func (r *Repository) UpdateUserRole(id, role string) error {
-	query := "UPDATE users SET role = $1 WHERE id = $2"
-	if r.driver == "sqlite3" {
-		query = "UPDATE users SET role = ? WHERE id = ?"
+// UpdateUserRole updates a user's role; it returns sql.ErrNoRows if there is no such user
+func (r *Repository) UpdateUserRole(ctx context.Context, id, role string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.exec(ctx, "UPDATE users SET role = ? WHERE id = ?", role, id)
+	if err != nil {
+		return r.lookupErr(err)
 	}
-	_, err := r.db.Exec(query, role, id)
-	return err
+	return expectAffected(res)
 }
 
-// CreateOffice inserts a new office and returns its id (or name fallback)
-func (r *Repository) CreateOffice(name, timezone string) (string, error) {
-	query := "INSERT INTO offices(name, timezone) VALUES ($1, $2)"
-	if r.driver == "sqlite3" {
-		query = "INSERT INTO offices(name, timezone) VALUES (?, ?)"
-	}
-	res, err := r.db.Exec(query, name, timezone)
+// SetFeedToken stores the hash of a user's personal calendar feed token,
+// replacing any earlier one; an empty hash turns the feed off. It returns
+// sql.ErrNoRows if there is no such user.
+func (r *Repository) SetFeedToken(ctx context.Context, id, tokenHash string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.exec(ctx, "UPDATE users SET feed_token_hash = ? WHERE id = ?", nullString(tokenHash), id)
 	if err != nil {
-		return "", err
+		return r.lookupErr(err)
 	}
-	if id, err := res.LastInsertId(); err == nil && id > 0 {
-		return fmt.Sprintf("%d", id), nil
+	return expectAffected(res)
+}
+
+// HasFeedToken reports whether a user's personal calendar feed is on
+func (r *Repository) HasFeedToken(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var hash sql.NullString
+	if err := r.queryRow(ctx, "SELECT feed_token_hash FROM users WHERE id = ?", id).Scan(&hash); err != nil {
+		return false, r.lookupErr(err)
 	}
-	return name, nil
+	return hash.Valid, nil
 }
 
-// CreateFloor inserts a new floor under an office
-func (r *Repository) CreateFloor(officeID string, number int, label string) (string, error) {
-	query := "INSERT INTO floors(office_id, number, label) VALUES ($1, $2, $3)"
-	if r.driver == "sqlite3" {
-		query = "INSERT INTO floors(office_id, number, label) VALUES (?, ?, ?)"
+// GetUserByFeedToken fetches the user whose feed token has the given hash
+func (r *Repository) GetUserByFeedToken(ctx context.Context, tokenHash string) (*User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return scanUser(r.queryRow(ctx, "SELECT "+userColumns+" FROM users WHERE feed_token_hash = ?", tokenHash))
+}
+
+// SetReminderMinutes sets how long before bookings start a user is reminded
+// of them; nil goes back to each office's default. It returns sql.ErrNoRows if
+// there is no such user.
+func (r *Repository) SetReminderMinutes(ctx context.Context, id string, minutes *int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var value sql.NullInt64
+	if minutes != nil {
+		value = sql.NullInt64{Int64: int64(*minutes), Valid: true}
 	}
-	res, err := r.db.Exec(query, officeID, number, label)
+	res, err := r.exec(ctx, "UPDATE users SET reminder_minutes = ? WHERE id = ?", value, id)
 	if err != nil {
-		return "", err
-	}
-	if id, err := res.LastInsertId(); err == nil && id > 0 {
-		return fmt.Sprintf("%d", id), nil
+		return r.lookupErr(err)
 	}
-	return fmt.Sprintf("%s-%d", officeID, number), nil
+	return expectAffected(res)
 }
 
-// CreateRoom inserts a new room under a floor
-func (r *Repository) CreateRoom(floorID, name string, capacity int, equipment string) (string, error) {
-	query := "INSERT INTO rooms(floor_id, name, capacity, equipment) VALUES ($1, $2, $3, $4)"
-	if r.driver == "sqlite3" {
-		query = "INSERT INTO rooms(floor_id, name, capacity, equipment) VALUES (?, ?, ?, ?)"
-	}
-	res, err := r.db.Exec(query, floorID, name, capacity, equipment)
+// CreateOffice inserts a new office and returns its id
+func (r *Repository) CreateOffice(ctx context.Context, name, timezone string) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return r.insert(ctx, "INSERT INTO offices(name, timezone) VALUES (?, ?)", name, timezone)
+}
+
+// CreateRoom inserts a new room under a floor and returns its id
+func (r *Repository) CreateRoom(ctx context.Context, floorID, name string, capacity int, equipment string) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return r.insert(ctx, "INSERT INTO rooms(floor_id, name, capacity, equipment) VALUES (?, ?, ?, ?)",
+		floorID, name, capacity, equipment)
+}
+
+// GetRoomGraphResource returns the Graph mailbox of a room, or "" if the room is not synced to Graph
+func (r *Repository) GetRoomGraphResource(ctx context.Context, roomID string) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var enabled sql.NullBool
+	var resourceID sql.NullString
+	err := r.queryRow(ctx, "SELECT has_graph_integration, graph_resource_id FROM rooms WHERE id = ?", roomID).
+		Scan(&enabled, &resourceID)
 	if err != nil {
-		return "", err
+		return "", r.lookupErr(err)
 	}
-	if id, err := res.LastInsertId(); err == nil && id > 0 {
-		return fmt.Sprintf("%d", id), nil
+	if !enabled.Bool {
+		return "", nil
 	}
-	return name, nil
+	return resourceID.String, nil
 }
-
-// Add more repository methods as needed
@@ -1,11 +1,17 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/migrate"
+	"roombooker/migrations"
 )
 
 func TestRepository_GetUserByID(t *testing.T) {
@@ -20,7 +26,8 @@ func TestRepository_GetUserByID(t *testing.T) {
 		email TEXT UNIQUE NOT NULL,
 		display_name TEXT,
 		role TEXT NOT NULL DEFAULT 'user',
-		timezone TEXT DEFAULT 'UTC'
+		timezone TEXT DEFAULT 'UTC',
+		reminder_minutes INTEGER
 	)`)
 	assert.NoError(t, err)
 
@@ -31,7 +38,7 @@ func TestRepository_GetUserByID(t *testing.T) {
 
 	repo := New(db, "sqlite3")
 
-	user, err := repo.GetUserByID("test-id")
+	user, err := repo.GetUserByID(context.Background(), "test-id")
 	assert.NoError(t, err)
 	assert.NotNil(t, user)
 	assert.Equal(t, "test-id", user.ID)
@@ -49,13 +56,90 @@ func TestRepository_GetUserByID_NotFound(t *testing.T) {
 		email TEXT UNIQUE NOT NULL,
 		display_name TEXT,
 		role TEXT NOT NULL DEFAULT 'user',
-		timezone TEXT DEFAULT 'UTC'
+		timezone TEXT DEFAULT 'UTC',
+		reminder_minutes INTEGER
 	)`)
 	assert.NoError(t, err)
 
 	repo := New(db, "sqlite3")
 
-	user, err := repo.GetUserByID("non-existent")
+	user, err := repo.GetUserByID(context.Background(), "non-existent")
 	assert.Error(t, err)
 	assert.Nil(t, user)
 }
+
+// newMigratedTestRepo returns a repository over an empty in-memory SQLite database with the embedded schema applied
+func newMigratedTestRepo(t *testing.T) *Repository {
+	db, err := sql.Open("sqlite3", "file::memory:?_fk=1")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	fsys, err := migrations.ForDriver("sqlite3")
+	require.NoError(t, err)
+	m, err := migrate.New(db, "sqlite3", fsys)
+	require.NoError(t, err)
+	_, err = m.Up(context.Background())
+	require.NoError(t, err)
+	// Drop the demo data; tests create the rows they need
+	_, err = db.Exec("DELETE FROM offices; DELETE FROM users")
+	require.NoError(t, err)
+	return New(db, "sqlite3")
+}
+
+func TestRepository_CreateReturnsGeneratedIDs(t *testing.T) {
+	repo := newMigratedTestRepo(t)
+
+	officeID, err := repo.CreateOffice(context.Background(), "HQ", "Europe/London")
+	require.NoError(t, err)
+	floorID, err := repo.CreateFloor(context.Background(), officeID, 3, "Third")
+	require.NoError(t, err)
+	roomID, err := repo.CreateRoom(context.Background(), floorID, "Boardroom", 12, `{"vc": true}`)
+	require.NoError(t, err)
+	userID, err := repo.CreateUser(context.Background(), "new@example.com", "New User", "user", "hash")
+	require.NoError(t, err)
+
+	// The returned ids are the real primary keys, not names or rowids
+	for _, id := range []string{officeID, floorID, roomID, userID} {
+		assert.Len(t, id, 36)
+	}
+	var name string
+	require.NoError(t, repo.DB().QueryRow("SELECT name FROM rooms WHERE id = ? AND floor_id = ?", roomID, floorID).Scan(&name))
+	assert.Equal(t, "Boardroom", name)
+
+	user, err := repo.GetUserByID(context.Background(), userID)
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", user.Email)
+}
+
+func TestRepository_QueryTimeout(t *testing.T) {
+	repo := newMigratedTestRepo(t)
+	repo.SetQueryTimeout(time.Nanosecond)
+
+	_, err := repo.CreateOffice(context.Background(), "HQ", "UTC")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	repo.SetQueryTimeout(0)
+	_, err = repo.CreateOffice(context.Background(), "HQ", "UTC")
+	assert.NoError(t, err)
+}
+
+func TestRepository_FloorNumberUnique(t *testing.T) {
+	repo := newMigratedTestRepo(t)
+	ctx := context.Background()
+	officeID, err := repo.CreateOffice(ctx, "HQ", "UTC")
+	require.NoError(t, err)
+	_, err = repo.CreateFloor(ctx, officeID, 1, "Ground")
+	require.NoError(t, err)
+
+	// Two requests passing checkFloorNumber at once still get one floor
+	_, err = repo.exec(ctx, "INSERT INTO floors(office_id, number, label) VALUES (?, ?, ?)", officeID, 1, "Also ground")
+	require.Error(t, err)
+	assert.True(t, repo.dialect.IsDuplicate(err))
+	assert.ErrorIs(t, repo.floorWriteError(err), ErrFloorNumberTaken)
+
+	otherID, err := repo.CreateOffice(ctx, "Annex", "UTC")
+	require.NoError(t, err)
+	_, err = repo.CreateFloor(ctx, otherID, 1, "Ground")
+	assert.NoError(t, err, "other offices may use the number")
+}
@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BookingRule is one row of booking_rules. Clock times are offsets from local
+// midnight in the rule's timezone; intervals are parsed from the stored text.
+type BookingRule struct {
+	ID             string
+	OfficeID       string
+	WorkdayStart   time.Duration
+	WorkdayEnd     time.Duration
+	MaxDuration    time.Duration
+	MinLeadTime    time.Duration
+	BufferBefore   time.Duration
+	BufferAfter    time.Duration
+	AllowRecurring bool
+	Timezone       string
+	EffectiveFrom  time.Time
+}
+
+// Intervals and clock times are cast to text so SQLite TEXT and PostgreSQL time/interval scan alike
+const bookingRuleColumns = `id, office_id, CAST(workday_start AS TEXT), CAST(workday_end AS TEXT),
+	CAST(max_duration AS TEXT), CAST(min_lead_time AS TEXT), CAST(buffer_before AS TEXT), CAST(buffer_after AS TEXT),
+	allow_recurring, timezone, effective_from`
+
+// CreateBookingRule inserts a booking rule and returns its id.
+// A zero EffectiveFrom means the rule applies from now.
+func (r *Repository) CreateBookingRule(ctx context.Context, rule *BookingRule) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	effective := rule.EffectiveFrom
+	if effective.IsZero() {
+		effective = time.Now()
+	}
+	tz := rule.Timezone
+	if tz == "" {
+		tz = "UTC"
+	}
+	return r.insert(ctx,
+		`INSERT INTO booking_rules(office_id, workday_start, workday_end, max_duration, min_lead_time,
+		buffer_before, buffer_after, allow_recurring, timezone, effective_from)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rule.OfficeID, FormatClock(rule.WorkdayStart), FormatClock(rule.WorkdayEnd),
+		FormatInterval(rule.MaxDuration), FormatInterval(rule.MinLeadTime),
+		FormatInterval(rule.BufferBefore), FormatInterval(rule.BufferAfter),
+		rule.AllowRecurring, tz, effective.UTC())
+}
+
+// ListBookingRules returns an office's rules ordered by effective_from, oldest first
+func (r *Repository) ListBookingRules(ctx context.Context, officeID string) ([]BookingRule, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.query(ctx, "SELECT "+bookingRuleColumns+" FROM booking_rules WHERE office_id = ? ORDER BY effective_from", officeID)
+	if err != nil {
+		return nil, r.lookupErr(err)
+	}
+	defer rows.Close()
+	var out []BookingRule
+	for rows.Next() {
+		rule, err := scanBookingRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *rule)
+	}
+	return out, rows.Err()
+}
+
+func scanBookingRule(s rowScanner) (*BookingRule, error) {
+	var rule BookingRule
+	var officeID, tz sql.NullString
+	var start, end, maxDur, lead, before, after sql.NullString
+	var allowRecurring sql.NullBool
+	var effective sql.NullTime
+	if err := s.Scan(&rule.ID, &officeID, &start, &end, &maxDur, &lead, &before, &after, &allowRecurring, &tz, &effective); err != nil {
+		return nil, err
+	}
+	rule.OfficeID = officeID.String
+	rule.AllowRecurring = allowRecurring.Bool
+	rule.Timezone = tz.String
+	if rule.Timezone == "" {
+		rule.Timezone = "UTC"
+	}
+	if effective.Valid {
+		rule.EffectiveFrom = effective.Time.UTC()
+	}
+
+	var err error
+	if rule.WorkdayStart, err = ParseClock(start.String); err != nil {
+		return nil, fmt.Errorf("booking rule %s workday_start: %w", rule.ID, err)
+	}
+	if rule.WorkdayEnd, err = ParseClock(end.String); err != nil {
+		return nil, fmt.Errorf("booking rule %s workday_end: %w", rule.ID, err)
+	}
+	for _, f := range []struct {
+		name string
+		raw  sql.NullString
+		dst  *time.Duration
+	}{
+		{"max_duration", maxDur, &rule.MaxDuration},
+		{"min_lead_time", lead, &rule.MinLeadTime},
+		{"buffer_before", before, &rule.BufferBefore},
+		{"buffer_after", after, &rule.BufferAfter},
+	} {
+		if *f.dst, err = ParseInterval(f.raw.String); err != nil {
+			return nil, fmt.Errorf("booking rule %s %s: %w", rule.ID, f.name, err)
+		}
+	}
+	return &rule, nil
+}
+
+// ParseClock parses "HH:MM" or "HH:MM:SS" into an offset from midnight
+func ParseClock(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid clock time %q", s)
+	}
+	var total time.Duration
+	units := []time.Duration{time.Hour, time.Minute, time.Second}
+	for i, p := range parts {
+		n, err := strconv.ParseFloat(p, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid clock time %q", s)
+		}
+		total += time.Duration(n * float64(units[i]))
+	}
+	if total > 24*time.Hour {
+		return 0, fmt.Errorf("invalid clock time %q", s)
+	}
+	return total, nil
+}
+
+// FormatClock renders an offset from midnight as "HH:MM:SS"
+func FormatClock(d time.Duration) string {
+	secs := int(d / time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", secs/3600, secs%3600/60, secs%60)
+}
+
+// ParseInterval parses the interval text stored in booking_rules. It accepts the
+// SQLite seed style ("4 hours", "1 hour 30 minutes") and PostgreSQL's output
+// style ("04:00:00", "1 day 02:00:00"). An empty string is zero.
+func ParseInterval(s string) (time.Duration, error) {
+	fields := strings.Fields(strings.ToLower(s))
+	var total time.Duration
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if strings.Contains(f, ":") {
+			d, err := ParseClock(strings.TrimPrefix(f, "+"))
+			if err != nil {
+				return 0, fmt.Errorf("invalid interval %q", s)
+			}
+			total += d
+			continue
+		}
+		n, err := strconv.ParseFloat(f, 64)
+		if err != nil || i+1 >= len(fields) {
+			return 0, fmt.Errorf("invalid interval %q", s)
+		}
+		i++
+		unit, ok := intervalUnit(fields[i])
+		if !ok {
+			return 0, fmt.Errorf("invalid interval unit in %q", s)
+		}
+		total += time.Duration(n * float64(unit))
+	}
+	return total, nil
+}
+
+func intervalUnit(u string) (time.Duration, bool) {
+	switch strings.TrimSuffix(u, "s") {
+	case "sec", "second":
+		return time.Second, true
+	case "min", "minute":
+		return time.Minute, true
+	case "hour":
+		return time.Hour, true
+	case "day":
+		return 24 * time.Hour, true
+	case "week":
+		return 7 * 24 * time.Hour, true
+	}
+	return 0, false
+}
+
+// FormatInterval renders a duration as interval text both drivers accept, e.g. "90 minutes"
+func FormatInterval(d time.Duration) string {
+	if d%time.Minute != 0 {
+		return fmt.Sprintf("%d seconds", int64(d/time.Second))
+	}
+	return fmt.Sprintf("%d minutes", int64(d/time.Minute))
+}
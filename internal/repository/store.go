@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// UserStore reads and writes user accounts
+type UserStore interface {
+	GetUserByID(ctx context.Context, id string) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetUserCredentials(ctx context.Context, email string) (id string, passwordHash string, role string, displayName string, err error)
+	CreateUser(ctx context.Context, email, displayName, role, passwordHash string) (string, error)
+	ListUsers(ctx context.Context) ([]User, error)
+	UpdateUserRole(ctx context.Context, id, role string) error
+	SetFeedToken(ctx context.Context, id, tokenHash string) error
+	HasFeedToken(ctx context.Context, id string) (bool, error)
+	GetUserByFeedToken(ctx context.Context, tokenHash string) (*User, error)
+	SetReminderMinutes(ctx context.Context, id string, minutes *int) error
+}
+
+// OfficeStore manages the office → floor → room hierarchy
+type OfficeStore interface {
+	CreateOffice(ctx context.Context, name, timezone string) (string, error)
+	CreateFloor(ctx context.Context, officeID string, number int, label string) (string, error)
+	CreateRoom(ctx context.Context, floorID, name string, capacity int, equipment string) (string, error)
+	GetRoomGraphResource(ctx context.Context, roomID string) (string, error)
+	ListOffices(ctx context.Context) ([]Office, error)
+	GetOffice(ctx context.Context, id string) (*Office, error)
+	UpdateOffice(ctx context.Context, o *Office) error
+	DeleteOffice(ctx context.Context, id string, cascade bool) error
+	ListFloors(ctx context.Context, officeID string) ([]Floor, error)
+	GetFloor(ctx context.Context, id string) (*Floor, error)
+	UpdateFloor(ctx context.Context, f *Floor) error
+	DeleteFloor(ctx context.Context, id string) error
+	ListRoomsByOffice(ctx context.Context, officeID string) ([]Room, error)
+	GetRoom(ctx context.Context, id string) (*Room, error)
+	UpdateRoom(ctx context.Context, room *Room) error
+	DecommissionRoom(ctx context.Context, id string, at time.Time, cancelBookings bool) ([]Booking, error)
+	DeleteRoom(ctx context.Context, id string) error
+}
+
+// BookingStore manages room bookings. Writes reject overlapping active
+// bookings in the same room with a *ConflictError, or a *SeriesConflictError
+// when several bookings are written together.
+type BookingStore interface {
+	CreateBooking(ctx context.Context, b *Booking) (string, error)
+	CreateBookingSeries(ctx context.Context, occurrences []Booking) ([]string, error)
+	GetBooking(ctx context.Context, id string) (*Booking, error)
+	ListBookingsByRoom(ctx context.Context, roomID string, from, to time.Time) ([]Booking, error)
+	ListRoomCalendar(ctx context.Context, roomID string, since time.Time) ([]Booking, error)
+	ListUserCalendar(ctx context.Context, userID, email string, since time.Time) ([]Booking, error)
+	ListBookingsByOffice(ctx context.Context, officeID string, from, to time.Time) ([]Booking, error)
+	ListBookingsStarting(ctx context.Context, from, to time.Time) ([]Booking, error)
+	ListBookingSeries(ctx context.Context, seriesID string) ([]Booking, error)
+	UpdateBooking(ctx context.Context, b *Booking) error
+	UpdateBookings(ctx context.Context, bookings []Booking) error
+	CancelBooking(ctx context.Context, id string) error
+	CancelBookings(ctx context.Context, ids []string) error
+	SetBookingExternalEventID(ctx context.Context, id, externalID string) error
+}
+
+// ParticipantStore manages the people invited to bookings and their responses
+type ParticipantStore interface {
+	ListParticipants(ctx context.Context, bookingID string) ([]Participant, error)
+	SetParticipants(ctx context.Context, bookingID string, participants []Participant) error
+	SetParticipantResponse(ctx context.Context, bookingID, email, status string) error
+}
+
+// ReminderStore tracks the booking reminders sent, so that however many
+// servers run each is sent once
+type ReminderStore interface {
+	ClaimReminder(ctx context.Context, rem Reminder, now, staleBefore time.Time) (bool, error)
+	MarkReminderSent(ctx context.Context, rem Reminder, at time.Time) error
+	ReleaseReminder(ctx context.Context, rem Reminder) error
+}
+
+// RuleStore reads office booking policies
+type RuleStore interface {
+	CreateBookingRule(ctx context.Context, rule *BookingRule) (string, error)
+	ListBookingRules(ctx context.Context, officeID string) ([]BookingRule, error)
+}
+
+// HolidayStore manages the days each office is closed
+type HolidayStore interface {
+	CreateHoliday(ctx context.Context, h *Holiday) (string, error)
+	GetHoliday(ctx context.Context, id string) (*Holiday, error)
+	UpdateHoliday(ctx context.Context, h *Holiday) error
+	DeleteHoliday(ctx context.Context, id string) error
+	ListHolidays(ctx context.Context, officeID string) ([]Holiday, error)
+}
+
+// AuditStore records and queries the audit trail
+type AuditStore interface {
+	CreateAuditLog(ctx context.Context, entry *AuditLog) (string, error)
+	ListAuditLogs(ctx context.Context, filter AuditFilter) ([]AuditLog, error)
+}
+
+// Store is everything the HTTP layer needs from persistence. Every method takes
+// the caller's context; implementations stop work once it is done.
+type Store interface {
+	UserStore
+	OfficeStore
+	BookingStore
+	ParticipantStore
+	ReminderStore
+	RuleStore
+	HolidayStore
+	AuditStore
+}
+
+var _ Store = (*Repository)(nil)
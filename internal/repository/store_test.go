@@ -0,0 +1,63 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/migrate"
+	"roombooker/internal/repository"
+	"roombooker/internal/repository/storetest"
+	"roombooker/migrations"
+)
+
+// migrateSchema applies every migration; callers clear the seed rows since the suite creates its own
+func migrateSchema(t *testing.T, db *sql.DB, driver string) {
+	fsys, err := migrations.ForDriver(driver)
+	require.NoError(t, err)
+	m, err := migrate.New(db, driver, fsys)
+	require.NoError(t, err)
+	_, err = m.Up(context.Background())
+	require.NoError(t, err)
+}
+
+// TestStore_SQLite runs against a database file opened as the server opens
+// it, so concurrent cases contend for SQLite's write lock across connections
+func TestStore_SQLite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) repository.Store {
+		db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "store.db")+"?_busy_timeout=5000&_fk=1")
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		migrateSchema(t, db, "sqlite3")
+		// Foreign keys cascade from these to every other seeded table
+		_, err = db.Exec("DELETE FROM offices; DELETE FROM users")
+		require.NoError(t, err)
+		return repository.New(db, "sqlite3")
+	})
+}
+
+// TestStore_Postgres runs against the database in ROOMBOOKER_TEST_POSTGRES_DSN.
+// Every table in it is truncated between cases.
+func TestStore_Postgres(t *testing.T) {
+	dsn := os.Getenv("ROOMBOOKER_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("ROOMBOOKER_TEST_POSTGRES_DSN not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, db.Ping())
+	migrateSchema(t, db, "postgres")
+
+	storetest.Run(t, func(t *testing.T) repository.Store {
+		_, err := db.Exec("TRUNCATE users, offices, audit_logs CASCADE")
+		require.NoError(t, err)
+		return repository.New(db, "postgres")
+	})
+}
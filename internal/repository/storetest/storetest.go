@@ -0,0 +1,1233 @@
+// Package storetest is a conformance suite every repository.Store
+// implementation must pass. Implementations call Run from their own tests.
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"roombooker/internal/repository"
+)
+
+// missingID is a well-formed uuid that no fixture uses
+const missingID = "00000000-0000-4000-8000-000000000000"
+
+// Run exercises newStore, which must return an empty store for every call
+func Run(t *testing.T, newStore func(t *testing.T) repository.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s repository.Store)
+	}{
+		{"Users", testUsers},
+		{"UserNotFound", testUserNotFound},
+		{"FeedTokens", testFeedTokens},
+		{"ReminderPreferences", testReminderPreferences},
+		{"OfficeHierarchy", testOfficeHierarchy},
+		{"ListOfficesFloorsRooms", testListOfficesFloorsRooms},
+		{"FloorManagement", testFloorManagement},
+		{"UpdateAndDeleteOffice", testUpdateAndDeleteOffice},
+		{"RoomLifecycle", testRoomLifecycle},
+		{"CreateAndGetBooking", testCreateAndGetBooking},
+		{"BookingNotFound", testBookingNotFound},
+		{"ListBookingsByRoom", testListBookingsByRoom},
+		{"ListBookingsByOffice", testListBookingsByOffice},
+		{"ListRoomCalendar", testListRoomCalendar},
+		{"ListUserCalendar", testListUserCalendar},
+		{"BookingConflict", testBookingConflict},
+		{"UpdateAndCancelBooking", testUpdateAndCancelBooking},
+		{"BookingBuffers", testBookingBuffers},
+		{"ConcurrentSameSlot", testConcurrentSameSlot},
+		{"BookingSeries", testBookingSeries},
+		{"Participants", testParticipants},
+		{"BookingWithParticipants", testBookingWithParticipants},
+		{"Reminders", testReminders},
+		{"BookingRules", testBookingRules},
+		{"Holidays", testHolidays},
+		{"AuditLogs", testAuditLogs},
+		{"AuditedWrites", testAuditedWrites},
+		{"CancelledContext", testCancelledContext},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+type fixture struct {
+	officeID string
+	floorID  string
+	roomID   string
+	otherID  string
+	userID   string
+}
+
+func newFixture(t *testing.T, s repository.Store) fixture {
+	ctx := context.Background()
+	var f fixture
+	var err error
+	f.officeID, err = s.CreateOffice(ctx, "HQ", "Europe/Berlin")
+	require.NoError(t, err)
+	f.floorID, err = s.CreateFloor(ctx, f.officeID, 1, "Ground")
+	require.NoError(t, err)
+	f.roomID, err = s.CreateRoom(ctx, f.floorID, "Alpha", 6, `{"screen": true}`)
+	require.NoError(t, err)
+	f.otherID, err = s.CreateRoom(ctx, f.floorID, "Beta", 4, "")
+	require.NoError(t, err)
+	f.userID, err = s.CreateUser(ctx, "owner@example.com", "Owner", "user", "hash")
+	require.NoError(t, err)
+	return f
+}
+
+func (f fixture) booking(start time.Time, d time.Duration) *repository.Booking {
+	return &repository.Booking{
+		RoomID:    f.roomID,
+		CreatedBy: f.userID,
+		Title:     "Meeting",
+		StartsAt:  start,
+		EndsAt:    start.Add(d),
+	}
+}
+
+var day = time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+
+func testUsers(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	id, err := s.CreateUser(ctx, "alice@example.com", "Alice", "user", "secret-hash")
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+
+	u, err := s.GetUserByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", u.Email)
+	assert.Equal(t, "user", u.Role)
+	assert.Equal(t, "UTC", u.Timezone)
+
+	byEmail, err := s.GetUserByEmail(ctx, "alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, id, byEmail.ID)
+
+	credID, hash, role, name, err := s.GetUserCredentials(ctx, "alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, id, credID)
+	assert.Equal(t, "secret-hash", hash)
+	assert.Equal(t, "user", role)
+	assert.Equal(t, "Alice", name)
+
+	_, err = s.CreateUser(ctx, "alice@example.com", "Alice Again", "user", "")
+	assert.Error(t, err, "emails are unique")
+
+	require.NoError(t, s.UpdateUserRole(ctx, id, "admin"))
+	u, err = s.GetUserByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "admin", u.Role)
+
+	_, err = s.CreateUser(ctx, "bob@example.com", "Bob", "user", "")
+	require.NoError(t, err)
+	users, err := s.ListUsers(ctx)
+	require.NoError(t, err)
+	assert.Len(t, users, 2)
+}
+
+func testUserNotFound(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	_, err := s.GetUserByID(ctx, missingID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.GetUserByEmail(ctx, "nobody@example.com")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, _, _, _, err = s.GetUserCredentials(ctx, "nobody@example.com")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testFeedTokens(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	on, err := s.HasFeedToken(ctx, f.userID)
+	require.NoError(t, err)
+	assert.False(t, on)
+	_, err = s.GetUserByFeedToken(ctx, "first")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, s.SetFeedToken(ctx, f.userID, "first"))
+	u, err := s.GetUserByFeedToken(ctx, "first")
+	require.NoError(t, err)
+	assert.Equal(t, f.userID, u.ID)
+	on, err = s.HasFeedToken(ctx, f.userID)
+	require.NoError(t, err)
+	assert.True(t, on)
+
+	// Rotating replaces the old token
+	require.NoError(t, s.SetFeedToken(ctx, f.userID, "second"))
+	_, err = s.GetUserByFeedToken(ctx, "first")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.GetUserByFeedToken(ctx, "second")
+	require.NoError(t, err)
+
+	require.NoError(t, s.SetFeedToken(ctx, f.userID, ""))
+	_, err = s.GetUserByFeedToken(ctx, "second")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	on, err = s.HasFeedToken(ctx, f.userID)
+	require.NoError(t, err)
+	assert.False(t, on)
+
+	assert.ErrorIs(t, s.SetFeedToken(ctx, missingID, "third"), sql.ErrNoRows)
+	_, err = s.HasFeedToken(ctx, missingID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testReminderPreferences(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	u, err := s.GetUserByID(ctx, f.userID)
+	require.NoError(t, err)
+	assert.Nil(t, u.ReminderMinutes, "the office default")
+
+	for _, minutes := range []int{30, 0} {
+		minutes := minutes
+		require.NoError(t, s.SetReminderMinutes(ctx, f.userID, &minutes))
+		u, err = s.GetUserByEmail(ctx, "owner@example.com")
+		require.NoError(t, err)
+		require.NotNil(t, u.ReminderMinutes)
+		assert.Equal(t, minutes, *u.ReminderMinutes)
+	}
+	require.NoError(t, s.SetReminderMinutes(ctx, f.userID, nil))
+	users, err := s.ListUsers(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Nil(t, users[0].ReminderMinutes)
+
+	assert.ErrorIs(t, s.SetReminderMinutes(ctx, missingID, nil), sql.ErrNoRows)
+}
+
+func testOfficeHierarchy(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	assert.NotEqual(t, f.roomID, f.otherID)
+
+	_, err := s.CreateFloor(ctx, missingID, 2, "Nowhere")
+	assert.Error(t, err, "floors need an existing office")
+	_, err = s.CreateRoom(ctx, missingID, "Ghost", 2, "")
+	assert.Error(t, err, "rooms need an existing floor")
+
+	resource, err := s.GetRoomGraphResource(ctx, f.roomID)
+	require.NoError(t, err)
+	assert.Empty(t, resource, "new rooms are not synced to Graph")
+
+	_, err = s.GetRoomGraphResource(ctx, missingID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testListOfficesFloorsRooms(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s) // HQ, floor 1 "Ground" with Alpha and Beta
+	branchID, err := s.CreateOffice(ctx, "Branch", "")
+	require.NoError(t, err)
+	upperID, err := s.CreateFloor(ctx, f.officeID, 3, "Third")
+	require.NoError(t, err)
+	_, err = s.CreateRoom(ctx, upperID, "Attic", 2, "")
+	require.NoError(t, err)
+	branchFloorID, err := s.CreateFloor(ctx, branchID, 1, "Lobby")
+	require.NoError(t, err)
+	_, err = s.CreateRoom(ctx, branchFloorID, "Annex", 8, "")
+	require.NoError(t, err)
+
+	offices, err := s.ListOffices(ctx)
+	require.NoError(t, err)
+	require.Len(t, offices, 2)
+	assert.Equal(t, "Branch", offices[0].Name, "ordered by name")
+	assert.Equal(t, "UTC", offices[0].Timezone, "timezone defaults to UTC")
+	assert.Equal(t, "HQ", offices[1].Name)
+
+	office, err := s.GetOffice(ctx, f.officeID)
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/Berlin", office.Timezone)
+	_, err = s.GetOffice(ctx, missingID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	floors, err := s.ListFloors(ctx, f.officeID)
+	require.NoError(t, err)
+	require.Len(t, floors, 2)
+	assert.Equal(t, 1, floors[0].Number)
+	assert.Equal(t, "Ground", floors[0].Label)
+	assert.Equal(t, upperID, floors[1].ID)
+
+	rooms, err := s.ListRoomsByOffice(ctx, f.officeID)
+	require.NoError(t, err)
+	require.Len(t, rooms, 3, "rooms of other offices are excluded")
+	assert.Equal(t, []string{"Alpha", "Beta", "Attic"}, []string{rooms[0].Name, rooms[1].Name, rooms[2].Name},
+		"ordered by floor number, then name")
+	alpha := rooms[0]
+	assert.Equal(t, f.roomID, alpha.ID)
+	assert.Equal(t, f.officeID, alpha.OfficeID)
+	assert.Equal(t, f.floorID, alpha.FloorID)
+	assert.Equal(t, 1, alpha.FloorNumber)
+	assert.Equal(t, "Ground", alpha.FloorLabel)
+	assert.Equal(t, 6, alpha.Capacity)
+	assert.JSONEq(t, `{"screen": true}`, alpha.Equipment)
+	assert.False(t, alpha.GraphIntegration)
+
+	room, err := s.GetRoom(ctx, f.roomID)
+	require.NoError(t, err)
+	assert.Equal(t, alpha, *room)
+	_, err = s.GetRoom(ctx, missingID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	none, err := s.ListRoomsByOffice(ctx, missingID)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+}
+
+func testFloorManagement(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s) // floor 1 "Ground" holds two rooms
+
+	_, err := s.CreateFloor(ctx, f.officeID, 1, "Duplicate")
+	assert.ErrorIs(t, err, repository.ErrFloorNumberTaken)
+
+	emptyID, err := s.CreateFloor(ctx, f.officeID, 2, "Second")
+	require.NoError(t, err)
+	floor, err := s.GetFloor(ctx, emptyID)
+	require.NoError(t, err)
+	assert.Equal(t, repository.Floor{ID: emptyID, OfficeID: f.officeID, Number: 2, Label: "Second"}, *floor)
+
+	floor.Number = 1
+	assert.ErrorIs(t, s.UpdateFloor(ctx, floor), repository.ErrFloorNumberTaken)
+	floor.Number = 5
+	floor.Label = "Fifth"
+	require.NoError(t, s.UpdateFloor(ctx, floor))
+	floor, err = s.GetFloor(ctx, emptyID)
+	require.NoError(t, err)
+	assert.Equal(t, 5, floor.Number)
+	assert.Equal(t, "Fifth", floor.Label)
+
+	assert.ErrorIs(t, s.DeleteFloor(ctx, f.floorID), repository.ErrFloorHasRooms)
+	require.NoError(t, s.DeleteFloor(ctx, emptyID))
+	_, err = s.GetFloor(ctx, emptyID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	assert.ErrorIs(t, s.DeleteFloor(ctx, missingID), sql.ErrNoRows)
+	assert.ErrorIs(t, s.UpdateFloor(ctx, &repository.Floor{ID: missingID, Number: 9}), sql.ErrNoRows)
+}
+
+func testUpdateAndDeleteOffice(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	_, err := s.CreateBookingRule(ctx, &repository.BookingRule{OfficeID: f.officeID, WorkdayStart: 9 * time.Hour, WorkdayEnd: 17 * time.Hour, Timezone: "Europe/Berlin"})
+	require.NoError(t, err)
+
+	office, err := s.GetOffice(ctx, f.officeID)
+	require.NoError(t, err)
+	assert.Equal(t, repository.DefaultReminderMinutes, office.ReminderMinutes)
+
+	require.NoError(t, s.UpdateOffice(ctx, &repository.Office{ID: f.officeID, Name: "Head Office", Timezone: "Asia/Tokyo", ReminderMinutes: 5}))
+	office, err = s.GetOffice(ctx, f.officeID)
+	require.NoError(t, err)
+	assert.Equal(t, repository.Office{ID: f.officeID, Name: "Head Office", Timezone: "Asia/Tokyo", ReminderMinutes: 5}, *office)
+	rules, err := s.ListBookingRules(ctx, f.officeID)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.Equal(t, "Asia/Tokyo", rules[0].Timezone, "rules follow the office timezone")
+	assert.ErrorIs(t, s.UpdateOffice(ctx, &repository.Office{ID: missingID, Name: "Nowhere", Timezone: "UTC"}), sql.ErrNoRows)
+
+	bookingID, err := s.CreateBooking(ctx, f.booking(day.Add(9*time.Hour), time.Hour))
+	require.NoError(t, err)
+	assert.ErrorIs(t, s.DeleteOffice(ctx, f.officeID, false), repository.ErrOfficeNotEmpty)
+	_, err = s.GetRoom(ctx, f.roomID)
+	require.NoError(t, err, "a refused delete removes nothing")
+
+	emptyID, err := s.CreateOffice(ctx, "Empty", "UTC")
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteOffice(ctx, emptyID, false))
+	_, err = s.GetOffice(ctx, emptyID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, s.DeleteOffice(ctx, f.officeID, true))
+	_, err = s.GetOffice(ctx, f.officeID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.GetFloor(ctx, f.floorID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.GetRoom(ctx, f.roomID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.GetBooking(ctx, bookingID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	rules, err = s.ListBookingRules(ctx, f.officeID)
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+
+	assert.ErrorIs(t, s.DeleteOffice(ctx, missingID, false), sql.ErrNoRows)
+	assert.ErrorIs(t, s.DeleteOffice(ctx, missingID, true), sql.ErrNoRows)
+}
+
+func testRoomLifecycle(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+
+	room, err := s.GetRoom(ctx, f.roomID)
+	require.NoError(t, err)
+	assert.True(t, room.DecommissionedAt.IsZero())
+	room.Name = "Alpha Suite"
+	room.Capacity = 10
+	room.Equipment = `{"vc": true}`
+	room.Color = "#112233"
+	room.GraphIntegration = true
+	room.GraphResourceID = "alpha@example.com"
+	require.NoError(t, s.UpdateRoom(ctx, room))
+
+	got, err := s.GetRoom(ctx, f.roomID)
+	require.NoError(t, err)
+	assert.Equal(t, *room, *got)
+	resource, err := s.GetRoomGraphResource(ctx, f.roomID)
+	require.NoError(t, err)
+	assert.Equal(t, "alpha@example.com", resource)
+	assert.ErrorIs(t, s.UpdateRoom(ctx, &repository.Room{ID: missingID, Name: "Ghost"}), sql.ErrNoRows)
+
+	// Booked rooms cannot be hard-deleted, only decommissioned
+	_, err = s.CreateBooking(ctx, f.booking(day.Add(9*time.Hour), time.Hour))
+	require.NoError(t, err)
+	assert.ErrorIs(t, s.DeleteRoom(ctx, f.roomID), repository.ErrRoomHasBookings)
+
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	runningID, err := s.CreateBooking(ctx, f.booking(at.Add(-30*time.Minute), time.Hour))
+	require.NoError(t, err)
+	laterID, err := s.CreateBooking(ctx, f.booking(at.Add(24*time.Hour), time.Hour))
+	require.NoError(t, err)
+	upcomingID, err := s.CreateBooking(ctx, f.booking(at.Add(30*time.Minute), time.Hour))
+	require.NoError(t, err)
+
+	// Bookings starting from at on are cancelled, and audited, with the room;
+	// those already under way are left alone
+	var audited []string
+	cancelled, err := s.DecommissionRoom(repository.WithAudit(ctx, func(ids []string) []repository.AuditLog {
+		audited = ids
+		return []repository.AuditLog{{ActorUserID: f.userID, Action: "room.decommission", EntityType: "room", EntityID: f.roomID}}
+	}), f.roomID, at, true)
+	require.NoError(t, err)
+	require.Len(t, cancelled, 2)
+	assert.Equal(t, []string{upcomingID, laterID}, []string{cancelled[0].ID, cancelled[1].ID})
+	assert.Equal(t, repository.BookingStatusCancelled, cancelled[0].Status)
+	assert.Equal(t, []string{upcomingID, laterID}, audited)
+	cancelled, err = s.DecommissionRoom(ctx, f.roomID, at.Add(time.Hour), true)
+	require.NoError(t, err, "decommissioning twice is harmless")
+	assert.Empty(t, cancelled)
+	got, err = s.GetRoom(ctx, f.roomID)
+	require.NoError(t, err)
+	assert.True(t, at.Equal(got.DecommissionedAt), "the first decommission time is kept")
+	for id, status := range map[string]string{
+		runningID:  repository.BookingStatusActive,
+		upcomingID: repository.BookingStatusCancelled,
+		laterID:    repository.BookingStatusCancelled,
+	} {
+		b, err := s.GetBooking(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, status, b.Status)
+	}
+
+	rooms, err := s.ListRoomsByOffice(ctx, f.officeID)
+	require.NoError(t, err)
+	require.Len(t, rooms, 1, "decommissioned rooms are not listed")
+	assert.Equal(t, f.otherID, rooms[0].ID)
+
+	history, err := s.ListBookingsByRoom(ctx, f.roomID, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, history, 2, "bookings survive decommissioning")
+
+	require.NoError(t, s.DeleteRoom(ctx, f.otherID))
+	_, err = s.GetRoom(ctx, f.otherID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.ErrorIs(t, s.DeleteRoom(ctx, missingID), sql.ErrNoRows)
+	_, err = s.DecommissionRoom(ctx, missingID, at, true)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testCreateAndGetBooking(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	start := day.Add(10 * time.Hour)
+	b := f.booking(start, time.Hour)
+	b.Description = "Quarterly review"
+
+	id, err := s.CreateBooking(ctx, b)
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+
+	got, err := s.GetBooking(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, id, got.ID)
+	assert.Equal(t, f.roomID, got.RoomID)
+	assert.Equal(t, f.userID, got.CreatedBy)
+	assert.Equal(t, "Meeting", got.Title)
+	assert.Equal(t, "Quarterly review", got.Description)
+	assert.Equal(t, repository.BookingStatusActive, got.Status)
+	assert.True(t, start.Equal(got.StartsAt))
+	assert.True(t, start.Add(time.Hour).Equal(got.EndsAt))
+	assert.Equal(t, time.UTC, got.StartsAt.Location())
+
+	require.NoError(t, s.SetBookingExternalEventID(ctx, id, "evt-1"))
+	got, err = s.GetBooking(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "evt-1", got.ExternalEventID)
+}
+
+func testBookingNotFound(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	_, err := s.GetBooking(ctx, missingID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.GetBooking(ctx, "not-a-uuid")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.ErrorIs(t, s.CancelBooking(ctx, missingID), sql.ErrNoRows)
+	assert.ErrorIs(t, s.SetBookingExternalEventID(ctx, missingID, "evt"), sql.ErrNoRows)
+
+	f := newFixture(t, s)
+	b := f.booking(day.Add(9*time.Hour), time.Hour)
+	b.ID = missingID
+	assert.ErrorIs(t, s.UpdateBooking(ctx, b), sql.ErrNoRows)
+}
+
+func testListBookingsByRoom(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	for _, h := range []int{14, 9, 11} {
+		_, err := s.CreateBooking(ctx, f.booking(day.Add(time.Duration(h)*time.Hour), time.Hour))
+		require.NoError(t, err)
+	}
+	other := f.booking(day.Add(9*time.Hour), time.Hour)
+	other.RoomID = f.otherID
+	_, err := s.CreateBooking(ctx, other)
+	require.NoError(t, err)
+
+	all, err := s.ListBookingsByRoom(ctx, f.roomID, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	for i, h := range []int{9, 11, 14} {
+		assert.Equal(t, h, all[i].StartsAt.Hour(), "ordered by start")
+	}
+
+	// [10:30, 14:00) overlaps 11:00 only; touching bookings do not overlap
+	window, err := s.ListBookingsByRoom(ctx, f.roomID, day.Add(10*time.Hour+30*time.Minute), day.Add(14*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, window, 1)
+	assert.Equal(t, 11, window[0].StartsAt.Hour())
+
+	require.NoError(t, s.CancelBooking(ctx, all[0].ID))
+	all, err = s.ListBookingsByRoom(ctx, f.roomID, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, all, 2, "cancelled bookings are not listed")
+}
+
+func testListRoomCalendar(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	var ids []string
+	for _, h := range []int{14, 9, 11} {
+		id, err := s.CreateBooking(ctx, f.booking(day.Add(time.Duration(h)*time.Hour), time.Hour))
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	other := f.booking(day.Add(9*time.Hour), time.Hour)
+	other.RoomID = f.otherID
+	_, err := s.CreateBooking(ctx, other)
+	require.NoError(t, err)
+	require.NoError(t, s.CancelBooking(ctx, ids[1]))
+
+	all, err := s.ListRoomCalendar(ctx, f.roomID, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, all, 3, "cancelled bookings are listed")
+	assert.Equal(t, ids[1], all[0].ID, "ordered by start")
+	assert.Equal(t, repository.BookingStatusCancelled, all[0].Status)
+
+	// Bookings ending by since are left out
+	later, err := s.ListRoomCalendar(ctx, f.roomID, day.Add(12*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, later, 1)
+	assert.Equal(t, ids[0], later[0].ID)
+}
+
+func testListUserCalendar(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	guestID, err := s.CreateUser(ctx, "guest@example.com", "Guest", "user", "")
+	require.NoError(t, err)
+
+	own, err := s.CreateBooking(ctx, f.booking(day.Add(11*time.Hour), time.Hour))
+	require.NoError(t, err)
+	invitedTo := f.booking(day.Add(9*time.Hour), time.Hour)
+	invitedTo.RoomID = f.otherID
+	invitedTo.CreatedBy = guestID
+	invited, err := s.CreateBooking(ctx, invitedTo)
+	require.NoError(t, err)
+	require.NoError(t, s.SetParticipants(ctx, invited, []repository.Participant{{Email: "Owner@Example.com", Required: true}}))
+	notMine := f.booking(day.Add(14*time.Hour), time.Hour)
+	notMine.CreatedBy = guestID
+	_, err = s.CreateBooking(ctx, notMine)
+	require.NoError(t, err)
+	require.NoError(t, s.CancelBooking(ctx, own))
+
+	all, err := s.ListUserCalendar(ctx, f.userID, "owner@example.com", time.Time{})
+	require.NoError(t, err)
+	require.Len(t, all, 2, "bookings made or invited to, cancelled ones included")
+	assert.Equal(t, invited, all[0].ID, "ordered by start")
+	assert.Equal(t, own, all[1].ID)
+	assert.Equal(t, repository.BookingStatusCancelled, all[1].Status)
+
+	later, err := s.ListUserCalendar(ctx, f.userID, "owner@example.com", day.Add(10*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, later, 1)
+	assert.Equal(t, own, later[0].ID)
+}
+
+func testListBookingsByOffice(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	for _, b := range []*repository.Booking{f.booking(day.Add(11*time.Hour), time.Hour), f.booking(day.Add(9*time.Hour), time.Hour)} {
+		_, err := s.CreateBooking(ctx, b)
+		require.NoError(t, err)
+	}
+	other := f.booking(day.Add(10*time.Hour), time.Hour)
+	other.RoomID = f.otherID
+	_, err := s.CreateBooking(ctx, other)
+	require.NoError(t, err)
+
+	elsewhereID, err := s.CreateOffice(ctx, "Branch", "UTC")
+	require.NoError(t, err)
+	floorID, err := s.CreateFloor(ctx, elsewhereID, 1, "")
+	require.NoError(t, err)
+	roomID, err := s.CreateRoom(ctx, floorID, "Gamma", 2, "")
+	require.NoError(t, err)
+	elsewhere := f.booking(day.Add(9*time.Hour), time.Hour)
+	elsewhere.RoomID = roomID
+	_, err = s.CreateBooking(ctx, elsewhere)
+	require.NoError(t, err)
+
+	all, err := s.ListBookingsByOffice(ctx, f.officeID, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, all, 3, "bookings of other offices are not listed")
+	for i, h := range []int{9, 10, 11} {
+		assert.Equal(t, h, all[i].StartsAt.Hour(), "ordered by start")
+	}
+
+	window, err := s.ListBookingsByOffice(ctx, f.officeID, day.Add(10*time.Hour), day.Add(11*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, window, 1)
+	assert.Equal(t, f.otherID, window[0].RoomID)
+
+	require.NoError(t, s.CancelBooking(ctx, all[0].ID))
+	all, err = s.ListBookingsByOffice(ctx, f.officeID, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, all, 2, "cancelled bookings are not listed")
+}
+
+func testBookingSeries(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	var occurrences []repository.Booking
+	for i := 0; i < 3; i++ {
+		b := f.booking(day.AddDate(0, 0, i).Add(10*time.Hour), time.Hour)
+		b.RRule = "FREQ=DAILY;COUNT=3"
+		b.RecurrenceID = b.StartsAt
+		occurrences = append(occurrences, *b)
+	}
+	blockerID, err := s.CreateBooking(ctx, f.booking(day.AddDate(0, 0, 1).Add(10*time.Hour+30*time.Minute), time.Hour))
+	require.NoError(t, err)
+
+	_, err = s.CreateBookingSeries(ctx, occurrences)
+	require.ErrorIs(t, err, repository.ErrBookingConflict)
+	var conflict *repository.SeriesConflictError
+	require.True(t, errors.As(err, &conflict))
+	require.Len(t, conflict.Occurrences, 1, "only the blocked occurrence is reported")
+	assert.True(t, occurrences[1].StartsAt.Equal(conflict.Occurrences[0].StartsAt))
+	require.Len(t, conflict.Occurrences[0].Conflicts, 1)
+	assert.Equal(t, blockerID, conflict.Occurrences[0].Conflicts[0].ID)
+	all, err := s.ListBookingsByRoom(ctx, f.roomID, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, all, 1, "nothing of a blocked series is written")
+
+	require.NoError(t, s.CancelBooking(ctx, blockerID))
+	ids, err := s.CreateBookingSeries(ctx, occurrences)
+	require.NoError(t, err)
+	require.Len(t, ids, 3)
+	series, err := s.ListBookingSeries(ctx, ids[0])
+	require.NoError(t, err)
+	require.Len(t, series, 3)
+	for i, b := range series {
+		assert.Equal(t, ids[i], b.ID)
+		assert.Equal(t, ids[0], b.SeriesID, "the first occurrence's id names the series")
+		assert.Equal(t, "FREQ=DAILY;COUNT=3", b.RRule)
+		assert.True(t, occurrences[i].StartsAt.Equal(b.RecurrenceID))
+	}
+
+	// Shift every occurrence by 30 minutes; each moves onto the previous one's old slot
+	for i := range series {
+		series[i].StartsAt = series[i].StartsAt.Add(30 * time.Minute)
+		series[i].EndsAt = series[i].EndsAt.Add(30 * time.Minute)
+	}
+	series[2].Status = repository.BookingStatusCancelled
+	require.NoError(t, s.UpdateBookings(ctx, series))
+	got, err := s.GetBooking(ctx, ids[1])
+	require.NoError(t, err)
+	assert.True(t, day.AddDate(0, 0, 1).Add(10*time.Hour+30*time.Minute).Equal(got.StartsAt))
+	assert.True(t, occurrences[1].StartsAt.Equal(got.RecurrenceID), "the recurrence id keeps the original start")
+	got, err = s.GetBooking(ctx, ids[2])
+	require.NoError(t, err)
+	assert.Equal(t, repository.BookingStatusCancelled, got.Status)
+
+	// Moving two occurrences onto each other is refused as a whole
+	clash := []repository.Booking{series[0], series[1]}
+	clash[1].StartsAt, clash[1].EndsAt = clash[0].StartsAt, clash[0].EndsAt
+	err = s.UpdateBookings(ctx, clash)
+	require.True(t, errors.As(err, &conflict))
+	assert.Len(t, conflict.Occurrences, 2)
+	got, err = s.GetBooking(ctx, ids[1])
+	require.NoError(t, err)
+	assert.Equal(t, repository.BookingStatusActive, got.Status)
+	assert.True(t, series[1].StartsAt.Equal(got.StartsAt))
+
+	require.NoError(t, s.CancelBookings(ctx, ids[:2]))
+	all, err = s.ListBookingsByRoom(ctx, f.roomID, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, all)
+	assert.ErrorIs(t, s.CancelBookings(ctx, []string{ids[0], missingID}), sql.ErrNoRows)
+	series, err = s.ListBookingSeries(ctx, ids[0])
+	require.NoError(t, err)
+	assert.Len(t, series, 3, "cancelled occurrences stay in the series")
+}
+
+func testParticipants(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	id, err := s.CreateBooking(ctx, f.booking(day.Add(10*time.Hour), time.Hour))
+	require.NoError(t, err)
+
+	none, err := s.ListParticipants(ctx, id)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+
+	require.NoError(t, s.SetParticipants(ctx, id, []repository.Participant{
+		{Email: " Zoe@Example.com", Required: true},
+		{Email: "amy@example.com"},
+	}))
+	got, err := s.ListParticipants(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, "amy@example.com", got[0].Email, "ordered by email")
+	assert.False(t, got[0].Required)
+	assert.Equal(t, "zoe@example.com", got[1].Email, "emails are stored lower-case")
+	assert.True(t, got[1].Required)
+	assert.Equal(t, id, got[1].BookingID)
+	assert.Equal(t, repository.ResponseNeedsAction, got[1].ResponseStatus)
+
+	require.NoError(t, s.SetParticipantResponse(ctx, id, "ZOE@example.com", repository.ResponseAccepted))
+	assert.ErrorIs(t, s.SetParticipantResponse(ctx, id, "bob@example.com", repository.ResponseAccepted), sql.ErrNoRows)
+
+	// Replacing the list keeps the answers of those who stay
+	require.NoError(t, s.SetParticipants(ctx, id, []repository.Participant{
+		{Email: "zoe@example.com", Required: true},
+		{Email: "bob@example.com", Required: true},
+	}))
+	got, err = s.ListParticipants(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, "bob@example.com", got[0].Email)
+	assert.Equal(t, repository.ResponseNeedsAction, got[0].ResponseStatus)
+	assert.Equal(t, repository.ResponseAccepted, got[1].ResponseStatus)
+
+	assert.Error(t, s.SetParticipants(ctx, id, []repository.Participant{{Email: "a@example.com"}, {Email: "A@example.com"}}))
+	assert.ErrorIs(t, s.SetParticipants(ctx, missingID, []repository.Participant{{Email: "a@example.com"}}), sql.ErrNoRows)
+	require.NoError(t, s.SetParticipants(ctx, id, nil))
+	got, err = s.ListParticipants(ctx, id)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func testBookingBuffers(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	_, err := s.CreateBooking(ctx, f.booking(day.Add(10*time.Hour), time.Hour))
+	require.NoError(t, err)
+
+	// 11:10 leaves 10 minutes after the 10:00 booking
+	b := f.booking(day.Add(11*time.Hour+10*time.Minute), time.Hour)
+	b.BufferBefore = 15 * time.Minute
+	_, err = s.CreateBooking(ctx, b)
+	assert.ErrorIs(t, err, repository.ErrBufferTaken)
+	b.BufferBefore, b.BufferAfter = 10*time.Minute, time.Hour
+	id, err := s.CreateBooking(ctx, b)
+	require.NoError(t, err, "the buffer after looks only ahead")
+	got, err := s.GetBooking(ctx, id)
+	require.NoError(t, err)
+	assert.Zero(t, got.BufferBefore, "buffers are not saved")
+
+	// Ending at 09:50 leaves 10 minutes before it
+	got.StartsAt, got.EndsAt = day.Add(9*time.Hour), day.Add(9*time.Hour+50*time.Minute)
+	got.BufferAfter = 15 * time.Minute
+	assert.ErrorIs(t, s.UpdateBooking(ctx, got), repository.ErrBufferTaken)
+	after, err := s.GetBooking(ctx, id)
+	require.NoError(t, err)
+	assert.True(t, b.StartsAt.Equal(after.StartsAt), "nothing is saved")
+	got.BufferAfter = 0
+	require.NoError(t, s.UpdateBooking(ctx, got))
+}
+
+func testBookingWithParticipants(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	emails := func(id string) []string {
+		got, err := s.ListParticipants(ctx, id)
+		require.NoError(t, err)
+		out := []string{}
+		for _, p := range got {
+			out = append(out, p.Email)
+		}
+		return out
+	}
+
+	b := f.booking(day.Add(10*time.Hour), time.Hour)
+	b.Participants = []repository.Participant{
+		{Email: "Amy@example.com", Required: true},
+		{Email: "zed@example.com", ResponseStatus: repository.ResponseTentative},
+	}
+	id, err := s.CreateBooking(ctx, b)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"amy@example.com", "zed@example.com"}, emails(id))
+	participants, err := s.ListParticipants(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, repository.ResponseNeedsAction, participants[0].ResponseStatus)
+	assert.Equal(t, repository.ResponseTentative, participants[1].ResponseStatus, "new attendees may come with an answer")
+	got, err := s.GetBooking(ctx, id)
+	require.NoError(t, err)
+	assert.Nil(t, got.Participants, "reads leave participants to ListParticipants")
+
+	// Bad attendees fail the whole write
+	b = f.booking(day.Add(12*time.Hour), time.Hour)
+	b.Participants = []repository.Participant{{Email: "a@example.com"}, {Email: "A@example.com"}}
+	_, err = s.CreateBooking(ctx, b)
+	assert.Error(t, err)
+	all, err := s.ListBookingsByRoom(ctx, f.roomID, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, all, 1, "no booking without its attendees")
+
+	require.NoError(t, s.SetParticipantResponse(ctx, id, "amy@example.com", repository.ResponseAccepted))
+	got.Title = "Renamed"
+	got.Participants = []repository.Participant{{Email: "amy@example.com"}, {Email: "bob@example.com"}}
+	require.NoError(t, s.UpdateBooking(ctx, got))
+	participants, err = s.ListParticipants(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, participants, 2)
+	assert.Equal(t, repository.ResponseAccepted, participants[0].ResponseStatus, "those who stay keep their answer")
+
+	got.Title = "Renamed again"
+	got.Participants = []repository.Participant{{Email: "x@example.com"}, {Email: "X@example.com"}}
+	assert.Error(t, s.UpdateBooking(ctx, got))
+	after, err := s.GetBooking(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", after.Title, "the booking is not saved without its attendees")
+	assert.Equal(t, []string{"amy@example.com", "bob@example.com"}, emails(id))
+
+	got.Participants = nil
+	require.NoError(t, s.UpdateBooking(ctx, got))
+	assert.Equal(t, []string{"amy@example.com", "bob@example.com"}, emails(id), "nil leaves the attendees alone")
+	got.Participants = []repository.Participant{}
+	require.NoError(t, s.UpdateBooking(ctx, got))
+	assert.Empty(t, emails(id))
+
+	var occurrences []repository.Booking
+	for i := 0; i < 2; i++ {
+		o := f.booking(day.AddDate(0, 0, i+1).Add(9*time.Hour), time.Hour)
+		o.RRule = "FREQ=DAILY;COUNT=2"
+		o.RecurrenceID = o.StartsAt
+		o.Participants = []repository.Participant{{Email: "carol@example.com"}}
+		occurrences = append(occurrences, *o)
+	}
+	ids, err := s.CreateBookingSeries(ctx, occurrences)
+	require.NoError(t, err)
+	for _, id := range ids {
+		assert.Equal(t, []string{"carol@example.com"}, emails(id))
+	}
+	moved, err := s.ListBookingSeries(ctx, ids[0])
+	require.NoError(t, err)
+	for i := range moved {
+		moved[i].Participants = []repository.Participant{{Email: "dan@example.com"}}
+	}
+	moved[1].Participants = append(moved[1].Participants, repository.Participant{Email: "DAN@example.com"})
+	assert.Error(t, s.UpdateBookings(ctx, moved))
+	assert.Equal(t, []string{"carol@example.com"}, emails(ids[0]), "all or nothing")
+	moved[1].Participants = moved[1].Participants[:1]
+	require.NoError(t, s.UpdateBookings(ctx, moved))
+	for _, id := range ids {
+		assert.Equal(t, []string{"dan@example.com"}, emails(id))
+	}
+}
+
+func testBookingConflict(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	firstID, err := s.CreateBooking(ctx, f.booking(day.Add(10*time.Hour), time.Hour))
+	require.NoError(t, err)
+
+	_, err = s.CreateBooking(ctx, f.booking(day.Add(10*time.Hour+30*time.Minute), time.Hour))
+	require.ErrorIs(t, err, repository.ErrBookingConflict)
+	var conflict *repository.ConflictError
+	require.True(t, errors.As(err, &conflict))
+	require.Len(t, conflict.Conflicts, 1)
+	assert.Equal(t, firstID, conflict.Conflicts[0].ID)
+
+	// Back-to-back and other-room bookings are fine
+	_, err = s.CreateBooking(ctx, f.booking(day.Add(11*time.Hour), time.Hour))
+	assert.NoError(t, err)
+	other := f.booking(day.Add(10*time.Hour), time.Hour)
+	other.RoomID = f.otherID
+	_, err = s.CreateBooking(ctx, other)
+	assert.NoError(t, err)
+
+	// A cancelled booking frees its slot
+	require.NoError(t, s.CancelBooking(ctx, firstID))
+	_, err = s.CreateBooking(ctx, f.booking(day.Add(10*time.Hour), time.Hour))
+	assert.NoError(t, err)
+}
+
+func testUpdateAndCancelBooking(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	id, err := s.CreateBooking(ctx, f.booking(day.Add(9*time.Hour), time.Hour))
+	require.NoError(t, err)
+	blockerID, err := s.CreateBooking(ctx, f.booking(day.Add(13*time.Hour), time.Hour))
+	require.NoError(t, err)
+
+	b, err := s.GetBooking(ctx, id)
+	require.NoError(t, err)
+	b.Title = "Moved"
+	b.StartsAt = day.Add(9*time.Hour + 30*time.Minute)
+	b.EndsAt = day.Add(10*time.Hour + 30*time.Minute)
+	require.NoError(t, s.UpdateBooking(ctx, b), "overlapping its own old slot is fine")
+
+	got, err := s.GetBooking(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "Moved", got.Title)
+	assert.True(t, b.StartsAt.Equal(got.StartsAt))
+
+	b.StartsAt = day.Add(12*time.Hour + 30*time.Minute)
+	b.EndsAt = day.Add(13*time.Hour + 30*time.Minute)
+	err = s.UpdateBooking(ctx, b)
+	var conflict *repository.ConflictError
+	require.True(t, errors.As(err, &conflict))
+	require.Len(t, conflict.Conflicts, 1)
+	assert.Equal(t, blockerID, conflict.Conflicts[0].ID)
+
+	require.NoError(t, s.CancelBooking(ctx, id))
+	got, err = s.GetBooking(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, repository.BookingStatusCancelled, got.Status)
+}
+
+func testConcurrentSameSlot(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make([]error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = s.CreateBooking(ctx, f.booking(day.Add(15*time.Hour), time.Hour))
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		assert.ErrorIs(t, err, repository.ErrBookingConflict)
+	}
+	assert.Equal(t, 1, created)
+}
+
+func testReminders(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	start := day.Add(10 * time.Hour)
+	id, err := s.CreateBooking(ctx, f.booking(start, time.Hour))
+	require.NoError(t, err)
+	later := f.booking(start.Add(2*time.Hour), time.Hour)
+	later.RoomID = f.otherID
+	laterID, err := s.CreateBooking(ctx, later)
+	require.NoError(t, err)
+	cancelledID, err := s.CreateBooking(ctx, f.booking(start.Add(4*time.Hour), time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, s.CancelBooking(ctx, cancelledID))
+
+	starting, err := s.ListBookingsStarting(ctx, start, start.Add(5*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, starting, 2, "active bookings in every room")
+	assert.Equal(t, id, starting[0].ID)
+	assert.Equal(t, laterID, starting[1].ID)
+	starting, err = s.ListBookingsStarting(ctx, start.Add(time.Minute), start.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, starting, "only bookings starting in [from, to)")
+
+	now := start.Add(-15 * time.Minute)
+	rem := repository.Reminder{BookingID: id, Email: "Owner@example.com", StartsAt: start}
+	claimed, err := s.ClaimReminder(ctx, rem, now, now.Add(-5*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	rem.Email = "owner@example.com"
+	claimed, err = s.ClaimReminder(ctx, rem, now, now.Add(-5*time.Minute))
+	require.NoError(t, err)
+	assert.False(t, claimed, "claimed already")
+
+	// A claim never marked sent is taken over once stale
+	now = now.Add(10 * time.Minute)
+	claimed, err = s.ClaimReminder(ctx, rem, now, now.Add(-5*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	require.NoError(t, s.MarkReminderSent(ctx, rem, now))
+	claimed, err = s.ClaimReminder(ctx, rem, now.Add(time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, claimed, "sent reminders stay sent")
+	require.NoError(t, s.ReleaseReminder(ctx, rem))
+	claimed, err = s.ClaimReminder(ctx, rem, now.Add(time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, claimed, "sent reminders cannot be released")
+
+	// Released claims can be taken again straight away, and each start is
+	// a reminder of its own
+	moved := repository.Reminder{BookingID: id, Email: "owner@example.com", StartsAt: start.Add(time.Hour)}
+	claimed, err = s.ClaimReminder(ctx, moved, now, now.Add(-5*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	require.NoError(t, s.ReleaseReminder(ctx, moved))
+	claimed, err = s.ClaimReminder(ctx, moved, now, now.Add(-5*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	assert.ErrorIs(t, s.MarkReminderSent(ctx, repository.Reminder{BookingID: laterID, Email: "owner@example.com", StartsAt: later.StartsAt}, now), sql.ErrNoRows)
+	_, err = s.ClaimReminder(ctx, repository.Reminder{BookingID: missingID, Email: "owner@example.com", StartsAt: start}, now, now)
+	assert.Error(t, err, "reminders need an existing booking")
+}
+
+func testBookingRules(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	later := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	earlier := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, from := range []time.Time{later, earlier} {
+		_, err := s.CreateBookingRule(ctx, &repository.BookingRule{
+			OfficeID:       f.officeID,
+			WorkdayStart:   9 * time.Hour,
+			WorkdayEnd:     18*time.Hour + 30*time.Minute,
+			MaxDuration:    4 * time.Hour,
+			MinLeadTime:    30 * time.Minute,
+			BufferBefore:   15 * time.Minute,
+			AllowRecurring: true,
+			Timezone:       "Europe/Berlin",
+			EffectiveFrom:  from,
+		})
+		require.NoError(t, err)
+	}
+
+	rules, err := s.ListBookingRules(ctx, f.officeID)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.True(t, earlier.Equal(rules[0].EffectiveFrom), "oldest first")
+	assert.True(t, later.Equal(rules[1].EffectiveFrom))
+
+	r := rules[0]
+	assert.Equal(t, f.officeID, r.OfficeID)
+	assert.Equal(t, 9*time.Hour, r.WorkdayStart)
+	assert.Equal(t, 18*time.Hour+30*time.Minute, r.WorkdayEnd)
+	assert.Equal(t, 4*time.Hour, r.MaxDuration)
+	assert.Equal(t, 30*time.Minute, r.MinLeadTime)
+	assert.Equal(t, 15*time.Minute, r.BufferBefore)
+	assert.Zero(t, r.BufferAfter)
+	assert.True(t, r.AllowRecurring)
+	assert.Equal(t, "Europe/Berlin", r.Timezone)
+
+	none, err := s.ListBookingRules(ctx, missingID)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+}
+
+func testHolidays(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	for _, h := range []repository.Holiday{
+		{OfficeID: f.officeID, Date: "2024-12-26", Description: "Boxing Day"},
+		{OfficeID: f.officeID, Date: "2024-12-25", Description: "Christmas Day"},
+		{OfficeID: f.officeID, Date: "2025-01-01"},
+	} {
+		_, err := s.CreateHoliday(ctx, &h)
+		require.NoError(t, err)
+	}
+	_, err := s.CreateHoliday(ctx, &repository.Holiday{OfficeID: f.officeID, Date: "25/12/2024"})
+	assert.Error(t, err)
+
+	holidays, err := s.ListHolidays(ctx, f.officeID)
+	require.NoError(t, err)
+	require.Len(t, holidays, 3)
+	assert.Equal(t, "2024-12-25", holidays[0].Date, "ordered by date")
+	assert.Equal(t, "Christmas Day", holidays[0].Description)
+	assert.Equal(t, f.officeID, holidays[0].OfficeID)
+	assert.Equal(t, "2024-12-26", holidays[1].Date)
+	assert.Equal(t, "2025-01-01", holidays[2].Date)
+	assert.Empty(t, holidays[2].Description)
+
+	none, err := s.ListHolidays(ctx, missingID)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+
+	_, err = s.CreateHoliday(ctx, &repository.Holiday{OfficeID: f.officeID, Date: "2024-12-25"})
+	assert.ErrorIs(t, err, repository.ErrHolidayExists)
+
+	got, err := s.GetHoliday(ctx, holidays[2].ID)
+	require.NoError(t, err)
+	assert.Equal(t, holidays[2], *got)
+	got.Date = "2025-01-02"
+	got.Description = "New Year (observed)"
+	require.NoError(t, s.UpdateHoliday(ctx, got))
+	got, err = s.GetHoliday(ctx, holidays[2].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "2025-01-02", got.Date)
+	assert.Equal(t, "New Year (observed)", got.Description)
+
+	got.Date = "2024-12-26"
+	assert.ErrorIs(t, s.UpdateHoliday(ctx, got), repository.ErrHolidayExists)
+	got.Date = "tomorrow"
+	assert.Error(t, s.UpdateHoliday(ctx, got))
+	assert.ErrorIs(t, s.UpdateHoliday(ctx, &repository.Holiday{ID: missingID, Date: "2025-01-03"}), sql.ErrNoRows)
+
+	require.NoError(t, s.DeleteHoliday(ctx, holidays[0].ID))
+	_, err = s.GetHoliday(ctx, holidays[0].ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.ErrorIs(t, s.DeleteHoliday(ctx, holidays[0].ID), sql.ErrNoRows)
+	holidays, err = s.ListHolidays(ctx, f.officeID)
+	require.NoError(t, err)
+	assert.Len(t, holidays, 2)
+}
+
+func testAuditLogs(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entries := []repository.AuditLog{
+		{ActorUserID: f.userID, Action: "booking.create", EntityType: "booking", EntityID: "b1", Payload: `{"title":"A"}`, CreatedAt: base},
+		{ActorUserID: f.userID, Action: "booking.cancel", EntityType: "booking", EntityID: "b1", CreatedAt: base.Add(time.Hour)},
+		{Action: "room.update", EntityType: "room", EntityID: f.roomID, CreatedAt: base.Add(2 * time.Hour)},
+	}
+	for i := range entries {
+		id, err := s.CreateAuditLog(ctx, &entries[i])
+		require.NoError(t, err)
+		require.NotEmpty(t, id)
+	}
+
+	all, err := s.ListAuditLogs(ctx, repository.AuditFilter{})
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	assert.Equal(t, "room.update", all[0].Action, "newest first")
+	assert.Empty(t, all[0].ActorUserID)
+	assert.Equal(t, "booking.create", all[2].Action)
+	assert.JSONEq(t, `{"title":"A"}`, all[2].Payload)
+	assert.True(t, base.Equal(all[2].CreatedAt))
+
+	byEntity, err := s.ListAuditLogs(ctx, repository.AuditFilter{EntityType: "booking", EntityID: "b1"})
+	require.NoError(t, err)
+	assert.Len(t, byEntity, 2)
+
+	byActor, err := s.ListAuditLogs(ctx, repository.AuditFilter{ActorUserID: f.userID, Action: "booking.cancel"})
+	require.NoError(t, err)
+	require.Len(t, byActor, 1)
+	assert.Equal(t, "booking.cancel", byActor[0].Action)
+
+	window, err := s.ListAuditLogs(ctx, repository.AuditFilter{From: base.Add(30 * time.Minute), To: base.Add(2 * time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, window, 1)
+	assert.Equal(t, "booking.cancel", window[0].Action)
+
+	page, err := s.ListAuditLogs(ctx, repository.AuditFilter{Limit: 2, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	assert.Equal(t, "booking.cancel", page[0].Action)
+	assert.Equal(t, "booking.create", page[1].Action)
+}
+
+func testAuditedWrites(t *testing.T, s repository.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	audit := func(action string) repository.AuditFunc {
+		return func(ids []string) []repository.AuditLog {
+			var out []repository.AuditLog
+			for _, id := range ids {
+				out = append(out, repository.AuditLog{ActorUserID: f.userID, Action: action, EntityType: "booking", EntityID: id})
+			}
+			if len(ids) == 0 {
+				out = append(out, repository.AuditLog{ActorUserID: f.userID, Action: action, EntityType: "booking"})
+			}
+			return out
+		}
+	}
+	list := func(action string) []repository.AuditLog {
+		entries, err := s.ListAuditLogs(ctx, repository.AuditFilter{Action: action})
+		require.NoError(t, err)
+		return entries
+	}
+
+	// Entries get the ids of the rows the write creates
+	audited := repository.WithAudit(ctx, audit("booking.create"))
+	id, err := s.CreateBooking(audited, f.booking(day.Add(9*time.Hour), time.Hour))
+	require.NoError(t, err)
+	entries := list("booking.create")
+	require.Len(t, entries, 1)
+	assert.Equal(t, id, entries[0].EntityID)
+	assert.Equal(t, f.userID, entries[0].ActorUserID)
+
+	// ...and are recorded once
+	_, err = s.CreateBooking(audited, f.booking(day.Add(11*time.Hour), time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, list("booking.create"), 1)
+
+	occurrences := []repository.Booking{*f.booking(day.Add(24*time.Hour), time.Hour), *f.booking(day.Add(48*time.Hour), time.Hour)}
+	ids, err := s.CreateBookingSeries(repository.WithAudit(ctx, audit("booking.series")), occurrences)
+	require.NoError(t, err)
+	entries = list("booking.series")
+	require.Len(t, entries, 2)
+	assert.ElementsMatch(t, ids, []string{entries[0].EntityID, entries[1].EntityID})
+
+	// A write that fails records nothing
+	_, err = s.CreateBooking(repository.WithAudit(ctx, audit("booking.clash")), f.booking(day.Add(9*time.Hour), time.Hour))
+	require.Error(t, err)
+	assert.Empty(t, list("booking.clash"))
+	err = s.CancelBooking(repository.WithAudit(ctx, audit("booking.missing")), missingID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.Empty(t, list("booking.missing"))
+
+	require.NoError(t, s.CancelBooking(repository.WithAudit(ctx, audit("booking.cancel")), id))
+	assert.Len(t, list("booking.cancel"), 1)
+	require.NoError(t, s.UpdateUserRole(repository.WithAudit(ctx, audit("user.role")), f.userID, "admin"))
+	assert.Len(t, list("user.role"), 1)
+	assert.ErrorIs(t, s.UpdateUserRole(ctx, missingID, "admin"), sql.ErrNoRows)
+}
+
+func testCancelledContext(t *testing.T, s repository.Store) {
+	f := newFixture(t, s)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := s.CreateBooking(ctx, f.booking(day.Add(9*time.Hour), time.Hour))
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = s.ListBookingsByRoom(ctx, f.roomID, time.Time{}, time.Time{})
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = s.GetUserByID(ctx, f.userID)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	all, err := s.ListBookingsByRoom(context.Background(), f.roomID, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, all, "nothing was written under the cancelled context")
+}
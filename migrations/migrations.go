@@ -0,0 +1,23 @@
+// Package migrations embeds the SQL schema migrations so the server binary can apply them itself.
+// Each supported driver has its own directory of NNNNNN_name.up.sql / NNNNNN_name.down.sql files,
+// kept in step so both dialects share version numbers.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+)
+
+//go:embed sqlite3/*.sql postgres/*.sql
+var files embed.FS
+
+// ForDriver returns the migration set written for a database/sql driver name
+func ForDriver(driver string) (fs.FS, error) {
+	switch driver {
+	case "sqlite3", "postgres":
+		return fs.Sub(files, driver)
+	default:
+		return nil, fmt.Errorf("no migrations for database driver %q", driver)
+	}
+}
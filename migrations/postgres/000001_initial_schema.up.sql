@@ -0,0 +1,119 @@
+-- +migrate Up
+-- PostgreSQL version: native uuid, timestamptz, boolean and jsonb types
+
+-- btree_gist lets the bookings exclusion constraint combine room equality with range overlap
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+CREATE TABLE users (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    email text UNIQUE NOT NULL,
+    display_name text,
+    role text NOT NULL DEFAULT 'user',
+    auth_provider text,
+    password_hash text,
+    mfa_enabled boolean NOT NULL DEFAULT false,
+    timezone text DEFAULT 'UTC',
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE oauth_accounts (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid REFERENCES users(id) ON DELETE CASCADE,
+    provider text NOT NULL,
+    subject text NOT NULL,
+    email text,
+    raw_profile_json jsonb,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE offices (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    name text NOT NULL,
+    timezone text DEFAULT 'UTC'
+);
+
+CREATE TABLE floors (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    office_id uuid REFERENCES offices(id) ON DELETE CASCADE,
+    number integer NOT NULL,
+    label text
+);
+
+CREATE TABLE rooms (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    floor_id uuid REFERENCES floors(id) ON DELETE CASCADE,
+    name text NOT NULL,
+    capacity integer NOT NULL,
+    equipment text,
+    has_graph_integration boolean NOT NULL DEFAULT false,
+    graph_resource_id text,
+    color text,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE bookings (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    room_id uuid REFERENCES rooms(id) ON DELETE CASCADE,
+    created_by uuid REFERENCES users(id) ON DELETE CASCADE,
+    title text NOT NULL,
+    description text,
+    starts_at_utc timestamptz NOT NULL,
+    ends_at_utc timestamptz NOT NULL,
+    rrule text,
+    status text DEFAULT 'active',
+    external_event_id text,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT bookings_valid_range CHECK (ends_at_utc > starts_at_utc),
+    -- Two active bookings of the same room may never overlap; [) ranges let slots touch
+    CONSTRAINT bookings_no_overlap EXCLUDE USING gist (
+        room_id WITH =,
+        tstzrange(starts_at_utc, ends_at_utc, '[)') WITH &&
+    ) WHERE (status = 'active')
+);
+
+CREATE TABLE booking_participants (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    booking_id uuid REFERENCES bookings(id) ON DELETE CASCADE,
+    email text NOT NULL,
+    is_required boolean NOT NULL DEFAULT true,
+    response_status text
+);
+
+CREATE TABLE booking_rules (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    office_id uuid REFERENCES offices(id) ON DELETE CASCADE,
+    workday_start time NOT NULL,
+    workday_end time NOT NULL,
+    max_duration interval NOT NULL,
+    min_lead_time interval NOT NULL,
+    buffer_before interval DEFAULT '0 minutes',
+    buffer_after interval DEFAULT '0 minutes',
+    allow_recurring boolean NOT NULL DEFAULT false,
+    timezone text DEFAULT 'UTC',
+    effective_from timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE holidays (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    office_id uuid REFERENCES offices(id) ON DELETE CASCADE,
+    date date NOT NULL,
+    description text
+);
+
+CREATE TABLE audit_logs (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    actor_user_id uuid REFERENCES users(id) ON DELETE SET NULL,
+    action text NOT NULL,
+    entity_type text NOT NULL,
+    entity_id text NOT NULL,
+    payload_json jsonb,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- Indexes
+CREATE INDEX idx_bookings_room_starts ON bookings(room_id, starts_at_utc);
+CREATE INDEX idx_rooms_floor ON rooms(floor_id);
+CREATE INDEX idx_audit_actor ON audit_logs(actor_user_id);
+CREATE INDEX idx_audit_entity ON audit_logs(entity_type, entity_id);
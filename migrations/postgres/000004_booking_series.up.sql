@@ -0,0 +1,7 @@
+-- +migrate Up
+-- Each occurrence of a recurring booking is its own row. series_id is the id of
+-- the series' first occurrence and recurrence_id the start the rule gave this
+-- occurrence, which stays put when the occurrence alone is moved.
+ALTER TABLE bookings ADD COLUMN series_id uuid;
+ALTER TABLE bookings ADD COLUMN recurrence_id timestamptz;
+CREATE INDEX idx_bookings_series ON bookings(series_id, recurrence_id);
@@ -0,0 +1,4 @@
+-- +migrate Up
+-- Personal calendar feeds are found by the hash of their secret token
+ALTER TABLE users ADD COLUMN feed_token_hash TEXT;
+CREATE UNIQUE INDEX idx_users_feed_token_hash ON users(feed_token_hash);
@@ -0,0 +1,5 @@
+-- +migrate Down
+DROP INDEX IF EXISTS idx_bookings_starts;
+DROP TABLE IF EXISTS booking_reminders;
+ALTER TABLE users DROP COLUMN reminder_minutes;
+ALTER TABLE offices DROP COLUMN reminder_minutes;
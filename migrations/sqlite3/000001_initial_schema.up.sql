@@ -108,15 +108,3 @@ CREATE INDEX idx_bookings_room_starts ON bookings(room_id, starts_at_utc);
 CREATE INDEX idx_rooms_floor ON rooms(floor_id);
 CREATE INDEX idx_audit_actor ON audit_logs(actor_user_id);
 CREATE INDEX idx_audit_entity ON audit_logs(entity_type, entity_id);
-
--- +migrate Down
-DROP TABLE IF EXISTS audit_logs;
-DROP TABLE IF EXISTS holidays;
-DROP TABLE IF EXISTS booking_rules;
-DROP TABLE IF EXISTS booking_participants;
-DROP TABLE IF EXISTS bookings;
-DROP TABLE IF EXISTS rooms;
-DROP TABLE IF EXISTS floors;
-DROP TABLE IF EXISTS offices;
-DROP TABLE IF EXISTS oauth_accounts;
-DROP TABLE IF EXISTS users;
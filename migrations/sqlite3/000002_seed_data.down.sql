@@ -0,0 +1,6 @@
+-- +migrate Down
+DELETE FROM booking_rules WHERE id = 'rule-1';
+DELETE FROM users WHERE id IN ('user-admin', 'user-regular');
+DELETE FROM rooms WHERE floor_id LIKE 'floor-1-%';
+DELETE FROM floors WHERE office_id = 'office-1';
+DELETE FROM offices WHERE id = 'office-1';
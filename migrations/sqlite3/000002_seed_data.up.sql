@@ -27,10 +27,3 @@ INSERT INTO users (id, email, display_name, role, timezone) VALUES
 
 INSERT INTO booking_rules (id, office_id, workday_start, workday_end, max_duration, min_lead_time, buffer_before, buffer_after, allow_recurring, timezone) VALUES
 ('rule-1', 'office-1', '09:00:00', '18:00:00', '4 hours', '30 minutes', '15 minutes', '15 minutes', 1, 'America/New_York');
-
--- +migrate Down
-DELETE FROM booking_rules WHERE id = 'rule-1';
-DELETE FROM users WHERE id IN ('user-admin', 'user-regular');
-DELETE FROM rooms WHERE floor_id LIKE 'floor-1-%';
-DELETE FROM floors WHERE office_id = 'office-1';
-DELETE FROM offices WHERE id = 'office-1';
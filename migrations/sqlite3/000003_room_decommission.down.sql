@@ -0,0 +1,2 @@
+-- +migrate Down
+ALTER TABLE rooms DROP COLUMN decommissioned_at;
@@ -0,0 +1,3 @@
+-- +migrate Up
+-- Decommissioned rooms are kept so their booking history survives
+ALTER TABLE rooms ADD COLUMN decommissioned_at DATETIME;
@@ -0,0 +1,4 @@
+-- +migrate Down
+DROP INDEX IF EXISTS idx_bookings_series;
+ALTER TABLE bookings DROP COLUMN recurrence_id;
+ALTER TABLE bookings DROP COLUMN series_id;
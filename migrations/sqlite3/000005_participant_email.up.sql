@@ -0,0 +1,3 @@
+-- +migrate Up
+-- Each email is invited to a booking at most once
+CREATE UNIQUE INDEX idx_booking_participants_email ON booking_participants(booking_id, email);
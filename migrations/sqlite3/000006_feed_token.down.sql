@@ -0,0 +1,3 @@
+-- +migrate Down
+DROP INDEX IF EXISTS idx_users_feed_token_hash;
+ALTER TABLE users DROP COLUMN feed_token_hash;
@@ -0,0 +1,19 @@
+-- +migrate Up
+-- Minutes before a booking starts that people are reminded of it: the
+-- office's default, which users may override (NULL keeps the default). 0 turns
+-- reminders off.
+ALTER TABLE offices ADD COLUMN reminder_minutes INTEGER NOT NULL DEFAULT 15;
+ALTER TABLE users ADD COLUMN reminder_minutes INTEGER;
+
+-- One row per reminder, claimed by the server instance sending it so no
+-- other sends it too. A claim never marked sent may be taken over once stale.
+CREATE TABLE booking_reminders (
+    booking_id TEXT NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    starts_at_utc DATETIME NOT NULL,
+    claimed_at DATETIME NOT NULL,
+    sent_at DATETIME,
+    PRIMARY KEY (booking_id, email, starts_at_utc)
+);
+
+CREATE INDEX idx_bookings_starts ON bookings(starts_at_utc);
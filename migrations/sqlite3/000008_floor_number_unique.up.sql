@@ -0,0 +1,3 @@
+-- +migrate Up
+-- Floor numbers are unique within an office
+CREATE UNIQUE INDEX idx_floors_office_number ON floors(office_id, number);
@@ -1,14 +1,10 @@
 #!/bin/bash
 
-# Migration script
+# Migration script: runs the migrations embedded in the server binary.
+# Usage: scripts/migrate.sh up | down [n] | status | goto <version>
+# DATABASE_DRIVER and DATABASE_DSN are read from the environment or .env
 
 set -e
 
-DB_DRIVER=${DATABASE_DRIVER:-sqlite3}
-DB_DSN=${DATABASE_DSN:-"file:roombooker.db?cache=shared&_fk=1"}
-
-if [ "$DB_DRIVER" = "postgres" ]; then
-    migrate -path ./migrations -database "postgres://$DB_DSN" "$@"
-else
-    migrate -path ./migrations -database "sqlite3://$DB_DSN" "$@"
-fi
+cd "$(dirname "$0")/.."
+go run ./cmd/server migrate "$@"
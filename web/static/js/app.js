@@ -65,6 +65,26 @@ function logout() {
   });
 }
 
+// subscribeMyBookings makes a new personal feed URL and opens it as a
+// subscription; any earlier URL stops working
+function subscribeMyBookings() {
+  if (!confirm("Make a new private link to your bookings? Any link made before stops working.")) return;
+  fetch("/me/calendar-feed", {
+    method: "POST",
+    credentials: "same-origin",
+  })
+    .then((response) => {
+      if (!response.ok) throw new Error(response.statusText);
+      return response.json();
+    })
+    .then((feed) => {
+      window.location.href = feed.url.replace(/^https?:/, "webcal:");
+    })
+    .catch((err) => {
+      showErrorMessage("Failed to create calendar link: " + err.message);
+    });
+}
+
 function initCalendar() {
   const calendarEl = document.getElementById("calendar");
   calendar = new FullCalendar.Calendar(calendarEl, {
@@ -80,23 +100,27 @@ function initCalendar() {
         openBookingModal(info.start, info.end);
       }
     },
+    // Bookings can be dragged or resized to reschedule them
+    editable: true,
+    eventDrop: rescheduleBooking,
+    eventResize: rescheduleBooking,
     eventClick: function (info) {
-      // Handle event click - could show booking details
-      console.log("Event clicked:", info.event);
+      showBookingDetails(info.event);
     },
     events: function (fetchInfo, successCallback, failureCallback) {
       if (!selectedRoomId) {
         successCallback([]);
         return;
       }
-      fetch(
-        `/api/rooms/${selectedRoomId}/bookings?from=${fetchInfo.start.toISOString()}&to=${fetchInfo.end.toISOString()}`,
-        {
+      const range = `from=${fetchInfo.start.toISOString()}&to=${fetchInfo.end.toISOString()}`;
+      const officeId = document.getElementById("officeSelect").value;
+      Promise.all([
+        fetch(`/api/rooms/${selectedRoomId}/bookings?${range}`, {
           credentials: "same-origin",
-        }
-      )
-        .then((response) => response.json())
-        .then((events) => {
+        }).then((response) => response.json()),
+        loadHolidayEvents(officeId, range),
+      ])
+        .then(([events, holidays]) => {
           console.debug(
             "Fetched events for room",
             selectedRoomId,
@@ -104,7 +128,7 @@ function initCalendar() {
             events.length,
             events
           );
-          successCallback(events);
+          successCallback(events.concat(holidays));
         })
         .catch((error) => failureCallback(error));
     },
@@ -112,6 +136,24 @@ function initCalendar() {
   calendar.render();
 }
 
+// loadHolidayEvents renders an office's holidays as closed, all-day background events
+function loadHolidayEvents(officeId, range) {
+  if (!officeId) return Promise.resolve([]);
+  return fetch(`/api/offices/${officeId}/holidays?${range}`, {
+    credentials: "same-origin",
+  })
+    .then((response) => (response.ok ? response.json() : []))
+    .then((holidays) =>
+      holidays.map((h) => ({
+        title: "Closed" + (h.description ? ": " + h.description : ""),
+        start: h.date,
+        allDay: true,
+        display: "background",
+        classNames: ["holiday"],
+      }))
+    );
+}
+
 function loadOffices() {
   fetch("/api/offices", {
     credentials: "same-origin",
@@ -143,23 +185,114 @@ function loadRooms() {
       rooms.forEach((room) => {
         const option = document.createElement("option");
         option.value = room.id;
-        option.textContent = `${room.name} (Capacity: ${room.capacity})`;
+        option.textContent = room.floor
+          ? `${room.name} – ${room.floor} (Capacity: ${room.capacity})`
+          : `${room.name} (Capacity: ${room.capacity})`;
         select.appendChild(option);
       });
       console.debug("Rooms loaded for office", officeId, rooms.length);
     });
 }
 
+function searchAvailability() {
+  const from = document.getElementById("searchFrom").value;
+  const to = document.getElementById("searchTo").value;
+  if (!from || !to) {
+    showErrorMessage("Please choose a start and end time.");
+    return;
+  }
+  const params = new URLSearchParams({
+    from: new Date(from).toISOString(),
+    to: new Date(to).toISOString(),
+  });
+  const capacity = document.getElementById("searchCapacity").value;
+  if (capacity) params.set("capacity", capacity);
+  const equipment = document.getElementById("searchEquipment").value.trim();
+  if (equipment) params.set("equipment", equipment);
+  const officeId = document.getElementById("officeSelect").value;
+  if (officeId) params.set("office_id", officeId);
+
+  fetch(`/api/availability?${params}`, { credentials: "same-origin" })
+    .then(async (response) => {
+      if (!response.ok) throw new Error(await response.text());
+      return response.json();
+    })
+    .then((results) => {
+      const list = document.getElementById("availabilityResults");
+      list.innerHTML = "";
+      if (!results.length) {
+        list.innerHTML =
+          '<li class="list-group-item">No free rooms in this window</li>';
+        return;
+      }
+      const closed = new Map();
+      results.forEach((a) =>
+        (a.closed_days || []).forEach((d) => closed.set(d.id, d))
+      );
+      closed.forEach((d) => {
+        const item = document.createElement("li");
+        item.className = "list-group-item list-group-item-secondary";
+        item.textContent = `Closed ${d.date}${
+          d.description ? " – " + d.description : ""
+        }`;
+        list.appendChild(item);
+      });
+      results.forEach((a) => {
+        const item = document.createElement("li");
+        item.className = "list-group-item list-group-item-action";
+        const slots = a.available
+          ? "free for the whole window"
+          : "free " +
+            a.free_slots
+              .map(
+                (s) =>
+                  `${new Date(s.start).toLocaleString()} – ${new Date(
+                    s.end
+                  ).toLocaleTimeString()}`
+              )
+              .join(", ");
+        item.textContent = `${a.room.name} (${a.room.floor}, capacity ${a.room.capacity}): ${slots}`;
+        item.onclick = () => bookFreeSlot(a);
+        list.appendChild(item);
+      });
+    })
+    .catch((err) => {
+      console.error("Availability error:", err);
+      showErrorMessage("Failed to search availability: " + err.message);
+    });
+}
+
+// bookFreeSlot shows the room's calendar and opens the booking form on its first free slot
+function bookFreeSlot(a) {
+  selectedRoomId = a.room_id;
+  const roomSel = document.getElementById("roomSelect");
+  if (roomSel) roomSel.value = a.room_id;
+  calendar.refetchEvents();
+  const slot = a.free_slots[0];
+  calendar.gotoDate(slot.start);
+  openBookingModal(new Date(slot.start), new Date(slot.end));
+}
+
 function loadCalendar() {
   selectedRoomId = document.getElementById("roomSelect").value;
+  const feedLink = document.getElementById("roomFeedLink");
+  feedLink.classList.toggle("d-none", !selectedRoomId);
   if (selectedRoomId) {
+    // webcal:// opens the feed as a subscription in the desktop calendar
+    feedLink.href = `webcal://${window.location.host}/rooms/${encodeURIComponent(selectedRoomId)}/calendar.ics`;
     calendar.refetchEvents();
   }
 }
 
+// localInputValue formats a date for a datetime-local input in the browser's zone
+function localInputValue(date) {
+  const local = new Date(date.getTime() - date.getTimezoneOffset() * 60000);
+  return local.toISOString().slice(0, 16);
+}
+
 function openBookingModal(start, end) {
-  document.getElementById("startTime").value = start.toISOString().slice(0, 16);
-  document.getElementById("endTime").value = end.toISOString().slice(0, 16);
+  document.getElementById("startTime").value = localInputValue(start);
+  document.getElementById("endTime").value = localInputValue(end);
   const modal = new bootstrap.Modal(document.getElementById("bookingModal"));
   modal.show();
 }
@@ -182,6 +315,9 @@ function saveBooking() {
       .value.split("\n")
       .filter((email) => email.trim()),
     room_id: selectedRoomId,
+    rrule: repeatRule(),
+    // The form shows times in the browser's zone
+    tz: Intl.DateTimeFormat().resolvedOptions().timeZone,
   };
 
   fetch(`/api/bookings`, {
@@ -234,6 +370,12 @@ function saveBooking() {
             console.debug("Failed to add event to calendar immediately", e);
           }
         }
+        if (created && created.occurrences) {
+          showSuccessMessage(
+            `Recurring booking created with ${created.occurrences.length} occurrences`
+          );
+          return;
+        }
         showSuccessMessage(
           "Booking created successfully! " +
             (created ? `ID: ${created.id}` : "")
@@ -241,18 +383,10 @@ function saveBooking() {
         return;
       }
 
-      // Try to parse JSON error, fallback to plain text
-      let errText = "Failed to create booking";
-      try {
-        const j = await response.json();
-        errText = j.message || JSON.stringify(j) || errText;
-      } catch (e) {
-        try {
-          errText = await response.text();
-        } catch (e2) {
-          /* ignore */
-        }
-      }
+      const errText = await bookingErrorText(
+        response,
+        "Failed to create booking"
+      );
       showErrorMessage(errText || `Booking failed (status ${response.status})`);
     })
     .catch((err) => {
@@ -261,6 +395,194 @@ function saveBooking() {
     });
 }
 
+// repeatRule builds the RRULE for the booking form's repeat fields, or ""
+function repeatRule() {
+  const freq = document.getElementById("repeat").value;
+  if (!freq) return "";
+  const count = parseInt(document.getElementById("repeatCount").value, 10);
+  return count > 0 ? `FREQ=${freq};COUNT=${count}` : `FREQ=${freq}`;
+}
+
+// chooseScope asks which occurrences of a recurring booking a change applies
+// to; it returns "" for one-off bookings and null if the user backs out
+function chooseScope(event, action) {
+  if (!event.extendedProps.series_id) return "";
+  const scope = prompt(
+    `This booking repeats. ${action} which occurrences?\n` +
+      "occurrence – only this one\n" +
+      "following – this and the following ones\n" +
+      "series – the whole series",
+    "occurrence"
+  );
+  if (scope === null) return null;
+  return `?scope=${encodeURIComponent(scope.trim())}`;
+}
+
+// bookingErrorText reads an error response, listing the bookings blocking
+// the slot when the server answered 409 and the broken rules on 422
+async function bookingErrorText(response, fallback) {
+  const text = await response.text();
+  try {
+    const j = JSON.parse(text);
+    let errText = j.message || JSON.stringify(j) || fallback;
+    if (j.conflicts && j.conflicts.length) {
+      errText +=
+        ":\n" +
+        j.conflicts
+          .map(
+            (c) =>
+              `${c.title} (${new Date(c.start).toLocaleString()} – ${new Date(
+                c.end
+              ).toLocaleTimeString()})`
+          )
+          .join("\n");
+    }
+    if (j.occurrences && j.occurrences.length) {
+      errText +=
+        ":\n" +
+        j.occurrences
+          .map(
+            (o) =>
+              `${new Date(o.start).toLocaleString()}: ` +
+              o.conflicts.map((c) => c.title).join(", ")
+          )
+          .join("\n");
+    }
+    if (j.violations && j.violations.length) {
+      errText +=
+        ":\n" +
+        j.violations
+          .map(
+            (v) =>
+              (v.occurrence
+                ? `${new Date(v.occurrence).toLocaleString()}: `
+                : "") + v.message
+          )
+          .join("\n");
+    }
+    return errText;
+  } catch (e) {
+    return text.trim() || fallback;
+  }
+}
+
+function rescheduleBooking(info) {
+  const scope = chooseScope(info.event, "Move");
+  if (scope === null) {
+    info.revert();
+    return;
+  }
+  fetch(`/api/bookings/${info.event.id}${scope}`, {
+    method: "PATCH",
+    headers: { "Content-Type": "application/json" },
+    credentials: "same-origin",
+    body: JSON.stringify({
+      start_time: info.event.start.toISOString(),
+      end_time: info.event.end.toISOString(),
+    }),
+  })
+    .then(async (response) => {
+      if (!response.ok) {
+        info.revert();
+        showErrorMessage(
+          await bookingErrorText(response, "Failed to reschedule booking")
+        );
+        return;
+      }
+      // Other occurrences may have moved too
+      if (scope) calendar.refetchEvents();
+    })
+    .catch((err) => {
+      console.error("Reschedule error:", err);
+      info.revert();
+      showErrorMessage("Network or server error while rescheduling booking");
+    });
+}
+
+function showBookingDetails(event) {
+  // Calendar events leave out attendees; load them with the booking
+  fetch(`/api/bookings/${event.id}`, { credentials: "same-origin" })
+    .then((response) => (response.ok ? response.json() : {}))
+    .catch(() => ({}))
+    .then((booking) => bookingDetailsAction(event, booking.attendees || []));
+}
+
+function bookingDetailsAction(event, attendees) {
+  const when = `${event.start.toLocaleString()} – ${event.end.toLocaleTimeString()}`;
+  const description = event.extendedProps.description
+    ? "\n" + event.extendedProps.description
+    : "";
+  const guests = attendees.length
+    ? "\n\nAttendees:\n" +
+      attendees
+        .map(
+          (a) =>
+            `${a.email}${a.required ? "" : " (optional)"}: ${a.response.replace(
+              "_",
+              " "
+            )}`
+        )
+        .join("\n")
+    : "";
+  const details = `${event.title}\n${when}${description}${guests}`;
+  const email = currentUser && (currentUser.email || "").toLowerCase();
+  if (attendees.some((a) => a.email === email)) {
+    const answer = prompt(
+      `${details}\n\nReply accepted, declined or tentative:`,
+      "accepted"
+    );
+    if (answer) rsvpBooking(event, answer.trim().toLowerCase());
+    return;
+  }
+  if (!confirm(`${details}\n\nCancel this booking?`)) {
+    return;
+  }
+  const scope = chooseScope(event, "Cancel");
+  if (scope === null) return;
+  fetch(`/api/bookings/${event.id}${scope}`, {
+    method: "DELETE",
+    credentials: "same-origin",
+  })
+    .then(async (response) => {
+      if (!response.ok) {
+        showErrorMessage(
+          await bookingErrorText(response, "Failed to cancel booking")
+        );
+        return;
+      }
+      if (scope) {
+        calendar.refetchEvents();
+      } else {
+        event.remove();
+      }
+      showSuccessMessage("Booking cancelled");
+    })
+    .catch((err) => {
+      console.error("Cancel error:", err);
+      showErrorMessage("Network or server error while cancelling booking");
+    });
+}
+
+function rsvpBooking(event, response) {
+  fetch(`/api/bookings/${event.id}/rsvp`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    credentials: "same-origin",
+    body: JSON.stringify({ response }),
+  })
+    .then(async (res) => {
+      if (!res.ok) {
+        showErrorMessage(await bookingErrorText(res, "Failed to send reply"));
+        return;
+      }
+      showSuccessMessage("Reply sent");
+    })
+    .catch((err) => {
+      console.error("RSVP error:", err);
+      showErrorMessage("Network or server error while sending reply");
+    });
+}
+
 // Admin Panel Functions
 function showAdminPanel() {
   document.getElementById("adminPanel").style.display = "block";
@@ -342,13 +664,69 @@ function createFloor() {
     headers: { "Content-Type": "application/json" },
     body: JSON.stringify({ office_id: officeId, number: num, label }),
   })
-    .then((r) => r.json())
+    .then(async (r) => {
+      if (!r.ok) throw new Error((await r.text()).trim());
+      return r.json();
+    })
+    .then((j) => {
+      showSuccessMessage("Floor created: " + (j.label || j.number));
+    })
+    .catch((e) => {
+      console.error(e);
+      showErrorMessage("Failed to create floor: " + e.message);
+    });
+}
+
+function createHoliday() {
+  const officeId = document.getElementById("holidayOfficeId").value;
+  const date = document.getElementById("holidayDate").value;
+  const description = document.getElementById("holidayDescription").value;
+  fetch("/api/admin/holidays", {
+    method: "POST",
+    credentials: "same-origin",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ office_id: officeId, date, description }),
+  })
+    .then(async (r) => {
+      if (!r.ok) throw new Error((await r.text()).trim());
+      return r.json();
+    })
+    .then((j) => {
+      showSuccessMessage("Office closed on " + j.date);
+      calendar.refetchEvents();
+    })
+    .catch((e) => {
+      console.error(e);
+      showErrorMessage("Failed to create holiday: " + e.message);
+    });
+}
+
+function importHolidays() {
+  const officeId = document.getElementById("holidayOfficeId").value;
+  const file = document.getElementById("holidayFile").files[0];
+  if (!file) {
+    showErrorMessage("Please choose an .ics file.");
+    return;
+  }
+  fetch(`/api/admin/holidays/import?office_id=${encodeURIComponent(officeId)}`, {
+    method: "POST",
+    credentials: "same-origin",
+    headers: { "Content-Type": "text/calendar" },
+    body: file,
+  })
+    .then(async (r) => {
+      if (!r.ok) throw new Error((await r.text()).trim());
+      return r.json();
+    })
     .then((j) => {
-      showSuccessMessage("Floor created");
+      showSuccessMessage(
+        `Imported ${j.imported.length} holidays, skipped ${j.skipped.length} already closed days`
+      );
+      calendar.refetchEvents();
     })
     .catch((e) => {
       console.error(e);
-      showErrorMessage("Failed to create floor");
+      showErrorMessage("Failed to import holidays: " + e.message);
     });
 }
 